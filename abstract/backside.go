@@ -0,0 +1,54 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Orientation of back side images in ADF duplex mode
+
+package abstract
+
+import "fmt"
+
+// BackSide specifies how the ADF duplex scanner delivers images
+// of the back side of the page, relative to the front side.
+//
+// Many duplex scanners turn the sheet over, so the back side
+// comes rotated or mirrored. This is the device-specific behavior,
+// declared in the [ScannerCapabilities]. The [Filter] uses it to
+// bring back sides into the normal orientation.
+type BackSide int
+
+// BackSide orientations:
+const (
+	BackSideUnset    BackSide = iota // Not set, same as BackSideNormal
+	BackSideNormal                   // Same orientation as front side
+	BackSideRotated                  // Rotated by 180 degrees
+	BackSideFlipped                  // Mirrored vertically
+	BackSideMirrored                 // Mirrored horizontally
+	backSideMax
+)
+
+// Valid reports if BackSide is valid
+func (bs BackSide) Valid() bool {
+	return BackSideUnset <= bs && bs < backSideMax
+}
+
+// String returns the string representation of the [BackSide],
+// for logging.
+func (bs BackSide) String() string {
+	switch bs {
+	case BackSideUnset:
+		return "Unset"
+	case BackSideNormal:
+		return "Normal"
+	case BackSideRotated:
+		return "Rotated"
+	case BackSideFlipped:
+		return "Flipped"
+	case BackSideMirrored:
+		return "Mirrored"
+	}
+
+	return fmt.Sprintf("Unknown (%d)", int(bs))
+}
@@ -0,0 +1,59 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Blank page detection
+
+package abstract
+
+import "fmt"
+
+// BlankPageMode specifies how the [Filter] handles blank pages.
+type BlankPageMode int
+
+// BlankPageMode modes:
+const (
+	BlankPageUnset  BlankPageMode = iota // Don't detect blank pages
+	BlankPageRemove                      // Remove blank pages
+	BlankPageFlag                        // Keep and flag blank pages
+	blankPageMax
+)
+
+// Default blank page detection thresholds.
+// See [FilterOptions] for details.
+const (
+	DefaultBlankCoverage = 0.001
+	DefaultBlankVariance = 0.005
+)
+
+// BlankPageInfo is implemented by the [DocumentFile]s, returned
+// by the [Filter] with blank page detection enabled.
+//
+// Blank reports if the page is considered blank. In the
+// [BlankPageRemove] mode, it always returns false, as blank
+// pages are not returned at all.
+type BlankPageInfo interface {
+	Blank() bool
+}
+
+// Valid reports if BlankPageMode is valid
+func (mode BlankPageMode) Valid() bool {
+	return BlankPageUnset <= mode && mode < blankPageMax
+}
+
+// String returns the string representation of the [BlankPageMode],
+// for logging.
+func (mode BlankPageMode) String() string {
+	switch mode {
+	case BlankPageUnset:
+		return "Unset"
+	case BlankPageRemove:
+		return "Remove"
+	case BlankPageFlag:
+		return "Flag"
+	}
+
+	return fmt.Sprintf("Unknown (%d)", int(mode))
+}
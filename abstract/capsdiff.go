@@ -0,0 +1,290 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Human-readable scanner capabilities diff
+
+package abstract
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Diff returns the human-readable description of differences
+// between scancaps and scancaps2, one difference per line.
+// If there are no differences, it returns "".
+//
+// Each line starts with the parameter name, followed by values,
+// present only in scancaps (prefixed with "-") and values, present
+// only in scancaps2 (prefixed with "+"):
+//
+//	DocumentFormats: -image/tiff +application/pdf
+//	BrightnessRange: -[-100...100] +[0...255]
+//	Platen.Resolutions: -1200x1200
+func (scancaps *ScannerCapabilities) Diff(
+	scancaps2 *ScannerCapabilities) string {
+
+	d := &capsDiffer{}
+	d.scanner("", scancaps, scancaps2)
+	return d.String()
+}
+
+// Diff returns the human-readable description of differences
+// between inpcaps and inpcaps2, in the same format as the
+// [ScannerCapabilities.Diff] does.
+//
+// Values, that depend on the settings profiles (resolutions,
+// color modes and so on) are compared as combined over all
+// profiles of the input.
+func (inpcaps *InputCapabilities) Diff(inpcaps2 *InputCapabilities) string {
+	d := &capsDiffer{}
+	d.input("", inpcaps, inpcaps2)
+	return d.String()
+}
+
+// capsDiffer accumulates the differences between capabilities.
+type capsDiffer struct {
+	lines []string // One line per difference
+}
+
+// String returns the accumulated differences, one per line.
+func (d *capsDiffer) String() string {
+	if len(d.lines) == 0 {
+		return ""
+	}
+	return strings.Join(d.lines, "\n") + "\n"
+}
+
+// scanner compares two ScannerCapabilities.
+func (d *capsDiffer) scanner(prefix string,
+	scancaps, scancaps2 *ScannerCapabilities) {
+
+	d.value(prefix+"UUID", scancaps.UUID, scancaps2.UUID)
+	d.value(prefix+"MakeAndModel",
+		scancaps.MakeAndModel, scancaps2.MakeAndModel)
+	d.value(prefix+"SerialNumber",
+		scancaps.SerialNumber, scancaps2.SerialNumber)
+	d.value(prefix+"Manufacturer",
+		scancaps.Manufacturer, scancaps2.Manufacturer)
+	d.value(prefix+"AdminURI", scancaps.AdminURI, scancaps2.AdminURI)
+	d.value(prefix+"IconURI", scancaps.IconURI, scancaps2.IconURI)
+
+	capsDiffList(d, prefix+"DocumentFormats",
+		scancaps.DocumentFormats, scancaps2.DocumentFormats)
+	d.value(prefix+"ADFCapacity",
+		scancaps.ADFCapacity, scancaps2.ADFCapacity)
+	d.value(prefix+"ADFBackSide",
+		scancaps.ADFBackSide, scancaps2.ADFBackSide)
+
+	d.rng(prefix+"CompressionRange",
+		scancaps.CompressionRange, scancaps2.CompressionRange)
+	d.rng(prefix+"BrightnessRange",
+		scancaps.BrightnessRange, scancaps2.BrightnessRange)
+	d.rng(prefix+"ContrastRange",
+		scancaps.ContrastRange, scancaps2.ContrastRange)
+	d.rng(prefix+"GammaRange",
+		scancaps.GammaRange, scancaps2.GammaRange)
+	d.rng(prefix+"HighlightRange",
+		scancaps.HighlightRange, scancaps2.HighlightRange)
+	d.rng(prefix+"NoiseRemovalRange",
+		scancaps.NoiseRemovalRange, scancaps2.NoiseRemovalRange)
+	d.rng(prefix+"ShadowRange",
+		scancaps.ShadowRange, scancaps2.ShadowRange)
+	d.rng(prefix+"SharpenRange",
+		scancaps.SharpenRange, scancaps2.SharpenRange)
+	d.rng(prefix+"ThresholdRange",
+		scancaps.ThresholdRange, scancaps2.ThresholdRange)
+
+	d.input(prefix+"Platen.", scancaps.Platen, scancaps2.Platen)
+	d.input(prefix+"ADFSimplex.",
+		scancaps.ADFSimplex, scancaps2.ADFSimplex)
+	d.input(prefix+"ADFDuplex.",
+		scancaps.ADFDuplex, scancaps2.ADFDuplex)
+}
+
+// input compares two InputCapabilities. Either of them may be nil.
+func (d *capsDiffer) input(prefix string,
+	inpcaps, inpcaps2 *InputCapabilities) {
+
+	name := strings.TrimSuffix(prefix, ".")
+	if name == "" {
+		name = "Input"
+	}
+
+	switch {
+	case inpcaps == nil && inpcaps2 == nil:
+		return
+	case inpcaps == nil:
+		d.add(name, "", "supported")
+		return
+	case inpcaps2 == nil:
+		d.add(name, "supported", "")
+		return
+	}
+
+	d.dim(prefix+"MinWidth", inpcaps.MinWidth, inpcaps2.MinWidth)
+	d.dim(prefix+"MaxWidth", inpcaps.MaxWidth, inpcaps2.MaxWidth)
+	d.dim(prefix+"MinHeight", inpcaps.MinHeight, inpcaps2.MinHeight)
+	d.dim(prefix+"MaxHeight", inpcaps.MaxHeight, inpcaps2.MaxHeight)
+	d.dim(prefix+"MaxXOffset", inpcaps.MaxXOffset, inpcaps2.MaxXOffset)
+	d.dim(prefix+"MaxYOffset", inpcaps.MaxYOffset, inpcaps2.MaxYOffset)
+	d.value(prefix+"MaxOpticalXResolution",
+		inpcaps.MaxOpticalXResolution, inpcaps2.MaxOpticalXResolution)
+	d.value(prefix+"MaxOpticalYResolution",
+		inpcaps.MaxOpticalYResolution, inpcaps2.MaxOpticalYResolution)
+	d.dim(prefix+"RiskyLeftMargins",
+		inpcaps.RiskyLeftMargins, inpcaps2.RiskyLeftMargins)
+	d.dim(prefix+"RiskyRightMargins",
+		inpcaps.RiskyRightMargins, inpcaps2.RiskyRightMargins)
+	d.dim(prefix+"RiskyTopMargins",
+		inpcaps.RiskyTopMargins, inpcaps2.RiskyTopMargins)
+	d.dim(prefix+"RiskyBottomMargins",
+		inpcaps.RiskyBottomMargins, inpcaps2.RiskyBottomMargins)
+
+	capsDiffList(d, prefix+"Intents",
+		inpcaps.Intents.Elements(), inpcaps2.Intents.Elements())
+
+	// Settings profiles, combined
+	var prof, prof2 SettingsProfile
+	var ranges, ranges2 []string
+
+	for _, p := range inpcaps.Profiles {
+		prof = prof.combine(p)
+		if !p.ResolutionRange.IsZero() {
+			ranges = append(ranges, capsResolutionRangeString(
+				p.ResolutionRange))
+		}
+	}
+
+	for _, p := range inpcaps2.Profiles {
+		prof2 = prof2.combine(p)
+		if !p.ResolutionRange.IsZero() {
+			ranges2 = append(ranges2, capsResolutionRangeString(
+				p.ResolutionRange))
+		}
+	}
+
+	d.value(prefix+"Profiles",
+		len(inpcaps.Profiles), len(inpcaps2.Profiles))
+	capsDiffList(d, prefix+"ColorModes",
+		prof.ColorModes.Elements(), prof2.ColorModes.Elements())
+	capsDiffList(d, prefix+"Depths",
+		prof.Depths.Elements(), prof2.Depths.Elements())
+	capsDiffList(d, prefix+"BinaryRenderings",
+		prof.BinaryRenderings.Elements(),
+		prof2.BinaryRenderings.Elements())
+	capsDiffList(d, prefix+"CCDChannels",
+		prof.CCDChannels.Elements(), prof2.CCDChannels.Elements())
+	capsDiffList(d, prefix+"Resolutions",
+		inpcaps.Resolutions(), inpcaps2.Resolutions())
+	capsDiffList(d, prefix+"ResolutionRanges", ranges, ranges2)
+}
+
+// value compares two values of the comparable type.
+func (d *capsDiffer) value(name string, v1, v2 any) {
+	if v1 != v2 {
+		d.add(name, fmt.Sprint(v1), fmt.Sprint(v2))
+	}
+}
+
+// dim compares two Dimensions.
+func (d *capsDiffer) dim(name string, v1, v2 Dimension) {
+	if v1 != v2 {
+		d.add(name, capsDimensionString(v1), capsDimensionString(v2))
+	}
+}
+
+// rng compares two Ranges.
+func (d *capsDiffer) rng(name string, r1, r2 Range) {
+	if r1 != r2 {
+		d.add(name, capsRangeString(r1), capsRangeString(r2))
+	}
+}
+
+// add adds a difference line. Empty values are omitted.
+func (d *capsDiffer) add(name, v1, v2 string) {
+	line := name + ":"
+	if v1 != "" {
+		line += " -" + v1
+	}
+	if v2 != "" {
+		line += " +" + v2
+	}
+
+	d.lines = append(d.lines, line)
+}
+
+// capsDiffList compares two lists of values, ignoring the order.
+func capsDiffList[T comparable](d *capsDiffer, name string, l1, l2 []T) {
+	var only1, only2 []string
+
+	for _, v := range l1 {
+		if !slices.Contains(l2, v) {
+			only1 = append(only1, fmt.Sprint(v))
+		}
+	}
+
+	for _, v := range l2 {
+		if !slices.Contains(l1, v) {
+			only2 = append(only2, fmt.Sprint(v))
+		}
+	}
+
+	if only1 == nil && only2 == nil {
+		return
+	}
+
+	line := name + ":"
+	for _, s := range only1 {
+		line += " -" + s
+	}
+	for _, s := range only2 {
+		line += " +" + s
+	}
+
+	d.lines = append(d.lines, line)
+}
+
+// combine returns the SettingsProfile that allows everything,
+// allowed by prof or prof2. Resolutions are not combined.
+func (prof SettingsProfile) combine(prof2 SettingsProfile) SettingsProfile {
+	return SettingsProfile{
+		ColorModes: prof.ColorModes.Union(prof2.ColorModes),
+		Depths:     prof.Depths.Union(prof2.Depths),
+		BinaryRenderings: prof.BinaryRenderings.Union(
+			prof2.BinaryRenderings),
+		CCDChannels: prof.CCDChannels.Union(prof2.CCDChannels),
+	}
+}
+
+// capsDimensionString formats Dimension for the diff output.
+func capsDimensionString(dim Dimension) string {
+	return fmt.Sprintf("%d.%02dmm", dim/Millimeter, dim%Millimeter)
+}
+
+// capsRangeString formats Range for the diff output.
+func capsRangeString(r Range) string {
+	if r.IsZero() {
+		return "none"
+	}
+
+	s := fmt.Sprintf("[%d...%d]", r.Min, r.Max)
+	if r.Normal != 0 {
+		s += fmt.Sprintf(",normal=%d", r.Normal)
+	}
+	if r.Step > 1 {
+		s += fmt.Sprintf(",step=%d", r.Step)
+	}
+
+	return s
+}
+
+// capsResolutionRangeString formats ResolutionRange for the diff output.
+func capsResolutionRangeString(rr ResolutionRange) string {
+	return fmt.Sprintf("%sx%s",
+		capsRangeString(rr.x()), capsRangeString(rr.y()))
+}
@@ -0,0 +1,458 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Scanner capabilities intersection and union
+
+package abstract
+
+import (
+	"slices"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// Intersect returns the [ScannerCapabilities], supported by both
+// scancaps and scancaps2, so any request, valid for the result, is
+// valid for both of them.
+//
+// It is useful to compute capabilities that are safe to advertise,
+// when the same device is available via the different protocols.
+//
+// Descriptive parameters (UUID, MakeAndModel and so on, and the
+// ADFBackSide) are taken from the scancaps, falling back to the
+// scancaps2, if not set.
+//
+// Inputs, supported only by one of the capabilities, are removed.
+// Unknown (zero) limits, like ADFCapacity, are not considered
+// as restrictions.
+func (scancaps *ScannerCapabilities) Intersect(
+	scancaps2 *ScannerCapabilities) *ScannerCapabilities {
+
+	out := scancaps.merge(scancaps2)
+
+	// Formats, supported by both
+	out.DocumentFormats = nil
+	for _, format := range scancaps.DocumentFormats {
+		if slices.Contains(scancaps2.DocumentFormats, format) {
+			out.DocumentFormats = append(out.DocumentFormats, format)
+		}
+	}
+
+	out.ADFCapacity = capsMinKnown(scancaps.ADFCapacity,
+		scancaps2.ADFCapacity)
+
+	// Ranges
+	out.CompressionRange = scancaps.CompressionRange.intersect(
+		scancaps2.CompressionRange)
+	out.BrightnessRange = scancaps.BrightnessRange.intersect(
+		scancaps2.BrightnessRange)
+	out.ContrastRange = scancaps.ContrastRange.intersect(
+		scancaps2.ContrastRange)
+	out.GammaRange = scancaps.GammaRange.intersect(
+		scancaps2.GammaRange)
+	out.HighlightRange = scancaps.HighlightRange.intersect(
+		scancaps2.HighlightRange)
+	out.NoiseRemovalRange = scancaps.NoiseRemovalRange.intersect(
+		scancaps2.NoiseRemovalRange)
+	out.ShadowRange = scancaps.ShadowRange.intersect(
+		scancaps2.ShadowRange)
+	out.SharpenRange = scancaps.SharpenRange.intersect(
+		scancaps2.SharpenRange)
+	out.ThresholdRange = scancaps.ThresholdRange.intersect(
+		scancaps2.ThresholdRange)
+
+	// Inputs
+	out.Platen = scancaps.Platen.Intersect(scancaps2.Platen)
+	out.ADFSimplex = scancaps.ADFSimplex.Intersect(scancaps2.ADFSimplex)
+	out.ADFDuplex = scancaps.ADFDuplex.Intersect(scancaps2.ADFDuplex)
+
+	return out
+}
+
+// Union returns the [ScannerCapabilities], that include everything,
+// supported by either scancaps or scancaps2.
+//
+// Descriptive parameters are chosen the same way as by the
+// [ScannerCapabilities.Intersect].
+func (scancaps *ScannerCapabilities) Union(
+	scancaps2 *ScannerCapabilities) *ScannerCapabilities {
+
+	out := scancaps.merge(scancaps2)
+
+	// Formats, supported by either
+	out.DocumentFormats = slices.Clone(scancaps.DocumentFormats)
+	for _, format := range scancaps2.DocumentFormats {
+		if !slices.Contains(out.DocumentFormats, format) {
+			out.DocumentFormats = append(out.DocumentFormats, format)
+		}
+	}
+
+	out.ADFCapacity = generic.Max(scancaps.ADFCapacity,
+		scancaps2.ADFCapacity)
+
+	// Ranges
+	out.CompressionRange = scancaps.CompressionRange.union(
+		scancaps2.CompressionRange)
+	out.BrightnessRange = scancaps.BrightnessRange.union(
+		scancaps2.BrightnessRange)
+	out.ContrastRange = scancaps.ContrastRange.union(
+		scancaps2.ContrastRange)
+	out.GammaRange = scancaps.GammaRange.union(
+		scancaps2.GammaRange)
+	out.HighlightRange = scancaps.HighlightRange.union(
+		scancaps2.HighlightRange)
+	out.NoiseRemovalRange = scancaps.NoiseRemovalRange.union(
+		scancaps2.NoiseRemovalRange)
+	out.ShadowRange = scancaps.ShadowRange.union(
+		scancaps2.ShadowRange)
+	out.SharpenRange = scancaps.SharpenRange.union(
+		scancaps2.SharpenRange)
+	out.ThresholdRange = scancaps.ThresholdRange.union(
+		scancaps2.ThresholdRange)
+
+	// Inputs
+	out.Platen = scancaps.Platen.Union(scancaps2.Platen)
+	out.ADFSimplex = scancaps.ADFSimplex.Union(scancaps2.ADFSimplex)
+	out.ADFDuplex = scancaps.ADFDuplex.Union(scancaps2.ADFDuplex)
+
+	return out
+}
+
+// merge returns a copy of the scancaps with descriptive parameters,
+// not set in the scancaps, taken from the scancaps2.
+func (scancaps *ScannerCapabilities) merge(
+	scancaps2 *ScannerCapabilities) *ScannerCapabilities {
+
+	out := scancaps.Clone()
+
+	out.UUID = capsFirstSet(out.UUID, scancaps2.UUID)
+	out.MakeAndModel = capsFirstSet(out.MakeAndModel,
+		scancaps2.MakeAndModel)
+	out.SerialNumber = capsFirstSet(out.SerialNumber,
+		scancaps2.SerialNumber)
+	out.Manufacturer = capsFirstSet(out.Manufacturer,
+		scancaps2.Manufacturer)
+	out.AdminURI = capsFirstSet(out.AdminURI,
+		scancaps2.AdminURI)
+	out.IconURI = capsFirstSet(out.IconURI,
+		scancaps2.IconURI)
+	out.ADFBackSide = capsFirstSet(out.ADFBackSide,
+		scancaps2.ADFBackSide)
+
+	return out
+}
+
+// Intersect returns the [InputCapabilities], supported by both
+// inpcaps and inpcaps2. If either of them is nil, it returns nil.
+//
+// Settings profiles are intersected pairwise, profiles that allow
+// nothing are dropped. If no profiles remain, the input is
+// considered unsupported and nil is returned.
+func (inpcaps *InputCapabilities) Intersect(
+	inpcaps2 *InputCapabilities) *InputCapabilities {
+
+	if inpcaps == nil || inpcaps2 == nil {
+		return nil
+	}
+
+	out := &InputCapabilities{
+		// Geometry: the smallest area, supported by both
+		MinWidth:   generic.Max(inpcaps.MinWidth, inpcaps2.MinWidth),
+		MaxWidth:   generic.Min(inpcaps.MaxWidth, inpcaps2.MaxWidth),
+		MinHeight:  generic.Max(inpcaps.MinHeight, inpcaps2.MinHeight),
+		MaxHeight:  generic.Min(inpcaps.MaxHeight, inpcaps2.MaxHeight),
+		MaxXOffset: capsMinKnown(inpcaps.MaxXOffset, inpcaps2.MaxXOffset),
+		MaxYOffset: capsMinKnown(inpcaps.MaxYOffset, inpcaps2.MaxYOffset),
+
+		MaxOpticalXResolution: capsMinKnown(
+			inpcaps.MaxOpticalXResolution,
+			inpcaps2.MaxOpticalXResolution),
+		MaxOpticalYResolution: capsMinKnown(
+			inpcaps.MaxOpticalYResolution,
+			inpcaps2.MaxOpticalYResolution),
+
+		// Risky margins: the largest ones
+		RiskyLeftMargins: generic.Max(inpcaps.RiskyLeftMargins,
+			inpcaps2.RiskyLeftMargins),
+		RiskyRightMargins: generic.Max(inpcaps.RiskyRightMargins,
+			inpcaps2.RiskyRightMargins),
+		RiskyTopMargins: generic.Max(inpcaps.RiskyTopMargins,
+			inpcaps2.RiskyTopMargins),
+		RiskyBottomMargins: generic.Max(inpcaps.RiskyBottomMargins,
+			inpcaps2.RiskyBottomMargins),
+
+		Intents: inpcaps.Intents.Intersection(inpcaps2.Intents),
+	}
+
+	if out.MinWidth > out.MaxWidth || out.MinHeight > out.MaxHeight {
+		return nil
+	}
+
+	for _, prof := range inpcaps.Profiles {
+		for _, prof2 := range inpcaps2.Profiles {
+			prof3 := prof.intersect(prof2)
+			if !prof3.isEmpty() && !prof3.in(out.Profiles) {
+				out.Profiles = append(out.Profiles, prof3)
+			}
+		}
+	}
+
+	if len(out.Profiles) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+// Union returns the [InputCapabilities], that include everything,
+// supported by either inpcaps or inpcaps2. If one of them is nil,
+// the copy of another is returned. If both are nil, it returns nil.
+//
+// Settings profiles of both inputs are combined, duplicates
+// are removed.
+func (inpcaps *InputCapabilities) Union(
+	inpcaps2 *InputCapabilities) *InputCapabilities {
+
+	switch {
+	case inpcaps == nil && inpcaps2 == nil:
+		return nil
+	case inpcaps == nil:
+		return inpcaps2.Clone()
+	case inpcaps2 == nil:
+		return inpcaps.Clone()
+	}
+
+	out := &InputCapabilities{
+		// Geometry: the largest area, supported by either
+		MinWidth:   generic.Min(inpcaps.MinWidth, inpcaps2.MinWidth),
+		MaxWidth:   generic.Max(inpcaps.MaxWidth, inpcaps2.MaxWidth),
+		MinHeight:  generic.Min(inpcaps.MinHeight, inpcaps2.MinHeight),
+		MaxHeight:  generic.Max(inpcaps.MaxHeight, inpcaps2.MaxHeight),
+		MaxXOffset: generic.Max(inpcaps.MaxXOffset, inpcaps2.MaxXOffset),
+		MaxYOffset: generic.Max(inpcaps.MaxYOffset, inpcaps2.MaxYOffset),
+
+		MaxOpticalXResolution: generic.Max(
+			inpcaps.MaxOpticalXResolution,
+			inpcaps2.MaxOpticalXResolution),
+		MaxOpticalYResolution: generic.Max(
+			inpcaps.MaxOpticalYResolution,
+			inpcaps2.MaxOpticalYResolution),
+
+		// Risky margins: the smallest known ones
+		RiskyLeftMargins: capsMinKnown(inpcaps.RiskyLeftMargins,
+			inpcaps2.RiskyLeftMargins),
+		RiskyRightMargins: capsMinKnown(inpcaps.RiskyRightMargins,
+			inpcaps2.RiskyRightMargins),
+		RiskyTopMargins: capsMinKnown(inpcaps.RiskyTopMargins,
+			inpcaps2.RiskyTopMargins),
+		RiskyBottomMargins: capsMinKnown(inpcaps.RiskyBottomMargins,
+			inpcaps2.RiskyBottomMargins),
+
+		Intents: inpcaps.Intents.Union(inpcaps2.Intents),
+	}
+
+	for _, list := range [][]SettingsProfile{
+		inpcaps.Profiles, inpcaps2.Profiles} {
+		for _, prof := range list {
+			if !prof.in(out.Profiles) {
+				out.Profiles = append(out.Profiles, prof)
+			}
+		}
+	}
+
+	return out
+}
+
+// intersect returns the [SettingsProfile] that allows only
+// parameters, allowed by both prof and prof2.
+func (prof SettingsProfile) intersect(prof2 SettingsProfile) SettingsProfile {
+	out := SettingsProfile{
+		ColorModes: prof.ColorModes.Intersection(prof2.ColorModes),
+		Depths:     prof.Depths.Intersection(prof2.Depths),
+		BinaryRenderings: prof.BinaryRenderings.Intersection(
+			prof2.BinaryRenderings),
+		CCDChannels: prof.CCDChannels.Intersection(prof2.CCDChannels),
+		ResolutionRange: prof.ResolutionRange.intersect(
+			prof2.ResolutionRange),
+	}
+
+	// Discrete resolutions, allowed by the both profiles,
+	// either explicitly or via the ResolutionRange
+	for _, res := range prof.Resolutions {
+		if slices.Contains(prof2.Resolutions, res) ||
+			prof2.ResolutionRange.within(res) {
+			out.Resolutions = append(out.Resolutions, res)
+		}
+	}
+
+	for _, res := range prof2.Resolutions {
+		if prof.ResolutionRange.within(res) &&
+			!slices.Contains(out.Resolutions, res) {
+			out.Resolutions = append(out.Resolutions, res)
+		}
+	}
+
+	return out
+}
+
+// isEmpty reports if SettingsProfile allows nothing.
+func (prof SettingsProfile) isEmpty() bool {
+	return prof.ColorModes.IsEmpty() ||
+		(len(prof.Resolutions) == 0 && prof.ResolutionRange.IsZero())
+}
+
+// in reports if the SettingsProfile is contained in the list.
+func (prof SettingsProfile) in(list []SettingsProfile) bool {
+	for _, prof2 := range list {
+		if prof.ColorModes == prof2.ColorModes &&
+			prof.Depths == prof2.Depths &&
+			prof.BinaryRenderings == prof2.BinaryRenderings &&
+			prof.CCDChannels == prof2.CCDChannels &&
+			prof.ResolutionRange == prof2.ResolutionRange &&
+			slices.Equal(prof.Resolutions, prof2.Resolutions) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// intersect returns the ResolutionRange, that contains only
+// resolutions, contained in both rr and rr2.
+func (rr ResolutionRange) intersect(rr2 ResolutionRange) ResolutionRange {
+	x := rr.x().intersect(rr2.x())
+	y := rr.y().intersect(rr2.y())
+	if x.IsZero() || y.IsZero() {
+		return ResolutionRange{}
+	}
+
+	return ResolutionRange{
+		XMin: x.Min, XMax: x.Max, XStep: x.Step, XNormal: x.Normal,
+		YMin: y.Min, YMax: y.Max, YStep: y.Step, YNormal: y.Normal,
+	}
+}
+
+// within reports if the Resolution is within the ResolutionRange.
+func (rr ResolutionRange) within(res Resolution) bool {
+	return rr.x().Within(res.XResolution) && rr.y().Within(res.YResolution)
+}
+
+// x returns the X resolution range as a [Range].
+func (rr ResolutionRange) x() Range {
+	return Range{Min: rr.XMin, Max: rr.XMax, Normal: rr.XNormal,
+		Step: rr.XStep}
+}
+
+// y returns the Y resolution range as a [Range].
+func (rr ResolutionRange) y() Range {
+	return Range{Min: rr.YMin, Max: rr.YMax, Normal: rr.YNormal,
+		Step: rr.YStep}
+}
+
+// intersect returns the Range, that contains only values,
+// contained in both r and r2. If there are no such values,
+// or one of the ranges is zero, it returns the zero Range.
+//
+// Normal value is taken from r and, if necessary, adjusted
+// to the nearest valid value.
+func (r Range) intersect(r2 Range) Range {
+	if r.IsZero() || r2.IsZero() {
+		return Range{}
+	}
+
+	out := Range{
+		Min:  generic.Max(r.Min, r2.Min),
+		Max:  generic.Min(r.Max, r2.Max),
+		Step: capsLCM(generic.Max(r.Step, 1), generic.Max(r2.Step, 1)),
+	}
+
+	// Align Min, so it is valid for both ranges
+	for i := 0; i < out.Step && !(r.Within(out.Min) &&
+		r2.Within(out.Min)); i++ {
+		out.Min++
+	}
+
+	if out.Min > out.Max || !(r.Within(out.Min) && r2.Within(out.Min)) {
+		return Range{}
+	}
+
+	out.Max -= (out.Max - out.Min) % out.Step
+
+	// Choose the nearest valid Normal value
+	steps := (generic.Max(r.Normal, out.Min) - out.Min + out.Step/2) /
+		out.Step
+	out.Normal = generic.Min(out.Min+steps*out.Step, out.Max)
+
+	if out.Step == 1 {
+		out.Step = 0
+	}
+
+	return out
+}
+
+// union returns the smallest Range that contains all values,
+// contained in either r or r2. If one of the ranges is zero,
+// another is returned.
+//
+// Normal value is taken from r.
+func (r Range) union(r2 Range) Range {
+	switch {
+	case r.IsZero():
+		return r2
+	case r2.IsZero():
+		return r
+	}
+
+	out := Range{
+		Min:    generic.Min(r.Min, r2.Min),
+		Max:    generic.Max(r.Max, r2.Max),
+		Normal: r.Normal,
+	}
+
+	// Step must fit values of both ranges
+	step := capsGCD(generic.Max(r.Step, 1), generic.Max(r2.Step, 1))
+	step = capsGCD(step, generic.Max(r.Min-r2.Min, r2.Min-r.Min))
+	if step > 1 {
+		out.Step = step
+	}
+
+	return out
+}
+
+// capsFirstSet returns v1, if it is not zero, v2 otherwise.
+func capsFirstSet[T comparable](v1, v2 T) T {
+	var zero T
+	if v1 != zero {
+		return v1
+	}
+	return v2
+}
+
+// capsMinKnown returns the minimum of two values, ignoring
+// zero (unknown) values.
+func capsMinKnown[T ~int](v1, v2 T) T {
+	switch {
+	case v1 == 0:
+		return v2
+	case v2 == 0:
+		return v1
+	}
+	return generic.Min(v1, v2)
+}
+
+// capsGCD returns the greatest common divisor of two non-negative
+// integers.
+func capsGCD(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// capsLCM returns the least common multiple of two positive integers.
+func capsLCM(a, b int) int {
+	return a / capsGCD(a, b) * b
+}
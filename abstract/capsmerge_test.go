@@ -0,0 +1,290 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Scanner capabilities intersection, union and diff tests
+
+package abstract
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// TestRangeIntersect tests Range.intersect method
+func TestRangeIntersect(t *testing.T) {
+	type testData struct {
+		r1, r2 Range
+		out    Range
+	}
+
+	tests := []testData{
+		{
+			// Zero range is not intersected
+			r1:  Range{},
+			r2:  Range{Min: 0, Max: 100},
+			out: Range{},
+		},
+
+		{
+			// Simple overlap
+			r1:  Range{Min: -100, Max: 100, Normal: 0},
+			r2:  Range{Min: 0, Max: 255, Normal: 128},
+			out: Range{Min: 0, Max: 100, Normal: 0},
+		},
+
+		{
+			// Overlap with step
+			r1:  Range{Min: -100, Max: 100, Normal: 0, Step: 2},
+			r2:  Range{Min: 0, Max: 255, Normal: 128},
+			out: Range{Min: 0, Max: 100, Normal: 0, Step: 2},
+		},
+
+		{
+			// Different steps: LCM is used, Min is aligned,
+			// Max is trimmed
+			r1:  Range{Min: 0, Max: 100, Normal: 50, Step: 2},
+			r2:  Range{Min: 1, Max: 100, Normal: 50, Step: 3},
+			out: Range{Min: 4, Max: 100, Normal: 52, Step: 6},
+		},
+
+		{
+			// Normal outside of the result is clamped
+			r1:  Range{Min: 0, Max: 100, Normal: 90},
+			r2:  Range{Min: 0, Max: 50, Normal: 10},
+			out: Range{Min: 0, Max: 50, Normal: 50},
+		},
+
+		{
+			// No overlap
+			r1:  Range{Min: 0, Max: 10, Normal: 5},
+			r2:  Range{Min: 20, Max: 30, Normal: 25},
+			out: Range{},
+		},
+	}
+
+	for _, test := range tests {
+		out := test.r1.intersect(test.r2)
+		if out != test.out {
+			t.Errorf("Range%v.intersect(%v):\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				test.r1, test.r2, test.out, out)
+		}
+	}
+}
+
+// TestRangeUnion tests Range.union method
+func TestRangeUnion(t *testing.T) {
+	type testData struct {
+		r1, r2 Range
+		out    Range
+	}
+
+	tests := []testData{
+		{
+			// Zero range is ignored
+			r1:  Range{},
+			r2:  Range{Min: 0, Max: 100, Normal: 50},
+			out: Range{Min: 0, Max: 100, Normal: 50},
+		},
+
+		{
+			// Simple union
+			r1:  Range{Min: -100, Max: 100, Normal: 0},
+			r2:  Range{Min: 0, Max: 255, Normal: 128},
+			out: Range{Min: -100, Max: 255, Normal: 0},
+		},
+
+		{
+			// Steps are combined
+			r1:  Range{Min: 0, Max: 100, Normal: 50, Step: 4},
+			r2:  Range{Min: 10, Max: 200, Normal: 50, Step: 6},
+			out: Range{Min: 0, Max: 200, Normal: 50, Step: 2},
+		},
+	}
+
+	for _, test := range tests {
+		out := test.r1.union(test.r2)
+		if out != test.out {
+			t.Errorf("Range%v.union(%v):\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				test.r1, test.r2, test.out, out)
+		}
+	}
+}
+
+// TestScannerCapabilitiesIntersect tests ScannerCapabilities.Intersect
+func TestScannerCapabilitiesIntersect(t *testing.T) {
+	caps2 := testScannerCapabilities.Clone()
+	caps2.DocumentFormats = []string{"image/jpeg", "application/pdf"}
+	caps2.ADFCapacity = 0
+	caps2.BrightnessRange = Range{Min: 0, Max: 255, Normal: 128}
+	caps2.ADFDuplex = nil
+	caps2.Platen = &InputCapabilities{
+		MinWidth:  DimensionFromDots(300, 300),
+		MinHeight: DimensionFromDots(300, 300),
+		MaxWidth:  DimensionFromDots(300, 2551),
+		MaxHeight: DimensionFromDots(300, 3300),
+		Intents:   generic.MakeBitset(IntentDocument, IntentObject),
+		Profiles: []SettingsProfile{
+			{
+				ColorModes: generic.MakeBitset(
+					ColorModeMono, ColorModeColor),
+				Depths: testDepth,
+				ResolutionRange: ResolutionRange{
+					XMin: 75, XMax: 600, XStep: 25, XNormal: 300,
+					YMin: 75, YMax: 600, YStep: 25, YNormal: 300,
+				},
+			},
+		},
+	}
+
+	out := testScannerCapabilities.Intersect(caps2)
+
+	if !reflect.DeepEqual(out.DocumentFormats, []string{"image/jpeg"}) {
+		t.Errorf("DocumentFormats: %v", out.DocumentFormats)
+	}
+
+	if out.ADFCapacity != 75 {
+		t.Errorf("ADFCapacity: expected 75, present %d",
+			out.ADFCapacity)
+	}
+
+	expRange := Range{Min: 0, Max: 100, Normal: 0}
+	if out.BrightnessRange != expRange {
+		t.Errorf("BrightnessRange: expected %v, present %v",
+			expRange, out.BrightnessRange)
+	}
+
+	if out.MakeAndModel != testScannerCapabilities.MakeAndModel {
+		t.Errorf("MakeAndModel: %q", out.MakeAndModel)
+	}
+
+	if out.ADFDuplex != nil {
+		t.Errorf("ADFDuplex: expected nil")
+	}
+
+	if out.ADFSimplex == nil {
+		t.Fatalf("ADFSimplex: expected non-nil")
+	}
+
+	platen := out.Platen
+	if platen == nil {
+		t.Fatalf("Platen: expected non-nil")
+	}
+
+	if platen.MinWidth != DimensionFromDots(300, 300) ||
+		platen.MaxHeight != DimensionFromDots(300, 3300) {
+		t.Errorf("Platen: invalid geometry")
+	}
+
+	if platen.Intents != generic.MakeBitset(IntentDocument) {
+		t.Errorf("Platen.Intents: %v", platen.Intents)
+	}
+
+	// Only resolutions within the ResolutionRange must remain,
+	// ColorModeBinary must disappear
+	expRes := []Resolution{
+		{XResolution: 200, YResolution: 100},
+		{XResolution: 200, YResolution: 200},
+		{XResolution: 200, YResolution: 400},
+		{XResolution: 300, YResolution: 300},
+		{XResolution: 400, YResolution: 400},
+		{XResolution: 600, YResolution: 600},
+	}
+
+	if res := platen.Resolutions(); !reflect.DeepEqual(res, expRes) {
+		t.Errorf("Platen.Resolutions:\n"+
+			"expected: %v\n"+
+			"present:  %v", expRes, res)
+	}
+
+	for _, prof := range platen.Profiles {
+		if prof.ColorModes.Contains(ColorModeBinary) {
+			t.Errorf("Platen: ColorModeBinary not expected")
+		}
+	}
+}
+
+// TestScannerCapabilitiesUnion tests ScannerCapabilities.Union
+func TestScannerCapabilitiesUnion(t *testing.T) {
+	caps1 := testScannerCapabilities.Clone()
+	caps1.ADFDuplex = nil
+
+	caps2 := testScannerCapabilities.Clone()
+	caps2.MakeAndModel = ""
+	caps2.DocumentFormats = []string{"application/pdf"}
+	caps2.ADFCapacity = 100
+	caps2.BrightnessRange = Range{Min: 0, Max: 255, Normal: 128}
+
+	out := caps1.Union(caps2)
+
+	expFormats := []string{"image/jpeg", "application/pdf"}
+	if !reflect.DeepEqual(out.DocumentFormats, expFormats) {
+		t.Errorf("DocumentFormats: %v", out.DocumentFormats)
+	}
+
+	if out.ADFCapacity != 100 {
+		t.Errorf("ADFCapacity: expected 100, present %d",
+			out.ADFCapacity)
+	}
+
+	expRange := Range{Min: -100, Max: 255, Normal: 0}
+	if out.BrightnessRange != expRange {
+		t.Errorf("BrightnessRange: expected %v, present %v",
+			expRange, out.BrightnessRange)
+	}
+
+	if out.MakeAndModel != testScannerCapabilities.MakeAndModel {
+		t.Errorf("MakeAndModel: %q", out.MakeAndModel)
+	}
+
+	if out.ADFDuplex == nil {
+		t.Errorf("ADFDuplex: expected non-nil")
+	}
+
+	// Identical profiles must not be duplicated
+	if n := len(out.Platen.Profiles); n != len(testSettingsProfilesHiRes) {
+		t.Errorf("Platen.Profiles: expected %d, present %d",
+			len(testSettingsProfilesHiRes), n)
+	}
+}
+
+// TestScannerCapabilitiesDiff tests ScannerCapabilities.Diff
+func TestScannerCapabilitiesDiff(t *testing.T) {
+	diff := testScannerCapabilities.Diff(testScannerCapabilities)
+	if diff != "" {
+		t.Errorf("Diff of equal capabilities:\n%s", diff)
+	}
+
+	caps2 := testScannerCapabilities.Clone()
+	caps2.DocumentFormats = []string{"image/jpeg", "application/pdf"}
+	caps2.BrightnessRange = Range{Min: 0, Max: 255, Normal: 128, Step: 5}
+	caps2.ADFDuplex = nil
+
+	platen := testPlatenInputCapabilities.Clone()
+	platen.Intents = generic.MakeBitset(IntentDocument, IntentPhoto)
+	platen.Profiles = testSettingsProfiles
+	caps2.Platen = platen
+
+	expected := "" +
+		"DocumentFormats: +application/pdf\n" +
+		"BrightnessRange: -[-100...100] +[0...255],normal=128,step=5\n" +
+		"Platen.Intents: -TextAndGraphic -Preview\n" +
+		"Platen.Profiles: -2 +1\n" +
+		"Platen.Resolutions: -1200x1200 -2400x2400\n" +
+		"ADFDuplex: -supported\n"
+
+	diff = testScannerCapabilities.Diff(caps2)
+	if diff != expected {
+		t.Errorf("Diff:\n"+
+			"expected:\n%s\n"+
+			"present:\n%s", expected, diff)
+	}
+}
@@ -0,0 +1,133 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Storage for the archived documents
+
+package abstract
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DocumentArchive is the storage, used by the [NewDocumentArchiver]
+// to save the archived document files.
+//
+// Files are created one by one: each file is closed before the
+// next one is created.
+type DocumentArchive interface {
+	// Create creates a new file with the specified name.
+	// The file is finished by the Close call.
+	Create(name string) (io.WriteCloser, error)
+
+	// Close finishes the archive.
+	Close() error
+}
+
+// dirArchive implements the DocumentArchive on a top of the
+// disk directory.
+type dirArchive struct {
+	dir string // Target directory
+}
+
+// tarArchive implements the DocumentArchive on a top of the
+// tar stream.
+type tarArchive struct {
+	out *tar.Writer // Output stream
+}
+
+// tarArchiveFile is the file, being written into the tarArchive.
+//
+// As the tar header contains the file size, and the size is not
+// known in advance, file content is spooled into the temporary
+// file on disk and copied into the tar stream when file is closed.
+type tarArchiveFile struct {
+	arc   *tarArchive // Archive the file belongs to
+	name  string      // File name
+	spool *os.File    // Temporary spool file
+}
+
+// NewDirArchive creates a new [DocumentArchive] that saves files
+// into the disk directory. The directory is created, if missed.
+func NewDirArchive(dir string) (DocumentArchive, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dirArchive{dir: dir}, nil
+}
+
+// Create creates a new file in the directory.
+func (arc *dirArchive) Create(name string) (io.WriteCloser, error) {
+	return os.Create(filepath.Join(arc.dir, name))
+}
+
+// Close finishes the archive.
+func (arc *dirArchive) Close() error {
+	return nil
+}
+
+// NewTarArchive creates a new [DocumentArchive] that writes files
+// into the tar stream.
+//
+// Closing the archive writes the tar trailer but doesn't close
+// the underlying [io.Writer].
+func NewTarArchive(w io.Writer) DocumentArchive {
+	return &tarArchive{out: tar.NewWriter(w)}
+}
+
+// Create creates a new file in the tar archive.
+func (arc *tarArchive) Create(name string) (io.WriteCloser, error) {
+	spool, err := os.CreateTemp("", "mfp-archive-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarArchiveFile{arc: arc, name: name, spool: spool}, nil
+}
+
+// Close finishes the archive.
+func (arc *tarArchive) Close() error {
+	return arc.out.Close()
+}
+
+// Write writes data into the file.
+func (file *tarArchiveFile) Write(data []byte) (int, error) {
+	return file.spool.Write(data)
+}
+
+// Close copies the spooled file content into the tar stream
+// and removes the spool file.
+func (file *tarArchiveFile) Close() error {
+	defer os.Remove(file.spool.Name())
+	defer file.spool.Close()
+
+	size, err := file.spool.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = file.spool.Seek(0, io.SeekStart)
+	}
+
+	if err == nil {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.name,
+			Mode:     0644,
+			Size:     size,
+			ModTime:  time.Now(),
+		}
+		err = file.arc.out.WriteHeader(hdr)
+	}
+
+	if err == nil {
+		_, err = io.Copy(file.arc.out, file.spool)
+	}
+
+	return err
+}
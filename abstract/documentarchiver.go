@@ -0,0 +1,317 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Document archiver
+
+package abstract
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DocumentArchiveManifest is the content of the manifest.json file,
+// written by the [NewDocumentArchiver].
+type DocumentArchiveManifest struct {
+	Request    string                `json:"request,omitempty"` // Request
+	Resolution string                `json:"resolution"`        // Resolution
+	Pages      []DocumentArchivePage `json:"pages"`             // Pages
+	Error      string                `json:"error,omitempty"`   // Error
+	Started    time.Time             `json:"started"`           // Created
+	Completed  time.Time             `json:"completed"`         // Closed
+}
+
+// DocumentArchivePage describes the single archived [DocumentFile]
+// in the [DocumentArchiveManifest].
+type DocumentArchivePage struct {
+	File      string    `json:"file"`      // File name in the archive
+	Format    string    `json:"format"`    // MIME type
+	Size      int64     `json:"size"`      // File size
+	Complete  bool      `json:"complete"`  // File received completely
+	Started   time.Time `json:"started"`   // Returned by the Next
+	Completed time.Time `json:"completed"` // Read till the end or closed
+}
+
+// documentArchiver wraps the [Document] and saves all its files
+// into the [DocumentArchive].
+type documentArchiver struct {
+	input    Document                // Underlying document
+	archive  DocumentArchive         // Archive storage
+	manifest DocumentArchiveManifest // The manifest
+	current  *documentArchiverFile   // Current file, nil if none
+	err      error                   // First archiving error
+	lock     sync.Mutex              // Access lock
+}
+
+// documentArchiverFile wraps the [DocumentFile] and saves its
+// content into the archive while it is being read.
+type documentArchiverFile struct {
+	DocumentFile                   // Underlying file
+	doc          *documentArchiver // Document the file belongs to
+	out          io.WriteCloser    // Archive file, nil when finished
+	page         int               // Index in the manifest.Pages
+}
+
+// NewDocumentArchiver creates a new [Document] wrapper, that
+// saves each [DocumentFile] of the input Document into the
+// [DocumentArchive], while it is being read by the client.
+//
+// The req parameter is the [ScannerRequest], that produced the
+// document. It is saved into the manifest and may be nil.
+//
+// Files are named page-NNN.ext, where ext depends on the file
+// format. Data is written into the archive as it is read, so
+// pages are never buffered in memory as a whole. When Next is
+// called before the current file is read till the end, its
+// remaining data is read by the archiver.
+//
+// When the Document is closed, the manifest.json file with the
+// [DocumentArchiveManifest] is written and the archive is closed.
+// Document.Close returns the first archiving error, if any.
+// Archiving errors don't affect the document data, returned to
+// the client.
+func NewDocumentArchiver(input Document, req *ScannerRequest,
+	archive DocumentArchive) Document {
+
+	doc := &documentArchiver{
+		input:   input,
+		archive: archive,
+		manifest: DocumentArchiveManifest{
+			Resolution: input.Resolution().String(),
+			Pages:      []DocumentArchivePage{},
+			Started:    time.Now(),
+		},
+	}
+
+	if req != nil {
+		doc.manifest.Request = string(req.MarshalLog())
+	}
+
+	return doc
+}
+
+// Resolution returns Document's Resolution
+func (doc *documentArchiver) Resolution() Resolution {
+	return doc.input.Resolution()
+}
+
+// Next returns the next file as [DocumentFile].
+func (doc *documentArchiver) Next() (DocumentFile, error) {
+	// Archive the rest of the current file
+	if doc.current != nil {
+		doc.current.drain()
+	}
+
+	file, err := doc.input.Next()
+	if err != nil {
+		if err != io.EOF {
+			doc.lock.Lock()
+			doc.manifest.Error = err.Error()
+			doc.lock.Unlock()
+		}
+		return nil, err
+	}
+
+	doc.lock.Lock()
+	defer doc.lock.Unlock()
+
+	format := file.Format()
+	ext := vprnDocExt[format]
+	if ext == "" {
+		ext = ".bin"
+	}
+
+	page := DocumentArchivePage{
+		File:    fmt.Sprintf("page-%3.3d%s", len(doc.manifest.Pages)+1, ext),
+		Format:  format,
+		Started: time.Now(),
+	}
+
+	out, err := doc.archive.Create(page.File)
+	doc.setErr(err)
+
+	doc.current = &documentArchiverFile{
+		DocumentFile: file,
+		doc:          doc,
+		out:          out,
+		page:         len(doc.manifest.Pages),
+	}
+
+	doc.manifest.Pages = append(doc.manifest.Pages, page)
+
+	return doc.current.expose(), nil
+}
+
+// Close closes the document, writes the manifest and closes
+// the archive.
+func (doc *documentArchiver) Close() error {
+	err := doc.input.Close()
+
+	doc.lock.Lock()
+	defer doc.lock.Unlock()
+
+	if doc.current != nil {
+		doc.current.finish(false)
+	}
+
+	if err != nil && doc.manifest.Error == "" {
+		doc.manifest.Error = err.Error()
+	}
+
+	doc.manifest.Completed = time.Now()
+	doc.setErr(doc.writeManifest())
+	doc.setErr(doc.archive.Close())
+
+	if err == nil {
+		err = doc.err
+	}
+
+	return err
+}
+
+// writeManifest writes the manifest.json file into the archive.
+func (doc *documentArchiver) writeManifest() error {
+	data, err := json.MarshalIndent(&doc.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	out, err := doc.archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(append(data, '\n'))
+	err2 := out.Close()
+	if err == nil {
+		err = err2
+	}
+
+	return err
+}
+
+// setErr saves the first archiving error.
+// It must be called under the lock.
+func (doc *documentArchiver) setErr(err error) {
+	if doc.err == nil {
+		doc.err = err
+	}
+}
+
+// Read reads the file data and saves it into the archive.
+func (file *documentArchiverFile) Read(buf []byte) (int, error) {
+	n, err := file.DocumentFile.Read(buf)
+
+	file.doc.lock.Lock()
+	defer file.doc.lock.Unlock()
+
+	if n > 0 && file.out != nil {
+		_, err2 := file.out.Write(buf[:n])
+		file.doc.setErr(err2)
+		file.doc.manifest.Pages[file.page].Size += int64(n)
+	}
+
+	if err != nil {
+		file.finish(err == io.EOF)
+	}
+
+	return n, err
+}
+
+// drain reads the rest of file, so it is saved into the archive.
+func (file *documentArchiverFile) drain() {
+	buf := make([]byte, 32768)
+	for {
+		file.doc.lock.Lock()
+		done := file.out == nil
+		file.doc.lock.Unlock()
+
+		if done {
+			return
+		}
+
+		file.Read(buf)
+	}
+}
+
+// finish finishes the archived file.
+// It must be called under the lock.
+func (file *documentArchiverFile) finish(complete bool) {
+	if file.out == nil {
+		return
+	}
+
+	file.doc.setErr(file.out.Close())
+	file.out = nil
+
+	page := &file.doc.manifest.Pages[file.page]
+	page.Complete = complete
+	page.Completed = time.Now()
+}
+
+// expose returns the file as [DocumentFile], that implements
+// the same optional interfaces ([DocumentFileWithInfo] and
+// [BlankPageInfo]), as the underlying file does.
+func (file *documentArchiverFile) expose() DocumentFile {
+	_, info := file.DocumentFile.(DocumentFileWithInfo)
+	_, blank := file.DocumentFile.(BlankPageInfo)
+
+	switch {
+	case info && blank:
+		return documentArchiverFileInfoBlank{file}
+	case info:
+		return documentArchiverFileInfo{file}
+	case blank:
+		return documentArchiverFileBlank{file}
+	}
+
+	return file
+}
+
+// documentArchiverFileInfo is the documentArchiverFile of the
+// file that implements [DocumentFileWithInfo].
+type documentArchiverFileInfo struct {
+	*documentArchiverFile
+}
+
+// Info returns the metadata of the underlying file.
+// It implements the [DocumentFileWithInfo] interface.
+func (file documentArchiverFileInfo) Info() DocumentFileInfo {
+	return file.DocumentFile.(DocumentFileWithInfo).Info()
+}
+
+// documentArchiverFileBlank is the documentArchiverFile of the
+// file that implements [BlankPageInfo].
+type documentArchiverFileBlank struct {
+	*documentArchiverFile
+}
+
+// Blank reports if the underlying file is a blank page.
+// It implements the [BlankPageInfo] interface.
+func (file documentArchiverFileBlank) Blank() bool {
+	return file.DocumentFile.(BlankPageInfo).Blank()
+}
+
+// documentArchiverFileInfoBlank is the documentArchiverFile of the
+// file that implements both [DocumentFileWithInfo] and [BlankPageInfo].
+type documentArchiverFileInfoBlank struct {
+	*documentArchiverFile
+}
+
+// Info returns the metadata of the underlying file.
+// It implements the [DocumentFileWithInfo] interface.
+func (file documentArchiverFileInfoBlank) Info() DocumentFileInfo {
+	return file.DocumentFile.(DocumentFileWithInfo).Info()
+}
+
+// Blank reports if the underlying file is a blank page.
+// It implements the [BlankPageInfo] interface.
+func (file documentArchiverFileInfoBlank) Blank() bool {
+	return file.DocumentFile.(BlankPageInfo).Blank()
+}
@@ -0,0 +1,236 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Document archiver tests
+
+package abstract
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestDocumentArchiverDir tests the document archiver with the
+// directory storage.
+func TestDocumentArchiverDir(t *testing.T) {
+	files := [][]byte{
+		testutils.Images.JPEG100x75rgb8,
+		testutils.Images.PNG100x75rgb8,
+	}
+
+	dir := t.TempDir()
+	archive, err := NewDirArchive(dir)
+	if err != nil {
+		t.Fatalf("NewDirArchive: %s", err)
+	}
+
+	req := &ScannerRequest{Input: InputADF, ADFMode: ADFModeDuplex}
+	doc := NewDocumentArchiver(NewVirtualDocument(Resolution{300, 300},
+		files...), req, archive)
+
+	// Read the first file completely, skip the second one
+	file, err := doc.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	data, _ := io.ReadAll(file)
+	if !bytes.Equal(data, files[0]) {
+		t.Errorf("Returned data mismatch")
+	}
+
+	_, err = doc.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	_, err = doc.Next()
+	if err != io.EOF {
+		t.Errorf("Error mismatch: %v != %s", err, io.EOF)
+	}
+
+	err = doc.Close()
+	if err != nil {
+		t.Errorf("Close: %s", err)
+	}
+
+	// Check archived files
+	for i, name := range []string{"page-001.jpg", "page-002.png"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s", err)
+		} else if !bytes.Equal(data, files[i]) {
+			t.Errorf("%s: data mismatch", name)
+		}
+	}
+
+	// Check manifest
+	data, err = os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var manifest DocumentArchiveManifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		t.Fatalf("manifest.json: %s", err)
+	}
+
+	if manifest.Request != string(req.MarshalLog()) {
+		t.Errorf("manifest: Request mismatch:\n%s", manifest.Request)
+	}
+
+	if len(manifest.Pages) != 2 {
+		t.Fatalf("manifest: %d pages, expected 2", len(manifest.Pages))
+	}
+
+	for i, page := range manifest.Pages {
+		if !page.Complete || page.Size != int64(len(files[i])) {
+			t.Errorf("manifest: page %d: %+v", i+1, page)
+		}
+	}
+
+	if manifest.Pages[1].Format != "image/png" {
+		t.Errorf("manifest: page 2: format %q", manifest.Pages[1].Format)
+	}
+}
+
+// TestDocumentArchiverTar tests the document archiver with the
+// tar storage.
+func TestDocumentArchiverTar(t *testing.T) {
+	files := [][]byte{
+		testutils.Images.JPEG100x75rgb8,
+		testutils.Images.JPEG100x75gray8,
+	}
+
+	buf := &bytes.Buffer{}
+	doc := NewDocumentArchiver(NewVirtualDocument(Resolution{300, 300},
+		files...), nil, NewTarArchive(buf))
+
+	// Read the first file partially and close the document
+	file, err := doc.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	part := make([]byte, 100)
+	io.ReadFull(file, part)
+
+	err = doc.Close()
+	if err != nil {
+		t.Errorf("Close: %s", err)
+	}
+
+	// Check the archive content
+	content := make(map[string][]byte)
+	rd := tar.NewReader(buf)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("tar: %s", err)
+		}
+
+		content[hdr.Name], _ = io.ReadAll(rd)
+	}
+
+	if !bytes.Equal(content["page-001.jpg"], part) {
+		t.Errorf("page-001.jpg: data mismatch")
+	}
+
+	var manifest DocumentArchiveManifest
+	err = json.Unmarshal(content["manifest.json"], &manifest)
+	if err != nil {
+		t.Fatalf("manifest.json: %s", err)
+	}
+
+	if len(manifest.Pages) != 1 {
+		t.Fatalf("manifest: %d pages, expected 1", len(manifest.Pages))
+	}
+
+	if page := manifest.Pages[0]; page.Complete || page.Size != 100 {
+		t.Errorf("manifest: page 1: %+v", page)
+	}
+}
+
+// testPlainDocument wraps the Document and hides optional
+// interfaces of its files.
+type testPlainDocument struct {
+	Document
+}
+
+func (doc testPlainDocument) Next() (DocumentFile, error) {
+	file, err := doc.Document.Next()
+	if err != nil {
+		return nil, err
+	}
+	return struct{ DocumentFile }{file}, nil
+}
+
+// TestDocumentArchiverInterfaces tests that archived files
+// implement the same optional interfaces, as the original files.
+func TestDocumentArchiverInterfaces(t *testing.T) {
+	res := Resolution{300, 300}
+	image := testutils.Images.PNG100x75rgb8
+
+	type testData struct {
+		name  string   // Test name
+		input Document // Input document
+		info  bool     // DocumentFileWithInfo expected
+		blank bool     // BlankPageInfo expected
+	}
+
+	tests := []testData{
+		{
+			name:  "plain",
+			input: testPlainDocument{NewVirtualDocument(res, image)},
+		},
+		{
+			name:  "virtual",
+			input: NewVirtualDocument(res, image),
+			info:  true,
+		},
+		{
+			name: "filter",
+			input: NewFilter(NewVirtualDocument(res, image),
+				FilterOptions{BlankPage: BlankPageFlag}),
+			info:  true,
+			blank: true,
+		},
+	}
+
+	for _, test := range tests {
+		doc := NewDocumentArchiver(test.input, nil,
+			NewTarArchive(&bytes.Buffer{}))
+
+		file, err := doc.Next()
+		if err != nil {
+			t.Errorf("%s: Next: %s", test.name, err)
+			doc.Close()
+			continue
+		}
+
+		_, info := file.(DocumentFileWithInfo)
+		_, blank := file.(BlankPageInfo)
+
+		if info != test.info || blank != test.blank {
+			t.Errorf("%s: DocumentFileWithInfo %v/%v, "+
+				"BlankPageInfo %v/%v (present/expected)",
+				test.name, info, test.info, blank, test.blank)
+		}
+
+		io.ReadAll(file)
+		doc.Close()
+	}
+}
@@ -0,0 +1,104 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Per-page metadata of the DocumentFile
+
+package abstract
+
+import "fmt"
+
+// DocumentFileInfo contains the per-page metadata of the
+// [DocumentFile].
+//
+// Zero value of any field means that the corresponding
+// parameter is not known.
+type DocumentFileInfo struct {
+	Width      int        // Image width, in pixels
+	Height     int        // Image height, in pixels
+	Resolution Resolution // Image resolution
+	ColorMode  ColorMode  // Image color mode
+	ColorDepth ColorDepth // Image color depth (ColorModeMono/Color)
+	Side       PageSide   // Side of the ADF sheet
+	Page       int        // Page number, 1-based
+	Length     int        // Length of the file, in bytes
+}
+
+// DocumentFileWithInfo is implemented by the [DocumentFile]s that
+// provide the per-page metadata.
+//
+// The metadata is available immediately after the DocumentFile
+// is returned by the Document.Next, without reading the file.
+type DocumentFileWithInfo interface {
+	DocumentFile
+
+	// Info returns the DocumentFile metadata.
+	Info() DocumentFileInfo
+}
+
+// PageSide specifies the side of the sheet, scanned by the ADF.
+type PageSide int
+
+// Known page sides:
+const (
+	PageSideUnset PageSide = iota // Not set
+	PageSideFront                 // Front side
+	PageSideBack                  // Back side
+	pageSideMax
+)
+
+// DuplexPageSide returns the [PageSide] of the page in the ADF
+// duplex Document, where pages alternate between the front and
+// back sides. Page numbers are 1-based.
+func DuplexPageSide(page int) PageSide {
+	if page%2 == 0 {
+		return PageSideBack
+	}
+	return PageSideFront
+}
+
+// Valid reports if PageSide is valid
+func (side PageSide) Valid() bool {
+	return PageSideUnset <= side && side < pageSideMax
+}
+
+// String returns the string representation of the [PageSide],
+// for logging.
+func (side PageSide) String() string {
+	switch side {
+	case PageSideUnset:
+		return "Unset"
+	case PageSideFront:
+		return "Front"
+	case PageSideBack:
+		return "Back"
+	}
+
+	return fmt.Sprintf("Unknown (%d)", int(side))
+}
+
+// BytesPerLine returns the count of bytes per image line in the
+// uncompressed form, computed from the image width, color mode
+// and depth. It returns 0, if these parameters are not known.
+func (info DocumentFileInfo) BytesPerLine() int {
+	bytes := 0
+	switch info.ColorDepth {
+	case ColorDepth8:
+		bytes = 1
+	case ColorDepth16:
+		bytes = 2
+	}
+
+	switch info.ColorMode {
+	case ColorModeBinary:
+		return (info.Width + 7) / 8
+	case ColorModeMono:
+		return info.Width * bytes
+	case ColorModeColor:
+		return info.Width * bytes * 3
+	}
+
+	return 0
+}
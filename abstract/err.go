@@ -19,6 +19,13 @@ const (
 	ErrInvalidParam
 	ErrUnsupportedParam
 	ErrDocumentClosed
+	ErrDocumentFormat
+	ErrUnsupportedFormat
+	ErrDeviceBusy
+	ErrADFEmpty
+	ErrADFJam
+	ErrCoverOpen
+	ErrDeviceInUse
 )
 
 // Error returns error string. It implements the [error] interface.
@@ -30,6 +37,20 @@ func (e ErrCode) Error() string {
 		return "Unsupported parameter"
 	case ErrDocumentClosed:
 		return "Document is closed"
+	case ErrDocumentFormat:
+		return "Document format error"
+	case ErrUnsupportedFormat:
+		return "Unsupported document format"
+	case ErrDeviceBusy:
+		return "Device is busy"
+	case ErrADFEmpty:
+		return "ADF is empty"
+	case ErrADFJam:
+		return "ADF paper jam"
+	case ErrCoverOpen:
+		return "Cover is open"
+	case ErrDeviceInUse:
+		return "Device is in use by another job"
 	}
 	return ""
 }
@@ -13,20 +13,47 @@ import (
 	"image"
 	"image/color"
 	"io"
+	"sync"
 
 	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/util/generic"
 )
 
+// Thresholds of the automatic color mode detection.
+// See Filter.colorful for details.
+const (
+	filterAutoColorfulness  = 0.02
+	filterAutoColorCoverage = 0.001
+)
+
+// filterOutputFormats contains the output formats, supported
+// by the Filter.
+var filterOutputFormats = map[string]bool{
+	imgconv.MIMETypeJPEG: true,
+	imgconv.MIMETypePNG:  true,
+	imgconv.MIMETypePDF:  true,
+	imgconv.MIMETypeTIFF: true,
+	imgconv.MIMETypeBMP:  true,
+	imgconv.MIMETypePWG:  true,
+	imgconv.MIMETypeURF:  true,
+}
+
 // Filter runs on a top of existent [Document] and performs various
 // transformations of the images, containing in the Document, such
 // as changing output format (say, PNG->JPEG), image scaling and
 // resizing, brightness and contrast adjustment and so on.
 //
+// If both input and output images are JPEG and no pixel transformation
+// is required, JPEG images are passed through without re-encoding.
+// MCU-aligned regions are cropped losslessly.
+//
 // Filter implements the [Document] interface.
 type Filter struct {
-	input   Document            // Input document
-	opt     FilterOptions       // Filter options
-	curfile *filterDocumentFile // Current DocumentFile, nil if none
+	input     Document            // Input document
+	opt       FilterOptions       // Filter options
+	curfile   *filterDocumentFile // Current DocumentFile, nil if none
+	files     int                 // Count of input files consumed
+	lookahead *filterLookAhead    // Look-ahead processing, if started
 }
 
 // FilterOptions define image transformations, performed
@@ -34,17 +61,53 @@ type Filter struct {
 type FilterOptions struct {
 	// OutputFormat specified the MIME type of the output
 	// image. If set to "", the output format will be choosen
-	// automatically.
+	// automatically (currently, PNG is used).
+	//
+	// Unsupported formats cause [Filter.Next] to fail with
+	// the [ErrUnsupportedFormat].
 	OutputFormat string
 
 	// Res requests image resampling into the specified resolution.
 	// Use zero value of [Resolution] to skip this step.
 	Res Resolution
 
+	// Resampling chooses the kernel, used to resample image into
+	// the Res. Bi-linear interpolation is used by default, but it
+	// aliases when downscaling by the large factor (say, 600 DPI
+	// to 150 DPI). ResamplingBox or ResamplingLanczos3 give much
+	// better results in this case.
+	Resampling Resampling
+
 	// Reg requests image clipping to the specified region.
 	// Use zero value of [Region] to skip this step.
 	Reg Region
 
+	// AutoCrop requests cropping the image to the page boundaries,
+	// detected against the scanner background, and Deskew requests
+	// the page skew correction. See [imgconv.AutoCrop] for details.
+	//
+	// Both operations require the whole image to be buffered
+	// in memory. They are performed before clipping to Reg.
+	AutoCrop bool
+	Deskew   bool
+
+	// Rotation requests the image rotation. It is applied after
+	// all other image transformations, so Reg is specified in
+	// the coordinates of the original (not rotated) image.
+	Rotation Rotation
+
+	// BackSide specifies orientation of the back side images
+	// in the duplex Document. If set, every second file of the
+	// Document is considered the back side and is brought into
+	// the normal orientation before any other processing.
+	BackSide BackSide
+
+	// Duplex specifies that the input Document is scanned by the
+	// ADF in the duplex mode, so files alternate between front
+	// and back sides. It only affects the [DocumentFileInfo.Side]
+	// reported by the filtered files.
+	Duplex bool
+
 	// Mode requests image conversion into the particular
 	// [ColorMode].
 	// Use [ColorModeUnset] to bypass this step.
@@ -54,6 +117,130 @@ type FilterOptions struct {
 	// color depth.
 	// Use [ColorDepthUnset] to bypass this step.
 	Depth ColorDepth
+
+	// Exposure control. See [imgconv.Levels] for the meaning
+	// and ranges of these parameters. Zero values bypass the
+	// corresponding adjustments.
+	Brightness float64 // Brightness, [-1.0...+1.0]
+	Contrast   float64 // Contrast, [-1.0...+1.0]
+	Gamma      float64 // Gamma (y=x^(1/g)), 0 means 1.0
+	Highlight  float64 // Highlight, [-1.0...+1.0]
+	Shadow     float64 // Shadow, [-1.0...+1.0]
+
+	// AutoColorMode requests the automatic detection of the
+	// color mode. If set, images without the noticeable color
+	// (see [imgconv.ImageStats]) are converted to ColorModeMono.
+	// It is ignored, if Mode is ColorModeBinary.
+	//
+	// AutoLevels requests the automatic exposure adjustment, which
+	// stretches the image luminance range to the full range (see
+	// [imgconv.ImageStats.AutoLevels]). It is applied before other
+	// exposure adjustments.
+	//
+	// Both operations require the whole image to be buffered
+	// in memory.
+	AutoColorMode bool
+	AutoLevels    bool
+
+	// Sharpen sharpens (positive) or softens (negative)
+	// the image. The range is [-1.0...+1.0].
+	Sharpen float64
+
+	// NoiseRemoval requests the noise removal. The range
+	// is [0...1.0].
+	NoiseRemoval float64
+
+	// BinaryRendering specifies how to render black and white
+	// images in the ColorModeBinary.
+	// BinaryRenderingUnset means BinaryRenderingThreshold.
+	BinaryRendering BinaryRendering
+
+	// Threshold is the black and white threshold level for
+	// the BinaryRenderingThreshold, in range [0...1.0].
+	// Zero means 0.5.
+	Threshold float64
+
+	// BlankPage enables detection of blank pages. Blank pages
+	// are either removed from the output or flagged (see
+	// [BlankPageInfo]).
+	//
+	// Detection requires the whole image to be processed before
+	// the page is returned, so output of each page is buffered.
+	BlankPage BlankPageMode
+
+	// Page is considered blank, if fraction of "ink" pixels
+	// doesn't exceed BlankCoverage and the luminance variance
+	// doesn't exceed BlankVariance. See [imgconv.BlankStats] for
+	// details. Zero values mean DefaultBlankCoverage and
+	// DefaultBlankVariance.
+	BlankCoverage float64
+	BlankVariance float64
+
+	// LookAhead enables processing of up to LookAhead pages ahead
+	// of the page being read by the client, concurrently, on the
+	// background goroutines. Zero disables the look-ahead.
+	//
+	// With the look-ahead, input files are read into memory and
+	// output of each page is buffered. LookAheadMemory limits
+	// the total size of the buffered input and output data and
+	// of the decoded images of pages being processed (the whole
+	// decoded image is charged, as some steps, like AutoCrop or
+	// AutoLevels, hold it in memory). Pages are not read from
+	// the input while the limit is exceeded. Zero means
+	// DefaultLookAheadMemory.
+	LookAhead       int
+	LookAheadMemory int
+}
+
+// NewFilterOptions creates [FilterOptions] that emulate the
+// processing, requested by the [ScannerRequest], in software.
+//
+// Brightness, contrast and other "analog" parameters are mapped
+// into the normalized Filter parameters, using the corresponding
+// [Range] from the [ScannerCapabilities]. The Range.Normal value
+// always means "no change".
+//
+// The request is expected to be already processed by the
+// [ScannerCapabilities.FillRequest].
+func NewFilterOptions(caps *ScannerCapabilities,
+	req *ScannerRequest) FilterOptions {
+
+	opt := FilterOptions{
+		OutputFormat: req.DocumentFormat,
+		Res:          req.Resolution,
+		Reg:          req.Region,
+		Mode:         req.ColorMode,
+		Depth:        req.ColorDepth,
+
+		Brightness: caps.BrightnessRange.relative(req.Brightness),
+		Contrast:   caps.ContrastRange.relative(req.Contrast),
+		Highlight:  caps.HighlightRange.relative(req.Highlight),
+		Shadow:     caps.ShadowRange.relative(req.Shadow),
+		Sharpen:    caps.SharpenRange.relative(req.Sharpen),
+	}
+
+	// Duplex back side orientation
+	if req.Input == InputADF && req.ADFMode == ADFModeDuplex {
+		opt.BackSide = caps.ADFBackSide
+		opt.Duplex = true
+	}
+
+	// Gamma: Range.Normal means 1.0
+	if g := caps.GammaRange; req.Gamma != nil && g.Normal > 0 {
+		opt.Gamma = float64(*req.Gamma) / float64(g.Normal)
+	}
+
+	// NoiseRemoval: only values above Range.Normal remove the noise
+	opt.NoiseRemoval = generic.Max(0,
+		caps.NoiseRemovalRange.relative(req.NoiseRemoval))
+
+	// Black and white rendering
+	if req.ColorMode == ColorModeBinary {
+		opt.BinaryRendering = req.BinaryRendering
+		opt.Threshold = caps.ThresholdRange.absolute(req.Threshold, 0.5)
+	}
+
+	return opt
 }
 
 // NewFilter creates a new [Filter] on a top of existent [Document].
@@ -64,7 +251,7 @@ func NewFilter(input Document, opt FilterOptions) *Filter {
 	}
 
 	if filter.opt.OutputFormat == "" {
-		filter.opt.OutputFormat = imgconv.MIMETypePNG //FIXME
+		filter.opt.OutputFormat = imgconv.MIMETypePNG
 	}
 
 	return filter
@@ -73,32 +260,163 @@ func NewFilter(input Document, opt FilterOptions) *Filter {
 // Resolution returns the document's rendering resolution in DPI
 // (dots per inch).
 func (filter *Filter) Resolution() Resolution {
+	res := filter.input.Resolution()
 	if !filter.opt.Res.IsZero() {
-		return filter.opt.Res
+		res = filter.opt.Res
 	}
-	return filter.input.Resolution()
+
+	return filter.opt.rotate(res)
 }
 
 // Next returns the next [DocumentFile].
+//
+// The returned DocumentFile implements the [DocumentFileWithInfo]
+// interface. If blank page detection is enabled, it also implements
+// the [BlankPageInfo] interface.
 func (filter *Filter) Next() (DocumentFile, error) {
-	// Close current DocumentFile, if any
-	if filter.curfile != nil {
-		filter.curfile.close()
-		filter.curfile = nil
+	// Start look-ahead processing on demand
+	if filter.opt.LookAhead > 0 && filter.lookahead == nil {
+		filter.lookahead = newFilterLookAhead(filter)
 	}
 
+	for {
+		// Close current DocumentFile, if any
+		if filter.curfile != nil {
+			filter.curfile.close()
+			filter.curfile = nil
+		}
+
+		var file *filterDocumentFile
+		var err error
+
+		if filter.lookahead != nil {
+			file, err = filter.lookahead.next()
+		} else {
+			file, err = filter.next()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		filter.curfile = file
+		if file.detector == nil {
+			return file, nil
+		}
+
+		// Process the whole page and check if it is blank
+		file.buffer()
+		if file.err != io.EOF {
+			return file, nil
+		}
+
+		file.info.Length = file.output.Len()
+
+		file.blank = filter.blank(file.detector.Stats())
+		if !file.blank || filter.opt.BlankPage != BlankPageRemove {
+			return file, nil
+		}
+	}
+}
+
+// blank reports if page is blank, based on its statistics.
+func (filter *Filter) blank(stats imgconv.BlankStats) bool {
+	coverage := filter.opt.BlankCoverage
+	if coverage == 0 {
+		coverage = DefaultBlankCoverage
+	}
+
+	variance := filter.opt.BlankVariance
+	if variance == 0 {
+		variance = DefaultBlankVariance
+	}
+
+	return stats.Coverage <= coverage && stats.Variance <= variance
+}
+
+// colorful reports if image is colorful, based on its statistics.
+//
+// Image is considered colorful, if either its colorfulness or
+// the fraction of colored pixels exceeds the threshold. The latter
+// catches mostly gray pages with small color elements, like logos
+// or stamps.
+func (filter *Filter) colorful(stats imgconv.ImageStats) bool {
+	return stats.Colorfulness > filterAutoColorfulness ||
+		stats.ColorCoverage > filterAutoColorCoverage
+}
+
+// next creates the filterDocumentFile for the next input file.
+func (filter *Filter) next() (*filterDocumentFile, error) {
 	// Obtain next DocumentFile from the underlying source Document
 	input, err := filter.input.Next()
 	if err != nil {
 		return nil, err
 	}
 
+	filter.files++
+
+	return filter.open(input, input, filter.files)
+}
+
+// open creates the filterDocumentFile for the input file, which
+// content is read from the source. Page is the 1-based index of
+// the file in the input Document.
+func (filter *Filter) open(input DocumentFile, source io.Reader,
+	page int) (*filterDocumentFile, error) {
+
+	// Check the output format before wasting time on decoding
+	if !filterOutputFormats[filter.opt.OutputFormat] {
+		err := ErrParam{
+			Err:   ErrUnsupportedFormat,
+			Name:  "OutputFormat",
+			Value: filter.opt.OutputFormat,
+		}
+		return nil, err
+	}
+
+	// Pass JPEG images through, if no pixel transformation is
+	// needed. The bytes, consumed by the JPEG header parser, are
+	// saved, so the image can be decoded if passthrough is not
+	// possible.
+	if filter.passthroughPossible(page) {
+		head := &bytes.Buffer{}
+		hdr, err := imgconv.ReadJPEGHeader(io.TeeReader(source, head))
+		source = io.MultiReader(head, source)
+
+		if err == nil {
+			file := filter.passthrough(input, source, hdr, page)
+			if file != nil {
+				return file, nil
+			}
+		}
+	}
+
 	// Create filtering pipeline
-	pipeline, err := imgconv.NewDetectReader(input)
+	pipeline, err := imgconv.NewDetectReader(source)
 	if err != nil {
 		return nil, err
 	}
 
+	var inmeta imgconv.ImageMeta
+	if decoder, ok := pipeline.(imgconv.Decoder); ok {
+		inmeta = decoder.Meta()
+	}
+
+	inmodel := pipeline.ColorModel()
+
+	// Bring back side of the duplex page into normal orientation
+	if page%2 == 0 {
+		switch filter.opt.BackSide {
+		case BackSideRotated:
+			pipeline = imgconv.NewRotate(pipeline, 180)
+		case BackSideFlipped:
+			pipeline = imgconv.NewMirror(pipeline)
+			pipeline = imgconv.NewRotate(pipeline, 180)
+		case BackSideMirrored:
+			pipeline = imgconv.NewMirror(pipeline)
+		}
+	}
+
 	// Resample to resolution
 	res := filter.input.Resolution()
 	if !filter.opt.Res.IsZero() && !res.IsZero() && filter.opt.Res != res {
@@ -106,30 +424,94 @@ func (filter *Filter) Next() (DocumentFile, error) {
 		newwid := wid * filter.opt.Res.XResolution / res.XResolution
 		newhei := hei * filter.opt.Res.YResolution / res.YResolution
 
-		pipeline = imgconv.NewScaler(pipeline, newwid, newhei)
+		pipeline = imgconv.NewScalerKernel(pipeline, newwid, newhei,
+			filter.opt.Resampling.kernel())
 		res = filter.opt.Res
 	}
 
+	// Automatic cropping and deskewing
+	autocrop, err := imgconv.NewAutoCrop(pipeline, imgconv.AutoCrop{
+		Crop:   filter.opt.AutoCrop,
+		Deskew: filter.opt.Deskew,
+	})
+	if err != nil {
+		pipeline.Close()
+		return nil, err
+	}
+
+	pipeline = autocrop
+
 	// Resize image
 	if !filter.opt.Reg.IsZero() {
-		rect := image.Rect(
-			0, 0,
-			filter.opt.Reg.Width.Dots(res.XResolution),
-			filter.opt.Reg.Height.Dots(res.XResolution),
-		)
+		pipeline = imgconv.NewResizer(pipeline, filter.region(res))
+	}
+
+	// Automatic color mode and levels detection
+	mode := filter.opt.Mode
+	autolevels := imgconv.Levels{}
+
+	if filter.opt.AutoColorMode || filter.opt.AutoLevels {
+		stats := imgconv.NewStatsReader(pipeline)
+		buffered, err := imgconv.NewImageBuffer(stats)
+		if err != nil {
+			pipeline.Close()
+			return nil, err
+		}
 
-		rect = rect.Add(image.Point{
-			X: filter.opt.Reg.XOffset.Dots(res.XResolution),
-			Y: filter.opt.Reg.YOffset.Dots(res.XResolution),
-		})
+		pipeline = buffered
 
-		pipeline = imgconv.NewResizer(pipeline, rect)
+		s := stats.Stats()
+		if filter.opt.AutoColorMode && mode != ColorModeBinary &&
+			!filter.colorful(s) {
+			mode = ColorModeMono
+		}
+
+		if filter.opt.AutoLevels {
+			autolevels = s.AutoLevels()
+		}
 	}
 
+	// Blank page detection
+	var detector *imgconv.BlankDetector
+	if filter.opt.BlankPage != BlankPageUnset {
+		detector = imgconv.NewBlankDetector(pipeline)
+		pipeline = detector
+	}
+
+	// Image processing
+	pipeline = imgconv.NewDenoise(pipeline, filter.opt.NoiseRemoval)
+	pipeline = imgconv.NewSharpen(pipeline, filter.opt.Sharpen)
+	pipeline = imgconv.NewLevels(pipeline, autolevels)
+	pipeline = imgconv.NewLevels(pipeline, imgconv.Levels{
+		Brightness: filter.opt.Brightness,
+		Contrast:   filter.opt.Contrast,
+		Gamma:      filter.opt.Gamma,
+		Highlight:  filter.opt.Highlight,
+		Shadow:     filter.opt.Shadow,
+	})
+
 	// Honor color mode conversion options
+	if mode == ColorModeBinary {
+		switch filter.opt.BinaryRendering {
+		case BinaryRenderingHalftone:
+			pipeline = imgconv.NewErrorDiffusion(pipeline)
+
+		default:
+			threshold := filter.opt.Threshold
+			if threshold == 0 {
+				threshold = 0.5
+			}
+			pipeline = imgconv.NewThreshold(pipeline, threshold)
+		}
+	}
+
+	// Rotate image
+	pipeline = imgconv.NewRotate(pipeline, filter.opt.Rotation.Degrees())
+	res = filter.opt.rotate(res)
+
 	model := pipeline.ColorModel()
 
-	switch filter.opt.Mode {
+	switch mode {
 	case ColorModeMono:
 		switch model {
 		case color.RGBAModel:
@@ -163,30 +545,77 @@ func (filter *Filter) Next() (DocumentFile, error) {
 		}
 	}
 
+	// Only PNG, PDF, TIFF, BMP and PWG Raster support 1-bit images.
+	// Other formats will get 8-bit grayscale with only black and
+	// white pixels.
+	switch filter.opt.OutputFormat {
+	case imgconv.MIMETypePNG, imgconv.MIMETypePDF, imgconv.MIMETypeTIFF,
+		imgconv.MIMETypeBMP, imgconv.MIMETypePWG:
+	default:
+		if model == imgconv.BilevelModel {
+			model = color.GrayModel
+		}
+	}
+
+	// BMP doesn't support 16-bit images
+	if filter.opt.OutputFormat == imgconv.MIMETypeBMP {
+		switch model {
+		case color.Gray16Model:
+			model = color.GrayModel
+		case color.RGBA64Model:
+			model = color.RGBAModel
+		}
+	}
+
 	// Create filterDocumentFile
+	wid, hei := pipeline.Size()
+
 	file := &filterDocumentFile{
 		filter:   filter,
 		input:    input,
 		pipeline: pipeline,
+		detector: detector,
 		row:      pipeline.NewRow(),
 		output:   &bytes.Buffer{},
+		info:     filter.info(input, wid, hei, res, model, page),
 	}
 
-	// Create encoder
-	wid, hei := pipeline.Size()
+	// Output metadata. ICC profile of the input image remains
+	// valid, unless image is converted between gray and color.
+	// Profiles, that don't match the output color model (say,
+	// CMYK profile of the image, decoded as RGB), are dropped.
+	meta := imgconv.ImageMeta{
+		XResolution: res.XResolution,
+		YResolution: res.YResolution,
+	}
 
-	switch filter.opt.OutputFormat {
-	default:
-		// FIXME
-		//
-		// For now, while not all image formats are implemented,
-		// we fallback to JPEG, as it is safe default. Later it will be fixed.
-		fallthrough
+	if filterModelGray(inmodel) == filterModelGray(model) &&
+		imgconv.ICCProfileMatches(inmeta.ICCProfile, model) {
+		meta.ICCProfile = inmeta.ICCProfile
+	}
 
+	// Create encoder
+	switch filter.opt.OutputFormat {
 	case imgconv.MIMETypeJPEG:
-		file.encoder, err = imgconv.NewJPEGWriter(file.output, wid, hei, model, 100)
+		file.encoder, err = imgconv.NewJPEGWriterMeta(file.output,
+			wid, hei, model, 100, meta)
 	case imgconv.MIMETypePNG:
-		file.encoder, err = imgconv.NewPNGWriter(file.output, wid, hei, model)
+		file.encoder, err = imgconv.NewPNGWriterMeta(file.output,
+			wid, hei, model, meta)
+	case imgconv.MIMETypePDF:
+		file.encoder, err = imgconv.NewPDFWriter(file.output, wid, hei, model,
+			res.XResolution, res.YResolution)
+	case imgconv.MIMETypeTIFF:
+		file.encoder, err = imgconv.NewTIFFWriter(file.output, wid, hei, model,
+			res.XResolution, res.YResolution)
+	case imgconv.MIMETypeBMP:
+		file.encoder, err = imgconv.NewBMPWriter(file.output, wid, hei, model)
+	case imgconv.MIMETypePWG:
+		file.encoder, err = imgconv.NewPWGWriter(file.output, wid, hei, model,
+			res.XResolution, res.YResolution)
+	case imgconv.MIMETypeURF:
+		file.encoder, err = imgconv.NewURFWriter(file.output, wid, hei, model,
+			res.XResolution, res.YResolution)
 	}
 
 	if err != nil {
@@ -197,27 +626,206 @@ func (filter *Filter) Next() (DocumentFile, error) {
 	return file, nil
 }
 
+// filterModelGray reports if color.Model is grayscale.
+func filterModelGray(model color.Model) bool {
+	switch model {
+	case imgconv.BilevelModel, color.GrayModel, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// region returns the FilterOptions.Reg in pixels of the image
+// with the specified resolution.
+func (filter *Filter) region(res Resolution) image.Rectangle {
+	rect := image.Rect(
+		0, 0,
+		filter.opt.Reg.Width.Dots(res.XResolution),
+		filter.opt.Reg.Height.Dots(res.XResolution),
+	)
+
+	rect = rect.Add(image.Point{
+		X: filter.opt.Reg.XOffset.Dots(res.XResolution),
+		Y: filter.opt.Reg.YOffset.Dots(res.XResolution),
+	})
+
+	return rect
+}
+
+// passthroughPossible reports if FilterOptions allow to pass
+// the JPEG images through without decoding for the specified page.
+//
+// Only the output format, resolution, region and color mode are
+// allowed to be set, and the final decision depends on the image
+// parameters. See Filter.passthrough for details.
+func (filter *Filter) passthroughPossible(page int) bool {
+	opt := filter.opt
+
+	backside := page%2 == 0 &&
+		opt.BackSide != BackSideUnset && opt.BackSide != BackSideNormal
+
+	levels := imgconv.Levels{
+		Brightness: opt.Brightness,
+		Contrast:   opt.Contrast,
+		Gamma:      opt.Gamma,
+		Highlight:  opt.Highlight,
+		Shadow:     opt.Shadow,
+	}
+
+	return opt.OutputFormat == imgconv.MIMETypeJPEG &&
+		(opt.Res.IsZero() || opt.Res == filter.input.Resolution()) &&
+		!backside && !opt.AutoCrop && !opt.Deskew &&
+		opt.Rotation == Rotation0 &&
+		opt.Mode != ColorModeBinary &&
+		(opt.Depth == ColorDepthUnset || opt.Depth == ColorDepth8) &&
+		opt.BlankPage == BlankPageUnset &&
+		!opt.AutoColorMode && !opt.AutoLevels &&
+		opt.NoiseRemoval == 0 && opt.Sharpen == 0 &&
+		levels.IsIdentity()
+}
+
+// passthrough creates the filterDocumentFile that passes the JPEG
+// image through without decoding.
+//
+// If region is requested, image is cropped losslessly, if region
+// is aligned to the JPEG MCU boundaries. It returns nil, if image
+// cannot be passed through.
+func (filter *Filter) passthrough(input DocumentFile, source io.Reader,
+	hdr imgconv.JPEGHeader, page int) *filterDocumentFile {
+
+	// Check image parameters
+	var model color.Model
+	switch {
+	case hdr.Precision != 8:
+		return nil
+	case hdr.Components == 1 && filter.opt.Mode != ColorModeColor:
+		model = color.GrayModel
+	case hdr.Components == 3 && filter.opt.Mode != ColorModeMono:
+		model = color.RGBAModel
+	default:
+		return nil
+	}
+
+	// Check region
+	res := filter.input.Resolution()
+	bounds := image.Rect(0, 0, hdr.Width, hdr.Height)
+	crop := bounds
+
+	if !filter.opt.Reg.IsZero() {
+		crop = filter.region(res)
+		if crop != bounds && !imgconv.JPEGCropFeasible(hdr, crop) {
+			return nil
+		}
+	}
+
+	file := &filterDocumentFile{
+		filter: filter,
+		input:  input,
+		source: source,
+		output: &bytes.Buffer{},
+		info: filter.info(input, crop.Dx(), crop.Dy(),
+			res, model, page),
+	}
+
+	if crop != bounds {
+		file.crop = crop
+	}
+
+	return file
+}
+
+// info returns the [DocumentFileInfo] of the filtered file.
+func (filter *Filter) info(input DocumentFile, wid, hei int,
+	res Resolution, model color.Model, page int) DocumentFileInfo {
+
+	info := DocumentFileInfo{
+		Width:      wid,
+		Height:     hei,
+		Resolution: res,
+		Page:       page,
+	}
+
+	switch model {
+	case imgconv.BilevelModel:
+		info.ColorMode = ColorModeBinary
+	case color.GrayModel:
+		info.ColorMode, info.ColorDepth = ColorModeMono, ColorDepth8
+	case color.Gray16Model:
+		info.ColorMode, info.ColorDepth = ColorModeMono, ColorDepth16
+	case color.RGBAModel:
+		info.ColorMode, info.ColorDepth = ColorModeColor, ColorDepth8
+	case color.RGBA64Model:
+		info.ColorMode, info.ColorDepth = ColorModeColor, ColorDepth16
+	}
+
+	if filter.opt.Duplex || filter.opt.BackSide != BackSideUnset {
+		info.Side = DuplexPageSide(page)
+	}
+
+	// Page number and side, reported by the input, take precedence
+	if in, ok := input.(DocumentFileWithInfo); ok {
+		ininfo := in.Info()
+		if ininfo.Page != 0 {
+			info.Page = ininfo.Page
+		}
+		if ininfo.Side != PageSideUnset {
+			info.Side = ininfo.Side
+		}
+	}
+
+	return info
+}
+
+// rotate returns the [Resolution] of the image after rotation.
+func (opt FilterOptions) rotate(res Resolution) Resolution {
+	switch opt.Rotation {
+	case Rotation90, Rotation270:
+		res.XResolution, res.YResolution =
+			res.YResolution, res.XResolution
+	}
+	return res
+}
+
 // Close closes the Document. It implicitly closes the current
 // image being read.
 func (filter *Filter) Close() error {
+	if filter.lookahead != nil {
+		filter.lookahead.stop()
+	}
+
+	// Close the input first. The current file may be read from
+	// another goroutine, holding the file lock while waiting for
+	// the input data, so closing the input unblocks the reader.
+	filter.input.Close()
+
 	if filter.curfile != nil {
 		filter.curfile.close()
 		filter.curfile = nil
 	}
-	filter.input.Close()
+
+	if filter.lookahead != nil {
+		filter.lookahead.finish()
+	}
+
 	return nil
 }
 
 // filterDocumentFile represents the [DocumentFile] of the
 // filtered [Document].
 type filterDocumentFile struct {
-	filter   *Filter        // Back link to the Filter
-	input    DocumentFile   // Underlying DocumentFile
-	pipeline imgconv.Reader // Image data decoding/filtering pipeline
-	row      imgconv.Row    // Temporary Row for encoding
-	output   *bytes.Buffer  // Output stream buffer
-	encoder  imgconv.Writer // Image encoder; nil if closed
-	err      error          // Sticky error
+	filter   *Filter                // Back link to the Filter
+	input    DocumentFile           // Underlying DocumentFile
+	pipeline imgconv.Reader         // Image decoding/filtering pipeline
+	source   io.Reader              // JPEG passthrough source, if any
+	crop     image.Rectangle        // JPEG passthrough lossless crop
+	detector *imgconv.BlankDetector // Blank page detector, if any
+	row      imgconv.Row            // Temporary Row for encoding
+	output   *bytes.Buffer          // Output stream buffer
+	encoder  imgconv.Writer         // Image encoder; nil if closed
+	info     DocumentFileInfo       // File metadata
+	blank    bool                   // Page is blank
+	err      error                  // Sticky error
+	lock     sync.Mutex             // Access lock
 }
 
 // Format returns the MIME type of the image format used by
@@ -231,27 +839,19 @@ func (file *filterDocumentFile) Format() string {
 
 // Read reads the document file content as a sequence of bytes.
 // It implements the [io.Reader] interface.
+//
+// The file may be closed by the Filter (by the Filter.Next or
+// Filter.Close) while being read from another goroutine, so
+// access is serialized with the file lock.
 func (file *filterDocumentFile) Read(buf []byte) (int, error) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+
 	// Run filtering pipeline until we have some output data
 	for file.output.Len() == 0 && file.err == nil {
 		// Don't let buffer to grow indefinitely
 		file.output.Reset()
-
-		// Read the next image Row
-		_, file.err = file.pipeline.Read(file.row)
-		if file.err != nil {
-			if file.err == io.EOF {
-				err := file.encoder.Close()
-				file.encoder = nil
-
-				if err != nil {
-					file.err = err
-				}
-			}
-			break
-		}
-
-		file.err = file.encoder.Write(file.row)
+		file.step()
 	}
 
 	// Return buffered data
@@ -262,10 +862,90 @@ func (file *filterDocumentFile) Read(buf []byte) (int, error) {
 	return 0, file.err
 }
 
+// Info returns the DocumentFile metadata.
+// It implements the [DocumentFileWithInfo] interface.
+//
+// Length is only known, if the whole file is buffered
+// by the blank page detection.
+func (file *filterDocumentFile) Info() DocumentFileInfo {
+	return file.info
+}
+
+// Blank reports if the page is blank.
+// It implements the [BlankPageInfo] interface.
+func (file *filterDocumentFile) Blank() bool {
+	return file.blank
+}
+
+// buffer runs the filtering pipeline to the end, buffering
+// all the output data.
+func (file *filterDocumentFile) buffer() {
+	for file.err == nil {
+		file.step()
+	}
+}
+
+// step runs the filtering pipeline for the single image Row.
+func (file *filterDocumentFile) step() {
+	if file.source != nil {
+		file.stepPassthrough()
+		return
+	}
+
+	// Read the next image Row
+	_, file.err = file.pipeline.Read(file.row)
+	if file.err != nil {
+		if file.err == io.EOF {
+			err := file.encoder.Close()
+			file.encoder = nil
+
+			if err != nil {
+				file.err = err
+			}
+		}
+		return
+	}
+
+	file.err = file.encoder.Write(file.row)
+}
+
+// stepPassthrough passes the next chunk of the JPEG image
+// through. If lossless crop is requested, the whole image is
+// processed at once.
+func (file *filterDocumentFile) stepPassthrough() {
+	if !file.crop.Empty() {
+		file.err = imgconv.JPEGCrop(file.output, file.source, file.crop)
+		if file.err == nil {
+			file.err = io.EOF
+		}
+		return
+	}
+
+	n, err := file.output.ReadFrom(io.LimitReader(file.source, 65536))
+	switch {
+	case err != nil:
+		file.err = err
+	case n == 0:
+		file.err = io.EOF
+	}
+}
+
 // close closes the filterDocumentFile.
+// Subsequent reads will return [ErrDocumentClosed].
 func (file *filterDocumentFile) close() {
-	file.pipeline.Close()
+	file.lock.Lock()
+	defer file.lock.Unlock()
+
+	if file.pipeline != nil {
+		file.pipeline.Close()
+	}
+
 	if file.encoder != nil {
 		file.encoder.Close()
+		file.encoder = nil
+	}
+
+	if file.err == nil || file.err == io.EOF {
+		file.err = ErrDocumentClosed
 	}
 }
@@ -0,0 +1,1337 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Filter tests
+
+package abstract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/util/optional"
+)
+
+// TestNewFilterOptions tests NewFilterOptions
+func TestNewFilterOptions(t *testing.T) {
+	caps := &ScannerCapabilities{
+		BrightnessRange:   Range{Min: -100, Max: 100, Normal: 0},
+		ContrastRange:     Range{Min: 0, Max: 100, Normal: 50},
+		GammaRange:        Range{Min: 50, Max: 300, Normal: 100},
+		NoiseRemovalRange: Range{Min: 0, Max: 10, Normal: 0},
+		SharpenRange:      Range{Min: 0, Max: 10, Normal: 5},
+		ThresholdRange:    Range{Min: 0, Max: 255, Normal: 128},
+	}
+
+	req := &ScannerRequest{
+		DocumentFormat: imgconv.MIMETypePNG,
+		ColorMode:      ColorModeBinary,
+		Brightness:     optional.New(-50),
+		Contrast:       optional.New(75),
+		Gamma:          optional.New(200),
+		NoiseRemoval:   optional.New(5),
+		Sharpen:        optional.New(0),
+		Threshold:      optional.New(51),
+
+		BinaryRendering: BinaryRenderingHalftone,
+	}
+
+	expected := FilterOptions{
+		OutputFormat: imgconv.MIMETypePNG,
+		Mode:         ColorModeBinary,
+		Brightness:   -0.5,
+		Contrast:     0.5,
+		Gamma:        2,
+		NoiseRemoval: 0.5,
+		Sharpen:      -1,
+		Threshold:    0.2,
+
+		BinaryRendering: BinaryRenderingHalftone,
+	}
+
+	opt := NewFilterOptions(caps, req)
+	if diff := testutils.Diff(opt, expected); diff != "" {
+		t.Errorf("NewFilterOptions:\n%s", diff)
+	}
+
+	// Threshold is only used for ColorModeBinary;
+	// noise removal below Normal means no change.
+	req.ColorMode = ColorModeColor
+	req.NoiseRemoval = optional.New(0)
+	opt = NewFilterOptions(caps, req)
+
+	if opt.Threshold != 0 {
+		t.Errorf("NewFilterOptions: Threshold must be 0 for %s, present %g",
+			req.ColorMode, opt.Threshold)
+	}
+
+	if opt.NoiseRemoval != 0 {
+		t.Errorf("NewFilterOptions: NoiseRemoval must be 0, present %g",
+			opt.NoiseRemoval)
+	}
+}
+
+// TestFilterAdjustments tests image adjustments, performed by the Filter
+func TestFilterAdjustments(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+
+	// scan runs the filter and returns the decoded image
+	scan := func(opt FilterOptions) image.Image {
+		doc := NewVirtualDocument(res, testutils.Images.PNG100x75rgb8)
+		filter := NewFilter(doc, opt)
+		defer filter.Close()
+
+		file, err := filter.Next()
+		if err != nil {
+			panic(err)
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			panic(err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			panic(err)
+		}
+
+		return img
+	}
+
+	// lightness returns the average image lightness
+	lightness := func(img image.Image) float64 {
+		sum := 0.0
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				sum += float64(r+g+b) / (3 * 0xffff)
+			}
+		}
+		return sum / float64(bounds.Dx()*bounds.Dy())
+	}
+
+	base := FilterOptions{OutputFormat: imgconv.MIMETypePNG}
+	normal := lightness(scan(base))
+
+	opt := base
+	opt.Brightness = 0.5
+	if l := lightness(scan(opt)); l <= normal {
+		t.Errorf("Brightness +0.5: image not lighter: %g <= %g",
+			l, normal)
+	}
+
+	opt = base
+	opt.Brightness = -0.5
+	if l := lightness(scan(opt)); l >= normal {
+		t.Errorf("Brightness -0.5: image not darker: %g >= %g",
+			l, normal)
+	}
+
+	// ColorModeBinary must produce only black and white pixels,
+	// with both threshold and halftone rendering.
+	renderings := []BinaryRendering{
+		BinaryRenderingThreshold,
+		BinaryRenderingHalftone,
+	}
+
+	for _, rendering := range renderings {
+		opt = base
+		opt.Mode = ColorModeBinary
+		opt.BinaryRendering = rendering
+		img := scan(opt)
+
+		if _, ok := img.(*image.Gray); !ok {
+			t.Errorf("ColorModeBinary (%s): expected 1-bit PNG, "+
+				"decoded as %T", rendering, img)
+		}
+
+		bounds := img.Bounds()
+	LOOP:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				if r != g || g != b || (r != 0 && r != 0xffff) {
+					t.Errorf("ColorModeBinary (%s): "+
+						"(%d,%d) is not B&W",
+						rendering, x, y)
+					break LOOP
+				}
+			}
+		}
+	}
+}
+
+// TestFilterTIFF tests TIFF input and output of the Filter
+func TestFilterTIFF(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	doc := NewVirtualDocument(res, testutils.Images.TIFF100x75)
+
+	opt := FilterOptions{
+		OutputFormat: imgconv.MIMETypeTIFF,
+		Mode:         ColorModeMono,
+		Depth:        ColorDepth8,
+	}
+
+	filter := NewFilter(doc, opt)
+	defer filter.Close()
+
+	file, err := filter.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	if file.Format() != imgconv.MIMETypeTIFF {
+		t.Errorf("Format: expected %q, present %q",
+			imgconv.MIMETypeTIFF, file.Format())
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+
+	reader, err := imgconv.NewTIFFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewTIFFReader: %s", err)
+	}
+	defer reader.Close()
+
+	wid, hei := reader.Size()
+	if wid != 100 || hei != 75 {
+		t.Errorf("Size: expected 100x75, present %dx%d", wid, hei)
+	}
+
+	if reader.ColorModel() != color.GrayModel {
+		t.Errorf("ColorModel: 8-bit grayscale expected")
+	}
+}
+
+// TestFilterBMP tests BMP output of the Filter
+func TestFilterBMP(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	doc := NewVirtualDocument(res, testutils.Images.PNG100x75gray16)
+
+	opt := FilterOptions{
+		OutputFormat: imgconv.MIMETypeBMP,
+	}
+
+	filter := NewFilter(doc, opt)
+	defer filter.Close()
+
+	file, err := filter.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	if file.Format() != imgconv.MIMETypeBMP {
+		t.Errorf("Format: expected %q, present %q",
+			imgconv.MIMETypeBMP, file.Format())
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+
+	reader, err := imgconv.NewBMPReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewBMPReader: %s", err)
+	}
+	defer reader.Close()
+
+	wid, hei := reader.Size()
+	if wid != 100 || hei != 75 {
+		t.Errorf("Size: expected 100x75, present %dx%d", wid, hei)
+	}
+
+	// 16-bit input must be downgraded to 8 bit
+	if reader.ColorModel() != color.GrayModel {
+		t.Errorf("ColorModel: 8-bit grayscale expected")
+	}
+}
+
+// TestFilterRaster tests PWG Raster and URF output of the Filter
+func TestFilterRaster(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+
+	type testData struct {
+		format string      // Output format
+		mode   ColorMode   // Color mode
+		model  color.Model // Expected color model
+	}
+
+	tests := []testData{
+		{imgconv.MIMETypePWG, ColorModeBinary, imgconv.BilevelModel},
+		{imgconv.MIMETypePWG, ColorModeColor, color.RGBAModel},
+		{imgconv.MIMETypeURF, ColorModeBinary, color.GrayModel},
+		{imgconv.MIMETypeURF, ColorModeMono, color.GrayModel},
+	}
+
+	for _, test := range tests {
+		doc := NewVirtualDocument(res, testutils.Images.PNG100x75rgb8)
+		opt := FilterOptions{
+			OutputFormat: test.format,
+			Mode:         test.mode,
+		}
+
+		filter := NewFilter(doc, opt)
+		file, err := filter.Next()
+		if err != nil {
+			t.Fatalf("%s: Next: %s", test.format, err)
+		}
+
+		data, err := io.ReadAll(file)
+		filter.Close()
+
+		if err != nil {
+			t.Fatalf("%s: Read: %s", test.format, err)
+		}
+
+		reader, err := imgconv.NewDetectReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: NewDetectReader: %s", test.format, err)
+		}
+
+		wid, hei := reader.Size()
+		if wid != 100 || hei != 75 {
+			t.Errorf("%s: Size: expected 100x75, present %dx%d",
+				test.format, wid, hei)
+		}
+
+		if reader.ColorModel() != test.model {
+			t.Errorf("%s: ColorModel mismatch", test.format)
+		}
+
+		reader.Close()
+	}
+}
+
+// TestFilterBlankPage tests blank page detection by the Filter
+func TestFilterBlankPage(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+
+	// Create blank page
+	img := image.NewGray(image.Rect(0, 0, 100, 75))
+	for i := range img.Pix {
+		img.Pix[i] = 250
+	}
+
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	blank := buf.Bytes()
+	content := testutils.Images.PNG100x75rgb8
+
+	// scan runs the filter and returns Blank() for each page
+	scan := func(mode BlankPageMode) []bool {
+		doc := NewVirtualDocument(res, blank, content, blank, blank)
+		filter := NewFilter(doc, FilterOptions{
+			OutputFormat: imgconv.MIMETypePNG,
+			BlankPage:    mode,
+		})
+		defer filter.Close()
+
+		pages := []bool{}
+		for {
+			file, err := filter.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Next: %s", mode, err)
+			}
+
+			data, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatalf("%s: Read: %s", mode, err)
+			}
+
+			_, err = png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: png.Decode: %s", mode, err)
+			}
+
+			pages = append(pages, file.(BlankPageInfo).Blank())
+		}
+
+		return pages
+	}
+
+	pages := scan(BlankPageRemove)
+	if diff := testutils.Diff(pages, []bool{false}); diff != "" {
+		t.Errorf("%s:\n%s", BlankPageRemove, diff)
+	}
+
+	pages = scan(BlankPageFlag)
+	expected := []bool{true, false, true, true}
+	if diff := testutils.Diff(pages, expected); diff != "" {
+		t.Errorf("%s:\n%s", BlankPageFlag, diff)
+	}
+}
+
+// TestFilterAutoCrop tests automatic cropping by the Filter
+func TestFilterAutoCrop(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+
+	// Create light 60x40 page on a dark background
+	img := image.NewGray(image.Rect(0, 0, 100, 75))
+	for y := 0; y < 75; y++ {
+		for x := 0; x < 100; x++ {
+			img.Pix[y*img.Stride+x] = 20
+			if x >= 20 && x < 80 && y >= 15 && y < 55 {
+				img.Pix[y*img.Stride+x] = 230
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+
+	doc := NewVirtualDocument(res, buf.Bytes())
+	filter := NewFilter(doc, FilterOptions{
+		OutputFormat: imgconv.MIMETypePNG,
+		AutoCrop:     true,
+		Deskew:       true,
+	})
+	defer filter.Close()
+
+	file, err := filter.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+
+	cropped, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode: %s", err)
+	}
+
+	bounds := cropped.Bounds()
+	if bounds.Dx() != 60 || bounds.Dy() != 40 {
+		t.Errorf("Size: expected 60x40, present %dx%d",
+			bounds.Dx(), bounds.Dy())
+	}
+}
+
+// TestFilterRotation tests image rotation and duplex back side
+// orientation handling by the Filter
+func TestFilterRotation(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 150}
+
+	// Create 4x2 image with the black left half
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	img.SetGray(0, 0, color.Gray{})
+	img.SetGray(1, 0, color.Gray{})
+	img.SetGray(0, 1, color.Gray{})
+	img.SetGray(1, 1, color.Gray{})
+
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	page := buf.Bytes()
+
+	// scan runs the filter and returns decoded images
+	scan := func(opt FilterOptions) (Resolution, []image.Image) {
+		doc := NewVirtualDocument(res, page, page, page)
+		filter := NewFilter(doc, opt)
+		defer filter.Close()
+
+		images := []image.Image{}
+		for {
+			file, err := filter.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Next: %s", err)
+			}
+
+			data, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatalf("Read: %s", err)
+			}
+
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("png.Decode: %s", err)
+			}
+
+			images = append(images, img)
+		}
+
+		return filter.Resolution(), images
+	}
+
+	// black reports if pixel is black
+	black := func(img image.Image, x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0
+	}
+
+	// Rotation by 90 degrees swaps image dimensions and resolution
+	filterRes, images := scan(FilterOptions{
+		OutputFormat: imgconv.MIMETypePNG,
+		Rotation:     Rotation90,
+	})
+
+	expectedRes := Resolution{XResolution: 150, YResolution: 300}
+	if filterRes != expectedRes {
+		t.Errorf("Rotation90: Resolution: expected %s, present %s",
+			expectedRes, filterRes)
+	}
+
+	for i, img := range images {
+		bounds := img.Bounds()
+		if bounds.Dx() != 2 || bounds.Dy() != 4 {
+			t.Errorf("Rotation90: page %d: expected 2x4, present %dx%d",
+				i, bounds.Dx(), bounds.Dy())
+		} else if !black(img, 0, 0) || black(img, 0, 3) {
+			t.Errorf("Rotation90: page %d: invalid image", i)
+		}
+	}
+
+	// Back sides are rotated by 180 degrees, front sides are not
+	_, images = scan(FilterOptions{
+		OutputFormat: imgconv.MIMETypePNG,
+		BackSide:     BackSideRotated,
+	})
+
+	for i, img := range images {
+		back := i%2 != 0
+		if black(img, 0, 0) == back || black(img, 3, 0) != back {
+			t.Errorf("BackSideRotated: page %d: invalid image", i)
+		}
+	}
+
+	// NewFilterOptions takes BackSide from capabilities for duplex
+	caps := &ScannerCapabilities{ADFBackSide: BackSideFlipped}
+	req := &ScannerRequest{Input: InputADF, ADFMode: ADFModeDuplex}
+	if opt := NewFilterOptions(caps, req); opt.BackSide != BackSideFlipped {
+		t.Errorf("NewFilterOptions: BackSide: expected %s, present %s",
+			BackSideFlipped, opt.BackSide)
+	}
+
+	req.ADFMode = ADFModeSimplex
+	if opt := NewFilterOptions(caps, req); opt.BackSide != BackSideUnset {
+		t.Errorf("NewFilterOptions: BackSide: expected %s, present %s",
+			BackSideUnset, opt.BackSide)
+	}
+}
+
+// testStalledDocument is the single-file Document, which file
+// returns the head of the image and then stalls, until the
+// Document is closed, like a stalled network connection.
+type testStalledDocument struct {
+	head   []byte        // Data returned before stall
+	closed chan struct{} // Closed by Close
+}
+
+// testStalledFile is the DocumentFile of the testStalledDocument.
+type testStalledFile struct {
+	doc  *testStalledDocument
+	head *bytes.Reader
+}
+
+func (doc *testStalledDocument) Resolution() Resolution {
+	return Resolution{XResolution: 300, YResolution: 300}
+}
+
+func (doc *testStalledDocument) Next() (DocumentFile, error) {
+	return &testStalledFile{doc, bytes.NewReader(doc.head)}, nil
+}
+
+func (doc *testStalledDocument) Close() error {
+	close(doc.closed)
+	return nil
+}
+
+func (file *testStalledFile) Format() string {
+	return imgconv.MIMETypePNG
+}
+
+func (file *testStalledFile) Read(buf []byte) (int, error) {
+	if file.head.Len() != 0 {
+		return file.head.Read(buf)
+	}
+
+	<-file.doc.closed
+	return 0, ErrDocumentClosed
+}
+
+// TestFilterCloseStalled tests that Filter.Close doesn't hang,
+// while the current file is being read from the stalled input
+func TestFilterCloseStalled(t *testing.T) {
+	image := testutils.Images.PNG100x75rgb8
+	doc := &testStalledDocument{
+		head:   image[:len(image)/2],
+		closed: make(chan struct{}),
+	}
+
+	filter := NewFilter(doc, FilterOptions{
+		OutputFormat: imgconv.MIMETypeJPEG,
+	})
+
+	file, err := filter.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	// Read in background, until stalled
+	done := make(chan error)
+	go func() {
+		_, err := io.ReadAll(file)
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		filter.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close: hang")
+	}
+
+	if err := <-done; err == nil {
+		t.Errorf("Read: error expected")
+	}
+}
+
+// TestFilterOutputFormat tests that Filter rejects unsupported
+// output formats
+func TestFilterOutputFormat(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	doc := NewVirtualDocument(res, testutils.Images.PNG100x75rgb8)
+	filter := NewFilter(doc, FilterOptions{OutputFormat: "image/gif"})
+	defer filter.Close()
+
+	_, err := filter.Next()
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Next: expected %s, present %v",
+			ErrUnsupportedFormat, err)
+	}
+}
+
+// TestFilterInfo tests the DocumentFileInfo, reported by the Filter
+func TestFilterInfo(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 150}
+	page := testutils.Images.PNG100x75rgb8
+
+	doc := NewVirtualDocument(res, page, page)
+	filter := NewFilter(doc, FilterOptions{
+		OutputFormat: imgconv.MIMETypePNG,
+		Rotation:     Rotation90,
+		Mode:         ColorModeMono,
+		Duplex:       true,
+		BlankPage:    BlankPageFlag,
+	})
+	defer filter.Close()
+
+	expected := []DocumentFileInfo{
+		{
+			Width:      75,
+			Height:     100,
+			Resolution: Resolution{XResolution: 150, YResolution: 300},
+			ColorMode:  ColorModeMono,
+			ColorDepth: ColorDepth8,
+			Side:       PageSideFront,
+			Page:       1,
+		},
+		{
+			Width:      75,
+			Height:     100,
+			Resolution: Resolution{XResolution: 150, YResolution: 300},
+			ColorMode:  ColorModeMono,
+			ColorDepth: ColorDepth8,
+			Side:       PageSideBack,
+			Page:       2,
+		},
+	}
+
+	for i, exp := range expected {
+		file, err := filter.Next()
+		if err != nil {
+			t.Fatalf("page %d: Next: %s", i, err)
+		}
+
+		info := file.(DocumentFileWithInfo).Info()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatalf("page %d: Read: %s", i, err)
+		}
+
+		// Length is known, as the page is buffered by
+		// the blank page detection.
+		exp.Length = len(data)
+
+		if diff := testutils.Diff(info, exp); diff != "" {
+			t.Errorf("page %d:\n%s", i, diff)
+		}
+
+		if bpl := info.BytesPerLine(); bpl != 75 {
+			t.Errorf("page %d: BytesPerLine: expected %d, present %d",
+				i, 75, bpl)
+		}
+	}
+}
+
+// TestFilterJPEGPassthrough tests passing JPEG images through
+// the Filter without decoding
+func TestFilterJPEGPassthrough(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	page := testutils.Images.JPEG100x75rgb8
+
+	hdr, err := imgconv.ReadJPEGHeader(bytes.NewReader(page))
+	if err != nil {
+		t.Fatalf("ReadJPEGHeader: %s", err)
+	}
+
+	// MCU-aligned and misaligned regions
+	aligned := Region{
+		XOffset: DimensionFromDots(300, hdr.MCUWidth),
+		YOffset: DimensionFromDots(300, hdr.MCUHeight),
+		Width:   DimensionFromDots(300, 50),
+		Height:  DimensionFromDots(300, 40),
+	}
+
+	misaligned := aligned
+	misaligned.XOffset = DimensionFromDots(300, hdr.MCUWidth+1)
+
+	rect := image.Rect(hdr.MCUWidth, hdr.MCUHeight,
+		hdr.MCUWidth+50, hdr.MCUHeight+40)
+
+	buf := &bytes.Buffer{}
+	err = imgconv.JPEGCrop(buf, bytes.NewReader(page), rect)
+	if err != nil {
+		t.Fatalf("JPEGCrop: %s", err)
+	}
+
+	cropped := buf.Bytes()
+
+	type testData struct {
+		name string        // Test name
+		opt  FilterOptions // Filter options
+		same bool          // Output must be the same as input
+		wid  int           // Expected image width
+		hei  int           // Expected image height
+		gray bool          // Grayscale image expected
+		crop bool          // Lossless crop expected
+	}
+
+	tests := []testData{
+		{
+			name: "no transformation",
+			opt:  FilterOptions{},
+			same: true, wid: 100, hei: 75,
+		},
+		{
+			name: "same resolution and mode",
+			opt: FilterOptions{
+				Res:   res,
+				Mode:  ColorModeColor,
+				Depth: ColorDepth8,
+			},
+			same: true, wid: 100, hei: 75,
+		},
+		{
+			name: "aligned region",
+			opt:  FilterOptions{Reg: aligned},
+			wid:  50, hei: 40, crop: true,
+		},
+		{
+			name: "misaligned region",
+			opt:  FilterOptions{Reg: misaligned},
+			wid:  50, hei: 40,
+		},
+		{
+			name: "brightness",
+			opt:  FilterOptions{Brightness: 0.5},
+			wid:  100, hei: 75,
+		},
+		{
+			name: "mono",
+			opt:  FilterOptions{Mode: ColorModeMono},
+			wid:  100, hei: 75, gray: true,
+		},
+	}
+
+	for _, test := range tests {
+		test.opt.OutputFormat = imgconv.MIMETypeJPEG
+		doc := NewVirtualDocument(res, page)
+		filter := NewFilter(doc, test.opt)
+
+		file, err := filter.Next()
+		if err != nil {
+			t.Errorf("%s: Next: %s", test.name, err)
+			filter.Close()
+			continue
+		}
+
+		info := file.(DocumentFileWithInfo).Info()
+		data, err := io.ReadAll(file)
+		filter.Close()
+
+		if err != nil {
+			t.Errorf("%s: Read: %s", test.name, err)
+			continue
+		}
+
+		if test.same && !bytes.Equal(data, page) {
+			t.Errorf("%s: image not passed through", test.name)
+		}
+
+		if !test.same && bytes.Equal(data, page) {
+			t.Errorf("%s: image passed through", test.name)
+		}
+
+		if test.crop && !bytes.Equal(data, cropped) {
+			t.Errorf("%s: image not cropped losslessly", test.name)
+		}
+
+		reader, err := imgconv.NewJPEGReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: NewJPEGReader: %s", test.name, err)
+			continue
+		}
+
+		wid, hei := reader.Size()
+		model := reader.ColorModel()
+		reader.Close()
+
+		if wid != test.wid || hei != test.hei {
+			t.Errorf("%s: Size: expected %dx%d, present %dx%d",
+				test.name, test.wid, test.hei, wid, hei)
+		}
+
+		if info.Width != wid || info.Height != hei {
+			t.Errorf("%s: Info: expected %dx%d, present %dx%d",
+				test.name, wid, hei, info.Width, info.Height)
+		}
+
+		if (model == color.GrayModel) != test.gray {
+			t.Errorf("%s: unexpected ColorModel", test.name)
+		}
+	}
+}
+
+// TestFilterLookAhead tests the Filter look-ahead processing
+func TestFilterLookAhead(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	pages := [][]byte{
+		testutils.Images.PNG100x75rgb8,
+		testutils.Images.JPEG100x75gray8,
+		testutils.Images.PNG100x75rgb16,
+		testutils.Images.JPEG100x75rgb8,
+		testutils.Images.PNG100x75gray8,
+	}
+
+	opt := FilterOptions{
+		OutputFormat: imgconv.MIMETypePNG,
+		Res:          Resolution{XResolution: 150, YResolution: 150},
+		Brightness:   0.2,
+		Duplex:       true,
+	}
+
+	// scan runs the filter and returns output and Info of all pages
+	scan := func(opt FilterOptions) ([][]byte, []DocumentFileInfo) {
+		filter := NewFilter(NewVirtualDocument(res, pages...), opt)
+		defer filter.Close()
+
+		output := [][]byte{}
+		infos := []DocumentFileInfo{}
+
+		for {
+			file, err := filter.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("LookAhead=%d: Next: %s", opt.LookAhead, err)
+			}
+
+			data, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatalf("LookAhead=%d: Read: %s", opt.LookAhead, err)
+			}
+
+			info := file.(DocumentFileWithInfo).Info()
+			info.Length = 0
+
+			output = append(output, data)
+			infos = append(infos, info)
+		}
+
+		return output, infos
+	}
+
+	expected, expectedInfos := scan(opt)
+	if len(expected) != len(pages) {
+		t.Fatalf("sequential: %d pages, expected %d",
+			len(expected), len(pages))
+	}
+
+	// Look-ahead must produce the same pages in the same order,
+	// regardless of the memory budget.
+	for _, budget := range []int{0, 1} {
+		for _, lookahead := range []int{1, 3, 10} {
+			opt.LookAhead = lookahead
+			opt.LookAheadMemory = budget
+
+			output, infos := scan(opt)
+
+			if diff := testutils.Diff(infos, expectedInfos); diff != "" {
+				t.Errorf("LookAhead=%d, LookAheadMemory=%d: Info:\n%s",
+					lookahead, budget, diff)
+			}
+
+			if len(output) != len(expected) {
+				t.Errorf("LookAhead=%d, LookAheadMemory=%d: "+
+					"%d pages, expected %d",
+					lookahead, budget,
+					len(output), len(expected))
+				continue
+			}
+
+			for i := range output {
+				if !bytes.Equal(output[i], expected[i]) {
+					t.Errorf("LookAhead=%d, LookAheadMemory=%d: "+
+						"page %d differs",
+						lookahead, budget, i+1)
+				}
+			}
+		}
+	}
+
+	// Decoded images are charged to the memory budget. With
+	// the budget of one decoded page, at most two pages are
+	// processed at once.
+	decoded := 100 * 75 * 4
+	opt.LookAhead = 10
+	opt.LookAheadMemory = decoded
+	filter := NewFilter(NewVirtualDocument(res, pages...), opt)
+	if _, err := filter.Next(); err != nil {
+		t.Fatalf("LookAheadMemory: Next: %s", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	la := filter.lookahead
+	la.lock.Lock()
+	pending := la.pending
+	la.lock.Unlock()
+
+	if pending > 2 {
+		t.Errorf("LookAheadMemory: %d pages pending, expected <= 2",
+			pending)
+	}
+
+	filter.Close()
+
+	spool := &filterSpooledFile{Reader: bytes.NewReader(pages[0])}
+	if size := la.decodedSize(spool); size != decoded {
+		t.Errorf("decodedSize: %d, expected %d", size, decoded)
+	}
+
+	// Blank page removal with look-ahead
+	img := image.NewGray(image.Rect(0, 0, 100, 75))
+	for i := range img.Pix {
+		img.Pix[i] = 250
+	}
+
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	blank := buf.Bytes()
+
+	filter = NewFilter(NewVirtualDocument(res, blank, pages[0], blank),
+		FilterOptions{
+			OutputFormat: imgconv.MIMETypePNG,
+			BlankPage:    BlankPageRemove,
+			LookAhead:    2,
+		})
+
+	file, err := filter.Next()
+	if err != nil {
+		t.Fatalf("BlankPageRemove: Next: %s", err)
+	}
+
+	if page := file.(DocumentFileWithInfo).Info().Page; page != 2 {
+		t.Errorf("BlankPageRemove: page %d returned, expected 2", page)
+	}
+
+	_, err = filter.Next()
+	if err != io.EOF {
+		t.Errorf("BlankPageRemove: Next: %v, expected %v", err, io.EOF)
+	}
+
+	filter.Close()
+
+	// Close in the middle of the document
+	opt.LookAhead = 2
+	opt.LookAheadMemory = 0
+	filter = NewFilter(NewVirtualDocument(res, pages...), opt)
+
+	file, err = filter.Next()
+	if err != nil {
+		t.Fatalf("Close: Next: %s", err)
+	}
+
+	filter.Close()
+
+	_, err = io.ReadAll(file)
+	if err != ErrDocumentClosed {
+		t.Errorf("Close: Read: %v, expected %v", err, ErrDocumentClosed)
+	}
+
+	_, err = filter.Next()
+	if err == nil {
+		t.Errorf("Close: Next succeeded after Close")
+	}
+}
+
+// testBrokenDocument wraps the Document. Reading of its file
+// with the specified number fails.
+type testBrokenDocument struct {
+	Document     // Underlying document
+	broken   int // Number of the broken file, 1-based
+	count    int // Count of returned files
+}
+
+// testBrokenFile is the broken DocumentFile of the testBrokenDocument.
+type testBrokenFile struct {
+	DocumentFile
+}
+
+var errTestBrokenFile = errors.New("broken file")
+
+func (doc *testBrokenDocument) Next() (DocumentFile, error) {
+	file, err := doc.Document.Next()
+	if err == nil {
+		doc.count++
+		if doc.count == doc.broken {
+			file = testBrokenFile{file}
+		}
+	}
+	return file, err
+}
+
+func (testBrokenFile) Read([]byte) (int, error) {
+	return 0, errTestBrokenFile
+}
+
+// TestFilterBrokenFile tests that the broken input file is reported,
+// but doesn't terminate the Document, with and without look-ahead
+func TestFilterBrokenFile(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	pages := [][]byte{
+		testutils.Images.PNG100x75rgb8,
+		testutils.Images.PNG100x75rgb8,
+		testutils.Images.PNG100x75rgb8,
+	}
+
+	for _, lookahead := range []int{0, 2} {
+		doc := &testBrokenDocument{
+			Document: NewVirtualDocument(res, pages...),
+			broken:   2,
+		}
+
+		filter := NewFilter(doc, FilterOptions{
+			OutputFormat: imgconv.MIMETypePNG,
+			LookAhead:    lookahead,
+		})
+
+		var results []error
+		for i := 0; i < len(pages)+1; i++ {
+			file, err := filter.Next()
+			if err == nil {
+				_, err = io.ReadAll(file)
+			}
+			results = append(results, err)
+		}
+
+		filter.Close()
+
+		// Error of the broken file may come from the image
+		// decoder, so only its presence is checked
+		if results[0] != nil || results[1] == nil ||
+			results[2] != nil || results[3] != io.EOF {
+			t.Errorf("LookAhead=%d: unexpected results: %v",
+				lookahead, results)
+		}
+	}
+}
+
+// TestFilterMeta tests propagation of resolution and ICC profile
+// into the Filter output
+func TestFilterMeta(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+
+	// Create the input image with ICC profile
+	buf := &bytes.Buffer{}
+	encoder, err := imgconv.NewPNGWriterMeta(buf, 100, 75, color.RGBAModel,
+		imgconv.ImageMeta{ICCProfile: imgconv.ICCProfileSRGB()})
+	if err != nil {
+		t.Fatalf("NewPNGWriterMeta: %s", err)
+	}
+	encoder.Close()
+
+	page := buf.Bytes()
+
+	type testData struct {
+		opt FilterOptions // Filter options
+		icc bool          // ICC profile expected
+	}
+
+	tests := []testData{
+		{
+			opt: FilterOptions{OutputFormat: imgconv.MIMETypePNG},
+			icc: true,
+		},
+		{
+			opt: FilterOptions{
+				OutputFormat: imgconv.MIMETypeJPEG,
+				Res:          Resolution{XResolution: 150, YResolution: 150},
+			},
+			icc: true,
+		},
+		{
+			opt: FilterOptions{
+				OutputFormat: imgconv.MIMETypePNG,
+				Rotation:     Rotation90,
+				Res:          Resolution{XResolution: 150, YResolution: 75},
+			},
+			icc: true,
+		},
+		{
+			opt: FilterOptions{
+				OutputFormat: imgconv.MIMETypeJPEG,
+				Mode:         ColorModeMono,
+			},
+			icc: false,
+		},
+	}
+
+	for _, test := range tests {
+		filter := NewFilter(NewVirtualDocument(res, page), test.opt)
+		file, err := filter.Next()
+		if err != nil {
+			t.Errorf("%s: Next: %s", test.opt.OutputFormat, err)
+			filter.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(file)
+		expected := filter.Resolution()
+		filter.Close()
+
+		if err != nil {
+			t.Errorf("%s: Read: %s", test.opt.OutputFormat, err)
+			continue
+		}
+
+		reader, err := imgconv.NewDetectReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: decode: %s", test.opt.OutputFormat, err)
+			continue
+		}
+
+		meta := reader.(imgconv.Decoder).Meta()
+		reader.Close()
+
+		if meta.XResolution != expected.XResolution ||
+			meta.YResolution != expected.YResolution {
+			t.Errorf("%s: resolution: expected %dx%d, present %dx%d",
+				test.opt.OutputFormat,
+				expected.XResolution, expected.YResolution,
+				meta.XResolution, meta.YResolution)
+		}
+
+		if (meta.ICCProfile != nil) != test.icc {
+			t.Errorf("%s, %s: ICC profile expected: %v",
+				test.opt.OutputFormat, test.opt.Mode, test.icc)
+		}
+	}
+
+	// The mismatched ICC profile must be dropped. Here the RGB
+	// JPEG image gets the CMYK profile, embedded as APP2 marker.
+	cmyk := imgconv.ICCProfileSRGB()
+	copy(cmyk[16:20], "CMYK")
+
+	app2 := []byte{0xff, 0xe2, 0, 0}
+	binary.BigEndian.PutUint16(app2[2:], uint16(2+12+2+len(cmyk)))
+	app2 = append(app2, "ICC_PROFILE\x00\x01\x01"...)
+	app2 = append(app2, cmyk...)
+
+	jpeg := testutils.Images.JPEG100x75rgb8
+	page = append([]byte{}, jpeg[:2]...)
+	page = append(page, app2...)
+	page = append(page, jpeg[2:]...)
+
+	for _, format := range []string{imgconv.MIMETypePNG,
+		imgconv.MIMETypeJPEG} {
+
+		filter := NewFilter(NewVirtualDocument(res, page),
+			FilterOptions{OutputFormat: format, Brightness: 0.1})
+
+		file, err := filter.Next()
+		if err == nil {
+			_, err = io.ReadAll(file)
+		}
+		filter.Close()
+
+		if err != nil {
+			t.Errorf("%s: CMYK profile: %s", format, err)
+		}
+	}
+}
+
+// TestFilterAuto tests automatic color mode and levels detection
+// by the Filter
+func TestFilterAuto(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+
+	// Create low-contrast RGB image without color
+	img := image.NewRGBA(image.Rect(0, 0, 100, 75))
+	for y := 0; y < 75; y++ {
+		for x := 0; x < 100; x++ {
+			v := uint8(64 + x*127/99)
+			img.SetRGBA(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	gray := buf.Bytes()
+	colorful := testutils.Images.PNG100x75rgb8
+
+	type testData struct {
+		name  string        // Test name
+		page  []byte        // Input image
+		opt   FilterOptions // Filter options
+		mode  ColorMode     // Expected color mode
+		black uint8         // Expected left column luminance
+		white uint8         // Expected right column luminance
+	}
+
+	tests := []testData{
+		{
+			name:  "gray, AutoColorMode",
+			page:  gray,
+			opt:   FilterOptions{AutoColorMode: true},
+			mode:  ColorModeMono,
+			black: 64,
+			white: 191,
+		},
+		{
+			name: "colorful, AutoColorMode",
+			page: colorful,
+			opt:  FilterOptions{AutoColorMode: true},
+			mode: ColorModeColor,
+		},
+		{
+			name: "gray, AutoColorMode, Binary",
+			page: gray,
+			opt: FilterOptions{
+				AutoColorMode: true,
+				Mode:          ColorModeBinary,
+			},
+			mode:  ColorModeBinary,
+			black: 0,
+			white: 255,
+		},
+		{
+			name:  "gray, AutoLevels",
+			page:  gray,
+			opt:   FilterOptions{AutoLevels: true},
+			mode:  ColorModeColor,
+			black: 0,
+			white: 255,
+		},
+		{
+			name: "gray, AutoColorMode, AutoLevels",
+			page: gray,
+			opt: FilterOptions{
+				AutoColorMode: true,
+				AutoLevels:    true,
+			},
+			mode:  ColorModeMono,
+			black: 0,
+			white: 255,
+		},
+	}
+
+	for _, test := range tests {
+		test.opt.OutputFormat = imgconv.MIMETypePNG
+		filter := NewFilter(NewVirtualDocument(res, test.page), test.opt)
+
+		file, err := filter.Next()
+		if err != nil {
+			t.Errorf("%s: Next: %s", test.name, err)
+			filter.Close()
+			continue
+		}
+
+		info := file.(DocumentFileWithInfo).Info()
+		data, err := io.ReadAll(file)
+		filter.Close()
+
+		if err != nil {
+			t.Errorf("%s: Read: %s", test.name, err)
+			continue
+		}
+
+		if info.ColorMode != test.mode {
+			t.Errorf("%s: ColorMode: expected %s, present %s",
+				test.name, test.mode, info.ColorMode)
+		}
+
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: png.Decode: %s", test.name, err)
+			continue
+		}
+
+		// Zero white means, range is not checked
+		if test.white == 0 {
+			continue
+		}
+
+		// Check the luminance range. Small deviation is
+		// acceptable, as AutoLevels ignores the extreme pixels.
+		lum := func(x int) int {
+			c := color.GrayModel.Convert(decoded.At(x, 37))
+			return int(c.(color.Gray).Y)
+		}
+
+		if d := lum(0) - int(test.black); d < -8 || d > 8 {
+			t.Errorf("%s: black: expected %d, present %d",
+				test.name, test.black, lum(0))
+		}
+
+		if d := lum(99) - int(test.white); d < -8 || d > 8 {
+			t.Errorf("%s: white: expected %d, present %d",
+				test.name, test.white, lum(99))
+		}
+	}
+}
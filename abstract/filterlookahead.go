@@ -0,0 +1,347 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Filter look-ahead processing
+
+package abstract
+
+import (
+	"bytes"
+	"image/color"
+	"io"
+	"sync"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+)
+
+// DefaultLookAheadMemory is the default memory budget of the
+// [Filter] look-ahead processing. See [FilterOptions] for details.
+const DefaultLookAheadMemory = 128 * 1024 * 1024
+
+// filterLookAhead processes pages of the [Filter] ahead of the
+// page being read by the client, on the background goroutines.
+//
+// The dispatcher goroutine reads input files into memory, one
+// by one, and starts the worker goroutine for each of them.
+// Workers run the filtering pipeline to the end, buffering the
+// output. Pages are queued in order of the input Document, so
+// the order is preserved regardless of what worker finishes first.
+type filterLookAhead struct {
+	filter  *Filter          // Back link to the Filter
+	queue   chan *filterPage // Pages in order of the input Document
+	current *filterPage      // Page being read by the client
+	err     error            // Input error, valid when queue is closed
+	budget  int              // Memory budget, bytes
+	used    int              // Memory in use, bytes
+	pending int              // Count of pages holding the memory
+	closed  bool             // Filter.Close is called
+	closing chan struct{}    // Closed by the Filter.Close
+	cond    *sync.Cond       // Signaled when memory is released
+	lock    sync.Mutex       // Access lock
+	wait    sync.WaitGroup   // Wait for goroutines termination
+}
+
+// filterPage is the page, processed by the filterLookAhead.
+type filterPage struct {
+	file    *filterDocumentFile // Processed file, nil on error
+	err     error               // Processing error
+	size    int                 // Memory held by the page, bytes
+	decoded int                 // Decoded image size, while processed
+	done    chan struct{}       // Closed when page is processed
+}
+
+// filterSpooledFile is the input [DocumentFile], read into memory.
+//
+// Reading the next input file implicitly closes the previous one,
+// so files are read completely before being processed, and their
+// Format and Info are saved.
+type filterSpooledFile struct {
+	*bytes.Reader                  // File content
+	format        string           // File format
+	info          DocumentFileInfo // File metadata
+}
+
+// newFilterLookAhead creates the new filterLookAhead and starts
+// the dispatcher goroutine.
+func newFilterLookAhead(filter *Filter) *filterLookAhead {
+	la := &filterLookAhead{
+		filter:  filter,
+		queue:   make(chan *filterPage, filter.opt.LookAhead),
+		budget:  filter.opt.LookAheadMemory,
+		closing: make(chan struct{}),
+	}
+
+	if la.budget <= 0 {
+		la.budget = DefaultLookAheadMemory
+	}
+
+	la.cond = sync.NewCond(&la.lock)
+
+	la.wait.Add(1)
+	go la.dispatch()
+
+	return la
+}
+
+// next returns the next processed file.
+//
+// The previously returned file is expected to be closed by
+// the caller and its memory is released.
+func (la *filterLookAhead) next() (*filterDocumentFile, error) {
+	if la.current != nil {
+		la.release(la.current)
+		la.current = nil
+	}
+
+	page, ok := <-la.queue
+	if !ok {
+		return nil, la.err
+	}
+
+	<-page.done
+	if page.err != nil {
+		// Like with the sequential processing, the broken
+		// page is reported but doesn't terminate the Document.
+		la.release(page)
+		return nil, page.err
+	}
+
+	la.current = page
+	return page.file, nil
+}
+
+// stop cancels the look-ahead processing. Workers abandon the
+// pages being processed, the dispatcher stops reading the input.
+//
+// As the dispatcher may be blocked on reading the input, the
+// input Document needs to be closed after calling stop and
+// before calling finish.
+func (la *filterLookAhead) stop() {
+	la.lock.Lock()
+	if !la.closed {
+		la.closed = true
+		close(la.closing)
+		la.cond.Broadcast()
+	}
+	la.lock.Unlock()
+}
+
+// finish waits for all goroutines to terminate and closes
+// the pages that remain queued.
+func (la *filterLookAhead) finish() {
+	la.wait.Wait()
+
+	for page := range la.queue {
+		<-page.done
+		if page.file != nil {
+			page.file.close()
+		}
+	}
+}
+
+// dispatch reads the input files and starts the workers.
+// It runs on its own goroutine.
+func (la *filterLookAhead) dispatch() {
+	defer la.wait.Done()
+	defer close(la.queue)
+
+	for pagenum := 1; ; pagenum++ {
+		page := &filterPage{done: make(chan struct{})}
+		if !la.reserve(page) {
+			la.err = ErrDocumentClosed
+			return
+		}
+
+		// Get the next input file. Input errors terminate
+		// the Document.
+		input, err := la.filter.input.Next()
+		if err != nil {
+			la.err = err
+			return
+		}
+
+		// Read the file. Like with the sequential processing,
+		// read error breaks only this page.
+		spool, err := la.spool(input)
+		if err != nil {
+			page.err = err
+			close(page.done)
+			if !la.enqueue(page) {
+				return
+			}
+			continue
+		}
+
+		// Charge the input data and the decoded image, as
+		// the filtering pipeline may hold the whole image
+		// in memory while page is being processed.
+		page.decoded = la.decodedSize(spool)
+		la.charge(page, spool.Len()+page.decoded)
+
+		// Queue the page and start the worker.
+		if !la.enqueue(page) {
+			return
+		}
+
+		la.wait.Add(1)
+		go la.process(page, spool, pagenum)
+	}
+}
+
+// enqueue adds the page to the queue. Queue capacity limits the
+// count of pages being processed ahead.
+//
+// It returns false, if Filter is closed meanwhile.
+func (la *filterLookAhead) enqueue(page *filterPage) bool {
+	select {
+	case la.queue <- page:
+		return true
+	case <-la.closing:
+		la.err = ErrDocumentClosed
+		return false
+	}
+}
+
+// spool reads the input file into memory.
+func (la *filterLookAhead) spool(input DocumentFile) (
+	*filterSpooledFile, error) {
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	spool := &filterSpooledFile{
+		Reader: bytes.NewReader(data),
+		format: input.Format(),
+	}
+
+	if in, ok := input.(DocumentFileWithInfo); ok {
+		spool.info = in.Info()
+	}
+
+	return spool, nil
+}
+
+// process runs the filtering pipeline for the page to the end.
+// It runs on its own goroutine.
+func (la *filterLookAhead) process(page *filterPage,
+	spool *filterSpooledFile, pagenum int) {
+
+	defer la.wait.Done()
+	defer close(page.done)
+
+	file, err := la.filter.open(spool, spool, pagenum)
+	if err != nil {
+		page.err = err
+		return
+	}
+
+	for file.err == nil {
+		select {
+		case <-la.closing:
+			file.err = ErrDocumentClosed
+		default:
+			file.step()
+		}
+	}
+
+	if file.err == io.EOF {
+		file.info.Length = file.output.Len()
+	}
+
+	// Decoded image is not needed anymore, output is buffered
+	la.charge(page, file.output.Len()-page.decoded)
+	page.file = file
+}
+
+// decodedSize estimates the memory, needed to hold the whole
+// decoded image of the spooled file, scaled to the requested
+// resolution, if upscaling is needed.
+func (la *filterLookAhead) decodedSize(spool *filterSpooledFile) int {
+	defer spool.Seek(0, io.SeekStart)
+
+	reader, err := imgconv.NewDetectReader(spool)
+	if err != nil {
+		return 0
+	}
+	defer reader.Close()
+
+	wid, hei := reader.Size()
+
+	bpp := 4
+	switch reader.ColorModel() {
+	case imgconv.BilevelModel, color.GrayModel:
+		bpp = 1
+	case color.Gray16Model:
+		bpp = 2
+	case color.RGBA64Model:
+		bpp = 8
+	}
+
+	size := int64(wid) * int64(hei) * int64(bpp)
+
+	res := la.filter.input.Resolution()
+	opt := la.filter.opt.Res
+	if !opt.IsZero() && !res.IsZero() {
+		scale := float64(opt.XResolution*opt.YResolution) /
+			float64(res.XResolution*res.YResolution)
+		if scale > 1 {
+			size = int64(float64(size) * scale)
+		}
+	}
+
+	return int(size)
+}
+
+// reserve waits until memory budget allows to process the
+// next page. Budget may be exceeded by a single page, so
+// at least one page is always processed.
+//
+// It returns false, if Filter is closed while waiting.
+func (la *filterLookAhead) reserve(page *filterPage) bool {
+	la.lock.Lock()
+	defer la.lock.Unlock()
+
+	for !la.closed && la.pending != 0 && la.used >= la.budget {
+		la.cond.Wait()
+	}
+
+	if la.closed {
+		return false
+	}
+
+	la.pending++
+	return true
+}
+
+// charge accounts the memory, used by the page.
+func (la *filterLookAhead) charge(page *filterPage, size int) {
+	la.lock.Lock()
+	page.size += size
+	la.used += size
+	la.lock.Unlock()
+}
+
+// release releases the memory, used by the page.
+func (la *filterLookAhead) release(page *filterPage) {
+	la.lock.Lock()
+	la.used -= page.size
+	la.pending--
+	page.size = 0
+	la.cond.Broadcast()
+	la.lock.Unlock()
+}
+
+// Format returns the MIME type of the file.
+func (spool *filterSpooledFile) Format() string {
+	return spool.format
+}
+
+// Info returns the file metadata.
+func (spool *filterSpooledFile) Info() DocumentFileInfo {
+	return spool.info
+}
@@ -0,0 +1,196 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Multi-page PDF document
+
+package abstract
+
+import (
+	"bytes"
+	"image/color"
+	"io"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+)
+
+// pdfDocument implements the [Document] interface, that combines
+// all files of the input Document into the single PDF file.
+type pdfDocument struct {
+	input    Document         // Input document
+	file     *pdfDocumentFile // Output file, nil if not created yet
+	consumed bool             // Output file already returned
+}
+
+// pdfDocumentFile represents the [DocumentFile] of the pdfDocument.
+type pdfDocumentFile struct {
+	doc      *pdfDocument               // Back link to the pdfDocument
+	output   *bytes.Buffer              // Output stream buffer
+	pdf      *imgconv.PDFDocumentWriter // PDF writer
+	pipeline imgconv.Reader             // Current page decoder, if any
+	page     imgconv.Writer             // Current page writer, if any
+	row      imgconv.Row                // Temporary Row for encoding
+	err      error                      // Sticky error
+}
+
+// NewPDFDocument creates a new [Document] that combines all
+// [DocumentFile]s of the input Document into a single multi-page
+// PDF file, one page per input image.
+//
+// JPEG images are embedded into the PDF as is, other formats
+// are decoded and re-compressed without loss of quality.
+//
+// The PDF is generated on the fly, as the output file is being
+// read, so memory consumption doesn't depend on the number of pages.
+//
+// Closing the returned Document closes the input Document.
+func NewPDFDocument(input Document) Document {
+	return &pdfDocument{input: input}
+}
+
+// Resolution returns the document's rendering resolution in DPI
+// (dots per inch).
+func (doc *pdfDocument) Resolution() Resolution {
+	return doc.input.Resolution()
+}
+
+// Next returns the next [DocumentFile].
+//
+// pdfDocument always contains the single file. The subsequent
+// calls to Next return [io.EOF].
+func (doc *pdfDocument) Next() (DocumentFile, error) {
+	if doc.consumed {
+		doc.closeFile()
+		return nil, io.EOF
+	}
+
+	doc.consumed = true
+
+	output := &bytes.Buffer{}
+	doc.file = &pdfDocumentFile{
+		doc:    doc,
+		output: output,
+		pdf:    imgconv.NewPDFDocumentWriter(output),
+	}
+
+	return doc.file, nil
+}
+
+// Close closes the Document. It implicitly closes the current
+// image being read.
+func (doc *pdfDocument) Close() error {
+	doc.closeFile()
+	return doc.input.Close()
+}
+
+// closeFile closes the output file, if it is opened.
+func (doc *pdfDocument) closeFile() {
+	if doc.file != nil {
+		doc.file.closePage()
+		doc.file = nil
+	}
+}
+
+// Format returns the MIME type of the image format used by
+// the document file.
+func (file *pdfDocumentFile) Format() string {
+	return imgconv.MIMETypePDF
+}
+
+// Read reads the document file content as a sequence of bytes.
+// It implements the [io.Reader] interface.
+func (file *pdfDocumentFile) Read(buf []byte) (int, error) {
+	// Generate PDF until we have some output data
+	for file.output.Len() == 0 && file.err == nil {
+		// Don't let buffer to grow indefinitely
+		file.output.Reset()
+		file.err = file.step()
+	}
+
+	// Return buffered data
+	if file.output.Len() != 0 {
+		return file.output.Read(buf)
+	}
+
+	return 0, file.err
+}
+
+// step performs the next step of PDF generation. It either
+// encodes the next image row or starts the next page.
+//
+// When all pages are written, it writes the PDF trailer and
+// returns [io.EOF].
+func (file *pdfDocumentFile) step() error {
+	// Encode the next row of the current page
+	if file.pipeline != nil {
+		_, err := file.pipeline.Read(file.row)
+		switch err {
+		case nil:
+			return file.page.Write(file.row)
+		case io.EOF:
+			err = file.page.Close()
+		}
+
+		file.closePage()
+		return err
+	}
+
+	// Start the next page
+	input, err := file.doc.input.Next()
+	if err == io.EOF {
+		err = file.pdf.Close()
+		if err == nil {
+			err = io.EOF
+		}
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	res := file.doc.input.Resolution()
+
+	if input.Format() == imgconv.MIMETypeJPEG {
+		return file.pdf.WriteJPEG(input,
+			res.XResolution, res.YResolution)
+	}
+
+	pipeline, err := imgconv.NewDetectReader(input)
+	if err != nil {
+		return err
+	}
+
+	switch pipeline.ColorModel() {
+	case imgconv.BilevelModel,
+		color.GrayModel, color.Gray16Model,
+		color.RGBAModel, color.RGBA64Model:
+	default:
+		pipeline = imgconv.NewColorModelFilter(pipeline,
+			color.RGBAModel)
+	}
+
+	wid, hei := pipeline.Size()
+	file.page, err = file.pdf.NewPage(wid, hei, pipeline.ColorModel(),
+		res.XResolution, res.YResolution)
+	if err != nil {
+		pipeline.Close()
+		return err
+	}
+
+	file.pipeline = pipeline
+	file.row = pipeline.NewRow()
+
+	return nil
+}
+
+// closePage closes the current page decoder, if any.
+func (file *pdfDocumentFile) closePage() {
+	if file.pipeline != nil {
+		file.pipeline.Close()
+		file.pipeline = nil
+		file.page = nil
+	}
+}
@@ -0,0 +1,110 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Multi-page PDF document test
+
+package abstract
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestPDFDocument tests NewPDFDocument
+func TestPDFDocument(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	input := NewVirtualDocument(res,
+		testutils.Images.JPEG100x75rgb8,
+		testutils.Images.PNG100x75rgb8,
+		testutils.Images.PNG100x75gray16,
+	)
+
+	doc := NewPDFDocument(input)
+	defer doc.Close()
+
+	if doc.Resolution() != res {
+		t.Errorf("Resolution: expected %v, present %v",
+			res, doc.Resolution())
+	}
+
+	file, err := doc.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	if file.Format() != imgconv.MIMETypePDF {
+		t.Errorf("Format: expected %q, present %q",
+			imgconv.MIMETypePDF, file.Format())
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+
+	if imgconv.MIMETypeDetect(data) != imgconv.MIMETypePDF {
+		t.Errorf("output is not PDF")
+	}
+
+	// Check page count and page size (100x75 pixels at 300 DPI)
+	m := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(data)
+	if m == nil || string(m[1]) != "3" {
+		t.Errorf("page count: expected 3, present %q", m)
+	}
+
+	if n := bytes.Count(data, []byte("/MediaBox [0 0 24 18]")); n != 3 {
+		t.Errorf("MediaBox: expected 3 pages of 24x18 pt, present %d", n)
+	}
+
+	// JPEG must be embedded as is
+	if !bytes.Contains(data, testutils.Images.JPEG100x75rgb8) {
+		t.Errorf("JPEG image is not passed as is")
+	}
+
+	// Document contains the single file
+	_, err = doc.Next()
+	if err != io.EOF {
+		t.Errorf("Next: expected io.EOF, present %v", err)
+	}
+}
+
+// TestFilterPDF tests PDF output of the Filter
+func TestFilterPDF(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	doc := NewVirtualDocument(res, testutils.Images.PNG100x75rgb8)
+
+	opt := FilterOptions{
+		OutputFormat: imgconv.MIMETypePDF,
+		Mode:         ColorModeBinary,
+	}
+
+	filter := NewFilter(doc, opt)
+	defer filter.Close()
+
+	file, err := filter.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+
+	if imgconv.MIMETypeDetect(data) != imgconv.MIMETypePDF {
+		t.Errorf("output is not PDF")
+	}
+
+	// Binary mode must produce 1-bit image
+	if !bytes.Contains(data, []byte("/BitsPerComponent 1 ")) {
+		t.Errorf("PDF: 1-bit image expected")
+	}
+}
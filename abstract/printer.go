@@ -8,7 +8,10 @@
 
 package abstract
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 // PrinterRequest contains protocol-independent parameters of a
 // print job, as negotiated between the client and the printer.
@@ -40,14 +43,14 @@ type PrinterRequest struct {
 	Media MediaSize
 }
 
-// Printer is the protocol-independent interface for receiving
-// print jobs from the virtual printer.
+// Printer is the protocol-independent, job-oriented interface for
+// receiving print jobs from the virtual printer.
 //
 // It is the printing analogue of [Scanner] for the scanning side.
 // Implementations are called by the protocol layer (IPP, IEEE 1284)
 // when a print job is ready to be processed.
 type Printer interface {
-	// PrintDocument is called when a new print document arrives.
+	// Submit submits a new print job.
 	//
 	// params contains the negotiated job parameters extracted from
 	// the protocol layer (IPP job attributes, PJL commands, etc.).
@@ -55,5 +58,33 @@ type Printer interface {
 	// body provides streaming access to the document data.
 	// The implementation must fully consume body before returning.
 	// body is valid only for the duration of this call.
-	PrintDocument(params PrinterRequest, body io.Reader) error
+	//
+	// Job processing may continue after Submit returns. Its progress
+	// and the final result are reported via the returned [PrintJob].
+	//
+	// Job processing can be canceled via provided [context.Context].
+	// The entire job lifetime is covered by this context.
+	Submit(ctx context.Context, params PrinterRequest,
+		body io.Reader) (PrintJob, error)
+}
+
+// PrintDocumentFunc adapts the ordinary function to the [Printer]
+// interface.
+//
+// The function is called synchronously by [Printer.Submit]. It
+// must fully consume body before returning. Its return value
+// becomes the result of the job, which is finished when Submit
+// returns.
+type PrintDocumentFunc func(ctx context.Context, params PrinterRequest,
+	body io.Reader) error
+
+// Submit calls the function and returns the finished [PrintJob].
+// It implements the [Printer] interface.
+func (f PrintDocumentFunc) Submit(ctx context.Context,
+	params PrinterRequest, body io.Reader) (PrintJob, error) {
+
+	tracker := NewPrintJobTracker(ctx)
+	tracker.SetProcessing()
+	tracker.Finish(f(tracker.Context(), params, body))
+	return tracker, nil
 }
@@ -0,0 +1,290 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2026 Mohammad Arman (officialmdarman@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// The print job
+
+package abstract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// PrintJob represents the print job, submitted to the [Printer].
+type PrintJob interface {
+	// Status returns the current job status.
+	Status() PrintJobStatus
+
+	// Done returns a channel that is closed when the job is
+	// finished (completed, canceled or aborted).
+	Done() <-chan struct{}
+
+	// Cancel requests the job cancellation. It doesn't wait for
+	// the job to be actually canceled; use Done for that.
+	Cancel()
+}
+
+// PrintJobStatus represents the current status of the [PrintJob].
+type PrintJobStatus struct {
+	State                PrintJobState                       // Job state
+	Reasons              generic.Bitset[PrintJobStateReason] // State reasons
+	ImpressionsCompleted int                                 // Printed impressions
+	MediaSheetsCompleted int                                 // Printed sheets
+	Err                  error                               // Error, if aborted
+}
+
+// PrintJobState represents the state of the [PrintJob].
+type PrintJobState int
+
+// Known job states:
+const (
+	PrintJobPending    PrintJobState = iota // Waiting for processing
+	PrintJobProcessing                      // Being processed
+	PrintJobCompleted                       // Completed successfully
+	PrintJobCanceled                        // Canceled
+	PrintJobAborted                         // Aborted due to error
+	printJobStateMax
+)
+
+// Finished reports whether the state is final (completed, canceled
+// or aborted).
+func (state PrintJobState) Finished() bool {
+	return state >= PrintJobCompleted && state < printJobStateMax
+}
+
+// String returns the string representation of [PrintJobState],
+// for logging.
+func (state PrintJobState) String() string {
+	switch state {
+	case PrintJobPending:
+		return "Pending"
+	case PrintJobProcessing:
+		return "Processing"
+	case PrintJobCompleted:
+		return "Completed"
+	case PrintJobCanceled:
+		return "Canceled"
+	case PrintJobAborted:
+		return "Aborted"
+	}
+	return fmt.Sprintf("Unknown (%d)", int(state))
+}
+
+// PrintJobStateReason provides additional information about
+// the [PrintJobState].
+type PrintJobStateReason int
+
+// Known job state reasons:
+const (
+	PrintJobReasonIncoming                  PrintJobStateReason = iota // Receiving data
+	PrintJobReasonPrinting                                             // Printing
+	PrintJobReasonProcessingToStopPoint                                // Being canceled
+	PrintJobReasonCanceledByUser                                       // Canceled
+	PrintJobReasonAbortedBySystem                                      // Aborted
+	PrintJobReasonCompletedSuccessfully                                // Completed
+	PrintJobReasonDocumentFormatError                                  // Bad document
+	PrintJobReasonUnsupportedDocumentFormat                            // Bad format
+	printJobStateReasonMax
+)
+
+// String returns the string representation of [PrintJobStateReason],
+// for logging.
+func (reason PrintJobStateReason) String() string {
+	switch reason {
+	case PrintJobReasonIncoming:
+		return "Incoming"
+	case PrintJobReasonPrinting:
+		return "Printing"
+	case PrintJobReasonProcessingToStopPoint:
+		return "ProcessingToStopPoint"
+	case PrintJobReasonCanceledByUser:
+		return "CanceledByUser"
+	case PrintJobReasonAbortedBySystem:
+		return "AbortedBySystem"
+	case PrintJobReasonCompletedSuccessfully:
+		return "CompletedSuccessfully"
+	case PrintJobReasonDocumentFormatError:
+		return "DocumentFormatError"
+	case PrintJobReasonUnsupportedDocumentFormat:
+		return "UnsupportedDocumentFormat"
+	}
+	return fmt.Sprintf("Unknown (%d)", int(reason))
+}
+
+// WaitPrintJob waits until the [PrintJob] is finished and returns
+// its final status.
+//
+// If ctx is canceled or expired before the job is finished, it
+// returns the current job status and the ctx's error.
+func WaitPrintJob(ctx context.Context, job PrintJob) (PrintJobStatus, error) {
+	select {
+	case <-job.Done():
+		return job.Status(), nil
+	case <-ctx.Done():
+		return job.Status(), ctx.Err()
+	}
+}
+
+// PrintJobTracker is the ready to use implementation of the
+// [PrintJob] interface for the [Printer] implementations.
+//
+// It tracks the job status, which is updated by the Printer as
+// job processing progresses, and provides the job's context,
+// which is canceled when the job is canceled.
+//
+// The Printer must call [PrintJobTracker.Finish] when job
+// processing is finished, including the case of cancellation.
+type PrintJobTracker struct {
+	ctx    context.Context    // Job's context
+	cancel context.CancelFunc // Cancels the ctx
+	done   chan struct{}      // Closed when job is finished
+	lock   sync.Mutex         // Access lock
+	status PrintJobStatus     // Current status
+}
+
+// NewPrintJobTracker creates a new [PrintJobTracker] in the
+// [PrintJobPending] state.
+//
+// The job's context is derived from the ctx, so canceling
+// the ctx cancels the job.
+func NewPrintJobTracker(ctx context.Context) *PrintJobTracker {
+	tracker := &PrintJobTracker{
+		done: make(chan struct{}),
+		status: PrintJobStatus{
+			State: PrintJobPending,
+		},
+	}
+
+	tracker.ctx, tracker.cancel = context.WithCancel(ctx)
+	return tracker
+}
+
+// Context returns the job's [context.Context].
+// It is canceled when the job is canceled.
+func (tracker *PrintJobTracker) Context() context.Context {
+	return tracker.ctx
+}
+
+// Status returns the current job status.
+// It implements the [PrintJob] interface.
+func (tracker *PrintJobTracker) Status() PrintJobStatus {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	return tracker.status
+}
+
+// Done returns a channel that is closed when the job is finished.
+// It implements the [PrintJob] interface.
+func (tracker *PrintJobTracker) Done() <-chan struct{} {
+	return tracker.done
+}
+
+// Cancel requests the job cancellation by canceling the job's
+// context. It implements the [PrintJob] interface.
+func (tracker *PrintJobTracker) Cancel() {
+	tracker.lock.Lock()
+	if !tracker.status.State.Finished() {
+		tracker.status.Reasons.Add(PrintJobReasonProcessingToStopPoint)
+	}
+	tracker.lock.Unlock()
+
+	tracker.cancel()
+}
+
+// SetProcessing moves the job into the [PrintJobProcessing] state.
+func (tracker *PrintJobTracker) SetProcessing() {
+	tracker.update(func(status *PrintJobStatus) {
+		status.State = PrintJobProcessing
+		status.Reasons.Add(PrintJobReasonPrinting)
+	})
+}
+
+// SetReason adds or removes the job state reason.
+func (tracker *PrintJobTracker) SetReason(reason PrintJobStateReason,
+	set bool) {
+
+	tracker.update(func(status *PrintJobStatus) {
+		if set {
+			status.Reasons.Add(reason)
+		} else {
+			status.Reasons.Del(reason)
+		}
+	})
+}
+
+// AddImpressions increments the count of completed impressions
+// and media sheets.
+func (tracker *PrintJobTracker) AddImpressions(impressions, sheets int) {
+	tracker.update(func(status *PrintJobStatus) {
+		status.ImpressionsCompleted += impressions
+		status.MediaSheetsCompleted += sheets
+	})
+}
+
+// Finish finishes the job. The final state depends on err:
+//   - nil means [PrintJobCompleted]
+//   - context.Canceled means [PrintJobCanceled]
+//   - any other error means [PrintJobAborted]
+//
+// If err wraps [ErrDocumentFormat] or [ErrUnsupportedFormat], the
+// appropriate job state reason is set.
+//
+// Calls to Finish after the first one are ignored.
+func (tracker *PrintJobTracker) Finish(err error) {
+	tracker.lock.Lock()
+
+	if tracker.status.State.Finished() {
+		tracker.lock.Unlock()
+		return
+	}
+
+	status := &tracker.status
+	status.Reasons.Del(PrintJobReasonIncoming)
+	status.Reasons.Del(PrintJobReasonPrinting)
+	status.Reasons.Del(PrintJobReasonProcessingToStopPoint)
+
+	switch {
+	case err == nil:
+		status.State = PrintJobCompleted
+		status.Reasons.Add(PrintJobReasonCompletedSuccessfully)
+
+	case errors.Is(err, context.Canceled):
+		status.State = PrintJobCanceled
+		status.Reasons.Add(PrintJobReasonCanceledByUser)
+
+	default:
+		status.State = PrintJobAborted
+		status.Err = err
+		status.Reasons.Add(PrintJobReasonAbortedBySystem)
+
+		switch {
+		case errors.Is(err, ErrDocumentFormat):
+			status.Reasons.Add(PrintJobReasonDocumentFormatError)
+		case errors.Is(err, ErrUnsupportedFormat):
+			status.Reasons.Add(PrintJobReasonUnsupportedDocumentFormat)
+		}
+	}
+
+	tracker.lock.Unlock()
+
+	close(tracker.done)
+	tracker.cancel()
+}
+
+// update updates the job status under the lock.
+// Finished jobs are not updated.
+func (tracker *PrintJobTracker) update(f func(status *PrintJobStatus)) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if !tracker.status.State.Finished() {
+		f(&tracker.status)
+	}
+}
@@ -0,0 +1,233 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2026 Mohammad Arman (officialmdarman@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// The print job test
+
+package abstract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPrintJobTrackerFinish tests mapping of errors into
+// the final job state by PrintJobTracker.Finish
+func TestPrintJobTrackerFinish(t *testing.T) {
+	type testData struct {
+		err     error                 // Finish parameter
+		state   PrintJobState         // Expected state
+		reasons []PrintJobStateReason // Expected reasons
+	}
+
+	tests := []testData{
+		{
+			err:     nil,
+			state:   PrintJobCompleted,
+			reasons: []PrintJobStateReason{PrintJobReasonCompletedSuccessfully},
+		},
+		{
+			err:     context.Canceled,
+			state:   PrintJobCanceled,
+			reasons: []PrintJobStateReason{PrintJobReasonCanceledByUser},
+		},
+		{
+			err:   errors.New("printer on fire"),
+			state: PrintJobAborted,
+			reasons: []PrintJobStateReason{
+				PrintJobReasonAbortedBySystem,
+			},
+		},
+		{
+			err:   fmt.Errorf("page 1: %w", ErrDocumentFormat),
+			state: PrintJobAborted,
+			reasons: []PrintJobStateReason{
+				PrintJobReasonAbortedBySystem,
+				PrintJobReasonDocumentFormatError,
+			},
+		},
+		{
+			err:   ErrUnsupportedFormat,
+			state: PrintJobAborted,
+			reasons: []PrintJobStateReason{
+				PrintJobReasonAbortedBySystem,
+				PrintJobReasonUnsupportedDocumentFormat,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		tracker := NewPrintJobTracker(context.Background())
+		tracker.SetProcessing()
+		tracker.AddImpressions(2, 1)
+		tracker.Finish(test.err)
+
+		select {
+		case <-tracker.Done():
+		default:
+			t.Errorf("%v: job must be done", test.err)
+		}
+
+		if tracker.Context().Err() == nil {
+			t.Errorf("%v: job context must be canceled", test.err)
+		}
+
+		status := tracker.Status()
+		if status.State != test.state {
+			t.Errorf("%v: state: expected %s, present %s",
+				test.err, test.state, status.State)
+		}
+
+		reasons := status.Reasons.Elements()
+		if !reflect.DeepEqual(reasons, test.reasons) {
+			t.Errorf("%v: reasons:\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				test.err, test.reasons, reasons)
+		}
+
+		if status.ImpressionsCompleted != 2 ||
+			status.MediaSheetsCompleted != 1 {
+			t.Errorf("%v: impressions/sheets: expected 2/1, present %d/%d",
+				test.err, status.ImpressionsCompleted,
+				status.MediaSheetsCompleted)
+		}
+
+		if test.state == PrintJobAborted && status.Err != test.err {
+			t.Errorf("%v: Err: expected %v, present %v",
+				test.err, test.err, status.Err)
+		}
+
+		// Finished job is not updated anymore
+		tracker.Finish(nil)
+		tracker.AddImpressions(1, 1)
+
+		if tracker.Status().State != test.state {
+			t.Errorf("%v: finished job state changed", test.err)
+		}
+	}
+}
+
+// TestPrintJobTrackerCancel tests the job cancellation
+func TestPrintJobTrackerCancel(t *testing.T) {
+	tracker := NewPrintJobTracker(context.Background())
+
+	status := tracker.Status()
+	if status.State != PrintJobPending {
+		t.Errorf("initial state: expected %s, present %s",
+			PrintJobPending, status.State)
+	}
+
+	tracker.SetProcessing()
+	tracker.Cancel()
+
+	status = tracker.Status()
+	if status.State != PrintJobProcessing {
+		t.Errorf("state: expected %s, present %s",
+			PrintJobProcessing, status.State)
+	}
+
+	if !status.Reasons.Contains(PrintJobReasonProcessingToStopPoint) {
+		t.Errorf("reasons: ProcessingToStopPoint missed")
+	}
+
+	// Printer sees cancellation via context
+	select {
+	case <-tracker.Context().Done():
+	default:
+		t.Fatalf("job context is not canceled")
+	}
+
+	tracker.Finish(tracker.Context().Err())
+
+	status = tracker.Status()
+	if status.State != PrintJobCanceled {
+		t.Errorf("state: expected %s, present %s",
+			PrintJobCanceled, status.State)
+	}
+
+	if status.Reasons.Contains(PrintJobReasonProcessingToStopPoint) {
+		t.Errorf("reasons: ProcessingToStopPoint not cleared")
+	}
+}
+
+// TestPrintDocumentFunc tests the PrintDocumentFunc adapter
+// and WaitPrintJob
+func TestPrintDocumentFunc(t *testing.T) {
+	var received []byte
+	var printer Printer = PrintDocumentFunc(func(ctx context.Context,
+		params PrinterRequest, body io.Reader) error {
+
+		var err error
+		received, err = io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+
+		if params.Format != "image/pwg-raster" {
+			return ErrUnsupportedFormat
+		}
+
+		return nil
+	})
+
+	ctx := context.Background()
+	params := PrinterRequest{Format: "image/pwg-raster"}
+
+	job, err := printer.Submit(ctx, params, strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("Submit: %s", err)
+	}
+
+	if string(received) != "data" {
+		t.Errorf("body: expected %q, present %q", "data", received)
+	}
+
+	status, err := WaitPrintJob(ctx, job)
+	if err != nil {
+		t.Fatalf("WaitPrintJob: %s", err)
+	}
+
+	if status.State != PrintJobCompleted {
+		t.Errorf("state: expected %s, present %s",
+			PrintJobCompleted, status.State)
+	}
+
+	// Unsupported format
+	params.Format = "application/x-unknown"
+	job, err = printer.Submit(ctx, params, strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("Submit: %s", err)
+	}
+
+	status, _ = WaitPrintJob(ctx, job)
+	if status.State != PrintJobAborted ||
+		!errors.Is(status.Err, ErrUnsupportedFormat) {
+		t.Errorf("unsupported format: present %s, %v",
+			status.State, status.Err)
+	}
+
+	// WaitPrintJob with expired context
+	tracker := NewPrintJobTracker(ctx)
+	waitctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+
+	status, err = WaitPrintJob(waitctx, tracker)
+	if err != context.DeadlineExceeded {
+		t.Errorf("WaitPrintJob: expected %v, present %v",
+			context.DeadlineExceeded, err)
+	}
+
+	if status.State != PrintJobPending {
+		t.Errorf("state: expected %s, present %s",
+			PrintJobPending, status.State)
+	}
+}
@@ -73,3 +73,42 @@ func (r Range) resolve(name string,
 
 	return param, nil
 }
+
+// relative returns the parameter value, relative to the Range.Normal
+// and scaled into the [-1.0...+1.0] range, so Normal maps to 0,
+// Min maps to -1.0 and Max maps to +1.0.
+//
+// It returns 0 (no change) if parameter is missed or Range is zero.
+func (r Range) relative(param optional.Val[int]) float64 {
+	if param == nil || r.IsZero() {
+		return 0
+	}
+
+	v := *param
+	switch {
+	case v > r.Normal && r.Max > r.Normal:
+		return float64(v-r.Normal) / float64(r.Max-r.Normal)
+	case v < r.Normal && r.Normal > r.Min:
+		return -float64(r.Normal-v) / float64(r.Normal-r.Min)
+	}
+
+	return 0
+}
+
+// absolute returns the parameter value, scaled into the [0...1.0]
+// range, so Min maps to 0 and Max maps to 1.0.
+//
+// If parameter is missed, Range.Normal is used instead. It returns
+// dflt if Range is zero or has no extent.
+func (r Range) absolute(param optional.Val[int], dflt float64) float64 {
+	if r.Max <= r.Min {
+		return dflt
+	}
+
+	v := r.Normal
+	if param != nil {
+		v = *param
+	}
+
+	return float64(v-r.Min) / float64(r.Max-r.Min)
+}
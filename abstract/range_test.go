@@ -8,7 +8,11 @@
 
 package abstract
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/util/optional"
+)
 
 // TestRangeIsZero tests Range.IsZero method
 func TestRangeIsZero(t *testing.T) {
@@ -139,3 +143,62 @@ func TestRangeWithin(t *testing.T) {
 		}
 	}
 }
+
+// TestRangeRelative tests Range.relative method
+func TestRangeRelative(t *testing.T) {
+	type testData struct {
+		rng   Range
+		param optional.Val[int]
+		rel   float64
+	}
+
+	tests := []testData{
+		{rng: Range{}, param: optional.New(5), rel: 0},
+		{rng: Range{Min: 0, Max: 100, Normal: 50}, param: nil, rel: 0},
+		{rng: Range{Min: 0, Max: 100, Normal: 50}, param: optional.New(50), rel: 0},
+		{rng: Range{Min: 0, Max: 100, Normal: 50}, param: optional.New(100), rel: 1},
+		{rng: Range{Min: 0, Max: 100, Normal: 50}, param: optional.New(0), rel: -1},
+		{rng: Range{Min: 0, Max: 100, Normal: 50}, param: optional.New(75), rel: 0.5},
+		{rng: Range{Min: 0, Max: 100, Normal: 0}, param: optional.New(25), rel: 0.25},
+		{rng: Range{Min: -10, Max: 10, Normal: 0}, param: optional.New(-5), rel: -0.5},
+	}
+
+	for _, test := range tests {
+		rel := test.rng.relative(test.param)
+
+		if rel != test.rel {
+			t.Errorf("Range%v.relative(%v):\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				test.rng, test.param, test.rel, rel)
+		}
+	}
+}
+
+// TestRangeAbsolute tests Range.absolute method
+func TestRangeAbsolute(t *testing.T) {
+	type testData struct {
+		rng   Range
+		param optional.Val[int]
+		abs   float64
+	}
+
+	tests := []testData{
+		{rng: Range{}, param: optional.New(5), abs: 0.5},
+		{rng: Range{Min: 0, Max: 255, Normal: 51}, param: nil, abs: 0.2},
+		{rng: Range{Min: 0, Max: 255, Normal: 51}, param: optional.New(0), abs: 0},
+		{rng: Range{Min: 0, Max: 255, Normal: 51}, param: optional.New(255), abs: 1},
+		{rng: Range{Min: 10, Max: 20, Normal: 15}, param: optional.New(12), abs: 0.2},
+	}
+
+	for _, test := range tests {
+		abs := test.rng.absolute(test.param, 0.5)
+
+		if abs != test.abs {
+			t.Errorf("Range%v.absolute(%v):\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				test.rng, test.param, test.abs, abs)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image resampling kernels
+
+package abstract
+
+import (
+	"fmt"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+)
+
+// Resampling specifies the kernel, used by the [Filter] to resample
+// images into the different resolution.
+type Resampling int
+
+// Resampling kernels:
+const (
+	ResamplingUnset    Resampling = iota // Not set, same as Bilinear
+	ResamplingBilinear                   // Bi-linear interpolation
+	ResamplingBox                        // Area averaging
+	ResamplingLanczos3                   // Lanczos, a=3
+	resamplingMax
+)
+
+// Valid reports if Resampling is valid
+func (rs Resampling) Valid() bool {
+	return ResamplingUnset <= rs && rs < resamplingMax
+}
+
+// String returns the string representation of the [Resampling],
+// for logging.
+func (rs Resampling) String() string {
+	switch rs {
+	case ResamplingUnset:
+		return "Unset"
+	case ResamplingBilinear:
+		return "Bilinear"
+	case ResamplingBox:
+		return "Box"
+	case ResamplingLanczos3:
+		return "Lanczos3"
+	}
+
+	return fmt.Sprintf("Unknown (%d)", int(rs))
+}
+
+// kernel returns the corresponding [imgconv.ScaleKernel].
+func (rs Resampling) kernel() imgconv.ScaleKernel {
+	switch rs {
+	case ResamplingBox:
+		return imgconv.ScaleBox
+	case ResamplingLanczos3:
+		return imgconv.ScaleLanczos3
+	}
+
+	return imgconv.ScaleBilinear
+}
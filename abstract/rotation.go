@@ -0,0 +1,54 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image rotation
+
+package abstract
+
+import "fmt"
+
+// Rotation specifies the image rotation.
+// Rotation is applied in the clockwise direction.
+type Rotation int
+
+// Rotation angles. Zero value means no rotation:
+const (
+	Rotation0   Rotation = iota // No rotation
+	Rotation90                  // 90 degrees
+	Rotation180                 // 180 degrees
+	Rotation270                 // 270 degrees
+	rotationMax
+)
+
+// Valid reports if Rotation is valid
+func (rot Rotation) Valid() bool {
+	return Rotation0 <= rot && rot < rotationMax
+}
+
+// Degrees returns the rotation angle in degrees.
+func (rot Rotation) Degrees() int {
+	if rot.Valid() {
+		return int(rot) * 90
+	}
+	return 0
+}
+
+// String returns the string representation of the [Rotation],
+// for logging.
+func (rot Rotation) String() string {
+	switch rot {
+	case Rotation0:
+		return "0"
+	case Rotation90:
+		return "90"
+	case Rotation180:
+		return "180"
+	case Rotation270:
+		return "270"
+	}
+
+	return fmt.Sprintf("Unknown (%d)", int(rot))
+}
@@ -0,0 +1,349 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Scanner arbiter: sharing one scanner between protocol frontends
+
+package abstract
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ScannerArbiter coordinates access to the single physical scanner,
+// shared between several protocol frontends (eSCL, WS-Scan, IPP
+// and so on).
+//
+// Each frontend gets its own [Scanner], returned by the
+// [ScannerArbiter.Scanner]. Only one scan job at a time is allowed
+// across all these Scanners. The job begins with the Scanner.Scan
+// call and ends, when the returned [Document] is closed, even if
+// all its files are consumed, so the next job doesn't start while
+// the previous Document is still open.
+//
+// If the scanner is in use, Scan either fails immediately with the
+// [ErrDeviceInUse] error, or, if QueueSize is not zero, waits in the
+// queue for its turn. Requests are served in the order of arrival.
+// The waiting is limited by the QueueTimeout, if set, and by the
+// request's [context.Context]. When the QueueTimeout expires,
+// Scan fails with the [ErrDeviceInUse] error.
+//
+// JobTimeout, if set, limits the job lifetime. When it expires,
+// the Document of the expired job is closed, the scanner is given
+// to the next request, and the Document fails with the
+// [ErrDocumentClosed] error. It
+// protects from clients that start a job and never finish it.
+//
+// Note, Scan blocks while waiting in the queue, so frontends must
+// not hold their own locks during the call. Otherwise, they will
+// not be able to serve status and cancel requests meanwhile.
+type ScannerArbiter struct {
+	QueueSize    int           // Max count of queued requests
+	QueueTimeout time.Duration // Max time in queue, 0 if unlimited
+	JobTimeout   time.Duration // Max job lifetime, 0 if unlimited
+
+	owner *scannerArbiterJob   // Current job, nil if idle
+	queue []*scannerArbiterJob // Queued jobs
+	lock  sync.Mutex           // Access lock
+}
+
+// ScannerArbiterStatus reports the [ScannerArbiter] status.
+type ScannerArbiterStatus struct {
+	Busy  bool     // Scanner is busy
+	Owner string   // Name of the frontend that owns the scanner
+	Queue []string // Names of frontends in the queue, in order
+}
+
+// scannerArbiterJob represents the single job (active or queued),
+// managed by the ScannerArbiter.
+type scannerArbiterJob struct {
+	name     string        // Frontend name
+	ready    chan struct{} // Closed when job becomes the owner
+	timer    *time.Timer   // JobTimeout timer, nil if none
+	expired  bool          // Job is finished by JobTimeout
+	doc      Document      // Job's Document, nil if not started yet
+	closeErr error         // Document close error
+	once     sync.Once     // Closes the Document only once
+}
+
+// scannerArbiterScanner implements the [Scanner] interface
+// for the ScannerArbiter frontends.
+type scannerArbiterScanner struct {
+	arb     *ScannerArbiter // The arbiter
+	name    string          // Frontend name
+	scanner Scanner         // Underlying scanner
+}
+
+// scannerArbiterDocument wraps the [Document] and releases the
+// scanner when the Document is done.
+type scannerArbiterDocument struct {
+	Document                    // Underlying document
+	arb      *ScannerArbiter    // The arbiter
+	job      *scannerArbiterJob // Job the document belongs to
+}
+
+// Scanner returns the [Scanner] for the frontend. All requests to
+// the returned Scanner are passed to the underlying scanner under
+// control of the ScannerArbiter.
+//
+// The name identifies the frontend in the [ScannerArbiterStatus].
+//
+// Frontends may use distinct underlying scanners (for example,
+// with different capabilities), if they represent the same
+// physical device.
+func (arb *ScannerArbiter) Scanner(name string, scanner Scanner) Scanner {
+	return &scannerArbiterScanner{
+		arb:     arb,
+		name:    name,
+		scanner: scanner,
+	}
+}
+
+// Status returns the current [ScannerArbiterStatus].
+func (arb *ScannerArbiter) Status() ScannerArbiterStatus {
+	arb.lock.Lock()
+	defer arb.lock.Unlock()
+
+	status := ScannerArbiterStatus{
+		Busy:  arb.owner != nil,
+		Queue: make([]string, len(arb.queue)),
+	}
+
+	if arb.owner != nil {
+		status.Owner = arb.owner.name
+	}
+
+	for i, job := range arb.queue {
+		status.Queue[i] = job.name
+	}
+
+	return status
+}
+
+// Position returns the 1-based position of the frontend in the queue,
+// or 0, if frontend is not in the queue.
+func (status ScannerArbiterStatus) Position(name string) int {
+	for i, n := range status.Queue {
+		if n == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// acquire acquires the scanner for the new job.
+func (arb *ScannerArbiter) acquire(ctx context.Context,
+	name string) (*scannerArbiterJob, error) {
+
+	job := &scannerArbiterJob{name: name, ready: make(chan struct{})}
+
+	arb.lock.Lock()
+	switch {
+	case arb.owner == nil:
+		arb.grant(job)
+		arb.lock.Unlock()
+		return job, nil
+
+	case len(arb.queue) >= arb.QueueSize:
+		owner := arb.owner.name
+		arb.lock.Unlock()
+		return nil, fmt.Errorf("%w: used by %s", ErrDeviceInUse, owner)
+	}
+
+	arb.queue = append(arb.queue, job)
+	arb.lock.Unlock()
+
+	// Wait for our turn
+	var timeout <-chan time.Time
+	if arb.QueueTimeout > 0 {
+		timer := time.NewTimer(arb.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-job.ready:
+		return job, nil
+	case <-timeout:
+		err = fmt.Errorf("%w: queue timeout", ErrDeviceInUse)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Leave the queue. Note, the job may become the owner
+	// while we were waiting for the lock.
+	arb.lock.Lock()
+	defer arb.lock.Unlock()
+
+	if arb.owner == job {
+		return job, nil
+	}
+
+	for i := range arb.queue {
+		if arb.queue[i] == job {
+			copy(arb.queue[i:], arb.queue[i+1:])
+			arb.queue = arb.queue[:len(arb.queue)-1]
+			break
+		}
+	}
+
+	return nil, err
+}
+
+// release releases the scanner, if it is owned by the job,
+// and passes it to the next job in the queue.
+func (arb *ScannerArbiter) release(job *scannerArbiterJob) {
+	arb.lock.Lock()
+	arb.releaseLocked(job)
+	arb.lock.Unlock()
+}
+
+// releaseLocked is the release, called under the arb.lock.
+func (arb *ScannerArbiter) releaseLocked(job *scannerArbiterJob) {
+	if job.timer != nil {
+		job.timer.Stop()
+	}
+
+	if arb.owner != job {
+		return
+	}
+
+	arb.owner = nil
+	if len(arb.queue) != 0 {
+		next := arb.queue[0]
+		copy(arb.queue, arb.queue[1:])
+		arb.queue = arb.queue[:len(arb.queue)-1]
+		arb.grant(next)
+	}
+}
+
+// grant makes the job the scanner owner.
+// Must be called under the arb.lock.
+func (arb *ScannerArbiter) grant(job *scannerArbiterJob) {
+	arb.owner = job
+	if arb.JobTimeout > 0 {
+		job.timer = time.AfterFunc(arb.JobTimeout, func() {
+			arb.expire(job)
+		})
+	}
+	close(job.ready)
+}
+
+// expire finishes the job by JobTimeout.
+//
+// The job's Document is closed before the scanner is given to the
+// next job, so the underlying scanner is not used by two jobs at
+// once. If the job's Document is not created yet, closing and
+// releasing is left to the scannerArbiterScanner.Scan.
+func (arb *ScannerArbiter) expire(job *scannerArbiterJob) {
+	arb.lock.Lock()
+	if arb.owner != job || job.expired {
+		arb.lock.Unlock()
+		return
+	}
+
+	job.expired = true
+	doc := job.doc
+	arb.lock.Unlock()
+
+	if doc != nil {
+		job.close()
+		arb.release(job)
+	}
+}
+
+// attach attaches the Document to the job.
+// It returns false, if job is already expired.
+func (arb *ScannerArbiter) attach(job *scannerArbiterJob, doc Document) bool {
+	arb.lock.Lock()
+	defer arb.lock.Unlock()
+
+	if job.expired {
+		return false
+	}
+
+	job.doc = doc
+	return true
+}
+
+// expired reports if the job is finished by JobTimeout.
+func (arb *ScannerArbiter) expired(job *scannerArbiterJob) bool {
+	arb.lock.Lock()
+	defer arb.lock.Unlock()
+	return job.expired
+}
+
+// Capabilities returns the [ScannerCapabilities] of the underlying
+// scanner.
+func (s *scannerArbiterScanner) Capabilities() *ScannerCapabilities {
+	return s.scanner.Capabilities()
+}
+
+// Scan acquires the scanner and passes the scan request to the
+// underlying scanner.
+func (s *scannerArbiterScanner) Scan(ctx context.Context,
+	req ScannerRequest) (Document, error) {
+
+	job, err := s.arb.acquire(ctx, s.name)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := s.scanner.Scan(ctx, req)
+	if err != nil {
+		s.arb.release(job)
+		return nil, err
+	}
+
+	if !s.arb.attach(job, doc) {
+		doc.Close()
+		s.arb.release(job)
+		return nil, ErrDocumentClosed
+	}
+
+	return &scannerArbiterDocument{
+		Document: doc,
+		arb:      s.arb,
+		job:      job,
+	}, nil
+}
+
+// Close closes the underlying scanner.
+func (s *scannerArbiterScanner) Close() error {
+	return s.scanner.Close()
+}
+
+// Next returns the next [DocumentFile].
+//
+// The scanner is not released here, even on error or io.EOF, as
+// the underlying Document remains open until Close.
+func (doc *scannerArbiterDocument) Next() (DocumentFile, error) {
+	if doc.arb.expired(doc.job) {
+		return nil, ErrDocumentClosed
+	}
+
+	return doc.Document.Next()
+}
+
+// Close closes the Document and releases the scanner.
+func (doc *scannerArbiterDocument) Close() error {
+	err := doc.job.close()
+	doc.arb.release(doc.job)
+	return err
+}
+
+// close closes the job's Document. The Document may be closed
+// by both the client and the JobTimeout, but the underlying
+// Document is closed only once.
+func (job *scannerArbiterJob) close() error {
+	job.once.Do(func() {
+		job.closeErr = job.doc.Close()
+	})
+	return job.closeErr
+}
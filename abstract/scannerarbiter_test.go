@@ -0,0 +1,249 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Scanner arbiter tests
+
+package abstract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testArbiterScanner is the trivial Scanner for ScannerArbiter tests.
+// Each scan returns a single-file document.
+type testArbiterScanner struct{}
+
+func (testArbiterScanner) Capabilities() *ScannerCapabilities {
+	return &ScannerCapabilities{}
+}
+
+func (testArbiterScanner) Scan(context.Context, ScannerRequest) (
+	Document, error) {
+	return NewVirtualDocument(Resolution{}, []byte("image")), nil
+}
+
+func (testArbiterScanner) Close() error {
+	return nil
+}
+
+// testArbiterTracker is the Scanner for ScannerArbiter tests that
+// counts Close calls of the returned Documents.
+type testArbiterTracker struct {
+	testArbiterScanner
+	closed *atomic.Int32 // Count of Document.Close calls
+}
+
+// testArbiterTrackedDocument is the Document, returned by the
+// testArbiterTracker.
+type testArbiterTrackedDocument struct {
+	Document
+	closed *atomic.Int32
+}
+
+func (tracker testArbiterTracker) Scan(ctx context.Context,
+	req ScannerRequest) (Document, error) {
+	doc, _ := tracker.testArbiterScanner.Scan(ctx, req)
+	return testArbiterTrackedDocument{doc, tracker.closed}, nil
+}
+
+func (doc testArbiterTrackedDocument) Close() error {
+	doc.closed.Add(1)
+	return doc.Document.Close()
+}
+
+// testArbiterWait waits until ScannerArbiter status matches
+// the expected.
+func testArbiterWait(t *testing.T, arb *ScannerArbiter,
+	expected ScannerArbiterStatus) {
+
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := arb.Status()
+		if reflect.DeepEqual(status, expected) {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("status mismatch:\n"+
+				"expected: %#v\n"+
+				"present:  %#v",
+				expected, status)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestScannerArbiterSerialize tests ScannerArbiter without queue
+func TestScannerArbiterSerialize(t *testing.T) {
+	arb := &ScannerArbiter{}
+	escl := arb.Scanner("eSCL", testArbiterScanner{})
+	wsd := arb.Scanner("WSD", testArbiterScanner{})
+
+	doc, err := escl.Scan(context.Background(), ScannerRequest{})
+	if err != nil {
+		t.Fatalf("eSCL: %s", err)
+	}
+
+	testArbiterWait(t, arb, ScannerArbiterStatus{
+		Busy: true, Owner: "eSCL", Queue: []string{}})
+
+	_, err = wsd.Scan(context.Background(), ScannerRequest{})
+	if !errors.Is(err, ErrDeviceInUse) {
+		t.Errorf("WSD: expected %v, present %v", ErrDeviceInUse, err)
+	}
+
+	// Consuming the document to the end doesn't release the
+	// scanner, until the document is closed
+	doc.Next()
+	_, err = doc.Next()
+	if err != io.EOF {
+		t.Errorf("eSCL: Next: expected io.EOF, present %v", err)
+	}
+
+	testArbiterWait(t, arb, ScannerArbiterStatus{
+		Busy: true, Owner: "eSCL", Queue: []string{}})
+
+	_, err = wsd.Scan(context.Background(), ScannerRequest{})
+	if !errors.Is(err, ErrDeviceInUse) {
+		t.Errorf("WSD: expected %v, present %v", ErrDeviceInUse, err)
+	}
+
+	doc.Close()
+	testArbiterWait(t, arb, ScannerArbiterStatus{Queue: []string{}})
+
+	// Closing the document releases the scanner
+	doc, err = wsd.Scan(context.Background(), ScannerRequest{})
+	if err != nil {
+		t.Fatalf("WSD: %s", err)
+	}
+
+	doc.Close()
+
+	testArbiterWait(t, arb, ScannerArbiterStatus{Queue: []string{}})
+}
+
+// TestScannerArbiterQueue tests ScannerArbiter queueing
+func TestScannerArbiterQueue(t *testing.T) {
+	arb := &ScannerArbiter{QueueSize: 2}
+	names := []string{"eSCL", "WSD", "IPP"}
+	scanners := make([]Scanner, len(names))
+	for i, name := range names {
+		scanners[i] = arb.Scanner(name, testArbiterScanner{})
+	}
+
+	doc, err := scanners[0].Scan(context.Background(), ScannerRequest{})
+	if err != nil {
+		t.Fatalf("%s: %s", names[0], err)
+	}
+
+	// Queue two requests, one by one, to make order predictable
+	docs := make(chan Document)
+	for i := 1; i < len(scanners); i++ {
+		go func(scanner Scanner) {
+			doc, err := scanner.Scan(context.Background(),
+				ScannerRequest{})
+			if err != nil {
+				t.Errorf("Scan: %s", err)
+			}
+			docs <- doc
+		}(scanners[i])
+
+		testArbiterWait(t, arb, ScannerArbiterStatus{
+			Busy: true, Owner: names[0], Queue: names[1 : i+1]})
+	}
+
+	if pos := arb.Status().Position("IPP"); pos != 2 {
+		t.Errorf("Position: expected 2, present %d", pos)
+	}
+
+	// Queue is full
+	_, err = arb.Scanner("extra", testArbiterScanner{}).Scan(
+		context.Background(), ScannerRequest{})
+	if !errors.Is(err, ErrDeviceInUse) {
+		t.Errorf("queue full: expected %v, present %v",
+			ErrDeviceInUse, err)
+	}
+
+	// Requests are served in order
+	for i := 1; i < len(names); i++ {
+		doc.Close()
+		doc = <-docs
+
+		testArbiterWait(t, arb, ScannerArbiterStatus{
+			Busy: true, Owner: names[i], Queue: names[i+1:]})
+	}
+
+	doc.Close()
+	testArbiterWait(t, arb, ScannerArbiterStatus{Queue: []string{}})
+}
+
+// TestScannerArbiterTimeouts tests ScannerArbiter timeouts and
+// context cancellation
+func TestScannerArbiterTimeouts(t *testing.T) {
+	arb := &ScannerArbiter{
+		QueueSize:    1,
+		QueueTimeout: 20 * time.Millisecond,
+		JobTimeout:   200 * time.Millisecond,
+	}
+
+	closed := &atomic.Int32{}
+	escl := arb.Scanner("eSCL", testArbiterTracker{closed: closed})
+	wsd := arb.Scanner("WSD", testArbiterScanner{})
+
+	doc, err := escl.Scan(context.Background(), ScannerRequest{})
+	if err != nil {
+		t.Fatalf("eSCL: %s", err)
+	}
+
+	// QueueTimeout
+	_, err = wsd.Scan(context.Background(), ScannerRequest{})
+	if !errors.Is(err, ErrDeviceInUse) {
+		t.Errorf("QueueTimeout: expected %v, present %v",
+			ErrDeviceInUse, err)
+	}
+
+	// Context cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+
+	_, err = wsd.Scan(ctx, ScannerRequest{})
+	if err != context.Canceled {
+		t.Errorf("cancel: expected %v, present %v",
+			context.Canceled, err)
+	}
+
+	testArbiterWait(t, arb, ScannerArbiterStatus{
+		Busy: true, Owner: "eSCL", Queue: []string{}})
+
+	// JobTimeout. Document of the expired job must be
+	// closed before scanner is released.
+	testArbiterWait(t, arb, ScannerArbiterStatus{Queue: []string{}})
+
+	if n := closed.Load(); n != 1 {
+		t.Errorf("JobTimeout: Document closed %d times, expected 1", n)
+	}
+
+	_, err = doc.Next()
+	if err != ErrDocumentClosed {
+		t.Errorf("JobTimeout: expected %v, present %v",
+			ErrDocumentClosed, err)
+	}
+
+	// Client's Close must not close the Document again
+	doc.Close()
+	if n := closed.Load(); n != 1 {
+		t.Errorf("Close: Document closed %d times, expected 1", n)
+	}
+}
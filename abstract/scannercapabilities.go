@@ -32,6 +32,7 @@ type ScannerCapabilities struct {
 	DocumentFormats  []string // Supported output formats
 	CompressionRange Range    // Lower num, better image
 	ADFCapacity      int      // 0 if unknown or no ADF
+	ADFBackSide      BackSide // ADFModeDuplex back side orientation
 
 	// Exposure control parameters
 	BrightnessRange   Range // Brightness
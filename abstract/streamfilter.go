@@ -24,10 +24,16 @@ type streamfilter struct {
 //
 // The [Resolution] and format information of the input stream
 // must be provided using the 'res' and 'format' parameters.
+//
+// FilterOptions.BlankPage is ignored, as the single stream
+// cannot be removed or flagged.
 func NewStreamFilter(in io.ReadCloser,
 	res Resolution, format string,
 	opt FilterOptions) io.ReadCloser {
 
+	// Blank pages cannot be removed from the single stream.
+	opt.BlankPage = BlankPageUnset
+
 	// Bypass filtering if options not set.
 	if opt == (FilterOptions{}) {
 		return in
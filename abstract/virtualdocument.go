@@ -21,6 +21,7 @@ type virtualDocument struct {
 	res    Resolution           // Returned by Document.Resolution
 	files  [][]byte             // Bodies of not yet consumed "files"
 	file   *virtualDocumentFile // Current file
+	pages  int                  // Count of files returned so far
 	closed bool                 // True if document is closed
 	lock   sync.Mutex           // Access lock
 }
@@ -40,11 +41,13 @@ func NewVirtualDocument(res Resolution, files ...[]byte) Document {
 type virtualDocumentFile struct {
 	format string     // Returned by DocumentFile.Format
 	data   []byte     // Remaining data bytes
+	length int        // Total length of data
+	page   int        // Page number, 1-based
 	lock   sync.Mutex // Access lock
 }
 
 // newVirtualDocumentFile returns new virtualDocumentFile
-func newVirtualDocumentFile(data []byte) *virtualDocumentFile {
+func newVirtualDocumentFile(data []byte, page int) *virtualDocumentFile {
 	format := imgconv.MIMETypeDetect(data)
 	if format == "" {
 		format = imgconv.MIMETypeData
@@ -53,6 +56,8 @@ func newVirtualDocumentFile(data []byte) *virtualDocumentFile {
 	return &virtualDocumentFile{
 		format: format,
 		data:   data,
+		length: len(data),
+		page:   page,
 	}
 }
 
@@ -62,6 +67,18 @@ func (file *virtualDocumentFile) Format() string {
 	return file.format
 }
 
+// Info returns the DocumentFile metadata.
+// It implements the [DocumentFileWithInfo] interface.
+//
+// Only the page number and length are known, as the file
+// content is not parsed.
+func (file *virtualDocumentFile) Info() DocumentFileInfo {
+	return DocumentFileInfo{
+		Page:   file.page,
+		Length: file.length,
+	}
+}
+
 // Read reads data bytes from the [virtualDocumentFile].
 func (file *virtualDocumentFile) Read(buf []byte) (n int, err error) {
 	file.lock.Lock()
@@ -114,7 +131,8 @@ func (doc *virtualDocument) Next() (DocumentFile, error) {
 
 	// Return new file, if more data is available
 	if len(doc.files) != 0 {
-		doc.file = newVirtualDocumentFile(doc.files[0])
+		doc.pages++
+		doc.file = newVirtualDocumentFile(doc.files[0], doc.pages)
 		doc.files = doc.files[1:]
 		return doc.file, nil
 	}
@@ -0,0 +1,275 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Test pattern generator for the virtual scanner
+
+package abstract
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// VirtualScannerGenerator is the [VirtualScannerSource] that
+// generates the test pattern pages.
+//
+// Each page has its page number, sheet number and side (front
+// or back) and the scan request parameters burned in, so pages
+// can be told apart by the client.
+//
+// Page orientation can be checked by the corner marks: the top-left
+// corner is black, the top-right is red, the bottom-left is green
+// and the bottom-right is blue. The "TOP" label with the arrow
+// is drawn at the top edge.
+type VirtualScannerGenerator struct {
+	Width, Height Dimension // Page size, A4 if zero
+	Sheets        int       // Sheets in ADF, 1 if zero
+}
+
+// vpatPalette is the palette, used for the test pattern images.
+var vpatPalette = color.Palette{
+	color.RGBA{255, 255, 255, 255}, // Background
+	color.RGBA{0, 0, 0, 255},       // Text and frame
+	color.RGBA{255, 0, 0, 255},     // Top-right mark
+	color.RGBA{0, 255, 0, 255},     // Bottom-left mark
+	color.RGBA{0, 0, 255, 255},     // Bottom-right mark
+	color.RGBA{128, 128, 128, 255}, // Request parameters
+}
+
+// Indices of vpatPalette colors:
+const (
+	vpatWhite uint8 = iota
+	vpatBlack
+	vpatRed
+	vpatGreen
+	vpatBlue
+	vpatGray
+)
+
+// Images returns images of pages for the scan request.
+// It implements the [VirtualScannerSource] interface.
+//
+// For the Platen scan, the single page is generated. For ADF,
+// one page per sheet is generated for the simplex scan and two
+// pages per sheet (front and back) for the duplex scan.
+func (gen *VirtualScannerGenerator) Images(req *ScannerRequest,
+	res Resolution) ([][]byte, error) {
+
+	sheets, sides := 1, 1
+	if req.Input == InputADF {
+		sheets = gen.Sheets
+		if sheets <= 0 {
+			sheets = 1
+		}
+
+		if req.ADFMode == ADFModeDuplex {
+			sides = 2
+		}
+	}
+
+	images := make([][]byte, 0, sheets*sides)
+	for sheet := 1; sheet <= sheets; sheet++ {
+		for side := 1; side <= sides; side++ {
+			img, err := gen.page(req, res, len(images)+1, sheet, side)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, img)
+		}
+	}
+
+	return images, nil
+}
+
+// page generates the single page image, encoded as PNG.
+func (gen *VirtualScannerGenerator) page(req *ScannerRequest,
+	res Resolution, pageno, sheet, side int) ([]byte, error) {
+
+	width, height := gen.Width, gen.Height
+	if width <= 0 || height <= 0 {
+		width, height = A4Width, A4Height
+	}
+
+	canvas := &vpatCanvas{
+		img: image.NewPaletted(image.Rect(0, 0,
+			width.Dots(res.XResolution),
+			height.Dots(res.YResolution)), vpatPalette),
+		res: res,
+	}
+
+	// Frame and corner marks
+	frame := 2 * Millimeter
+	mark := 15 * Millimeter
+
+	canvas.rect(0, 0, width, height, vpatBlack)
+	canvas.rect(frame, frame, width-frame, height-frame, vpatWhite)
+
+	canvas.rect(frame, frame, frame+mark, frame+mark, vpatBlack)
+	canvas.rect(width-frame-mark, frame, width-frame, frame+mark, vpatRed)
+	canvas.rect(frame, height-frame-mark, frame+mark, height-frame, vpatGreen)
+	canvas.rect(width-frame-mark, height-frame-mark,
+		width-frame, height-frame, vpatBlue)
+
+	// The "TOP" label with arrow
+	canvas.arrow(width/2, frame+3*Millimeter, 10*Millimeter, vpatBlack)
+	canvas.text(width/2, frame+15*Millimeter, 8*Millimeter, "TOP",
+		vpatBlack)
+
+	// Page identification
+	sideName := "FRONT"
+	if side == 2 {
+		sideName = "BACK"
+	}
+
+	canvas.text(width/2, height/3, 30*Millimeter,
+		fmt.Sprintf("PAGE %d", pageno), vpatBlack)
+	canvas.text(width/2, height/3+40*Millimeter, 15*Millimeter,
+		fmt.Sprintf("SHEET %d %s", sheet, sideName), vpatBlack)
+
+	// Request parameters
+	y := height/2 + 20*Millimeter
+	lines := strings.Split(strings.TrimSpace(string(req.MarshalLog())), "\n")
+	for _, line := range lines {
+		canvas.text(width/2, y, 5*Millimeter, line, vpatGray)
+		y += 6 * Millimeter
+	}
+
+	return canvas.encode()
+}
+
+// vpatCanvas is the drawing canvas for the test pattern.
+// Coordinates are specified as [Dimension] and converted
+// to dots according to the resolution.
+type vpatCanvas struct {
+	img *image.Paletted // Underlying image
+	res Resolution      // Image resolution
+}
+
+// dots converts the point coordinates into dots.
+func (canvas *vpatCanvas) dots(x, y Dimension) (int, int) {
+	return x.Dots(canvas.res.XResolution), y.Dots(canvas.res.YResolution)
+}
+
+// fill fills the rectangle, specified in dots.
+func (canvas *vpatCanvas) fill(r image.Rectangle, c uint8) {
+	r = r.Intersect(canvas.img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		off := canvas.img.PixOffset(r.Min.X, y)
+		pix := canvas.img.Pix[off : off+r.Dx()]
+		for i := range pix {
+			pix[i] = c
+		}
+	}
+}
+
+// rect fills the rectangle.
+func (canvas *vpatCanvas) rect(x0, y0, x1, y1 Dimension, c uint8) {
+	dx0, dy0 := canvas.dots(x0, y0)
+	dx1, dy1 := canvas.dots(x1, y1)
+	canvas.fill(image.Rect(dx0, dy0, dx1, dy1), c)
+}
+
+// arrow draws the up-pointing arrow with the tip at (x,y).
+func (canvas *vpatCanvas) arrow(x, y, size Dimension, c uint8) {
+	tipX, tipY := canvas.dots(x, y)
+	_, hei := canvas.dots(0, size)
+
+	// Arrow head: the triangle
+	for i := 0; i < hei/2; i++ {
+		w, _ := canvas.dots(size*Dimension(i)/Dimension(hei), 0)
+		canvas.fill(image.Rect(tipX-w/2, tipY+i,
+			tipX+w/2+1, tipY+i+1), c)
+	}
+
+	// Arrow shaft
+	shaft, _ := canvas.dots(size/5, 0)
+	canvas.fill(image.Rect(tipX-shaft/2, tipY+hei/2,
+		tipX+shaft/2+1, tipY+hei), c)
+}
+
+// text draws the line of text, centered horizontally at x,
+// with the top edge at y.
+//
+// The basic 7x13 bitmap font is scaled up to the requested
+// text height.
+func (canvas *vpatCanvas) text(x, y, height Dimension, s string, c uint8) {
+	face := basicfont.Face7x13
+
+	// Render text into the mask at the native font size
+	drawer := font.Drawer{Face: face}
+	wid := drawer.MeasureString(s).Ceil()
+	hei := face.Height
+
+	mask := image.NewAlpha(image.Rect(0, 0, wid, hei))
+	drawer.Dst = mask
+	drawer.Src = image.Opaque
+	drawer.Dot = fixed.P(0, face.Ascent)
+	drawer.DrawString(s)
+
+	// Blit the scaled mask
+	_, dhei := canvas.dots(0, height)
+	scaleY := float64(dhei) / float64(hei)
+	scaleX := scaleY * float64(canvas.res.XResolution) /
+		float64(canvas.res.YResolution)
+
+	x0, y0 := canvas.dots(x, y)
+	x0 -= int(float64(wid) * scaleX / 2)
+
+	for my := 0; my < hei; my++ {
+		for mx := 0; mx < wid; mx++ {
+			if mask.AlphaAt(mx, my).A < 0x80 {
+				continue
+			}
+
+			canvas.fill(image.Rect(
+				x0+int(float64(mx)*scaleX),
+				y0+int(float64(my)*scaleY),
+				x0+int(float64(mx+1)*scaleX),
+				y0+int(float64(my+1)*scaleY)), c)
+		}
+	}
+}
+
+// encode encodes the image into PNG.
+func (canvas *vpatCanvas) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	bounds := canvas.img.Bounds()
+
+	encoder, err := imgconv.NewPNGWriter(buf, bounds.Dx(), bounds.Dy(),
+		color.RGBAModel)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make(imgconv.RowRGBA32, bounds.Dx())
+	for y := 0; y < bounds.Dy() && err == nil; y++ {
+		off := canvas.img.PixOffset(0, y)
+		for x, c := range canvas.img.Pix[off : off+bounds.Dx()] {
+			row[x] = vpatPalette[c].(color.RGBA)
+		}
+
+		err = encoder.Write(row)
+	}
+
+	err2 := encoder.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
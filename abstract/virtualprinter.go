@@ -0,0 +1,360 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// The virtual printer
+
+package abstract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/log"
+)
+
+// VirtualPrinter implements the [Printer] interface for the virtual
+// (simulated) printer.
+//
+// It spools each received job into the separate subdirectory of
+// the SpoolDir, named job-NNNN. The job directory contains:
+//
+//	document.ext - the document, as received
+//	job.json     - job parameters, timestamps and final state
+//	page-NNN.png - rendered pages, if RenderPages is set
+//
+// Pages are rendered for the PWG Raster and Apple Raster (URF)
+// documents. For these formats document is also validated and
+// its pages are counted as impressions.
+//
+// The job.json file is written when job is received and then
+// rewritten when job is finished, so its "state" field can be
+// used to wait for the job completion.
+type VirtualPrinter struct {
+	SpoolDir    string // Spool directory
+	RenderPages bool   // Render raster pages into PNG
+
+	lock  sync.Mutex // Access lock
+	jobID int        // Last used job ID
+}
+
+// VirtualPrinterJobInfo is the content of the job.json file,
+// written by the [VirtualPrinter].
+type VirtualPrinterJobInfo struct {
+	JobID     int       `json:"job-id"`               // Job ID
+	Format    string    `json:"format"`               // MIME type
+	JobName   string    `json:"job-name,omitempty"`   // Job name
+	Copies    int       `json:"copies,omitempty"`     // Copies
+	Sides     string    `json:"sides,omitempty"`      // Sides
+	ColorMode string    `json:"color-mode,omitempty"` // Color mode
+	Media     string    `json:"media,omitempty"`      // WxH, 1/100 mm
+	Document  string    `json:"document"`             // Document file
+	Size      int64     `json:"size"`                 // Document size
+	Pages     []string  `json:"pages,omitempty"`      // Rendered pages
+	State     string    `json:"state"`                // Job state
+	Error     string    `json:"error,omitempty"`      // Error, if any
+	Received  time.Time `json:"received"`             // When received
+	Completed time.Time `json:"completed"`            // When finished
+}
+
+// vprnDocExt maps document MIME types into file extensions.
+var vprnDocExt = map[string]string{
+	imgconv.MIMETypeBMP:        ".bmp",
+	imgconv.MIMETypeJPEG:       ".jpg",
+	imgconv.MIMETypePDF:        ".pdf",
+	imgconv.MIMETypePNG:        ".png",
+	imgconv.MIMETypePWG:        ".pwg",
+	imgconv.MIMETypeTIFF:       ".tiff",
+	imgconv.MIMETypeURF:        ".urf",
+	"application/postscript":   ".ps",
+	"application/vnd.hp-PCL":   ".pcl",
+	"application/vnd.hp-PCLXL": ".pxl",
+	"text/plain":               ".txt",
+}
+
+// Submit spools the new print job.
+// It implements the [Printer] interface.
+func (vprn *VirtualPrinter) Submit(ctx context.Context,
+	params PrinterRequest, body io.Reader) (PrintJob, error) {
+
+	log.Debug(ctx, "VPRN: job submitted: format=%q name=%q",
+		params.Format, params.JobName)
+
+	// Create the job directory
+	id, dir, err := vprn.newJobDir()
+	if err != nil {
+		log.Error(ctx, "VPRN: %s", err)
+		return nil, err
+	}
+
+	info := &VirtualPrinterJobInfo{
+		JobID:    id,
+		Format:   params.Format,
+		JobName:  params.JobName,
+		Copies:   params.Copies,
+		Received: time.Now(),
+	}
+
+	if params.Sides != SidesUnset {
+		info.Sides = params.Sides.String()
+	}
+	if params.ColorMode != ColorModeUnset {
+		info.ColorMode = params.ColorMode.String()
+	}
+	if !params.Media.IsZero() {
+		info.Media = fmt.Sprintf("%dx%d",
+			params.Media.Width, params.Media.Height)
+	}
+
+	// Spool the document. Format detection requires few first
+	// bytes of the document, so save them on the way.
+	head := &vprnHead{}
+	body = io.TeeReader(body, head)
+
+	info.Document, info.Size, err = vprn.spool(dir, params.Format, body)
+	if err != nil {
+		log.Error(ctx, "VPRN: job %d: %s", id, err)
+		return nil, err
+	}
+
+	log.Debug(ctx, "VPRN: job %d: %d bytes spooled to %s",
+		id, info.Size, filepath.Join(dir, info.Document))
+
+	// Process the job
+	tracker := NewPrintJobTracker(ctx)
+	tracker.SetProcessing()
+
+	info.State = PrintJobProcessing.String()
+	vprn.writeInfo(ctx, dir, info)
+
+	go func() {
+		format := imgconv.MIMETypeDetect(head.buf)
+		err := vprn.render(tracker, dir, format, params.Sides, info)
+		tracker.Finish(err)
+
+		status := tracker.Status()
+		info.State = status.State.String()
+		if status.Err != nil {
+			info.Error = status.Err.Error()
+		}
+		info.Completed = time.Now()
+		vprn.writeInfo(ctx, dir, info)
+
+		log.Debug(ctx, "VPRN: job %d: %s", id, info.State)
+	}()
+
+	return tracker, nil
+}
+
+// newJobDir allocates the job ID and creates the job directory.
+// Existent directories are not reused.
+func (vprn *VirtualPrinter) newJobDir() (int, string, error) {
+	vprn.lock.Lock()
+	defer vprn.lock.Unlock()
+
+	err := os.MkdirAll(vprn.SpoolDir, 0755)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for {
+		vprn.jobID++
+		dir := filepath.Join(vprn.SpoolDir,
+			fmt.Sprintf("job-%4.4d", vprn.jobID))
+
+		err = os.Mkdir(dir, 0755)
+		switch {
+		case err == nil:
+			return vprn.jobID, dir, nil
+		case !errors.Is(err, os.ErrExist):
+			return 0, "", err
+		}
+	}
+}
+
+// spool saves the document into the job directory.
+// It returns the document file name and size.
+func (vprn *VirtualPrinter) spool(dir, format string,
+	body io.Reader) (string, int64, error) {
+
+	ext := vprnDocExt[format]
+	if ext == "" {
+		ext = ".bin"
+	}
+
+	name := "document" + ext
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.Copy(file, body)
+	err2 := file.Close()
+	if err == nil {
+		err = err2
+	}
+
+	return name, size, err
+}
+
+// render validates the raster document and counts its pages.
+// If RenderPages is set, pages are also rendered into PNG.
+// Documents of other formats are accepted as is.
+func (vprn *VirtualPrinter) render(tracker *PrintJobTracker,
+	dir, format string, sides Sides, info *VirtualPrinterJobInfo) error {
+
+	file, err := os.Open(filepath.Join(dir, info.Document))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Open the document
+	var nextPage func() (imgconv.Decoder, error)
+
+	switch format {
+	case imgconv.MIMETypePWG:
+		doc, err := imgconv.NewPWGDocumentReader(file)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrDocumentFormat, err)
+		}
+		nextPage = func() (imgconv.Decoder, error) {
+			return doc.NextPage()
+		}
+
+	case imgconv.MIMETypeURF:
+		doc, err := imgconv.NewURFDocumentReader(file)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrDocumentFormat, err)
+		}
+		nextPage = func() (imgconv.Decoder, error) {
+			return doc.NextPage()
+		}
+
+	default:
+		return nil
+	}
+
+	// Process pages
+	for pageno := 1; ; pageno++ {
+		if err := tracker.Context().Err(); err != nil {
+			return err
+		}
+
+		page, err := nextPage()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return fmt.Errorf("%w: page %d: %s",
+				ErrDocumentFormat, pageno, err)
+		}
+
+		if vprn.RenderPages {
+			name := fmt.Sprintf("page-%3.3d.png", pageno)
+			err = vprn.renderPage(filepath.Join(dir, name), page)
+			if err != nil {
+				return fmt.Errorf("page %d: %w", pageno, err)
+			}
+			info.Pages = append(info.Pages, name)
+		}
+
+		sheets := 1
+		if sides == SidesTwoSidedLongEdge ||
+			sides == SidesTwoSidedShortEdge {
+			sheets = pageno & 1
+		}
+		tracker.AddImpressions(1, sheets)
+	}
+}
+
+// renderPage renders the single page into the PNG file.
+// Errors reading the page are reported as ErrDocumentFormat.
+func (vprn *VirtualPrinter) renderPage(path string,
+	page imgconv.Decoder) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	wid, hei := page.Size()
+	encoder, err := imgconv.NewPNGWriter(file, wid, hei, page.ColorModel())
+	if err != nil {
+		return err
+	}
+
+	row := page.NewRow()
+	for {
+		_, err = page.Read(row)
+		if err != nil {
+			break
+		}
+
+		err = encoder.Write(row)
+		if err != nil {
+			encoder.Close()
+			return err
+		}
+	}
+
+	if err != io.EOF {
+		encoder.Close()
+		return fmt.Errorf("%w: %s", ErrDocumentFormat, err)
+	}
+
+	err = encoder.Close()
+	if err == nil {
+		err = file.Close()
+	}
+
+	return err
+}
+
+// writeInfo writes the job.json file.
+//
+// The file is written atomically (via rename), so the readers never
+// see it partially written. Errors are logged but otherwise ignored.
+func (vprn *VirtualPrinter) writeInfo(ctx context.Context,
+	dir string, info *VirtualPrinterJobInfo) {
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err == nil {
+		tmp := filepath.Join(dir, "job.json.tmp")
+		err = os.WriteFile(tmp, append(data, '\n'), 0644)
+		if err == nil {
+			err = os.Rename(tmp, filepath.Join(dir, "job.json"))
+		}
+	}
+
+	if err != nil {
+		log.Error(ctx, "VPRN: job %d: %s", info.JobID, err)
+	}
+}
+
+// vprnHead is the io.Writer that saves few first bytes written,
+// enough for the document format detection.
+type vprnHead struct {
+	buf []byte
+}
+
+// Write saves the beginning of data. It implements the [io.Writer]
+// interface.
+func (head *vprnHead) Write(data []byte) (int, error) {
+	const max = 512
+	if n := max - len(head.buf); n > 0 {
+		head.buf = append(head.buf, data[:min(n, len(data))]...)
+	}
+	return len(data), nil
+}
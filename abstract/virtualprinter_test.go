@@ -0,0 +1,213 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// VirtualPrinter tests
+
+package abstract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+)
+
+// testVirtualPrinterPWG creates the PWG Raster document with
+// the specified number of pages.
+func testVirtualPrinterPWG(t *testing.T, pages int) []byte {
+	const wid, hei = 40, 30
+
+	buf := &bytes.Buffer{}
+	doc := imgconv.NewPWGDocumentWriter(buf)
+
+	for i := 0; i < pages; i++ {
+		hdr, err := imgconv.NewPWGPageHeader(wid, hei,
+			color.GrayModel, 300, 300)
+		if err != nil {
+			t.Fatalf("NewPWGPageHeader: %s", err)
+		}
+
+		page, err := doc.NewPage(hdr)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+
+		row := make(imgconv.RowGray8, wid)
+		for x := range row {
+			row[x] = color.Gray{Y: uint8(x * 6)}
+		}
+
+		for y := 0; y < hei; y++ {
+			page.Write(row)
+		}
+
+		page.Close()
+	}
+
+	err := doc.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// testVirtualPrinterJob submits the job to the VirtualPrinter and
+// waits for its completion. It returns the final job status and
+// decoded job.json.
+func testVirtualPrinterJob(t *testing.T, vprn *VirtualPrinter,
+	params PrinterRequest, data []byte) (
+	PrintJobStatus, VirtualPrinterJobInfo) {
+
+	t.Helper()
+
+	ctx := context.Background()
+	job, err := vprn.Submit(ctx, params, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Submit: %s", err)
+	}
+
+	status, err := WaitPrintJob(ctx, job)
+	if err != nil {
+		t.Fatalf("WaitPrintJob: %s", err)
+	}
+
+	// job.json is rewritten after job is finished, so poll it
+	var info VirtualPrinterJobInfo
+	dir, _ := filepath.Glob(filepath.Join(vprn.SpoolDir, "job-*"))
+	path := filepath.Join(dir[len(dir)-1], "job.json")
+
+	for info.Completed.IsZero() {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("job.json: %s", err)
+		}
+
+		info = VirtualPrinterJobInfo{}
+		err = json.Unmarshal(text, &info)
+		if err != nil {
+			t.Fatalf("job.json: %s", err)
+		}
+	}
+
+	return status, info
+}
+
+// TestVirtualPrinter tests the VirtualPrinter
+func TestVirtualPrinter(t *testing.T) {
+	vprn := &VirtualPrinter{
+		SpoolDir:    t.TempDir(),
+		RenderPages: true,
+	}
+
+	// PWG Raster document, rendered into PNG
+	data := testVirtualPrinterPWG(t, 3)
+	params := PrinterRequest{
+		Format:    imgconv.MIMETypePWG,
+		JobName:   "test job",
+		Copies:    2,
+		Sides:     SidesTwoSidedLongEdge,
+		ColorMode: ColorModeMono,
+		Media:     MediaSize{Width: A4Width, Height: A4Height},
+	}
+
+	status, info := testVirtualPrinterJob(t, vprn, params, data)
+
+	if status.State != PrintJobCompleted {
+		t.Errorf("state: expected %s, present %s (%v)",
+			PrintJobCompleted, status.State, status.Err)
+	}
+
+	if status.ImpressionsCompleted != 3 || status.MediaSheetsCompleted != 2 {
+		t.Errorf("impressions/sheets: expected 3/2, present %d/%d",
+			status.ImpressionsCompleted, status.MediaSheetsCompleted)
+	}
+
+	expected := VirtualPrinterJobInfo{
+		JobID:     1,
+		Format:    imgconv.MIMETypePWG,
+		JobName:   "test job",
+		Copies:    2,
+		Sides:     "TwoSidedLongEdge",
+		ColorMode: "Mono",
+		Media:     "21000x29700",
+		Document:  "document.pwg",
+		Size:      int64(len(data)),
+		Pages:     []string{"page-001.png", "page-002.png", "page-003.png"},
+		State:     "Completed",
+		Received:  info.Received,
+		Completed: info.Completed,
+	}
+
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("job.json:\n"+
+			"expected: %+v\n"+
+			"present:  %+v", expected, info)
+	}
+
+	dir := filepath.Join(vprn.SpoolDir, "job-0001")
+	spooled, err := os.ReadFile(filepath.Join(dir, "document.pwg"))
+	if err != nil || !bytes.Equal(spooled, data) {
+		t.Errorf("document.pwg: spooled data mismatch (%v)", err)
+	}
+
+	for _, name := range info.Pages {
+		png, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if imgconv.MIMETypeDetect(png) != imgconv.MIMETypePNG {
+			t.Errorf("%s: not a PNG file", name)
+		}
+	}
+
+	// Non-raster document is spooled as is
+	data = []byte("%PDF-1.4\n%%EOF\n")
+	params = PrinterRequest{Format: imgconv.MIMETypePDF}
+	status, info = testVirtualPrinterJob(t, vprn, params, data)
+
+	if status.State != PrintJobCompleted {
+		t.Errorf("PDF: state: expected %s, present %s",
+			PrintJobCompleted, status.State)
+	}
+
+	if info.JobID != 2 || info.Document != "document.pdf" ||
+		info.Pages != nil {
+		t.Errorf("PDF: unexpected job.json: %+v", info)
+	}
+
+	// Truncated raster document is rejected
+	data = testVirtualPrinterPWG(t, 1)
+	data = data[:len(data)-10]
+	params = PrinterRequest{Format: "application/octet-stream"}
+	status, info = testVirtualPrinterJob(t, vprn, params, data)
+
+	if status.State != PrintJobAborted ||
+		!status.Reasons.Contains(PrintJobReasonDocumentFormatError) {
+		t.Errorf("truncated: expected %s/DocumentFormatError, present %s/%v",
+			PrintJobAborted, status.State, status.Reasons.Elements())
+	}
+
+	if info.State != "Aborted" || info.Error == "" ||
+		info.Document != "document.bin" {
+		t.Errorf("truncated: unexpected job.json: %+v", info)
+	}
+
+	// Existent job directories are not reused
+	vprn2 := &VirtualPrinter{SpoolDir: vprn.SpoolDir}
+	_, info = testVirtualPrinterJob(t, vprn2, params, []byte("data"))
+	if info.JobID != 4 {
+		t.Errorf("job-id: expected 4, present %d", info.JobID)
+	}
+}
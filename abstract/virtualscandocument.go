@@ -0,0 +1,207 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Simulated scanning timing and ADF paper jams
+
+package abstract
+
+import (
+	"sync"
+	"time"
+)
+
+// virtualScanDocument wraps the [Document] and simulates the
+// timing of the real scanner and the ADF paper jams.
+type virtualScanDocument struct {
+	input      Document      // Underlying document
+	delay      time.Duration // Delay before each page
+	throughput int           // Bytes per second, 0 if unlimited
+	jamAfter   int           // Jam after this count of pages, 0 if none
+	pages      int           // Count of pages returned so far
+	jammed     bool          // The paper jam has occurred
+	done       chan struct{} // Closed by Close
+	closeOnce  sync.Once     // To close done only once
+}
+
+// virtualScanFile wraps the [DocumentFile] and limits its
+// transfer speed.
+type virtualScanFile struct {
+	DocumentFile                      // Underlying file
+	doc          *virtualScanDocument // Document the file belongs to
+	started      time.Time            // Transfer start time
+	count        int64                // Bytes transferred so far
+}
+
+// newVirtualScanDocument creates a new virtualScanDocument.
+func newVirtualScanDocument(input Document, delay time.Duration,
+	throughput, jamAfter int) Document {
+
+	return &virtualScanDocument{
+		input:      input,
+		delay:      delay,
+		throughput: throughput,
+		jamAfter:   jamAfter,
+		done:       make(chan struct{}),
+	}
+}
+
+// Resolution returns Document's Resolution
+func (doc *virtualScanDocument) Resolution() Resolution {
+	return doc.input.Resolution()
+}
+
+// Next returns the next file as [DocumentFile]
+//
+// It waits the page delay before returning the page. Once the
+// jamAfter pages are returned, and if more pages remain, the
+// paper jam occurs and all subsequent calls return [ErrADFJam].
+func (doc *virtualScanDocument) Next() (DocumentFile, error) {
+	if doc.jammed {
+		return nil, ErrADFJam
+	}
+
+	file, err := doc.input.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.jamAfter > 0 && doc.pages >= doc.jamAfter {
+		doc.jammed = true
+		return nil, ErrADFJam
+	}
+
+	err = doc.sleep(doc.delay)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.pages++
+
+	if doc.throughput > 0 {
+		vfile := &virtualScanFile{
+			DocumentFile: file,
+			doc:          doc,
+			started:      time.Now(),
+		}
+		file = vfile.expose()
+	}
+
+	return file, nil
+}
+
+// Close closes the document.
+func (doc *virtualScanDocument) Close() error {
+	doc.closeOnce.Do(func() { close(doc.done) })
+	return doc.input.Close()
+}
+
+// sleep sleeps for the specified duration. It returns
+// [ErrDocumentClosed], if document is closed while sleeping.
+func (doc *virtualScanDocument) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-doc.done:
+		return ErrDocumentClosed
+	}
+}
+
+// Read reads data bytes from the [virtualScanFile].
+//
+// Data is returned in chunks of about 1/10 of the throughput
+// and the Read sleeps as needed to not exceed the throughput.
+func (file *virtualScanFile) Read(buf []byte) (int, error) {
+	chunk := file.doc.throughput / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	if len(buf) > chunk {
+		buf = buf[:chunk]
+	}
+
+	n, err := file.DocumentFile.Read(buf)
+	file.count += int64(n)
+
+	if n > 0 {
+		due := time.Duration(file.count) * time.Second /
+			time.Duration(file.doc.throughput)
+		err2 := file.doc.sleep(due - time.Since(file.started))
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}
+
+	return n, err
+}
+
+// expose returns the file as [DocumentFile], that implements
+// the same optional interfaces ([DocumentFileWithInfo] and
+// [BlankPageInfo]), as the underlying file does.
+func (file *virtualScanFile) expose() DocumentFile {
+	_, info := file.DocumentFile.(DocumentFileWithInfo)
+	_, blank := file.DocumentFile.(BlankPageInfo)
+
+	switch {
+	case info && blank:
+		return virtualScanFileInfoBlank{file}
+	case info:
+		return virtualScanFileInfo{file}
+	case blank:
+		return virtualScanFileBlank{file}
+	}
+
+	return file
+}
+
+// virtualScanFileInfo is the virtualScanFile of the file that
+// implements [DocumentFileWithInfo].
+type virtualScanFileInfo struct {
+	*virtualScanFile
+}
+
+// Info returns the metadata of the underlying file.
+// It implements the [DocumentFileWithInfo] interface.
+func (file virtualScanFileInfo) Info() DocumentFileInfo {
+	return file.DocumentFile.(DocumentFileWithInfo).Info()
+}
+
+// virtualScanFileBlank is the virtualScanFile of the file that
+// implements [BlankPageInfo].
+type virtualScanFileBlank struct {
+	*virtualScanFile
+}
+
+// Blank reports if the underlying file is a blank page.
+// It implements the [BlankPageInfo] interface.
+func (file virtualScanFileBlank) Blank() bool {
+	return file.DocumentFile.(BlankPageInfo).Blank()
+}
+
+// virtualScanFileInfoBlank is the virtualScanFile of the file that
+// implements both [DocumentFileWithInfo] and [BlankPageInfo].
+type virtualScanFileInfoBlank struct {
+	*virtualScanFile
+}
+
+// Info returns the metadata of the underlying file.
+// It implements the [DocumentFileWithInfo] interface.
+func (file virtualScanFileInfoBlank) Info() DocumentFileInfo {
+	return file.DocumentFile.(DocumentFileWithInfo).Info()
+}
+
+// Blank reports if the underlying file is a blank page.
+// It implements the [BlankPageInfo] interface.
+func (file virtualScanFileInfoBlank) Blank() bool {
+	return file.DocumentFile.(BlankPageInfo).Blank()
+}
@@ -10,17 +10,62 @@ package abstract
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/OpenPrinting/go-mfp/log"
 )
 
 // VirtualScanner implements the [Scanner] interface for the virtual
 // (simulated) scanner.
+//
+// Images are taken from the PlatenSource and ADFSource, if set,
+// or from the PlatenImage and ADFImages otherwise.
+//
+// By default, the VirtualScanner returns all pages instantly and
+// never fails. The remaining fields allow to simulate the behavior
+// of the real device:
+//
+//   - PageDelay delays each page, as if it was being scanned.
+//     Pages become available one by one, as they "finish".
+//   - Throughput limits the speed of the image data transfer.
+//   - WarmUp simulates the lamp warm-up. The warm-up starts with the
+//     first scan request, and until it finishes, Scan fails with the
+//     [ErrDeviceBusy] error.
+//   - ADFEmpty makes the ADF scan to fail with the [ErrADFEmpty] error.
+//     The same error is returned, if ADF source has no images.
+//   - CoverOpen makes any scan to fail with the [ErrCoverOpen] error.
+//   - JamAfter simulates the paper jam in the middle of the ADF batch.
+//     After JamAfter pages are returned, the Document.Next fails with
+//     the [ErrADFJam] error.
 type VirtualScanner struct {
-	ScanCaps    *ScannerCapabilities // Scanner capabilities
-	Resolution  Resolution           // Images resolution
-	PlatenImage []byte               // Image "loaded" into Platen
-	ADFImages   [][]byte             // Images "loaded" into ADF
+	ScanCaps     *ScannerCapabilities // Scanner capabilities
+	Resolution   Resolution           // Images resolution
+	PlatenImage  []byte               // Image "loaded" into Platen
+	ADFImages    [][]byte             // Images "loaded" into ADF
+	PlatenSource VirtualScannerSource // Source of Platen images
+	ADFSource    VirtualScannerSource // Source of ADF images
+
+	// Simulated timing
+	PageDelay  time.Duration // Time to scan the single page
+	Throughput int           // Transfer speed, bytes per second
+	WarmUp     time.Duration // Warm-up time
+
+	// Simulated failures
+	ADFEmpty  bool // ADF is empty
+	CoverOpen bool // Scanner cover is open
+	JamAfter  int  // ADF jams after this count of pages, if not 0
+
+	// BlankPage enables blank page detection in the returned
+	// Document. See [FilterOptions] for details.
+	BlankPage BlankPageMode
+
+	// Resampling chooses the kernel, used to emulate the requested
+	// resolution. See [FilterOptions] for details.
+	Resampling Resampling
+
+	warmUpEnd time.Time  // Warm-up end time, zero if not started
+	lock      sync.Mutex // Access lock
 }
 
 // Capabilities returns the [ScannerCapabilities].
@@ -44,24 +89,106 @@ func (vscan *VirtualScanner) Scan(ctx context.Context, rawreq ScannerRequest) (
 		return nil, err
 	}
 
-	images := [][]byte{vscan.PlatenImage}
-	if req.Input == InputADF {
-		images = vscan.ADFImages
+	err = vscan.check(req)
+	if err != nil {
+		log.Debug(ctx, "VSCAN: %s", err)
+		return nil, err
 	}
 
-	doc := NewVirtualDocument(vscan.Resolution, images...)
+	images, err := vscan.images(req)
+	if err != nil {
+		log.Debug(ctx, "VSCAN: %s", err)
+		return nil, err
+	}
 
-	opt := FilterOptions{
-		OutputFormat: req.DocumentFormat,
-		Res:          req.Resolution,
-		Reg:          req.Region,
+	if req.Input == InputADF && len(images) == 0 {
+		log.Debug(ctx, "VSCAN: %s", ErrADFEmpty)
+		return nil, ErrADFEmpty
 	}
 
+	doc := NewVirtualDocument(vscan.Resolution, images...)
+	doc = vscan.simulate(req, doc)
+
+	opt := NewFilterOptions(vscan.ScanCaps, req)
+	opt.BlankPage = vscan.BlankPage
+	opt.Resampling = vscan.Resampling
 	filter := NewFilter(doc, opt)
 
 	return filter, nil
 }
 
+// check checks the simulated device state and returns error,
+// if the scan request cannot be started.
+func (vscan *VirtualScanner) check(req *ScannerRequest) error {
+	if vscan.CoverOpen {
+		return ErrCoverOpen
+	}
+
+	if vscan.WarmUp > 0 {
+		vscan.lock.Lock()
+		now := time.Now()
+		if vscan.warmUpEnd.IsZero() {
+			vscan.warmUpEnd = now.Add(vscan.WarmUp)
+		}
+		warm := !now.Before(vscan.warmUpEnd)
+		vscan.lock.Unlock()
+
+		if !warm {
+			return ErrDeviceBusy
+		}
+	}
+
+	if req.Input == InputADF && vscan.ADFEmpty {
+		return ErrADFEmpty
+	}
+
+	return nil
+}
+
+// simulate wraps the Document to simulate timing and paper jams,
+// if requested.
+func (vscan *VirtualScanner) simulate(req *ScannerRequest,
+	doc Document) Document {
+
+	jamAfter := 0
+	if req.Input == InputADF {
+		jamAfter = vscan.JamAfter
+	}
+
+	if vscan.PageDelay <= 0 && vscan.Throughput <= 0 && jamAfter <= 0 {
+		return doc
+	}
+
+	return newVirtualScanDocument(doc, vscan.PageDelay,
+		vscan.Throughput, jamAfter)
+}
+
+// images returns images for the scan request.
+func (vscan *VirtualScanner) images(req *ScannerRequest) ([][]byte, error) {
+	source := vscan.PlatenSource
+	images := [][]byte{vscan.PlatenImage}
+
+	if req.Input == InputADF {
+		source = vscan.ADFSource
+		images = vscan.ADFImages
+	}
+
+	if source != nil {
+		var err error
+		images, err = source.Images(req, vscan.Resolution)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Platen holds the single page
+	if req.Input != InputADF && len(images) > 1 {
+		images = images[:1]
+	}
+
+	return images, nil
+}
+
 // Close closes the scanner connection.
 func (vscan *VirtualScanner) Close() error {
 	return nil
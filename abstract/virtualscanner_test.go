@@ -0,0 +1,205 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Virtual scanner tests
+
+package abstract
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestVirtualScannerCheck tests simulated device failures
+// of the VirtualScanner
+func TestVirtualScannerCheck(t *testing.T) {
+	platen := &ScannerRequest{Input: InputPlaten}
+	adf := &ScannerRequest{Input: InputADF}
+
+	vscan := &VirtualScanner{}
+	if err := vscan.check(adf); err != nil {
+		t.Errorf("no failures: unexpected error %v", err)
+	}
+
+	vscan.ADFEmpty = true
+	if err := vscan.check(platen); err != nil {
+		t.Errorf("ADFEmpty: Platen: unexpected error %v", err)
+	}
+	if err := vscan.check(adf); err != ErrADFEmpty {
+		t.Errorf("ADFEmpty: ADF: expected %v, present %v",
+			ErrADFEmpty, err)
+	}
+
+	vscan.CoverOpen = true
+	if err := vscan.check(platen); err != ErrCoverOpen {
+		t.Errorf("CoverOpen: expected %v, present %v",
+			ErrCoverOpen, err)
+	}
+
+	// Warm-up starts with the first request
+	vscan = &VirtualScanner{WarmUp: 50 * time.Millisecond}
+	if err := vscan.check(platen); err != ErrDeviceBusy {
+		t.Errorf("WarmUp: expected %v, present %v",
+			ErrDeviceBusy, err)
+	}
+
+	time.Sleep(vscan.WarmUp)
+	if err := vscan.check(platen); err != nil {
+		t.Errorf("WarmUp: finished: unexpected error %v", err)
+	}
+}
+
+// TestVirtualScanDocument tests simulated timing and paper jams
+func TestVirtualScanDocument(t *testing.T) {
+	res := Resolution{XResolution: 300, YResolution: 300}
+	data := make([]byte, 1000)
+
+	// Page delay
+	delay := 20 * time.Millisecond
+	doc := newVirtualScanDocument(NewVirtualDocument(res, data, data),
+		delay, 0, 0)
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		_, err := doc.Next()
+		if err != nil {
+			t.Fatalf("PageDelay: Next: %s", err)
+		}
+
+		if elapsed := time.Since(start); elapsed < delay {
+			t.Errorf("PageDelay: page %d returned too early (%s)",
+				i, elapsed)
+		}
+	}
+
+	if _, err := doc.Next(); err != io.EOF {
+		t.Errorf("PageDelay: expected io.EOF, present %v", err)
+	}
+
+	doc.Close()
+
+	// Throughput: 1000 bytes at 10000 bytes per second
+	doc = newVirtualScanDocument(NewVirtualDocument(res, data),
+		0, 10000, 0)
+
+	file, err := doc.Next()
+	if err != nil {
+		t.Fatalf("Throughput: Next: %s", err)
+	}
+
+	start := time.Now()
+	got, err := io.ReadAll(file)
+	elapsed := time.Since(start)
+
+	switch {
+	case err != nil:
+		t.Errorf("Throughput: Read: %s", err)
+	case len(got) != len(data):
+		t.Errorf("Throughput: %d bytes expected, %d present",
+			len(data), len(got))
+	case elapsed < 90*time.Millisecond:
+		t.Errorf("Throughput: transfer is too fast (%s)", elapsed)
+	}
+
+	doc.Close()
+
+	// Paper jam after the first page
+	doc = newVirtualScanDocument(NewVirtualDocument(res, data, data, data),
+		0, 0, 1)
+
+	if _, err = doc.Next(); err != nil {
+		t.Errorf("JamAfter: first page: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err = doc.Next(); err != ErrADFJam {
+			t.Errorf("JamAfter: expected %v, present %v",
+				ErrADFJam, err)
+		}
+	}
+
+	doc.Close()
+
+	// No jam if pages end before
+	doc = newVirtualScanDocument(NewVirtualDocument(res, data),
+		0, 0, 1)
+
+	doc.Next()
+	if _, err = doc.Next(); err != io.EOF {
+		t.Errorf("JamAfter: expected io.EOF, present %v", err)
+	}
+
+	doc.Close()
+
+	// Close interrupts the delay
+	doc = newVirtualScanDocument(NewVirtualDocument(res, data),
+		time.Hour, 0, 0)
+
+	time.AfterFunc(10*time.Millisecond, func() { doc.Close() })
+	if _, err = doc.Next(); err != ErrDocumentClosed {
+		t.Errorf("Close: expected %v, present %v",
+			ErrDocumentClosed, err)
+	}
+}
+
+// TestVirtualScanDocumentInterfaces tests that files with limited
+// throughput implement the same optional interfaces, as the
+// original files.
+func TestVirtualScanDocumentInterfaces(t *testing.T) {
+	res := Resolution{300, 300}
+	image := testutils.Images.PNG100x75rgb8
+
+	type testData struct {
+		name  string   // Test name
+		input Document // Input document
+		info  bool     // DocumentFileWithInfo expected
+		blank bool     // BlankPageInfo expected
+	}
+
+	tests := []testData{
+		{
+			name:  "plain",
+			input: testPlainDocument{NewVirtualDocument(res, image)},
+		},
+		{
+			name:  "virtual",
+			input: NewVirtualDocument(res, image),
+			info:  true,
+		},
+		{
+			name: "filter",
+			input: NewFilter(NewVirtualDocument(res, image),
+				FilterOptions{BlankPage: BlankPageFlag}),
+			info:  true,
+			blank: true,
+		},
+	}
+
+	for _, test := range tests {
+		doc := newVirtualScanDocument(test.input, 0, 1<<30, 0)
+
+		file, err := doc.Next()
+		if err != nil {
+			t.Errorf("%s: Next: %s", test.name, err)
+			doc.Close()
+			continue
+		}
+
+		_, info := file.(DocumentFileWithInfo)
+		_, blank := file.(BlankPageInfo)
+
+		if info != test.info || blank != test.blank {
+			t.Errorf("%s: DocumentFileWithInfo %v/%v, "+
+				"BlankPageInfo %v/%v (present/expected)",
+				test.name, info, test.info, blank, test.blank)
+		}
+
+		doc.Close()
+	}
+}
@@ -0,0 +1,255 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image sources for the virtual scanner
+
+package abstract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+)
+
+// VirtualScannerSource supplies page images for the [VirtualScanner].
+type VirtualScannerSource interface {
+	// Images returns images of pages for the scan request.
+	//
+	// res is the resolution, the VirtualScanner reports for
+	// the returned images.
+	//
+	// Each image is the file of any format, supported by the
+	// [NewFilter]. For the duplex ADF scan, front and back sides
+	// of sheets go interleaved. For Platen scan, only the first
+	// image is used.
+	Images(req *ScannerRequest, res Resolution) ([][]byte, error)
+}
+
+// VirtualScannerImages is the [VirtualScannerSource] that returns
+// the fixed set of images, regardless of the scan request.
+type VirtualScannerImages [][]byte
+
+// NewVirtualScannerImages creates the [VirtualScannerImages] from
+// the image files.
+//
+// Multi-page PDF, TIFF, PWG Raster and URF files are split into
+// pages, and each page becomes a separate image, re-encoded into
+// PNG. Other files are used as is.
+func NewVirtualScannerImages(files ...[]byte) (VirtualScannerImages, error) {
+	images := VirtualScannerImages{}
+
+	for _, file := range files {
+		pages, err := vsrcSplit(file)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, pages...)
+	}
+
+	return images, nil
+}
+
+// LoadVirtualScannerImages loads the [VirtualScannerImages] from
+// the files.
+//
+// Each path may be either the file name, the directory name
+// or the glob pattern (see [filepath.Match] for syntax). Files
+// from directories and files, that match the pattern, are loaded
+// in the alphabetical order. When loading directories and patterns,
+// files of unknown formats are silently skipped.
+//
+// Multi-page files are split into pages, as with the
+// [NewVirtualScannerImages].
+func LoadVirtualScannerImages(paths ...string) (VirtualScannerImages, error) {
+	images := VirtualScannerImages{}
+
+	for _, path := range paths {
+		// Expand the path
+		names := []string{path}
+		explicit := true
+
+		if st, err := os.Stat(path); err == nil && st.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+
+			names = names[:0]
+			for _, ent := range entries {
+				if !ent.IsDir() {
+					names = append(names,
+						filepath.Join(path, ent.Name()))
+				}
+			}
+			explicit = false
+		} else if err != nil {
+			matches, err2 := filepath.Glob(path)
+			if err2 != nil || len(matches) == 0 {
+				return nil, err
+			}
+
+			names = matches
+			explicit = false
+		}
+
+		sort.Strings(names)
+
+		// Load files
+		cnt := 0
+		for _, name := range names {
+			file, err := os.ReadFile(name)
+			if err != nil {
+				if !explicit && errors.Is(err, os.ErrPermission) {
+					continue
+				}
+				return nil, err
+			}
+
+			if !explicit && imgconv.MIMETypeDetect(file) == "" {
+				continue
+			}
+
+			pages, err := vsrcSplit(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			images = append(images, pages...)
+			cnt++
+		}
+
+		if cnt == 0 {
+			return nil, fmt.Errorf("%s: no images found", path)
+		}
+	}
+
+	return images, nil
+}
+
+// Images returns images of pages for the scan request.
+// It implements the [VirtualScannerSource] interface.
+func (images VirtualScannerImages) Images(*ScannerRequest,
+	Resolution) ([][]byte, error) {
+	return images, nil
+}
+
+// vsrcSplit splits the multi-page file into pages.
+// Single-page files are returned as is.
+func vsrcSplit(file []byte) ([][]byte, error) {
+	var nextPage func() (imgconv.Decoder, error)
+
+	switch imgconv.MIMETypeDetect(file) {
+	case imgconv.MIMETypePDF:
+		doc, err := imgconv.NewPDFDocumentReader(bytes.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		nextPage = doc.NextPage
+
+	case imgconv.MIMETypeTIFF:
+		doc, err := imgconv.NewTIFFDocumentReader(bytes.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		if doc.Pages() == 1 {
+			return [][]byte{file}, nil
+		}
+		nextPage = doc.NextPage
+
+	case imgconv.MIMETypePWG:
+		doc, err := imgconv.NewPWGDocumentReader(bytes.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		nextPage = func() (imgconv.Decoder, error) {
+			return doc.NextPage()
+		}
+
+	case imgconv.MIMETypeURF:
+		doc, err := imgconv.NewURFDocumentReader(bytes.NewReader(file))
+		if err != nil {
+			return nil, err
+		}
+		nextPage = func() (imgconv.Decoder, error) {
+			return doc.NextPage()
+		}
+
+	case "":
+		return nil, errors.New("unknown image format")
+
+	default:
+		return [][]byte{file}, nil
+	}
+
+	// Re-encode pages into PNG
+	pages := [][]byte{}
+	for {
+		page, err := nextPage()
+		if err == io.EOF {
+			return pages, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		png, err := vsrcEncodePNG(page)
+		page.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pages = append(pages, png)
+	}
+}
+
+// vsrcEncodePNG encodes the image into PNG.
+func vsrcEncodePNG(img imgconv.Reader) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	wid, hei := img.Size()
+
+	model := img.ColorModel()
+	switch model {
+	case imgconv.BilevelModel, color.GrayModel, color.Gray16Model,
+		color.RGBAModel, color.RGBA64Model:
+	default:
+		model = color.RGBAModel
+	}
+
+	encoder, err := imgconv.NewPNGWriter(buf, wid, hei, model)
+	if err != nil {
+		return nil, err
+	}
+
+	row := img.NewRow()
+	for {
+		_, err = img.Read(row)
+		if err != nil {
+			break
+		}
+
+		err = encoder.Write(row)
+		if err != nil {
+			break
+		}
+	}
+
+	err2 := encoder.Close()
+	switch {
+	case err != io.EOF:
+		return nil, err
+	case err2 != nil:
+		return nil, err2
+	}
+
+	return buf.Bytes(), nil
+}
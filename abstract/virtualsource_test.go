@@ -0,0 +1,266 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Virtual scanner image sources tests
+
+package abstract
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// testVirtualSourceDecode decodes the image.
+func testVirtualSourceDecode(t *testing.T, data []byte) image.Image {
+	t.Helper()
+
+	reader, err := imgconv.NewDetectReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewDetectReader: %s", err)
+	}
+	defer reader.Close()
+
+	wid, hei := reader.Size()
+	img := image.NewRGBA(image.Rect(0, 0, wid, hei))
+	row := imgconv.NewRow(color.RGBAModel, wid)
+
+	for y := 0; y < hei; y++ {
+		_, err := reader.Read(row)
+		if err != nil {
+			t.Fatalf("Read: %s", err)
+		}
+
+		for x := 0; x < wid; x++ {
+			img.Set(x, y, row.At(x))
+		}
+	}
+
+	return img
+}
+
+// testVirtualSourceTIFF creates the multi-page TIFF file.
+// Each page has its own size: 10x(10+pageno).
+func testVirtualSourceTIFF(t *testing.T, pages int) []byte {
+	buf := &bytes.Buffer{}
+	doc := imgconv.NewTIFFDocumentWriter(buf)
+
+	for i := 0; i < pages; i++ {
+		page, err := doc.NewPage(10, 10+i, color.GrayModel, 0, 0)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+		page.Close()
+	}
+
+	err := doc.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// TestVirtualScannerImages tests NewVirtualScannerImages and
+// LoadVirtualScannerImages
+func TestVirtualScannerImages(t *testing.T) {
+	png := testutils.Images.PNG100x75rgb8
+	tiff := testVirtualSourceTIFF(t, 3)
+
+	// Multi-page files are split into pages
+	images, err := NewVirtualScannerImages(png, tiff)
+	if err != nil {
+		t.Fatalf("NewVirtualScannerImages: %s", err)
+	}
+
+	if len(images) != 4 {
+		t.Fatalf("expected 4 images, present %d", len(images))
+	}
+
+	if !bytes.Equal(images[0], png) {
+		t.Errorf("single-page image must be used as is")
+	}
+
+	for i, data := range images[1:] {
+		if imgconv.MIMETypeDetect(data) != imgconv.MIMETypePNG {
+			t.Errorf("page %d: not a PNG", i)
+			continue
+		}
+
+		img := testVirtualSourceDecode(t, data)
+		if img.Bounds().Dy() != 10+i {
+			t.Errorf("page %d: pages out of order", i)
+		}
+	}
+
+	_, err = NewVirtualScannerImages([]byte("garbage"))
+	if err == nil {
+		t.Errorf("NewVirtualScannerImages: garbage must fail")
+	}
+
+	// Load from directory and glob
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "b.tiff"), tiff, 0644)
+	os.WriteFile(filepath.Join(dir, "a.png"), png, 0644)
+	os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("text"), 0644)
+
+	images, err = LoadVirtualScannerImages(dir)
+	if err != nil {
+		t.Fatalf("LoadVirtualScannerImages: %s", err)
+	}
+
+	if len(images) != 4 || !bytes.Equal(images[0], png) {
+		t.Errorf("directory: unexpected images (%d)", len(images))
+	}
+
+	images, err = LoadVirtualScannerImages(filepath.Join(dir, "*.tiff"),
+		filepath.Join(dir, "a.png"))
+	if err != nil {
+		t.Fatalf("LoadVirtualScannerImages: %s", err)
+	}
+
+	if len(images) != 4 || !bytes.Equal(images[3], png) {
+		t.Errorf("glob: unexpected images (%d)", len(images))
+	}
+
+	// Errors
+	errpaths := []string{
+		filepath.Join(dir, "missed.png"),
+		filepath.Join(dir, "*.jpeg"),
+		filepath.Join(dir, "readme.txt"),
+	}
+
+	for _, path := range errpaths {
+		_, err = LoadVirtualScannerImages(path)
+		if err == nil {
+			t.Errorf("LoadVirtualScannerImages(%q): error expected",
+				filepath.Base(path))
+		}
+	}
+}
+
+// TestVirtualScannerGenerator tests the VirtualScannerGenerator
+func TestVirtualScannerGenerator(t *testing.T) {
+	gen := &VirtualScannerGenerator{
+		Width:  100 * Millimeter,
+		Height: 150 * Millimeter,
+		Sheets: 2,
+	}
+
+	res := Resolution{XResolution: 50, YResolution: 100}
+
+	type testData struct {
+		req   ScannerRequest // Scan request
+		pages int            // Expected count of pages
+	}
+
+	tests := []testData{
+		{ScannerRequest{Input: InputPlaten}, 1},
+		{ScannerRequest{Input: InputADF, ADFMode: ADFModeSimplex}, 2},
+		{ScannerRequest{Input: InputADF, ADFMode: ADFModeDuplex}, 4},
+	}
+
+	for _, test := range tests {
+		images, err := gen.Images(&test.req, res)
+		if err != nil {
+			t.Fatalf("%s: %s", test.req.ADFMode, err)
+		}
+
+		if len(images) != test.pages {
+			t.Errorf("%s %s: expected %d pages, present %d",
+				test.req.Input, test.req.ADFMode,
+				test.pages, len(images))
+		}
+
+		for i := 1; i < len(images); i++ {
+			if bytes.Equal(images[0], images[i]) {
+				t.Errorf("%s %s: pages 0 and %d are the same",
+					test.req.Input, test.req.ADFMode, i)
+			}
+		}
+	}
+
+	// Check the image size and orientation marks
+	req := &ScannerRequest{Input: InputPlaten}
+	images, _ := gen.Images(req, res)
+	img := testVirtualSourceDecode(t, images[0])
+
+	wid := gen.Width.Dots(res.XResolution)
+	hei := gen.Height.Dots(res.YResolution)
+	if img.Bounds() != image.Rect(0, 0, wid, hei) {
+		t.Errorf("image bounds: expected %dx%d, present %v",
+			wid, hei, img.Bounds())
+	}
+
+	// Sample corners 5mm from the page edges
+	dx := (5 * Millimeter).Dots(res.XResolution)
+	dy := (5 * Millimeter).Dots(res.YResolution)
+
+	marks := []struct {
+		x, y int
+		c    color.Color
+	}{
+		{dx, dy, color.RGBA{0, 0, 0, 255}},
+		{wid - dx, dy, color.RGBA{255, 0, 0, 255}},
+		{dx, hei - dy, color.RGBA{0, 255, 0, 255}},
+		{wid - dx, hei - dy, color.RGBA{0, 0, 255, 255}},
+		{wid / 2, hei - dy, color.RGBA{255, 255, 255, 255}},
+	}
+
+	for _, mark := range marks {
+		present := color.RGBAModel.Convert(img.At(mark.x, mark.y))
+		if present != mark.c {
+			t.Errorf("pixel (%d,%d): expected %v, present %v",
+				mark.x, mark.y, mark.c, present)
+		}
+	}
+}
+
+// TestVirtualScannerSources tests VirtualScanner with sources
+func TestVirtualScannerSources(t *testing.T) {
+	one := testutils.Images.PNG100x75rgb8
+	two := testutils.Images.PNG100x75gray8
+
+	vscan := &VirtualScanner{
+		PlatenImage:  one,
+		ADFImages:    [][]byte{one},
+		PlatenSource: VirtualScannerImages{two, one},
+		ADFSource:    VirtualScannerImages{two, one},
+	}
+
+	images, err := vscan.images(&ScannerRequest{Input: InputPlaten})
+	if err != nil {
+		t.Fatalf("Platen: %s", err)
+	}
+
+	if len(images) != 1 || !bytes.Equal(images[0], two) {
+		t.Errorf("Platen: PlatenSource must be used")
+	}
+
+	images, err = vscan.images(&ScannerRequest{Input: InputADF})
+	if err != nil {
+		t.Fatalf("ADF: %s", err)
+	}
+
+	if len(images) != 2 || !bytes.Equal(images[0], two) {
+		t.Errorf("ADF: ADFSource must be used")
+	}
+
+	// Without sources, images are used
+	vscan.PlatenSource = nil
+	vscan.ADFSource = nil
+
+	images, _ = vscan.images(&ScannerRequest{Input: InputPlaten})
+	if len(images) != 1 || !bytes.Equal(images[0], one) {
+		t.Errorf("Platen: PlatenImage must be used")
+	}
+}
@@ -0,0 +1,103 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// The "model" command
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Scanner capabilities intersection, union and diff
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/modeling"
+	"github.com/OpenPrinting/go-mfp/proto/escl"
+)
+
+// capsOperations lists values of the --caps option
+var capsOperations = []string{"intersect", "union", "diff"}
+
+// capsSource represents the scanner capabilities, obtained
+// from the particular protocol
+type capsSource struct {
+	proto string                        // Protocol name
+	caps  *abstract.ScannerCapabilities // Capabilities
+}
+
+// capsCommand handles the --caps option.
+//
+// It converts scanner capabilities of all protocols, present in
+// the model, into the protocol-independent form and then either
+// intersects or unites them, writing result as the eSCL
+// ScannerCapabilities XML, or writes the human-readable
+// difference between each pair of them.
+func capsCommand(w io.Writer, model *modeling.Model, op string) error {
+	sources := capsSources(model)
+	if len(sources) < 2 {
+		err := errors.New(
+			"model must contain scanner capabilities of at least 2 protocols")
+		return err
+	}
+
+	if op == "diff" {
+		for i := 0; i < len(sources); i++ {
+			for j := i + 1; j < len(sources); j++ {
+				src1, src2 := sources[i], sources[j]
+				fmt.Fprintf(w, "--- %s\n", src1.proto)
+				fmt.Fprintf(w, "+++ %s\n", src2.proto)
+				fmt.Fprint(w, src1.caps.Diff(src2.caps))
+			}
+		}
+		return nil
+	}
+
+	caps := sources[0].caps
+	for _, src := range sources[1:] {
+		switch op {
+		case "intersect":
+			caps = caps.Intersect(src.caps)
+		case "union":
+			caps = caps.Union(src.caps)
+		}
+	}
+
+	scancaps := escl.FromAbstractScannerCapabilities(
+		escl.DefaultVersion, caps)
+	xml := scancaps.ToXML()
+
+	return xml.EncodeIndent(w, escl.NsMap, "  ")
+}
+
+// capsSources returns scanner capabilities of all protocols,
+// present in the model. Protocols without scanner inputs
+// are skipped.
+func capsSources(model *modeling.Model) []capsSource {
+	var sources []capsSource
+
+	add := func(proto string, caps *abstract.ScannerCapabilities) {
+		if caps.Platen != nil || caps.ADFSimplex != nil ||
+			caps.ADFDuplex != nil {
+			sources = append(sources, capsSource{proto, caps})
+		}
+	}
+
+	if esclcaps := model.GetESCLScanCaps(); esclcaps != nil {
+		add("eSCL", esclcaps.ToAbstract())
+	}
+
+	if wsdcaps := model.GetWSDScanCaps(); wsdcaps != nil {
+		add("WSD", wsdcaps.ToAbstract())
+	}
+
+	if ippattrs := model.GetIPPPrinterAttrs(); ippattrs != nil {
+		caps := ippattrs.ScannerDescription.ToAbstract()
+		caps.DocumentFormats = ippattrs.DocumentFormatSupported
+		add("IPP", caps)
+	}
+
+	return sources
+}
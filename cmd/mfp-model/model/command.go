@@ -99,6 +99,19 @@ var Command = argv.Command{
 				"--dnssd", "--escl", "--ipp", "--wsd",
 			},
 		},
+		argv.Option{
+			Name:    "-C",
+			Aliases: []string{"--caps"},
+			Help: "intersect, unite or diff scanner capabilities " +
+				"of existent model",
+			HelpArg:   "intersect|union|diff",
+			Singleton: true,
+			Conflicts: []string{
+				"--dnssd", "--escl", "--ipp", "--wsd", "--validate",
+			},
+			Validate: argv.ValidateStrings(capsOperations),
+			Complete: argv.CompleteStrings(capsOperations),
+		},
 		argv.Option{
 			Name:    "-d",
 			Aliases: []string{"--debug"},
@@ -136,17 +149,36 @@ func cmdModelHandler(ctx context.Context, inv *argv.Invocation) error {
 	// Check options
 	optDHSSD, haveDNSSD := inv.Get("--dnssd")
 	_, validate := inv.Get("--validate")
+	optCaps, haveCaps := inv.Get("--caps")
 	optESCL := inv.Values("--escl")
 	optIPP := inv.Values("--ipp")
 	optWSD := inv.Values("--wsd")
 
-	if !haveDNSSD && !validate &&
+	if !haveDNSSD && !validate && !haveCaps &&
 		optIPP == nil && optESCL == nil && optWSD == nil {
 
-		err := errors.New("at least one option required: --dnssd, --escl, --ipp, --wsd or --validate")
+		err := errors.New("at least one option required: --dnssd, --escl, --ipp, --wsd, --validate or --caps")
 		return err
 	}
 
+	// Handle the --caps option
+	if haveCaps {
+		model, err := modeling.NewModel()
+		if err != nil {
+			return err
+		}
+
+		defer model.Close()
+
+		file, _ := inv.Get("-m")
+		err = model.Load(file)
+		if err != nil {
+			return err
+		}
+
+		return capsCommand(os.Stdout, model, optCaps)
+	}
+
 	// Handle the --validate option
 	if validate {
 		model, err := modeling.NewModel()
@@ -11,8 +11,10 @@ package virtual
 import (
 	"context"
 	"fmt"
+	"os"
 	"strconv"
 
+	"github.com/OpenPrinting/go-mfp/abstract"
 	"github.com/OpenPrinting/go-mfp/argv"
 	"github.com/OpenPrinting/go-mfp/log"
 	"github.com/OpenPrinting/go-mfp/log/trace"
@@ -67,6 +69,35 @@ var Command = argv.Command{
 			Validate:  argv.ValidateAny,
 			Complete:  argv.CompleteOSPath,
 		},
+		argv.Option{
+			Name:      "-S",
+			Aliases:   []string{"--spool"},
+			Help:      "spool printed jobs into directory",
+			HelpArg:   "dir",
+			Singleton: true,
+			Validate:  argv.ValidateAny,
+			Complete:  argv.CompleteOSPath,
+		},
+		argv.Option{
+			Name:    "-R",
+			Aliases: []string{"--render-pages"},
+			Help:    "render pages of printed raster jobs into PNG",
+		},
+		argv.Option{
+			Name:     "-i",
+			Aliases:  []string{"--images"},
+			Help:     "scan images from file, directory or glob",
+			HelpArg:  "path",
+			Validate: argv.ValidateAny,
+			Complete: argv.CompleteOSPath,
+		},
+		argv.Option{
+			Name:      "-g",
+			Aliases:   []string{"--generate"},
+			Help:      "scan generated test pattern pages",
+			Singleton: true,
+			Conflicts: []string{"-i"},
+		},
 		argv.Option{
 			Name:     "-t",
 			Aliases:  []string{"--trace"},
@@ -160,6 +191,40 @@ func cmdVirtualHandler(ctx context.Context, inv *argv.Invocation) error {
 		}
 	}
 
+	// Setup print spooler. Without explicit spool directory,
+	// the temporary one is used.
+	spooldir, ok := inv.Get("-S")
+	if !ok {
+		spooldir, err = os.MkdirTemp("", "mfp-virtual-")
+		if err != nil {
+			return err
+		}
+
+		defer os.RemoveAll(spooldir)
+	}
+
+	log.Info(ctx, "printed jobs are spooled to %s", spooldir)
+
+	printer := &abstract.VirtualPrinter{
+		SpoolDir:    spooldir,
+		RenderPages: inv.Flag("-R"),
+	}
+
+	// Setup scanner image source. Without explicit source,
+	// the default images are used.
+	var source abstract.VirtualScannerSource
+	switch {
+	case inv.Flag("-g"):
+		source = &abstract.VirtualScannerGenerator{Sheets: 3}
+
+	case len(inv.Values("-i")) != 0:
+		source, err = abstract.LoadVirtualScannerImages(
+			inv.Values("-i")...)
+		if err != nil {
+			return err
+		}
+	}
+
 	argv := []string{}
 	if command, ok := inv.Get("command"); ok {
 		argv = append(argv, command)
@@ -168,5 +233,5 @@ func cmdVirtualHandler(ctx context.Context, inv *argv.Invocation) error {
 
 	// Run the simulator
 	usbip := inv.Flag("-U")
-	return simulate(ctx, model, port, usbip, argv)
+	return simulate(ctx, model, printer, source, port, usbip, argv)
 }
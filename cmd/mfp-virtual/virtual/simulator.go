@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/OpenPrinting/go-mfp/abstract"
 	"github.com/OpenPrinting/go-mfp/internal/env"
@@ -22,17 +23,29 @@ import (
 	"github.com/OpenPrinting/go-mfp/transport"
 )
 
+// scanJobTimeout limits the scan job lifetime, so the job, abandoned
+// by client, doesn't hold the virtual scanner forever.
+const scanJobTimeout = 5 * time.Minute
+
 // simulate runs scanner simulator.
 //
+// Printed jobs are submitted to the printer.
+//
 // If argv is not empty, it specifies the external command that will
 // be run under the simulator.
 func simulate(ctx context.Context, model *modeling.Model,
+	printer abstract.Printer, source abstract.VirtualScannerSource,
 	portnum int, usbip bool, argv []string) error {
 
 	// Create the PathMux
 	mux := transport.NewPathMux()
 	runner := env.Runner{}
 
+	// eSCL and WS-Scan share the same virtual scanner
+	arbiter := &abstract.ScannerArbiter{
+		JobTimeout: scanJobTimeout,
+	}
+
 	// Add eSCL handler
 	if esclcaps := model.GetESCLScanCaps(); esclcaps != nil {
 		s := &abstract.VirtualScanner{
@@ -47,9 +60,11 @@ func simulate(ctx context.Context, model *modeling.Model,
 				testutils.Images.PNG5100x7016,
 				testutils.Images.PNG5100x7016,
 			},
+			PlatenSource: source,
+			ADFSource:    source,
 		}
 
-		handler := model.NewESCLServer(s)
+		handler := model.NewESCLServer(arbiter.Scanner("eSCL", s))
 		mux.Add("/eSCL", handler)
 
 		runner.ESCLName = "Virtual MFP Scanner"
@@ -71,9 +86,11 @@ func simulate(ctx context.Context, model *modeling.Model,
 				testutils.Images.PNG5100x7016,
 				testutils.Images.PNG5100x7016,
 			},
+			PlatenSource: source,
+			ADFSource:    source,
 		}
 
-		handler := model.NewWSDServer(s)
+		handler := model.NewWSDServer(arbiter.Scanner("WS-Scan", s))
 		mux.Add("/WSScan", handler)
 
 		runner.WSDName = "Virtual MFP Scanner"
@@ -83,6 +100,7 @@ func simulate(ctx context.Context, model *modeling.Model,
 
 	// Add IPP handler
 	if handler := model.NewIPPServer(); handler != nil {
+		handler.SetPrintBackend(printer)
 		mux.Add("/ipp/print", handler)
 		runner.CUPSPort = portnum
 	}
@@ -117,7 +135,7 @@ func simulate(ctx context.Context, model *modeling.Model,
 		log.Info(ctx, "  sudo modprobe vhci-hcd")
 		log.Info(ctx, "  sudo usbip attach -r localhost -b 1-1")
 
-		_, err := newUsbipServer(ctx, addr, mux)
+		_, err := newUsbipServer(ctx, addr, mux, printer)
 		if err != nil {
 			return err
 		}
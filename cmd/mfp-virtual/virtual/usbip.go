@@ -13,6 +13,7 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/OpenPrinting/go-mfp/abstract"
 	"github.com/OpenPrinting/go-mfp/internal/assert"
 	"github.com/OpenPrinting/go-mfp/modeling/defaults"
 	"github.com/OpenPrinting/go-mfp/proto/ieee1284"
@@ -26,8 +27,11 @@ import (
 // The server accepts incoming USBIP connection on the provided
 // address and forwards incoming IPP over USB requests (which
 // are essentially the HTTP requests) to the provided http.Handler.
-func newUsbipServer(ctx context.Context,
-	addr net.Addr, handler http.Handler) (*usbip.Server, error) {
+//
+// Jobs, printed via the legacy USB printer interfaces, are submitted
+// to the provided abstract.Printer.
+func newUsbipServer(ctx context.Context, addr net.Addr,
+	handler http.Handler, printer abstract.Printer) (*usbip.Server, error) {
 
 	// Obtain device descriptor
 	desc := defaults.USBIPPDescriptor()
@@ -41,7 +45,7 @@ func newUsbipServer(ctx context.Context,
 
 	ieeeprinters := make([]*ieee1284.Printer, n)
 	for i := 0; i < n; i++ {
-		ieeeprinters[i] = ieee1284.NewPrinter(ctx, nil)
+		ieeeprinters[i] = ieee1284.NewPrinter(ctx, printer)
 	}
 
 	// Create the USB printer device
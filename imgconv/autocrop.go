@@ -0,0 +1,518 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Automatic cropping and deskewing
+
+package imgconv
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+)
+
+// Default AutoCrop parameters
+const (
+	autoCropThreshold = 0.15 // Default AutoCrop.Threshold
+	autoCropMaxAngle  = 10   // Default AutoCrop.MaxAngle
+	autoCropMinAngle  = 0.05 // Smaller angles are not corrected
+	autoCropRun       = 4    // Min run of page pixels, for page edge
+	autoCropMinPoints = 8    // Min points to estimate edge slope
+)
+
+// AutoCrop defines parameters of the automatic cropping and
+// deskewing of the scanned page.
+//
+// The page is detected against the scanner background (the platen
+// lid or ADF backing), which luminance is estimated from the image
+// edges. So the page must not cover the whole image and must be
+// noticeably lighter or darker that the background. Otherwise,
+// the image content is used to find the page boundaries.
+type AutoCrop struct {
+	// Crop requests cropping the image to the page boundaries.
+	Crop bool
+
+	// Deskew requests the page skew correction. Skew is
+	// estimated from the page edges and corrected by rotating
+	// the image.
+	Deskew bool
+
+	// Threshold is the minimal luminance difference between the
+	// page and the background, in range [0...1.0]. Zero means 0.15.
+	Threshold float64
+
+	// MaxAngle is the maximal skew angle to correct, in degrees.
+	// Larger angles most likely mean detection failure and will
+	// not be corrected. Zero means 10 degrees.
+	MaxAngle float64
+}
+
+// autoCrop implements the automatic cropping and deskewing filter.
+type autoCrop struct {
+	input    Reader          // Image source
+	rows     []Row           // Buffered source image
+	srcWid   int             // Source image width
+	srcHei   int             // Source image height
+	rect     image.Rectangle // Output rectangle (deskewed coordinates)
+	sin, cos float64         // Deskew rotation
+	cx, cy   float64         // Rotation center
+	out      RowFP           // Output row
+	samples  []float32       // Samples of the output row
+	ch       int             // Channels per pixel in samples
+	y        int             // Current output row
+}
+
+// autoCropEdges contains the page edges, found in the image.
+//
+// For each row, left and right contain the leftmost and rightmost
+// page pixels. For each column, top and bottom contain the topmost
+// and bottommost page pixels. -1 means no page pixels.
+type autoCropEdges struct {
+	left, right []int // Per row
+	top, bottom []int // Per column
+}
+
+// IsIdentity reports if AutoCrop doesn't change the image.
+func (ac AutoCrop) IsIdentity() bool {
+	return !ac.Crop && !ac.Deskew
+}
+
+// NewAutoCrop creates a new automatic cropping and deskewing filter
+// on a top of the existent [Reader].
+//
+// The page boundaries and skew can be found only when the whole image
+// is available, so NewAutoCrop reads the entire input image into the
+// memory. It returns an error, if input image cannot be read. On
+// error, the input Reader is not closed.
+//
+// Areas of the output image, not covered by the source image, are
+// filled with the white color.
+//
+// If AutoCrop.IsIdentity is true, the filter is bypassed.
+func NewAutoCrop(in Reader, ac AutoCrop) (Reader, error) {
+	wid, hei := in.Size()
+	if ac.IsIdentity() || wid == 0 || hei == 0 {
+		return in, nil
+	}
+
+	// Load the image
+	rows := make([]Row, hei)
+	lum := make([]color.Gray, wid*hei)
+
+	for y := range rows {
+		rows[y] = in.NewRow()
+		_, err := in.Read(rows[y])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		gray8Row(RowGray8(lum[y*wid:(y+1)*wid]), rows[y])
+	}
+
+	// Find the page
+	threshold := ac.Threshold
+	if threshold == 0 {
+		threshold = autoCropThreshold
+	}
+
+	edges := autoCropFindEdges(lum, wid, hei, threshold)
+
+	// Estimate the skew
+	angle := 0.0
+	if ac.Deskew {
+		maxAngle := ac.MaxAngle
+		if maxAngle == 0 {
+			maxAngle = autoCropMaxAngle
+		}
+
+		angle = edges.skew(wid, hei)
+		deg := math.Abs(angle * 180 / math.Pi)
+		if deg < autoCropMinAngle || deg > maxAngle {
+			angle = 0
+		}
+	}
+
+	acr := &autoCrop{
+		input:  in,
+		rows:   rows,
+		srcWid: wid,
+		srcHei: hei,
+		rect:   image.Rect(0, 0, wid, hei),
+		sin:    math.Sin(angle),
+		cos:    math.Cos(angle),
+		cx:     float64(wid) / 2,
+		cy:     float64(hei) / 2,
+	}
+
+	if ac.Crop {
+		acr.rect = acr.crop(edges)
+	}
+
+	acr.out = NewRowFP(in.ColorModel(), acr.rect.Dx())
+	switch out := acr.out.(type) {
+	case RowGrayFP32:
+		acr.samples, acr.ch = out, 1
+	case RowRGBAFP32:
+		acr.samples, acr.ch = out, 4
+	}
+
+	return acr, nil
+}
+
+// autoCropFindEdges finds the page edges in the image, represented
+// by its luminance.
+func autoCropFindEdges(lum []color.Gray, wid, hei int,
+	threshold float64) autoCropEdges {
+
+	// Estimate background luminance as a median of border pixels
+	border := make([]int, 0, 2*(wid+hei))
+	for x := 0; x < wid; x++ {
+		border = append(border,
+			int(lum[x].Y), int(lum[(hei-1)*wid+x].Y))
+	}
+	for y := 0; y < hei; y++ {
+		border = append(border,
+			int(lum[y*wid].Y), int(lum[y*wid+wid-1].Y))
+	}
+
+	sort.Ints(border)
+	bg := border[len(border)/2]
+	thr := int(threshold * 255)
+
+	page := func(x, y int) bool {
+		d := int(lum[y*wid+x].Y) - bg
+		return d > thr || d < -thr
+	}
+
+	// find returns the position of the first run of page pixels
+	// along the line, or -1 if not found
+	find := func(n int, at func(i int) bool) int {
+		run := 0
+		for i := 0; i < n; i++ {
+			if !at(i) {
+				run = 0
+				continue
+			}
+
+			run++
+			if run == autoCropRun || run == n {
+				return i - run + 1
+			}
+		}
+		return -1
+	}
+
+	edges := autoCropEdges{
+		left:   make([]int, hei),
+		right:  make([]int, hei),
+		top:    make([]int, wid),
+		bottom: make([]int, wid),
+	}
+
+	for y := 0; y < hei; y++ {
+		edges.left[y] = find(wid, func(x int) bool {
+			return page(x, y)
+		})
+
+		edges.right[y] = -1
+		if edges.left[y] >= 0 {
+			edges.right[y] = wid - 1 - find(wid, func(x int) bool {
+				return page(wid-1-x, y)
+			})
+		}
+	}
+
+	for x := 0; x < wid; x++ {
+		edges.top[x] = find(hei, func(y int) bool {
+			return page(x, y)
+		})
+
+		edges.bottom[x] = -1
+		if edges.top[x] >= 0 {
+			edges.bottom[x] = hei - 1 - find(hei, func(y int) bool {
+				return page(x, hei-1-y)
+			})
+		}
+	}
+
+	return edges
+}
+
+// skew estimates the page skew angle, in radians, from its edges.
+// Positive angle means clockwise rotation. If skew cannot be
+// estimated, 0 is returned.
+//
+// Edges that touch the image border (i.e., the page is partially
+// out of the image) are not used for estimation.
+func (edges autoCropEdges) skew(wid, hei int) float64 {
+	var estimates []float64
+
+	// Vertical edges: x = a*y + b, a = -tan(angle)
+	if a, ok := autoCropSlope(edges.left, 0); ok {
+		estimates = append(estimates, -a)
+	}
+	if a, ok := autoCropSlope(edges.right, wid-1); ok {
+		estimates = append(estimates, -a)
+	}
+
+	// Horizontal edges: y = a*x + b, a = tan(angle)
+	if a, ok := autoCropSlope(edges.top, 0); ok {
+		estimates = append(estimates, a)
+	}
+	if a, ok := autoCropSlope(edges.bottom, hei-1); ok {
+		estimates = append(estimates, a)
+	}
+
+	if len(estimates) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, e := range estimates {
+		sum += e
+	}
+
+	return math.Atan(sum / float64(len(estimates)))
+}
+
+// autoCropSlope estimates slope of the page edge, given as a
+// sequence of its points positions (-1 for missed points).
+//
+// Only the middle half of the edge is used, as its ends may be
+// affected by the page corners. Edge is rejected, if many of its
+// points lie at the image border.
+func autoCropSlope(edge []int, border int) (float64, bool) {
+	// Find the edge extent
+	first, last := -1, -1
+	for i, v := range edge {
+		if v >= 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	if first < 0 {
+		return 0, false
+	}
+
+	n := last - first + 1
+	first += n / 4
+	last -= n / 4
+
+	// Collect points
+	var pts [][2]float64
+	atBorder := 0
+	for i := first; i <= last; i++ {
+		switch edge[i] {
+		case -1:
+		case border:
+			atBorder++
+		default:
+			pts = append(pts, [2]float64{float64(i), float64(edge[i])})
+		}
+	}
+
+	if len(pts) < autoCropMinPoints || atBorder > len(pts) {
+		return 0, false
+	}
+
+	// Fit the line, then refit without outliers
+	a, b := autoCropFit(pts)
+
+	dev := 0.0
+	for _, p := range pts {
+		dev += math.Abs(p[1] - (a*p[0] + b))
+	}
+	dev = math.Max(2, 2*dev/float64(len(pts)))
+
+	inliers := pts[:0]
+	for _, p := range pts {
+		if math.Abs(p[1]-(a*p[0]+b)) <= dev {
+			inliers = append(inliers, p)
+		}
+	}
+
+	if len(inliers) < autoCropMinPoints {
+		return 0, false
+	}
+
+	a, _ = autoCropFit(inliers)
+	return a, true
+}
+
+// autoCropFit fits the line y = a*x + b to the points, using
+// the least squares method.
+func autoCropFit(pts [][2]float64) (a, b float64) {
+	var sx, sy, sxx, sxy float64
+	for _, p := range pts {
+		sx += p[0]
+		sy += p[1]
+		sxx += p[0] * p[0]
+		sxy += p[0] * p[1]
+	}
+
+	n := float64(len(pts))
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0, sy / n
+	}
+
+	a = (n*sxy - sx*sy) / d
+	b = (sy - a*sx) / n
+	return
+}
+
+// crop returns the page bounding rectangle in the deskewed
+// coordinates. If page is not found, the whole image is returned.
+func (acr *autoCrop) crop(edges autoCropEdges) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+
+	for y, left := range edges.left {
+		if left < 0 {
+			continue
+		}
+
+		right := edges.right[y] + 1
+		corners := [][2]float64{
+			{float64(left), float64(y)},
+			{float64(left), float64(y + 1)},
+			{float64(right), float64(y)},
+			{float64(right), float64(y + 1)},
+		}
+
+		for _, p := range corners {
+			dx, dy := p[0]-acr.cx, p[1]-acr.cy
+			x := acr.cos*dx + acr.sin*dy + acr.cx
+			y := -acr.sin*dx + acr.cos*dy + acr.cy
+
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		}
+	}
+
+	if math.IsInf(minX, 0) {
+		return image.Rect(0, 0, acr.srcWid, acr.srcHei)
+	}
+
+	return image.Rect(
+		int(math.Floor(minX+0.5)), int(math.Floor(minY+0.5)),
+		int(math.Floor(maxX+0.5)), int(math.Floor(maxY+0.5)))
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (acr *autoCrop) ColorModel() color.Model {
+	return acr.input.ColorModel()
+}
+
+// Size returns the image size.
+func (acr *autoCrop) Size() (wid, hei int) {
+	return acr.rect.Dx(), acr.rect.Dy()
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (acr *autoCrop) NewRow() Row {
+	return NewRow(acr.ColorModel(), acr.rect.Dx())
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (acr *autoCrop) Read(row Row) (int, error) {
+	if acr.y == acr.rect.Dy() {
+		return 0, io.EOF
+	}
+
+	y := acr.rect.Min.Y + acr.y
+	acr.y++
+
+	// Fast path: cropping without rotation
+	if acr.sin == 0 {
+		return row.Copy(acr.rows[y].Slice(
+			acr.rect.Min.X, acr.rect.Max.X)), nil
+	}
+
+	// Rotate with bi-linear interpolation
+	for i := range acr.samples {
+		acr.samples[i] = 0
+	}
+
+	dy := float64(y) + 0.5 - acr.cy
+	for x := 0; x < acr.rect.Dx(); x++ {
+		dx := float64(acr.rect.Min.X+x) + 0.5 - acr.cx
+		sx := acr.cos*dx - acr.sin*dy + acr.cx - 0.5
+		sy := acr.sin*dx + acr.cos*dy + acr.cy - 0.5
+
+		x0, y0 := math.Floor(sx), math.Floor(sy)
+		fx, fy := float32(sx-x0), float32(sy-y0)
+		ix, iy := int(x0), int(y0)
+
+		s := acr.samples[x*acr.ch : (x+1)*acr.ch]
+		acr.sample(s, ix, iy, (1-fx)*(1-fy))
+		acr.sample(s, ix+1, iy, fx*(1-fy))
+		acr.sample(s, ix, iy+1, (1-fx)*fy)
+		acr.sample(s, ix+1, iy+1, fx*fy)
+	}
+
+	return row.Copy(acr.out), nil
+}
+
+// sample adds the source pixel at (x, y), multiplied by the
+// weight w, to the output pixel samples s. Pixels outside of
+// the source image are white.
+func (acr *autoCrop) sample(s []float32, x, y int, w float32) {
+	if w == 0 {
+		return
+	}
+
+	if x < 0 || y < 0 || x >= acr.srcWid || y >= acr.srcHei {
+		for i := range s {
+			s[i] += w
+		}
+		return
+	}
+
+	switch row := acr.rows[y].(type) {
+	case RowGray8:
+		s[0] += w * float32(row[x].Y) / 0xff
+	case RowGray16:
+		s[0] += w * float32(row[x].Y) / 0xffff
+	case RowRGBA32:
+		c := row[x]
+		s[0] += w * float32(c.R) / 0xff
+		s[1] += w * float32(c.G) / 0xff
+		s[2] += w * float32(c.B) / 0xff
+		s[3] += w * float32(c.A) / 0xff
+	case RowRGBA64:
+		c := row[x]
+		s[0] += w * float32(c.R) / 0xffff
+		s[1] += w * float32(c.G) / 0xffff
+		s[2] += w * float32(c.B) / 0xffff
+		s[3] += w * float32(c.A) / 0xffff
+	default:
+		r, g, b, a := row.At(x).RGBA()
+		s[0] += w * float32(r) / 0xffff
+		if len(s) == 4 {
+			s[1] += w * float32(g) / 0xffff
+			s[2] += w * float32(b) / 0xffff
+			s[3] += w * float32(a) / 0xffff
+		}
+	}
+}
+
+// Close closes the reader.
+func (acr *autoCrop) Close() {
+	acr.rows = nil
+	acr.input.Close()
+}
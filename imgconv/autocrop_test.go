@@ -0,0 +1,200 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Automatic cropping and deskewing test
+
+package imgconv
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// testAutoCropPage returns the image of the light page on a dark
+// background. The page occupies the rect and rotated clockwise by
+// the angle (in degrees) around the image center.
+func testAutoCropPage(wid, hei int, rect image.Rectangle,
+	angle float64) [][]uint8 {
+
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	cx, cy := float64(wid)/2, float64(hei)/2
+
+	pixels := make([][]uint8, hei)
+	for y := range pixels {
+		pixels[y] = make([]uint8, wid)
+		for x := range pixels[y] {
+			// Rotate pixel center back
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			px := cos*dx + sin*dy + cx
+			py := -sin*dx + cos*dy + cy
+
+			pixels[y][x] = 30
+			if float64(rect.Min.X) <= px && px < float64(rect.Max.X) &&
+				float64(rect.Min.Y) <= py && py < float64(rect.Max.Y) {
+				pixels[y][x] = 240
+			}
+		}
+	}
+
+	return pixels
+}
+
+// TestAutoCrop tests the automatic cropping and deskewing filter
+func TestAutoCrop(t *testing.T) {
+	const wid, hei = 200, 160
+	rect := image.Rect(30, 20, 170, 140)
+
+	type testData struct {
+		name     string  // Test name
+		angle    float64 // Page rotation, degrees
+		ac       AutoCrop
+		wid, hei int // Expected output size
+	}
+
+	tests := []testData{
+		{
+			name: "crop",
+			ac:   AutoCrop{Crop: true},
+			wid:  rect.Dx(),
+			hei:  rect.Dy(),
+		},
+		{
+			name:  "deskew",
+			angle: 3,
+			ac:    AutoCrop{Deskew: true},
+			wid:   wid,
+			hei:   hei,
+		},
+		{
+			name:  "crop+deskew",
+			angle: -4,
+			ac:    AutoCrop{Crop: true, Deskew: true},
+			wid:   rect.Dx(),
+			hei:   rect.Dy(),
+		},
+		{
+			name:  "angle too large",
+			angle: 4,
+			ac:    AutoCrop{Deskew: true, MaxAngle: 2},
+			wid:   wid,
+			hei:   hei,
+		},
+	}
+
+	models := map[string]color.Model{
+		"Gray8":  color.GrayModel,
+		"RGBA32": color.RGBAModel,
+	}
+
+	for _, test := range tests {
+		pixels := testAutoCropPage(wid, hei, rect, test.angle)
+
+		for name, model := range models {
+			in := NewColorModelFilter(
+				newRowsReader(color.GrayModel,
+					testGrayRows(pixels)),
+				model)
+
+			filter, err := NewAutoCrop(in, test.ac)
+			if err != nil {
+				t.Errorf("%s (%s): %s", test.name, name, err)
+				continue
+			}
+
+			// Check image size
+			w, h := filter.Size()
+			if abs(w-test.wid) > 2 || abs(h-test.hei) > 2 {
+				t.Errorf("%s (%s): size mismatch:\n"+
+					"expected: %dx%d\n"+
+					"present:  %dx%d",
+					test.name, name, test.wid, test.hei, w, h)
+			}
+
+			rows := mustDecodeImageRows(filter)
+			if len(rows) != h {
+				t.Errorf("%s (%s): %d rows expected, %d present",
+					test.name, name, h, len(rows))
+				continue
+			}
+
+			// Page edges must be straightened: in the deskewed
+			// image, rows in the middle of the page must start
+			// at the same column. Note, corners of the deskewed
+			// image are filled with white, so we look for the
+			// dark to light transition.
+			if test.ac.Deskew && !test.ac.Crop &&
+				test.ac.MaxAngle == 0 {
+				first := func(y int) int {
+					for x := 1; x < w; x++ {
+						if testGrayAt(rows, x-1, y) <= 128 &&
+							testGrayAt(rows, x, y) > 128 {
+							return x
+						}
+					}
+					return -1
+				}
+
+				top := first(h/2 - 40)
+				bottom := first(h/2 + 40)
+				if abs(top-bottom) > 1 {
+					t.Errorf("%s (%s): page not deskewed: "+
+						"edge at %d and %d",
+						test.name, name, top, bottom)
+				}
+			}
+
+			// Cropped page must not contain the background,
+			// except the thin strip at edges.
+			if test.ac.Crop {
+				dark := 0
+				for y := range rows {
+					for x := 0; x < w; x++ {
+						if testGrayAt(rows, x, y) <= 128 {
+							dark++
+						}
+					}
+				}
+
+				if dark > (w+h)*2 {
+					t.Errorf("%s (%s): background not cropped: "+
+						"%d dark pixels",
+						test.name, name, dark)
+				}
+			}
+		}
+	}
+}
+
+// TestAutoCropNoPage tests AutoCrop on image without the page
+func TestAutoCropNoPage(t *testing.T) {
+	pixels := testAutoCropPage(50, 40, image.Rectangle{}, 0)
+	in := newRowsReader(color.GrayModel, testGrayRows(pixels))
+
+	filter, err := NewAutoCrop(in, AutoCrop{Crop: true, Deskew: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if w, h := filter.Size(); w != 50 || h != 40 {
+		t.Errorf("size mismatch: expected 50x40, present %dx%d", w, h)
+	}
+
+	// Identity AutoCrop bypasses the filter
+	filter, _ = NewAutoCrop(in, AutoCrop{})
+	if filter != in {
+		t.Errorf("identity AutoCrop must bypass the filter")
+	}
+}
+
+// abs returns the absolute value of the integer
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,163 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Bilevel (1-bit black and white) images
+
+package imgconv
+
+import (
+	"image/color"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// BilevelModel is the [color.Model] for the bilevel (1-bit black
+// and white) images.
+//
+// It converts colors into the pure black or pure white [color.Gray],
+// using the 50% luminance threshold.
+var BilevelModel color.Model = color.ModelFunc(bilevelModel)
+
+// bilevelModel converts any color.Color into the bilevel color.
+func bilevelModel(c color.Color) color.Color {
+	return bilevelGray(bilevelWhite(c))
+}
+
+// bilevelWhite reports whether color is white in terms of
+// the BilevelModel.
+func bilevelWhite(c color.Color) bool {
+	switch c := c.(type) {
+	case color.Gray:
+		return c.Y >= 0x80
+	case color.Gray16:
+		return c.Y >= 0x8000
+	}
+
+	y := color.Gray16Model.Convert(c).(color.Gray16).Y
+	return y >= 0x8000
+}
+
+// bilevelGray returns the color.Gray for the bilevel pixel.
+func bilevelGray(white bool) color.Gray {
+	if white {
+		return color.Gray{Y: 0xff}
+	}
+	return color.Gray{Y: 0}
+}
+
+// RowBilevel represents a row of the bilevel (1-bit black and
+// white) image.
+//
+// Pixels are packed 8 per byte, most significant bit first.
+// The bit set means white, the same way as in the 1-bit
+// grayscale PNG images.
+type RowBilevel struct {
+	bits []byte // Packed pixels
+	off  int    // Offset of the first pixel, in bits
+	wid  int    // Row width, in pixels
+}
+
+// NewRowBilevel returns the new [RowBilevel] of the specified width.
+// Initially, all pixels are black.
+func NewRowBilevel(wid int) RowBilevel {
+	return RowBilevel{bits: make([]byte, (wid+7)/8), wid: wid}
+}
+
+// Width returns the row width, in pixels.
+func (r RowBilevel) Width() int {
+	return r.wid
+}
+
+// At returns pixel at the specified position as [color.Color].
+func (r RowBilevel) At(x int) color.Color {
+	return r.GrayAt(x)
+}
+
+// GrayAt returns pixel at the specified position as [color.Gray].
+func (r RowBilevel) GrayAt(x int) color.Gray {
+	return bilevelGray(r.BitAt(x))
+}
+
+// BitAt reports whether pixel at the specified position is white.
+func (r RowBilevel) BitAt(x int) bool {
+	x += r.off
+	return r.bits[x>>3]&(0x80>>(x&7)) != 0
+}
+
+// SetBit sets the pixel at the specified position to white
+// (if white is true) or black.
+func (r RowBilevel) SetBit(x int, white bool) {
+	x += r.off
+	mask := byte(0x80 >> (x & 7))
+	if white {
+		r.bits[x>>3] |= mask
+	} else {
+		r.bits[x>>3] &^= mask
+	}
+}
+
+// Set sets the pixel at the specified position.
+func (r RowBilevel) Set(x int, c color.Color) {
+	r.SetBit(x, bilevelWhite(c))
+}
+
+// Slice returns a [low:high] sub-slice of the original Row.
+func (r RowBilevel) Slice(low, high int) Row {
+	if low < 0 || high < low || high > r.wid {
+		panic("RowBilevel.Slice: bounds out of range")
+	}
+	return RowBilevel{bits: r.bits, off: r.off + low, wid: high - low}
+}
+
+// Fill fills Row with the pixels of the specified color
+func (r RowBilevel) Fill(c color.Color) {
+	white := bilevelWhite(c)
+	for x := 0; x < r.wid; x++ {
+		r.SetBit(x, white)
+	}
+}
+
+// Copy copies content of the r2 into the receiver Row.
+func (r RowBilevel) Copy(r2 Row) int {
+	wid := generic.Min(r.Width(), r2.Width())
+
+	switch r2 := r2.(type) {
+	case RowBilevel:
+		if r.off%8 == 0 && r2.off%8 == 0 && wid%8 == 0 {
+			copy(r.bits[r.off/8:r.off/8+wid/8],
+				r2.bits[r2.off/8:])
+			return wid
+		}
+
+		// Rows may overlap, so choose direction carefully.
+		if r.off > r2.off {
+			for x := wid - 1; x >= 0; x-- {
+				r.SetBit(x, r2.BitAt(x))
+			}
+		} else {
+			for x := 0; x < wid; x++ {
+				r.SetBit(x, r2.BitAt(x))
+			}
+		}
+
+	case RowGray8:
+		for x := 0; x < wid; x++ {
+			r.SetBit(x, r2[x].Y >= 0x80)
+		}
+
+	case RowGrayFP32:
+		for x := 0; x < wid; x++ {
+			r.SetBit(x, r2[x] >= 0.5)
+		}
+
+	default:
+		for x := 0; x < wid; x++ {
+			r.SetBit(x, bilevelWhite(r2.At(x)))
+		}
+	}
+
+	return wid
+}
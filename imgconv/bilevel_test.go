@@ -0,0 +1,162 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Bilevel images test
+
+package imgconv
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// TestRowBilevel tests RowBilevel operations
+func TestRowBilevel(t *testing.T) {
+	row := NewRowBilevel(20)
+	if row.Width() != 20 {
+		t.Errorf("RowBilevel.Width: expected %d, present %d",
+			20, row.Width())
+	}
+
+	// New row must be black
+	for x := 0; x < row.Width(); x++ {
+		if row.BitAt(x) {
+			t.Errorf("NewRowBilevel: pixel %d is not black", x)
+		}
+	}
+
+	// Set/At
+	row.Set(3, color.White)
+	row.Set(9, color.Gray{Y: 0x80})
+	row.Set(10, color.Gray{Y: 0x7f})
+
+	for x := 0; x < row.Width(); x++ {
+		expected := color.Gray{}
+		if x == 3 || x == 9 {
+			expected = color.Gray{Y: 0xff}
+		}
+
+		present := row.At(x)
+		if present != expected {
+			t.Errorf("RowBilevel.At(%d): expected %v, present %v",
+				x, expected, present)
+		}
+	}
+
+	// Fill of unaligned slice must not affect neighbor pixels
+	row.Fill(color.Black)
+	row.Slice(5, 13).Fill(color.White)
+
+	for x := 0; x < row.Width(); x++ {
+		expected := x >= 5 && x < 13
+		if row.BitAt(x) != expected {
+			t.Errorf("RowBilevel.Slice(5,13).Fill: pixel %d: "+
+				"expected %v, present %v",
+				x, expected, row.BitAt(x))
+		}
+	}
+
+	// Copy from unaligned slice
+	row2 := NewRowBilevel(10)
+	n := row2.Copy(row.Slice(3, 20))
+	if n != 10 {
+		t.Errorf("RowBilevel.Copy: expected %d, present %d", 10, n)
+	}
+
+	for x := 0; x < row2.Width(); x++ {
+		expected := x+3 >= 5 && x+3 < 13
+		if row2.BitAt(x) != expected {
+			t.Errorf("RowBilevel.Copy: pixel %d: "+
+				"expected %v, present %v",
+				x, expected, row2.BitAt(x))
+		}
+	}
+
+	// Copy from RowGray8
+	gray := RowGray8{{Y: 0}, {Y: 0x7f}, {Y: 0x80}, {Y: 0xff}}
+	row3 := NewRowBilevel(4)
+	row3.Copy(gray)
+
+	for x, expected := range []bool{false, false, true, true} {
+		if row3.BitAt(x) != expected {
+			t.Errorf("RowBilevel.Copy(RowGray8): pixel %d: "+
+				"expected %v, present %v",
+				x, expected, row3.BitAt(x))
+		}
+	}
+}
+
+// TestRowBilevelSlicePanic tests that RowBilevel.Slice panics
+// on invalid bounds
+func TestRowBilevelSlicePanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RowBilevel.Slice: panic expected")
+		}
+	}()
+
+	NewRowBilevel(8).Slice(2, 9)
+}
+
+// TestPNGBilevel tests encoding of the 1-bit PNG images
+func TestPNGBilevel(t *testing.T) {
+	const wid, hei = 13, 5
+
+	// Create a checkerboard image
+	rows := make([]Row, hei)
+	for y := range rows {
+		row := NewRowBilevel(wid)
+		for x := 0; x < wid; x++ {
+			row.SetBit(x, (x+y)&1 != 0)
+		}
+		rows[y] = row
+	}
+
+	// Encode the image
+	buf := &bytes.Buffer{}
+	writer, err := NewPNGWriter(buf, wid, hei, BilevelModel)
+	if err != nil {
+		t.Fatalf("NewPNGWriter: %s", err)
+	}
+
+	for _, row := range rows {
+		err = writer.Write(row)
+		if err != nil {
+			t.Fatalf("PNGWriter.Write: %s", err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("PNGWriter.Close: %s", err)
+	}
+
+	// Check the header: bit depth 1, color type 0 (grayscale)
+	hdr := buf.Bytes()[16:26]
+	if hdr[8] != 1 || hdr[9] != 0 {
+		t.Errorf("PNG IHDR: expected depth=1 type=0, present %d %d",
+			hdr[8], hdr[9])
+	}
+
+	// Decode and compare
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("png.Decode: %s", err)
+	}
+
+	for y := 0; y < hei; y++ {
+		for x := 0; x < wid; x++ {
+			expected := bilevelGray((x+y)&1 != 0)
+			present := color.GrayModel.Convert(img.At(x, y))
+			if present != expected {
+				t.Errorf("(%d,%d): expected %v, present %v",
+					x, y, expected, present)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Blank page detector
+
+package imgconv
+
+import (
+	"image/color"
+	"math"
+)
+
+// blankMargin is the fraction of image width and height, excluded
+// from analysis at each image edge. Scanners often produce shadows
+// and dark borders near the page edges, which are not a content.
+const blankMargin = 0.05
+
+// blankInkLevel is the minimal difference between luminance of the
+// pixel and the background, for pixel to be considered as "ink".
+const blankInkLevel = 0.25
+
+// BlankDetector is the image filter that passes the image unchanged
+// and gathers the statistics, used to detect blank pages.
+//
+// It implements the [Reader] interface. Statistics becomes available
+// via the [BlankDetector.Stats] after the whole image is read.
+type BlankDetector struct {
+	input       Reader      // Image source
+	wid, hei    int         // Image size
+	left, right int         // Analyzed columns
+	top, bottom int         // Analyzed rows
+	y           int         // Current row
+	gray        RowGray8    // Row, converted to grayscale
+	hist        [256]uint64 // Luminance histogram
+}
+
+// BlankStats contains the image statistics, gathered by the
+// [BlankDetector].
+type BlankStats struct {
+	// Background is the background (paper) luminance, in range
+	// [0...1.0]. It is the most often luminance in the image.
+	Background float64
+
+	// Coverage is the fraction of the "ink" pixels, in range
+	// [0...1.0]. Pixels, noticeably darker that the background,
+	// are counted as ink.
+	Coverage float64
+
+	// Variance is the variance of the pixels luminance.
+	// Luminance is in range [0...1.0], so the variance
+	// is in range [0...0.25].
+	Variance float64
+}
+
+// NewBlankDetector creates a new [BlankDetector] on a top of the
+// existent [Reader].
+//
+// The image margins (5% of width and height at each edge) are
+// excluded from analysis.
+func NewBlankDetector(in Reader) *BlankDetector {
+	wid, hei := in.Size()
+	mx := int(float64(wid) * blankMargin)
+	my := int(float64(hei) * blankMargin)
+
+	return &BlankDetector{
+		input:  in,
+		wid:    wid,
+		hei:    hei,
+		left:   mx,
+		right:  wid - mx,
+		top:    my,
+		bottom: hei - my,
+		gray:   make(RowGray8, wid-2*mx),
+	}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (bd *BlankDetector) ColorModel() color.Model {
+	return bd.input.ColorModel()
+}
+
+// Size returns the image size.
+func (bd *BlankDetector) Size() (wid, hei int) {
+	return bd.wid, bd.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (bd *BlankDetector) NewRow() Row {
+	return bd.input.NewRow()
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (bd *BlankDetector) Read(row Row) (int, error) {
+	n, err := bd.input.Read(row)
+	if err != nil {
+		return n, err
+	}
+
+	if bd.top <= bd.y && bd.y < bd.bottom &&
+		row.Width() >= bd.right && bd.left < bd.right {
+
+		gray8Row(bd.gray, row.Slice(bd.left, bd.right))
+		for _, c := range bd.gray {
+			bd.hist[c.Y]++
+		}
+	}
+
+	bd.y++
+	return n, nil
+}
+
+// Close closes the reader.
+func (bd *BlankDetector) Close() {
+	bd.input.Close()
+}
+
+// Stats returns the gathered statistics.
+func (bd *BlankDetector) Stats() BlankStats {
+	// Compute total, mean and the histogram peak
+	var total, sum uint64
+	peak := 0
+
+	for l, cnt := range bd.hist {
+		total += cnt
+		sum += uint64(l) * cnt
+		if cnt > bd.hist[peak] {
+			peak = l
+		}
+	}
+
+	if total == 0 {
+		return BlankStats{Background: 1}
+	}
+
+	mean := float64(sum) / float64(total) / 255
+
+	// Compute variance and ink coverage
+	inkLevel := float64(peak)/255 - blankInkLevel
+	var variance float64
+	var ink uint64
+
+	for l, cnt := range bd.hist {
+		v := float64(l) / 255
+		variance += math.Pow(v-mean, 2) * float64(cnt)
+		if v < inkLevel {
+			ink += cnt
+		}
+	}
+
+	return BlankStats{
+		Background: float64(peak) / 255,
+		Coverage:   float64(ink) / float64(total),
+		Variance:   variance / float64(total),
+	}
+}
+
+// gray8Row converts the source Row into the 8-bit grayscale.
+// Both rows must be of the same width.
+func gray8Row(dst RowGray8, src Row) {
+	switch src := src.(type) {
+	case RowRGBA32:
+		// Fast path for the most common case. Luminance
+		// is computed the same way as by color.GrayModel.
+		for x, c := range src {
+			y := (19595*uint32(c.R) + 38470*uint32(c.G) +
+				7471*uint32(c.B) + 1<<15) >> 16
+			dst[x] = color.Gray{Y: uint8(y)}
+		}
+
+	default:
+		dst.Copy(src)
+	}
+}
@@ -0,0 +1,112 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Blank page detector test
+
+package imgconv
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestBlankDetector tests the blank page detector
+func TestBlankDetector(t *testing.T) {
+	const size = 40
+
+	// page returns the size x size page of the background color
+	page := func() [][]uint8 {
+		pixels := make([][]uint8, size)
+		for y := range pixels {
+			pixels[y] = make([]uint8, size)
+			for x := range pixels[y] {
+				pixels[y][x] = 240
+			}
+		}
+		return pixels
+	}
+
+	// Blank page with dark borders within the margins
+	blank := page()
+	for i := 0; i < size; i++ {
+		blank[0][i], blank[size-1][i] = 0, 0
+		blank[i][0], blank[i][size-1] = 0, 0
+	}
+
+	// Page with 10x10 black square in the middle
+	content := page()
+	for y := 15; y < 25; y++ {
+		for x := 15; x < 25; x++ {
+			content[y][x] = 0
+		}
+	}
+
+	// Margins are 2 pixels, so 36x36 pixels are analyzed
+	const analyzed = 36 * 36
+
+	type testData struct {
+		name     string    // Test name
+		pixels   [][]uint8 // Input image
+		coverage float64   // Expected coverage
+	}
+
+	tests := []testData{
+		{"blank", blank, 0},
+		{"content", content, 100.0 / analyzed},
+	}
+
+	models := map[string]color.Model{
+		"Gray8":  color.GrayModel,
+		"RGBA32": color.RGBAModel,
+	}
+
+	for _, test := range tests {
+		for name, model := range models {
+			in := NewColorModelFilter(
+				newRowsReader(color.GrayModel,
+					testGrayRows(test.pixels)),
+				model)
+
+			detector := NewBlankDetector(in)
+			rows := mustDecodeImageRows(detector)
+
+			// Image must pass unchanged
+			if len(rows) != size || testGrayAt(rows, 20, 20) !=
+				test.pixels[20][20] {
+				t.Errorf("%s (%s): image changed", test.name, name)
+			}
+
+			stats := detector.Stats()
+
+			if stats.Background != 240.0/255 {
+				t.Errorf("%s (%s): Background: "+
+					"expected %g, present %g",
+					test.name, name, 240.0/255,
+					stats.Background)
+			}
+
+			if math.Abs(stats.Coverage-test.coverage) > 1e-6 {
+				t.Errorf("%s (%s): Coverage: "+
+					"expected %g, present %g",
+					test.name, name, test.coverage,
+					stats.Coverage)
+			}
+
+			if (test.coverage == 0) != (stats.Variance == 0) {
+				t.Errorf("%s (%s): Variance: unexpected %g",
+					test.name, name, stats.Variance)
+			}
+		}
+	}
+
+	// Empty image
+	detector := NewBlankDetector(newRowsReader(color.GrayModel, nil))
+	stats := detector.Stats()
+	if stats != (BlankStats{Background: 1}) {
+		t.Errorf("empty image: unexpected %+v", stats)
+	}
+}
@@ -0,0 +1,578 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// BMP Reader and Writer
+
+package imgconv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math/bits"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// BMP header sizes
+const (
+	bmpFileHeaderSize = 14 // BITMAPFILEHEADER
+	bmpCoreHeaderSize = 12 // BITMAPCOREHEADER
+	bmpInfoHeaderSize = 40 // BITMAPINFOHEADER
+)
+
+// BMP compression methods
+const (
+	bmpCompressionRGB            = 0
+	bmpCompressionBitfields      = 3
+	bmpCompressionAlphaBitfields = 6
+)
+
+// bmpMaxSize is the maximal image width and height, in pixels,
+// accepted by the BMP reader. It protects from allocation of the
+// huge buffers due to the broken headers.
+const bmpMaxSize = 1 << 16
+
+// bmpReader implements the [Decoder] interface for reading BMP images.
+type bmpReader struct {
+	input    io.Reader   // Underlying io.Reader
+	wid, hei int         // Image size
+	bpp      int         // Bits per pixel
+	topDown  bool        // Rows are stored top-down
+	model    color.Model // Image color model
+	palette  []byte      // Palette, as R-G-B triplets
+	invert   bool        // Bilevel image with inverted palette
+	masks    [3]uint32   // R, G, B masks for 16 and 32 bpp images
+	meta     ImageMeta   // Image metadata
+	pixels   []byte      // Pixel array of the bottom-up image
+	rawBytes []byte      // Raw row, as stored in file
+	rowBytes []byte      // Row, converted for decoding
+	y        int         // Current y-coordinate
+	err      error       // Sticky error
+}
+
+// NewBMPReader creates a new [Decoder] for BMP images.
+//
+// Supported are the uncompressed images with 1, 4 and 8 bits per
+// pixel (with palette), 16 and 32 bits per pixel (including the
+// BI_BITFIELDS images) and 24 bits per pixel. Alpha channel,
+// if present, is ignored.
+//
+// The top-down images are decoded on the fly, row by row. The
+// bottom-up images (which are the most common) are stored in the
+// reverse row order, so the pixel array is loaded into memory
+// when the first row is being read.
+//
+// Palette images are decoded as [BilevelModel] or [color.GrayModel],
+// if palette contains only black and white or gray colors. Otherwise,
+// [color.RGBAModel] is used.
+func NewBMPReader(input io.Reader) (Decoder, error) {
+	reader := &bmpReader{input: input}
+
+	// Read BITMAPFILEHEADER and the header size
+	var hdr [bmpFileHeaderSize + 4]byte
+	err := reader.readFull(hdr[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr[0] != 'B' || hdr[1] != 'M' {
+		return nil, errors.New("BMP: invalid header")
+	}
+
+	pixoff := int(binary.LittleEndian.Uint32(hdr[10:]))
+	hdrsize := int(binary.LittleEndian.Uint32(hdr[14:]))
+
+	if hdrsize != bmpCoreHeaderSize && hdrsize < bmpInfoHeaderSize ||
+		hdrsize > 1024 {
+		return nil, errors.New("BMP: invalid header")
+	}
+
+	// Read the rest of header
+	info := make([]byte, hdrsize)
+	copy(info, hdr[bmpFileHeaderSize:])
+
+	err = reader.readFull(info[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	consumed := bmpFileHeaderSize + hdrsize
+
+	var compression uint32
+	var colors int
+	palEntrySize := 4
+
+	le := binary.LittleEndian
+	if hdrsize == bmpCoreHeaderSize {
+		reader.wid = int(le.Uint16(info[4:]))
+		reader.hei = int(le.Uint16(info[6:]))
+		reader.bpp = int(le.Uint16(info[10:]))
+		palEntrySize = 3
+	} else {
+		reader.wid = int(int32(le.Uint32(info[4:])))
+		reader.hei = int(int32(le.Uint32(info[8:])))
+		reader.bpp = int(le.Uint16(info[14:]))
+		compression = le.Uint32(info[16:])
+		colors = int(le.Uint32(info[32:]))
+
+		reader.meta.XResolution = metaDPIFromPPM(le.Uint32(info[24:]))
+		reader.meta.YResolution = metaDPIFromPPM(le.Uint32(info[28:]))
+	}
+
+	if reader.hei < 0 {
+		reader.hei = -reader.hei
+		reader.topDown = true
+	}
+
+	if reader.wid <= 0 || reader.wid > bmpMaxSize ||
+		reader.hei <= 0 || reader.hei > bmpMaxSize {
+		return nil, errors.New("BMP: invalid image size")
+	}
+
+	// Check compression, obtain color masks
+	switch reader.bpp {
+	case 16:
+		reader.masks = [3]uint32{0x7c00, 0x03e0, 0x001f}
+	case 32:
+		reader.masks = [3]uint32{0xff0000, 0x00ff00, 0x0000ff}
+	}
+
+	switch compression {
+	case bmpCompressionRGB:
+	case bmpCompressionBitfields, bmpCompressionAlphaBitfields:
+		if reader.bpp != 16 && reader.bpp != 32 {
+			return nil, errors.New("BMP: invalid bitfields image")
+		}
+
+		// Masks follow BITMAPINFOHEADER or included into
+		// the larger headers.
+		masks := info[bmpInfoHeaderSize:]
+		if hdrsize == bmpInfoHeaderSize {
+			masks = make([]byte, 12)
+			err = reader.readFull(masks)
+			if err != nil {
+				return nil, err
+			}
+			consumed += len(masks)
+		} else if len(masks) < 12 {
+			return nil, errors.New("BMP: invalid header")
+		}
+
+		for i := range reader.masks {
+			reader.masks[i] = le.Uint32(masks[i*4:])
+			if reader.masks[i] == 0 {
+				return nil, errors.New("BMP: invalid color mask")
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("BMP: unsupported compression %d",
+			compression)
+	}
+
+	// Read palette and choose color model
+	switch reader.bpp {
+	case 1, 4, 8:
+		if colors == 0 || colors > 1<<reader.bpp {
+			colors = 1 << reader.bpp
+		}
+
+		pal := make([]byte, colors*palEntrySize)
+		err = reader.readFull(pal)
+		if err != nil {
+			return nil, err
+		}
+		consumed += len(pal)
+
+		reader.setPalette(pal, colors, palEntrySize)
+
+	case 16, 24, 32:
+		reader.model = color.RGBAModel
+
+	default:
+		return nil, fmt.Errorf("BMP: unsupported %d bits per pixel",
+			reader.bpp)
+	}
+
+	// Skip to the pixel array
+	if pixoff < consumed {
+		return nil, errors.New("BMP: invalid pixel array offset")
+	}
+
+	_, err = io.CopyN(io.Discard, input, int64(pixoff-consumed))
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	// Allocate buffers. Rows are padded to 4 bytes.
+	stride := ((reader.wid*reader.bpp + 31) / 32) * 4
+	reader.rawBytes = make([]byte, stride)
+
+	switch reader.model {
+	case color.GrayModel:
+		reader.rowBytes = make([]byte, reader.wid)
+	case color.RGBAModel:
+		reader.rowBytes = make([]byte, reader.wid*3)
+	}
+
+	return reader, nil
+}
+
+// setPalette sets the image palette and chooses the color model.
+func (reader *bmpReader) setPalette(pal []byte, colors, entrySize int) {
+	// Palette entries are stored as B-G-R-(X)
+	reader.palette = make([]byte, 256*3)
+	gray := true
+	for i := 0; i < colors; i++ {
+		ent := pal[i*entrySize:]
+		reader.palette[i*3] = ent[2]
+		reader.palette[i*3+1] = ent[1]
+		reader.palette[i*3+2] = ent[0]
+		gray = gray && ent[0] == ent[1] && ent[1] == ent[2]
+	}
+
+	switch {
+	case !gray:
+		reader.model = color.RGBAModel
+
+	case reader.bpp == 1 && colors == 2 &&
+		reader.palette[0] == 0 && reader.palette[3] == 0xff:
+		reader.model = BilevelModel
+
+	case reader.bpp == 1 && colors == 2 &&
+		reader.palette[0] == 0xff && reader.palette[3] == 0:
+		reader.model = BilevelModel
+		reader.invert = true
+
+	default:
+		reader.model = color.GrayModel
+	}
+}
+
+// MIMEType returns the MIME type of the image being decoded.
+func (*bmpReader) MIMEType() string {
+	return MIMETypeBMP
+}
+
+// Meta returns the image metadata.
+// Only the resolution is reported.
+func (reader *bmpReader) Meta() ImageMeta {
+	return reader.meta
+}
+
+// Close closes the reader.
+func (reader *bmpReader) Close() {
+	reader.pixels = nil
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (reader *bmpReader) ColorModel() color.Model {
+	return reader.model
+}
+
+// Size returns the image size.
+func (reader *bmpReader) Size() (wid, hei int) {
+	return reader.wid, reader.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (reader *bmpReader) NewRow() Row {
+	return NewRow(reader.model, reader.wid)
+}
+
+// Read returns the next image [Row].
+func (reader *bmpReader) Read(row Row) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+
+	// Read the next row
+	raw := reader.rawBytes
+	if reader.topDown {
+		reader.err = reader.readFull(raw)
+	} else {
+		// Load pixel array of the bottom-up image. The buffer
+		// grows as data is read, so the truncated image doesn't
+		// allocate memory according to the claimed image size.
+		if reader.pixels == nil {
+			reader.err = reader.loadPixels(len(raw) * reader.hei)
+		}
+
+		if reader.err == nil {
+			off := (reader.hei - reader.y - 1) * len(raw)
+			raw = reader.pixels[off : off+len(raw)]
+		}
+	}
+
+	if reader.err != nil {
+		reader.pixels = nil
+		return 0, reader.err
+	}
+
+	// Decode the row
+	wid := generic.Min(row.Width(), reader.wid)
+	reader.decodeRow(row, raw)
+
+	// Update current y
+	reader.y++
+	if reader.y == reader.hei {
+		reader.err = io.EOF
+		reader.pixels = nil
+	}
+
+	return wid, nil
+}
+
+// decodeRow decodes the raw row into the Row.
+func (reader *bmpReader) decodeRow(row Row, raw []byte) {
+	switch {
+	case reader.model == BilevelModel:
+		if reader.invert {
+			for i := range raw {
+				raw[i] = ^raw[i]
+			}
+		}
+		row.Copy(RowBilevel{bits: raw, wid: reader.wid})
+
+	case reader.model == color.GrayModel:
+		for x := 0; x < reader.wid; x++ {
+			i := int(bytesPackedSample(raw, x, reader.bpp))
+			reader.rowBytes[x] = reader.palette[i*3]
+		}
+		bytesGray8toRow(row, reader.rowBytes)
+
+	case reader.palette != nil:
+		for x := 0; x < reader.wid; x++ {
+			i := int(bytesPackedSample(raw, x, reader.bpp)) * 3
+			copy(reader.rowBytes[x*3:x*3+3], reader.palette[i:i+3])
+		}
+		bytesRGB8toRow(row, reader.rowBytes)
+
+	case reader.bpp == 24:
+		for x := 0; x < reader.wid; x++ {
+			s := raw[x*3 : x*3+3]
+			d := reader.rowBytes[x*3 : x*3+3]
+			d[0], d[1], d[2] = s[2], s[1], s[0]
+		}
+		bytesRGB8toRow(row, reader.rowBytes)
+
+	default:
+		// 16 or 32 bits per pixel, with color masks
+		for x := 0; x < reader.wid; x++ {
+			var pix uint32
+			if reader.bpp == 16 {
+				pix = uint32(binary.LittleEndian.Uint16(raw[x*2:]))
+			} else {
+				pix = binary.LittleEndian.Uint32(raw[x*4:])
+			}
+
+			for c, mask := range reader.masks {
+				reader.rowBytes[x*3+c] = bmpMaskedValue(pix, mask)
+			}
+		}
+		bytesRGB8toRow(row, reader.rowBytes)
+	}
+}
+
+// loadPixels loads the pixel array of the specified size
+// into reader.pixels.
+func (reader *bmpReader) loadPixels(size int) error {
+	pixels, err := io.ReadAll(io.LimitReader(reader.input, int64(size)))
+	if err == nil && len(pixels) < size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	reader.pixels = pixels
+	return err
+}
+
+// readFull reads exactly len(buf) bytes from the input.
+func (reader *bmpReader) readFull(buf []byte) error {
+	_, err := io.ReadFull(reader.input, buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// bmpMaskedValue extracts the color component from the pixel,
+// using the component's mask, and scales it to 8 bits.
+func bmpMaskedValue(pix, mask uint32) uint8 {
+	shift := bits.TrailingZeros32(mask)
+	max := mask >> shift
+	v := (pix & mask) >> shift
+	return uint8(uint64(v) * 255 / uint64(max))
+}
+
+// bmpWriter implements the [Encoder] interface for writing BMP images.
+type bmpWriter struct {
+	output   io.Writer   // Underlying io.Writer
+	wid, hei int         // Image size
+	model    color.Model // Color model
+	rowBytes []byte      // Row encoding buffer
+	rgbBytes []byte      // R-G-B row, before conversion to B-G-R
+	y        int         // Current y-coordinate
+	err      error       // Sticky error
+}
+
+// NewBMPWriter creates a new [Encoder] for BMP images.
+//
+// Images are written top-down, so no image buffering is required.
+//
+// Supported color models are following:
+//   - BilevelModel (1 bit per pixel, black and white palette)
+//   - color.GrayModel (8 bits per pixel, grayscale palette)
+//   - color.RGBAModel (24 bits per pixel)
+func NewBMPWriter(output io.Writer,
+	wid, hei int, model color.Model) (Encoder, error) {
+
+	var bpp, colors int
+
+	switch model {
+	case BilevelModel:
+		bpp, colors = 1, 2
+	case color.GrayModel:
+		bpp, colors = 8, 256
+	case color.RGBAModel:
+		bpp = 24
+	default:
+		return nil, errors.New("BMP: unsupported color model")
+	}
+
+	if wid <= 0 || hei <= 0 {
+		return nil, errors.New("BMP: invalid image size")
+	}
+
+	stride := ((wid*bpp + 31) / 32) * 4
+	writer := &bmpWriter{
+		output:   output,
+		wid:      wid,
+		hei:      hei,
+		model:    model,
+		rowBytes: make([]byte, stride),
+	}
+
+	if model == color.RGBAModel {
+		writer.rgbBytes = make([]byte, wid*3)
+	}
+
+	// Write headers. Negative height means the top-down image.
+	pixoff := bmpFileHeaderSize + bmpInfoHeaderSize + colors*4
+	filesize := pixoff + stride*hei
+
+	hdr := make([]byte, pixoff)
+	le := binary.LittleEndian
+
+	hdr[0], hdr[1] = 'B', 'M'
+	le.PutUint32(hdr[2:], uint32(filesize))
+	le.PutUint32(hdr[10:], uint32(pixoff))
+
+	info := hdr[bmpFileHeaderSize:]
+	le.PutUint32(info[0:], bmpInfoHeaderSize)
+	le.PutUint32(info[4:], uint32(wid))
+	le.PutUint32(info[8:], uint32(-int32(hei)))
+	le.PutUint16(info[12:], 1)
+	le.PutUint16(info[14:], uint16(bpp))
+	le.PutUint32(info[16:], bmpCompressionRGB)
+	le.PutUint32(info[20:], uint32(stride*hei))
+	le.PutUint32(info[32:], uint32(colors))
+
+	// Write palette
+	pal := info[bmpInfoHeaderSize:]
+	for i := 0; i < colors; i++ {
+		v := uint8(i * 255 / (colors - 1))
+		pal[i*4], pal[i*4+1], pal[i*4+2] = v, v, v
+	}
+
+	_, writer.err = output.Write(hdr)
+	if writer.err != nil {
+		return nil, writer.err
+	}
+
+	return writer, nil
+}
+
+// MIMEType returns the MIME type of the image being encoded.
+func (*bmpWriter) MIMEType() string {
+	return MIMETypeBMP
+}
+
+// Size returns the image size.
+func (writer *bmpWriter) Size() (wid, hei int) {
+	return writer.wid, writer.hei
+}
+
+// ColorModel returns the [color.Model] of image being written.
+func (writer *bmpWriter) ColorModel() color.Model {
+	return writer.model
+}
+
+// Write writes the next image [Row].
+func (writer *bmpWriter) Write(row Row) error {
+	// Check for pending error
+	if writer.err != nil {
+		return writer.err
+	}
+
+	// Silently ignore excessive rows
+	if writer.y == writer.hei {
+		return nil
+	}
+
+	// Encode the row. The tail is filled by white.
+	wid := generic.Min(row.Width(), writer.wid)
+
+	switch writer.model {
+	case BilevelModel:
+		bytesBilevelFromRow(writer.rowBytes, row)
+		for x := wid; x < writer.wid; x++ {
+			writer.rowBytes[x>>3] |= 0x80 >> (x & 7)
+		}
+
+	case color.GrayModel:
+		bytesGray8fromRow(writer.rowBytes, row)
+		for x := wid; x < writer.wid; x++ {
+			writer.rowBytes[x] = 0xff
+		}
+
+	case color.RGBAModel:
+		bytesRGB8fromRow(writer.rgbBytes, row)
+		for x := wid * 3; x < writer.wid*3; x++ {
+			writer.rgbBytes[x] = 0xff
+		}
+
+		for x := 0; x < writer.wid; x++ {
+			s := writer.rgbBytes[x*3 : x*3+3]
+			d := writer.rowBytes[x*3 : x*3+3]
+			d[0], d[1], d[2] = s[2], s[1], s[0]
+		}
+	}
+
+	// Write the row
+	_, writer.err = writer.output.Write(writer.rowBytes)
+	if writer.err == nil {
+		writer.y++
+	}
+
+	return writer.err
+}
+
+// Close flushes the buffered data and then closes the Writer
+func (writer *bmpWriter) Close() error {
+	// Write missed lines
+	for writer.err == nil && writer.y < writer.hei {
+		writer.Write(RowEmpty{})
+	}
+
+	return writer.err
+}
@@ -0,0 +1,393 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// BMP Reader and Writer test
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"golang.org/x/image/bmp"
+)
+
+// testBMPBuild builds the BMP image with BITMAPINFOHEADER.
+// Negative hei means the top-down image. For palette images,
+// extra contains the palette. Rows must be already
+// padded to 4 bytes and stored in the file order.
+func testBMPBuild(wid, hei, bpp int, compression uint32,
+	extra []byte, pixels []byte) []byte {
+
+	le := binary.LittleEndian
+	pixoff := bmpFileHeaderSize + bmpInfoHeaderSize + len(extra)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("BM")
+	binary.Write(buf, le, uint32(pixoff+len(pixels)))
+	binary.Write(buf, le, uint32(0))
+	binary.Write(buf, le, uint32(pixoff))
+
+	binary.Write(buf, le, uint32(bmpInfoHeaderSize))
+	binary.Write(buf, le, int32(wid))
+	binary.Write(buf, le, int32(hei))
+	binary.Write(buf, le, uint16(1))
+	binary.Write(buf, le, uint16(bpp))
+	binary.Write(buf, le, compression)
+	binary.Write(buf, le, uint32(len(pixels)))
+	binary.Write(buf, le, [2]uint32{})
+
+	// For palette images, extra contains the palette
+	clrused := 0
+	if bpp <= 8 {
+		clrused = len(extra) / 4
+	}
+	binary.Write(buf, le, uint32(clrused))
+	binary.Write(buf, le, uint32(0))
+
+	buf.Write(extra)
+	buf.Write(pixels)
+
+	return buf.Bytes()
+}
+
+// TestBMPDecode tests BMP decoding of the sample image
+func TestBMPDecode(t *testing.T) {
+	reference, err := png.Decode(
+		bytes.NewReader(testutils.Images.PNG100x75rgb8))
+	if err != nil {
+		panic(err)
+	}
+
+	reader, err := NewBMPReader(bytes.NewReader(testutils.Images.BMP100x75))
+	if err != nil {
+		t.Fatalf("NewBMPReader: %s", err)
+	}
+	defer reader.Close()
+
+	if reader.MIMEType() != MIMETypeBMP {
+		t.Errorf("MIMEType: expected %q, present %q",
+			MIMETypeBMP, reader.MIMEType())
+	}
+
+	if reader.ColorModel() != color.RGBAModel {
+		t.Errorf("ColorModel mismatch")
+	}
+
+	img, err := decodeImage(reader)
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	if diff := imageDiff(reference, img); diff != "" {
+		t.Errorf("%s", diff)
+	}
+
+	// Reading past the end must return io.EOF
+	_, err = reader.Read(reader.NewRow())
+	if err != io.EOF {
+		t.Errorf("expected io.EOF, present: %v", err)
+	}
+
+	// NewDetectReader must recognize BMP
+	detected, err := NewDetectReader(
+		bytes.NewReader(testutils.Images.BMP100x75))
+	if err != nil {
+		t.Fatalf("NewDetectReader: %s", err)
+	}
+	detected.Close()
+}
+
+// TestBMPDecodeFormats tests decoding of various BMP formats
+func TestBMPDecodeFormats(t *testing.T) {
+	type testData struct {
+		name   string        // Test name
+		data   []byte        // BMP image
+		model  color.Model   // Expected color model
+		pixels []color.Color // Expected pixels, 2x2
+	}
+
+	black := color.Gray{Y: 0}
+	white := color.Gray{Y: 255}
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	tests := []testData{
+		{
+			// Bottom-up, palette: 0 is white, 1 is black
+			name: "1-bit inverted palette",
+			data: testBMPBuild(2, 2, 1, bmpCompressionRGB,
+				[]byte{255, 255, 255, 0, 0, 0, 0, 0},
+				[]byte{
+					0x40, 0, 0, 0, // Bottom row
+					0x80, 0, 0, 0, // Top row
+				}),
+			model:  BilevelModel,
+			pixels: []color.Color{black, white, white, black},
+		},
+		{
+			name: "4-bit color palette, top-down",
+			data: testBMPBuild(2, -2, 4, bmpCompressionRGB,
+				[]byte{0, 0, 255, 0, 255, 0, 0, 0},
+				[]byte{
+					0x01, 0, 0, 0,
+					0x10, 0, 0, 0,
+				}),
+			model:  color.RGBAModel,
+			pixels: []color.Color{red, blue, blue, red},
+		},
+		{
+			name: "8-bit gray palette",
+			data: testBMPBuild(2, -2, 8, bmpCompressionRGB,
+				[]byte{0, 0, 0, 0, 128, 128, 128, 0},
+				[]byte{
+					0, 1, 0, 0,
+					1, 0, 0, 0,
+				}),
+			model: color.GrayModel,
+			pixels: []color.Color{
+				black, color.Gray{Y: 128},
+				color.Gray{Y: 128}, black,
+			},
+		},
+		{
+			name: "16-bit 5-5-5",
+			data: testBMPBuild(2, -2, 16, bmpCompressionRGB, nil,
+				[]byte{
+					0x00, 0x7c, 0x1f, 0x00,
+					0x1f, 0x00, 0x00, 0x7c,
+				}),
+			model:  color.RGBAModel,
+			pixels: []color.Color{red, blue, blue, red},
+		},
+		{
+			name: "16-bit bitfields 5-6-5",
+			data: testBMPBuild(2, -2, 16, bmpCompressionBitfields,
+				[]byte{
+					0x00, 0xf8, 0, 0,
+					0xe0, 0x07, 0, 0,
+					0x1f, 0x00, 0, 0,
+				},
+				[]byte{
+					0x00, 0xf8, 0x1f, 0x00,
+					0x1f, 0x00, 0x00, 0xf8,
+				}),
+			model:  color.RGBAModel,
+			pixels: []color.Color{red, blue, blue, red},
+		},
+		{
+			name: "24-bit",
+			data: testBMPBuild(2, -2, 24, bmpCompressionRGB, nil,
+				[]byte{
+					0, 0, 255, 255, 0, 0, 0, 0,
+					255, 0, 0, 0, 0, 255, 0, 0,
+				}),
+			model:  color.RGBAModel,
+			pixels: []color.Color{red, blue, blue, red},
+		},
+	}
+
+	for _, test := range tests {
+		reader, err := NewBMPReader(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: NewBMPReader: %s", test.name, err)
+			continue
+		}
+
+		if reader.ColorModel() != test.model {
+			t.Errorf("%s: ColorModel mismatch", test.name)
+		}
+
+		img, err := decodeImage(reader)
+		reader.Close()
+
+		if err != nil {
+			t.Errorf("%s: decodeImage: %s", test.name, err)
+			continue
+		}
+
+		for i, expected := range test.pixels {
+			present := img.At(i%2, i/2)
+			if !colorEqual(expected, present) {
+				t.Errorf("%s: pixel (%d,%d):\n"+
+					"expected: %v\n"+
+					"present:  %v",
+					test.name, i%2, i/2, expected, present)
+			}
+		}
+	}
+}
+
+// TestBMPDecodeErrors tests BMP decoding errors
+func TestBMPDecodeErrors(t *testing.T) {
+	type testData struct {
+		name string // Test name
+		data []byte // BMP image
+	}
+
+	tests := []testData{
+		{"truncated header", []byte("BM\x00\x00")},
+		{"invalid signature", testBMPBuild(1, 1, 24, 0, nil,
+			make([]byte, 4))[2:]},
+		{"RLE compression", testBMPBuild(1, 1, 8, 1, nil,
+			make([]byte, 4))},
+		{"2 bits per pixel", testBMPBuild(1, 1, 2, 0,
+			make([]byte, 16), make([]byte, 4))},
+		{"zero width", testBMPBuild(0, 1, 24, 0, nil, nil)},
+		{"huge width", testBMPBuild(1<<30, 1, 24, 0, nil, nil)},
+		{"huge height", testBMPBuild(1, -(1 << 30), 24, 0, nil, nil)},
+	}
+
+	for _, test := range tests {
+		reader, err := NewBMPReader(bytes.NewReader(test.data))
+		if err == nil {
+			reader.Close()
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+
+	// Truncated pixel array must be detected while reading
+	data := testBMPBuild(1, -2, 24, 0, nil, make([]byte, 6))
+	reader, err := NewBMPReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewBMPReader: %s", err)
+	}
+	defer reader.Close()
+
+	row := reader.NewRow()
+	_, err = reader.Read(row)
+	if err != nil {
+		t.Errorf("row 0: unexpected error: %s", err)
+	}
+
+	_, err = reader.Read(row)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("row 1: expected %v, present %v",
+			io.ErrUnexpectedEOF, err)
+	}
+
+	// Truncated bottom-up image of the maximal size must not
+	// allocate the whole claimed pixel array
+	data = testBMPBuild(bmpMaxSize, bmpMaxSize, 24, 0, nil, make([]byte, 6))
+	reader, err = NewBMPReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewBMPReader: %s", err)
+	}
+	defer reader.Close()
+
+	_, err = reader.Read(reader.NewRow())
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("bottom-up: expected %v, present %v",
+			io.ErrUnexpectedEOF, err)
+	}
+}
+
+// TestBMPEncode tests BMP encoding
+func TestBMPEncode(t *testing.T) {
+	src, err := NewPNGReader(bytes.NewReader(testutils.Images.PNG100x75rgb8))
+	if err != nil {
+		panic(err)
+	}
+	rgb, err := decodeImage(src)
+	src.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	bounds := rgb.Bounds()
+	models := []color.Model{
+		color.RGBAModel,
+		color.GrayModel,
+		BilevelModel,
+	}
+
+	for _, model := range models {
+		// Encode the image. The last row is omitted and
+		// must be filled by Close.
+		buf := &bytes.Buffer{}
+		writer, err := NewBMPWriter(buf, bounds.Dx(), bounds.Dy(), model)
+		if err != nil {
+			t.Fatalf("NewBMPWriter: %s", err)
+		}
+
+		if writer.MIMEType() != MIMETypeBMP {
+			t.Errorf("MIMEType: expected %q, present %q",
+				MIMETypeBMP, writer.MIMEType())
+		}
+
+		expected := image.NewRGBA(bounds)
+		row := NewRow(model, bounds.Dx())
+		for y := 0; y < bounds.Dy()-1; y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				row.Set(x, rgb.At(x, y))
+				expected.Set(x, y, row.At(x))
+			}
+			writer.Write(row)
+		}
+
+		for x := 0; x < bounds.Dx(); x++ {
+			expected.Set(x, bounds.Dy()-1, color.White)
+		}
+
+		err = writer.Close()
+		if err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+
+		// Decode and compare
+		reader, err := NewBMPReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("NewBMPReader: %s", err)
+		}
+
+		if reader.ColorModel() != model {
+			t.Errorf("ColorModel mismatch")
+		}
+
+		img, err := decodeImage(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("decodeImage: %s", err)
+		}
+
+		if diff := imageDiff(expected, img); diff != "" {
+			t.Errorf("%s", diff)
+		}
+
+		// Compare with the reference decoder, if it
+		// supports the format
+		if model != BilevelModel {
+			reference, err := bmp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("bmp.Decode: %s", err)
+			}
+
+			if diff := imageDiff(expected, reference); diff != "" {
+				t.Errorf("%s", diff)
+			}
+		}
+	}
+
+	// Unsupported model
+	_, err = NewBMPWriter(io.Discard, 10, 10, color.Gray16Model)
+	if err == nil {
+		t.Errorf("NewBMPWriter: unsupported model must fail")
+	}
+
+	// Write errors
+	errTest := io.ErrShortWrite
+	_, err = NewBMPWriter(newIoWriterWithError(io.Discard, 0, errTest),
+		10, 10, color.GrayModel)
+	if err != errTest {
+		t.Errorf("NewBMPWriter: expected %v, present %v", errTest, err)
+	}
+}
@@ -0,0 +1,90 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// In-memory image buffer
+
+package imgconv
+
+import (
+	"image/color"
+	"io"
+)
+
+// imageBuffer replays the image, buffered in memory.
+type imageBuffer struct {
+	input    Reader // Image source
+	rows     []Row  // Buffered image
+	wid, hei int    // Image size
+	y        int    // Current row
+}
+
+// NewImageBuffer reads the entire input image into the memory and
+// returns the [Reader] that replays the buffered image.
+//
+// It allows to analyze the whole image (say, with the [StatsReader])
+// before the image is processed further. It returns an error, if input
+// image cannot be read. On error, the input Reader is not closed.
+func NewImageBuffer(in Reader) (Reader, error) {
+	wid, hei := in.Size()
+	rows := make([]Row, hei)
+
+	for y := range rows {
+		rows[y] = in.NewRow()
+		_, err := in.Read(rows[y])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := &imageBuffer{
+		input: in,
+		rows:  rows,
+		wid:   wid,
+		hei:   hei,
+	}
+
+	return buf, nil
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (buf *imageBuffer) ColorModel() color.Model {
+	return buf.input.ColorModel()
+}
+
+// Size returns the image size.
+func (buf *imageBuffer) Size() (wid, hei int) {
+	return buf.wid, buf.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (buf *imageBuffer) NewRow() Row {
+	return buf.input.NewRow()
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (buf *imageBuffer) Read(row Row) (int, error) {
+	if buf.y == buf.hei {
+		return 0, io.EOF
+	}
+
+	n := row.Copy(buf.rows[buf.y])
+	buf.rows[buf.y] = nil
+	buf.y++
+
+	return n, nil
+}
+
+// Close closes the reader.
+func (buf *imageBuffer) Close() {
+	buf.rows = nil
+	buf.input.Close()
+}
@@ -286,6 +286,40 @@ func bytesGray8fromRow(bytes []byte, r Row) int {
 	return wid
 }
 
+// bytesBilevelFromRow converts Row to byte slice.
+// The byte slice assumed to contain 1-bit packed bilevel image line,
+// most significant bit first, bit set means white.
+// It returns the resulting Row length, in pixels.
+func bytesBilevelFromRow(bytes []byte, r Row) int {
+	wid := generic.Min(r.Width(), len(bytes)*8)
+
+	if r, ok := r.(RowBilevel); ok && r.off%8 == 0 {
+		off := r.off / 8
+		copy(bytes, r.bits[off:off+(wid+7)/8])
+		return wid
+	}
+
+	for i := range bytes[:(wid+7)/8] {
+		bytes[i] = 0
+	}
+
+	for x := 0; x < wid; x++ {
+		var white bool
+		switch r := r.(type) {
+		case RowBilevel:
+			white = r.BitAt(x)
+		default:
+			white = bilevelWhite(r.At(x))
+		}
+
+		if white {
+			bytes[x>>3] |= 0x80 >> (x & 7)
+		}
+	}
+
+	return wid
+}
+
 // bytesGray16BEfromRow converts Row to byte slice.
 // The byte slice assumed to contain 16-bit big endian grayscale image line.
 // It returns the resulting Row length, in pixels.
@@ -538,3 +572,11 @@ func bytesFPtoU8(f float32) uint8 {
 func bytesFPtoU16(f float32) uint16 {
 	return uint16(generic.Min(f, 1.0) * 0xffff)
 }
+
+// bytesPackedSample returns the i-th sample of the bps bits wide
+// from the packed (MSB first) byte slice. bps must be 1, 2, 4 or 8.
+func bytesPackedSample(bytes []byte, i, bps int) uint8 {
+	bit := i * bps
+	shift := 8 - bps - bit&7
+	return (bytes[bit>>3] >> shift) & (1<<bps - 1)
+}
@@ -48,7 +48,7 @@ func decodeImage(reader Reader) (image.Image, error) {
 	var img draw.Image
 
 	switch reader.ColorModel() {
-	case color.GrayModel:
+	case BilevelModel, color.GrayModel:
 		img = image.NewGray(bounds)
 	case color.Gray16Model:
 		img = image.NewGray16(bounds)
@@ -368,3 +368,55 @@ func (writer *writerWithError) Write(Row) error {
 func (writer *writerWithError) Close() error {
 	return nil
 }
+
+// rowsReader implements [Reader] interface on a top of the
+// slice of image rows.
+type rowsReader struct {
+	model color.Model // Image color model
+	rows  []Row       // Image rows
+	y     int         // Current y-coordinate
+}
+
+// newRowsReader creates a new rowsReader.
+// All rows must be of the same width.
+func newRowsReader(model color.Model, rows []Row) Reader {
+	return &rowsReader{model: model, rows: rows}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (reader *rowsReader) ColorModel() color.Model {
+	return reader.model
+}
+
+// Size returns the image size.
+func (reader *rowsReader) Size() (wid, hei int) {
+	if len(reader.rows) > 0 {
+		wid = reader.rows[0].Width()
+	}
+	return wid, len(reader.rows)
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (reader *rowsReader) NewRow() Row {
+	wid, _ := reader.Size()
+	return NewRow(reader.model, wid)
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (reader *rowsReader) Read(row Row) (int, error) {
+	if reader.y == len(reader.rows) {
+		return 0, io.EOF
+	}
+
+	src := reader.rows[reader.y]
+	reader.y++
+
+	row.Copy(src)
+	return src.Width(), nil
+}
+
+// Close closes the reader.
+func (reader *rowsReader) Close() {
+}
@@ -0,0 +1,91 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Noise removal filter
+
+package imgconv
+
+import "github.com/OpenPrinting/go-mfp/util/generic"
+
+// denoise implements the noise removal image filter
+type denoise struct {
+	*window3         // Sliding window of input rows
+	amount   float32 // Blending amount
+}
+
+// NewDenoise creates a new image filter on a top of the existent
+// [Reader].
+//
+// This filter removes the impulse noise (specks), using the 3x3
+// median filter. The amount, in range [0...1.0], controls blending
+// between the original (0.0) and the median-filtered (1.0) image.
+// Zero amount bypasses the filter.
+func NewDenoise(in Reader, amount float64) Reader {
+	amount = levelsClamp(amount, 0, 1)
+	if amount == 0 {
+		return in
+	}
+
+	return &denoise{window3: newWindow3(in), amount: float32(amount)}
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (dn *denoise) Read(row Row) (int, error) {
+	err := dn.advance()
+	if err != nil {
+		return 0, err
+	}
+
+	prev := dn.samples(dn.rows[0])
+	cur := dn.samples(dn.rows[1])
+	next := dn.samples(dn.rows[2])
+	out := dn.samples(dn.out)
+	ch := dn.channels()
+
+	var window [9]float32
+
+	for i := range cur {
+		if ch == 4 && i%4 == 3 {
+			out[i] = cur[i] // Alpha channel
+			continue
+		}
+
+		// Horizontal neighbors, replicated at the edges
+		l, r := i-ch, i+ch
+		if l < 0 {
+			l = i
+		}
+		if r >= len(cur) {
+			r = i
+		}
+
+		window = [9]float32{
+			prev[l], prev[i], prev[r],
+			cur[l], cur[i], cur[r],
+			next[l], next[i], next[r],
+		}
+
+		med := denoiseMedian9(&window)
+		v := cur[i] + dn.amount*(med-cur[i])
+		out[i] = generic.Max(0, generic.Min(v, 1))
+	}
+
+	return row.Copy(dn.out), nil
+}
+
+// denoiseMedian9 returns the median of 9 values.
+// Content of the array is reordered.
+func denoiseMedian9(v *[9]float32) float32 {
+	// Insertion sort is fast enough for 9 elements
+	for i := 1; i < len(v); i++ {
+		for j := i; j > 0 && v[j] < v[j-1]; j-- {
+			v[j], v[j-1] = v[j-1], v[j]
+		}
+	}
+
+	return v[4]
+}
@@ -40,10 +40,20 @@ func NewDetectReader(input io.Reader) (r Reader, err error) {
 	input = io.MultiReader(bytes.NewReader(buf[:]), input)
 
 	switch mime := MIMETypeDetect(buf[:]); mime {
+	case MIMETypeBMP:
+		r, err = NewBMPReader(input)
 	case MIMETypeJPEG:
 		r, err = NewJPEGReader(input)
+	case MIMETypePDF:
+		r, err = NewPDFReader(input)
 	case MIMETypePNG:
 		r, err = NewPNGReader(input)
+	case MIMETypePWG:
+		r, err = NewPWGReader(input)
+	case MIMETypeTIFF:
+		r, err = NewTIFFReader(input)
+	case MIMETypeURF:
+		r, err = NewURFReader(input)
 	case "":
 		err = errors.New("image format cannot be detected")
 	default:
@@ -0,0 +1,190 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Halftone (dithering) filters
+
+package imgconv
+
+import (
+	"image/color"
+)
+
+// dither contains the common part of the dithering filters.
+type dither struct {
+	input    Reader      // Image source
+	wid, hei int         // Image size
+	y        int         // Current y-coordinate
+	tmp      Row         // Input buffer
+	gray     RowGrayFP32 // Input row, converted to grayscale
+	out      RowBilevel  // Output buffer
+}
+
+// newDither initializes the dither.
+func newDither(in Reader) dither {
+	wid, hei := in.Size()
+	return dither{
+		input: in,
+		wid:   wid,
+		hei:   hei,
+		tmp:   in.NewRow(),
+		gray:  make(RowGrayFP32, wid),
+		out:   NewRowBilevel(wid),
+	}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (d *dither) ColorModel() color.Model {
+	return BilevelModel
+}
+
+// Size returns the image size.
+func (d *dither) Size() (wid, hei int) {
+	return d.wid, d.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (d *dither) NewRow() Row {
+	return NewRowBilevel(d.wid)
+}
+
+// Close closes the reader.
+func (d *dither) Close() {
+	d.input.Close()
+}
+
+// read reads the next input row and converts it into grayscale.
+func (d *dither) read() error {
+	_, err := d.input.Read(d.tmp)
+	if err == nil {
+		d.gray.Copy(d.tmp)
+	}
+	return err
+}
+
+// errorDiffusion implements the error diffusion dithering filter
+type errorDiffusion struct {
+	dither
+	errCur  []float32 // Errors, diffused into the current row
+	errNext []float32 // Errors, diffused into the next row
+}
+
+// NewErrorDiffusion creates a new image filter on a top of the
+// existent [Reader].
+//
+// This filter converts image into the black and white, simulating
+// the halftones using the Floyd–Steinberg error diffusion with
+// serpentine scanning. It gives the best visual quality for
+// photos and other continuous-tone images.
+//
+// The output image uses the [BilevelModel].
+func NewErrorDiffusion(in Reader) Reader {
+	d := &errorDiffusion{dither: newDither(in)}
+
+	// Error buffers have one extra pixel at each side,
+	// so diffusion at the row edges doesn't need checks.
+	d.errCur = make([]float32, d.wid+2)
+	d.errNext = make([]float32, d.wid+2)
+
+	return d
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (d *errorDiffusion) Read(row Row) (int, error) {
+	err := d.read()
+	if err != nil {
+		return 0, err
+	}
+
+	d.errCur, d.errNext = d.errNext, d.errCur
+	for i := range d.errNext {
+		d.errNext[i] = 0
+	}
+
+	// Even rows are processed left to right, odd rows
+	// right to left.
+	x, end, dir := 0, d.wid, 1
+	if d.y&1 != 0 {
+		x, end, dir = d.wid-1, -1, -1
+	}
+
+	for ; x != end; x += dir {
+		i := x + 1 // Index in the error buffers
+		v := d.gray[x] + d.errCur[i]
+
+		white := v >= 0.5
+		d.out.SetBit(x, white)
+
+		e := v
+		if white {
+			e = v - 1
+		}
+
+		// Floyd–Steinberg weights:
+		//
+		//	    *  7
+		//	 3  5  1   / 16
+		d.errCur[i+dir] += e * 7 / 16
+		d.errNext[i-dir] += e * 3 / 16
+		d.errNext[i] += e * 5 / 16
+		d.errNext[i+dir] += e * 1 / 16
+	}
+
+	d.y++
+
+	return row.Copy(d.out), nil
+}
+
+// orderedDither implements the ordered dithering filter
+type orderedDither struct {
+	dither
+}
+
+// orderedDitherMatrix is the 8x8 Bayer threshold matrix.
+var orderedDitherMatrix = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// NewOrderedDither creates a new image filter on a top of the
+// existent [Reader].
+//
+// This filter converts image into the black and white, simulating
+// the halftones using the ordered dithering with the 8x8 Bayer
+// matrix. Unlike [NewErrorDiffusion], the result is a regular
+// pattern, which compresses well and doesn't produce artifacts
+// on the uniform areas.
+//
+// The output image uses the [BilevelModel].
+func NewOrderedDither(in Reader) Reader {
+	return &orderedDither{dither: newDither(in)}
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (d *orderedDither) Read(row Row) (int, error) {
+	err := d.read()
+	if err != nil {
+		return 0, err
+	}
+
+	line := &orderedDitherMatrix[d.y&7]
+	for x, v := range d.gray {
+		threshold := (float32(line[x&7]) + 0.5) / 64
+		d.out.SetBit(x, v >= threshold)
+	}
+
+	d.y++
+
+	return row.Copy(d.out), nil
+}
@@ -0,0 +1,94 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Halftone (dithering) filters test
+
+package imgconv
+
+import (
+	"errors"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// TestDither tests the dithering filters
+func TestDither(t *testing.T) {
+	const wid, hei = 32, 32
+
+	filters := map[string]func(Reader) Reader{
+		"NewErrorDiffusion": NewErrorDiffusion,
+		"NewOrderedDither":  NewOrderedDither,
+	}
+
+	// uniform creates uniform gray image
+	uniform := func(v uint8) Reader {
+		pixels := make([][]uint8, hei)
+		for y := range pixels {
+			pixels[y] = make([]uint8, wid)
+			for x := range pixels[y] {
+				pixels[y][x] = v
+			}
+		}
+		return newRowsReader(color.GrayModel, testGrayRows(pixels))
+	}
+
+	for name, newFilter := range filters {
+		for _, v := range []uint8{0, 64, 128, 192, 255} {
+			filter := newFilter(uniform(v))
+			if filter.ColorModel() != BilevelModel {
+				t.Errorf("%s: invalid color model", name)
+			}
+
+			rows := mustDecodeImageRows(filter)
+			white := 0
+			for y := range rows {
+				for x := 0; x < wid; x++ {
+					if testGrayAt(rows, x, y) != 0 {
+						white++
+					}
+				}
+			}
+
+			// Ratio of white pixels must approximate
+			// the input gray level.
+			expected := float64(v) / 255
+			present := float64(white) / (wid * hei)
+			if present < expected-0.05 || present > expected+0.05 {
+				t.Errorf("%s: gray %d: white ratio %g, expected %g",
+					name, v, present, expected)
+			}
+
+			_, err := filter.Read(filter.NewRow())
+			if err != io.EOF {
+				t.Errorf("%s: expected io.EOF, present: %v",
+					name, err)
+			}
+		}
+
+		// Errors must be propagated
+		errTest := errors.New("test error")
+		in := newReaderWithError(color.RGBAModel, 10, 10, 3, errTest)
+		filter := newFilter(in)
+		row := filter.NewRow()
+
+		for y := 0; y < 3; y++ {
+			_, err := filter.Read(row)
+			if err != nil {
+				t.Errorf("%s: row %d: unexpected error: %s",
+					name, y, err)
+			}
+		}
+
+		_, err := filter.Read(row)
+		if err != errTest {
+			t.Errorf("%s: error expected: %v, present: %v",
+				name, errTest, err)
+		}
+
+		filter.Close()
+	}
+}
@@ -0,0 +1,206 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// ICC color profiles
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"math"
+)
+
+// ICC color space signatures
+const (
+	iccSpaceGray = "GRAY"
+	iccSpaceRGB  = "RGB "
+)
+
+// iccTag represents the ICC profile tag being written.
+type iccTag struct {
+	sig  string // Tag signature
+	data []byte // Tag data
+}
+
+// ICCProfileSRGB returns the ICC profile of the sRGB color space,
+// suitable for embedding into the color images.
+//
+// The profile is the ICC v2 matrix/TRC display profile, with the
+// sRGB primaries (adapted to D50) and the sRGB transfer function.
+func ICCProfileSRGB() []byte {
+	// sRGB transfer function
+	trc := make([]uint16, 1024)
+	for i := range trc {
+		x := float64(i) / float64(len(trc)-1)
+		if x <= 0.04045 {
+			x /= 12.92
+		} else {
+			x = math.Pow((x+0.055)/1.055, 2.4)
+		}
+
+		trc[i] = uint16(math.Round(x * 65535))
+	}
+
+	return iccBuild(iccSpaceRGB, []iccTag{
+		{"desc", iccDesc("sRGB")},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+		{"rXYZ", iccXYZ(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", iccXYZ(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", iccXYZ(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", iccCurve(trc)},
+		{"gTRC", iccCurve(trc)},
+		{"bTRC", iccCurve(trc)},
+	})
+}
+
+// ICCProfileGray returns the ICC profile of the gray color space
+// with the specified gamma (say, 2.2), suitable for embedding into
+// the grayscale images.
+func ICCProfileGray(gamma float64) []byte {
+	g := uint16(math.Round(gamma * 256))
+
+	return iccBuild(iccSpaceGray, []iccTag{
+		{"desc", iccDesc("Gray")},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+		{"kTRC", iccCurve([]uint16{g})},
+	})
+}
+
+// iccColorSpace returns the color space signature of the ICC
+// profile (say, "RGB " or "GRAY") or "", if profile is invalid.
+func iccColorSpace(profile []byte) string {
+	if len(profile) < 132 ||
+		binary.BigEndian.Uint32(profile) != uint32(len(profile)) ||
+		string(profile[36:40]) != "acsp" {
+		return ""
+	}
+
+	return string(profile[16:20])
+}
+
+// ICCProfileMatches reports if the ICC profile matches the color model,
+// so it can be embedded into the image (see [ImageMeta]).
+//
+// Gray profiles match grayscale models, RGB profiles match RGB models.
+// Other profiles (say, CMYK or Lab) and invalid profiles never match.
+func ICCProfileMatches(profile []byte, model color.Model) bool {
+	space := iccColorSpace(profile)
+
+	switch model {
+	case BilevelModel, color.GrayModel, color.Gray16Model:
+		return space == iccSpaceGray
+	case color.RGBAModel, color.RGBA64Model:
+		return space == iccSpaceRGB
+	}
+
+	return false
+}
+
+// iccBuild builds the ICC v2 display profile for the specified
+// color space out of tags.
+func iccBuild(space string, tags []iccTag) []byte {
+	be := binary.BigEndian
+
+	// Compute layout. Tag data is 4-byte aligned.
+	off := 128 + 4 + 12*len(tags)
+	offsets := make([]int, len(tags))
+	for i, tag := range tags {
+		offsets[i] = off
+		off += (len(tag.data) + 3) &^ 3
+	}
+
+	profile := make([]byte, off)
+
+	// Profile header
+	be.PutUint32(profile[0:], uint32(len(profile)))
+	be.PutUint32(profile[8:], 0x02100000) // Version 2.1
+	copy(profile[12:], "mntr")            // Display device profile
+	copy(profile[16:], space)
+	copy(profile[20:], "XYZ ") // Profile connection space
+
+	date := []uint16{2024, 1, 1, 0, 0, 0}
+	for i, v := range date {
+		be.PutUint16(profile[24+i*2:], v)
+	}
+
+	copy(profile[36:], "acsp")
+	copy(profile[68:], iccXYZ(0.9642, 1.0, 0.8249)[8:]) // D50
+
+	// Tag table and tag data
+	be.PutUint32(profile[128:], uint32(len(tags)))
+	for i, tag := range tags {
+		ent := profile[128+4+12*i:]
+		copy(ent, tag.sig)
+		be.PutUint32(ent[4:], uint32(offsets[i]))
+		be.PutUint32(ent[8:], uint32(len(tag.data)))
+
+		copy(profile[offsets[i]:], tag.data)
+	}
+
+	return profile
+}
+
+// iccXYZ encodes the XYZType tag data.
+func iccXYZ(x, y, z float64) []byte {
+	data := make([]byte, 20)
+	copy(data, "XYZ ")
+
+	for i, v := range []float64{x, y, z} {
+		fixed := int32(math.Round(v * 65536))
+		binary.BigEndian.PutUint32(data[8+i*4:], uint32(fixed))
+	}
+
+	return data
+}
+
+// iccCurve encodes the curveType tag data. The single entry
+// is the gamma value in the u8Fixed8 format, multiple entries
+// are the sampled curve.
+func iccCurve(entries []uint16) []byte {
+	data := make([]byte, 12+2*len(entries))
+	copy(data, "curv")
+	binary.BigEndian.PutUint32(data[8:], uint32(len(entries)))
+
+	for i, v := range entries {
+		binary.BigEndian.PutUint16(data[12+i*2:], v)
+	}
+
+	return data
+}
+
+// iccDesc encodes the textDescriptionType tag data.
+// Only the ASCII description is written, Unicode and
+// ScriptCode descriptions are left empty.
+func iccDesc(text string) []byte {
+	buf := &bytes.Buffer{}
+	be := binary.BigEndian
+
+	buf.WriteString("desc")
+	binary.Write(buf, be, uint32(0))
+	binary.Write(buf, be, uint32(len(text)+1))
+	buf.WriteString(text)
+	buf.WriteByte(0)
+
+	binary.Write(buf, be, uint32(0)) // Unicode language code
+	binary.Write(buf, be, uint32(0)) // Unicode count
+	binary.Write(buf, be, uint16(0)) // ScriptCode code
+	buf.WriteByte(0)                 // ScriptCode count
+	buf.Write(make([]byte, 67))      // ScriptCode description
+
+	return buf.Bytes()
+}
+
+// iccText encodes the textType tag data.
+func iccText(text string) []byte {
+	data := make([]byte, 8+len(text)+1)
+	copy(data, "text")
+	copy(data[8:], text)
+	return data
+}
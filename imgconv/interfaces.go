@@ -75,6 +75,11 @@ type Decoder interface {
 
 	// MIMEType returns the MIME type of the image being decoded.
 	MIMEType() string
+
+	// Meta returns the image metadata, embedded into the image.
+	// The metadata which is not present in the image (or not
+	// supported by the format) is returned as zero value.
+	Meta() ImageMeta
 }
 
 // Writer implements streaming image writer.
@@ -12,6 +12,7 @@ import (
 	"errors"
 	"image/color"
 	"io"
+	"math"
 	"runtime/cgo"
 	"unsafe"
 
@@ -34,6 +35,7 @@ type jpegReader struct {
 	input      io.Reader                        // Underlying io.Reader
 	model      color.Model                      // Image color mode
 	wid, hei   int                              // Image size
+	meta       ImageMeta                        // Image metadata
 	rowBytes   []byte                           // Row decoding buffer
 	y          int                              // Current y-coordinate
 }
@@ -79,12 +81,17 @@ func NewJPEGReader(input io.Reader) (r Decoder, err error) {
 	C.do_jpeg_init_decompress(reader.jpeg,
 		reader.jpegErrMgr, reader.jpegSrcMgr, C.uintptr_t(reader.handle))
 
+	// Save APP2 markers, that may contain the ICC profile
+	C.jpeg_save_markers(reader.jpeg, C.JPEG_APP0+2, 0xffff)
+
 	rc := C.jpeg_read_header(reader.jpeg, 1)
 	if rc != C.JPEG_HEADER_OK {
 		err := errors.New("JPEG: invalid header")
 		return nil, err
 	}
 
+	reader.readMeta()
+
 	ok := C.jpeg_start_decompress(reader.jpeg)
 	if ok == 0 {
 		err := errors.New("JPEG: invalid image")
@@ -106,6 +113,37 @@ func NewJPEGReader(input io.Reader) (r Decoder, err error) {
 	return reader, nil
 }
 
+// readMeta obtains the image metadata from the JFIF and
+// APP2 markers.
+func (reader *jpegReader) readMeta() {
+	if reader.jpeg.saw_JFIF_marker != 0 {
+		xres := int(reader.jpeg.X_density)
+		yres := int(reader.jpeg.Y_density)
+
+		switch reader.jpeg.density_unit {
+		case 1: // Dots per inch
+			reader.meta.XResolution = xres
+			reader.meta.YResolution = yres
+		case 2: // Dots per cm
+			reader.meta.XResolution = int(math.Round(float64(xres) * 2.54))
+			reader.meta.YResolution = int(math.Round(float64(yres) * 2.54))
+		}
+	}
+
+	var icc *C.JOCTET
+	var iccLen C.uint
+	if C.jpeg_read_icc_profile(reader.jpeg, &icc, &iccLen) != 0 {
+		reader.meta.ICCProfile = C.GoBytes(unsafe.Pointer(icc),
+			C.int(iccLen))
+		C.free(unsafe.Pointer(icc))
+	}
+}
+
+// Meta returns the image metadata.
+func (reader *jpegReader) Meta() ImageMeta {
+	return reader.meta
+}
+
 // Close closes the reader.
 func (reader *jpegReader) Close() {
 	C.jpeg_destroy_decompress(reader.jpeg)
@@ -286,7 +324,22 @@ type jpegWriter struct {
 // level of compression and image quality. 0 is the best compression, lowest
 // quality, 100 is the best quality, lowest compression.
 func NewJPEGWriter(output io.Writer,
-	wid, hei int, model color.Model, quality int) (w Encoder, err error) {
+	wid, hei int, model color.Model, quality int) (Encoder, error) {
+	return NewJPEGWriterMeta(output, wid, hei, model, quality, ImageMeta{})
+}
+
+// NewJPEGWriterMeta creates a new [Writer] for JPEG images, with
+// the image metadata.
+//
+// Resolution, if known, is written into the JFIF marker. The ICC
+// profile, if present, is written into the APP2 markers and must
+// match the color model (GRAY profile for grayscale images, RGB
+// for color).
+//
+// Supported color models and quality are the same as for the
+// [NewJPEGWriter].
+func NewJPEGWriterMeta(output io.Writer, wid, hei int,
+	model color.Model, quality int, meta ImageMeta) (w Encoder, err error) {
 
 	// Check model
 	var rgb bool
@@ -301,6 +354,11 @@ func NewJPEGWriter(output io.Writer,
 		return nil, err
 	}
 
+	if meta.ICCProfile != nil && !ICCProfileMatches(meta.ICCProfile, model) {
+		err := errors.New("JPEG: ICC profile doesn't match color model")
+		return nil, err
+	}
+
 	// Create writer structure.
 	writer := &jpegWriter{
 		output: output,
@@ -359,8 +417,21 @@ func NewJPEGWriter(output io.Writer,
 	writer.jpeg.comp_info.h_samp_factor = 1
 	writer.jpeg.comp_info.v_samp_factor = 1
 
+	// Set resolution
+	if meta.XResolution > 0 && meta.YResolution > 0 {
+		writer.jpeg.density_unit = 1 // Dots per inch
+		writer.jpeg.X_density = C.UINT16(generic.Min(meta.XResolution, 65535))
+		writer.jpeg.Y_density = C.UINT16(generic.Min(meta.YResolution, 65535))
+	}
+
 	C.jpeg_start_compress(writer.jpeg, 1)
 
+	if meta.ICCProfile != nil {
+		C.jpeg_write_icc_profile(writer.jpeg,
+			(*C.JOCTET)(unsafe.Pointer(&meta.ICCProfile[0])),
+			C.uint(len(meta.ICCProfile)))
+	}
+
 	return writer, nil
 }
 
@@ -0,0 +1,150 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Lossless JPEG crop
+
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"io"
+	"runtime/cgo"
+	"unsafe"
+)
+
+// #include "jpegglue.h"
+import "C"
+
+// JPEGCrop performs the lossless crop of the JPEG image.
+//
+// Image is cropped at the DCT coefficients level, without decoding
+// and re-encoding, so image quality is preserved. However, the whole
+// image coefficients are loaded into memory.
+//
+// The rect.Min must be aligned to the MCU boundary, i.e., to the
+// multiple of the [JPEGHeader] MCUWidth and MCUHeight, and rect must
+// be within the image bounds. Lossless and hierarchical JPEG images
+// are not supported. See [JPEGCropFeasible].
+//
+// The output image is always sequential (not progressive). The JFIF
+// resolution of the source image is preserved, other markers (EXIF,
+// ICC profile and so on) are dropped.
+func JPEGCrop(output io.Writer, input io.Reader,
+	rect image.Rectangle) (err error) {
+
+	if rect.Empty() || rect.Min.X < 0 || rect.Min.Y < 0 {
+		return errors.New("JPEG: invalid crop rectangle")
+	}
+
+	// Create decompressor and compressor
+	reader := &jpegReader{input: input}
+
+	p := C.calloc(C.size_t(unsafe.Sizeof(*reader.jpeg)), 1)
+	reader.jpeg = (*C.struct_jpeg_decompress_struct)(p)
+
+	p = C.calloc(C.size_t(unsafe.Sizeof(*reader.jpegErrMgr)), 1)
+	reader.jpegErrMgr = (*C.struct_jpeg_error_mgr)(p)
+
+	p = C.calloc(C.size_t(unsafe.Sizeof(*reader.jpegSrcMgr)), 1)
+	reader.jpegSrcMgr = (*C.struct_jpeg_source_mgr)(p)
+
+	reader.handle = cgo.NewHandle(reader)
+	defer reader.Close()
+
+	writer := &jpegWriter{output: output}
+
+	p = C.calloc(C.size_t(unsafe.Sizeof(*writer.jpeg)), 1)
+	writer.jpeg = (*C.struct_jpeg_compress_struct)(p)
+
+	p = C.calloc(C.size_t(unsafe.Sizeof(*writer.jpegErrMgr)), 1)
+	writer.jpegErrMgr = (*C.struct_jpeg_error_mgr)(p)
+
+	p = C.calloc(C.size_t(unsafe.Sizeof(*writer.jpegDstMgr)), 1)
+	writer.jpegDstMgr = (*C.struct_jpeg_destination_mgr)(p)
+
+	writer.handle = cgo.NewHandle(writer)
+	defer writer.destroy()
+
+	// Handle libjpeg errors
+	defer func() {
+		p := recover()
+		if _, ok := p.(jpegPanic); p != nil && !ok {
+			panic(p)
+		}
+
+		switch {
+		case reader.err != nil && reader.err != io.EOF:
+			err = reader.err
+		case writer.err != nil:
+			err = writer.err
+		}
+	}()
+
+	C.do_jpeg_init_decompress(reader.jpeg,
+		reader.jpegErrMgr, reader.jpegSrcMgr, C.uintptr_t(reader.handle))
+
+	C.do_jpeg_init_compress(writer.jpeg,
+		writer.jpegErrMgr, writer.jpegDstMgr, C.uintptr_t(writer.handle))
+
+	rc := C.jpeg_read_header(reader.jpeg, 1)
+	if rc != C.JPEG_HEADER_OK {
+		return errors.New("JPEG: invalid header")
+	}
+
+	// Validate crop rectangle
+	bounds := image.Rect(0, 0,
+		int(reader.jpeg.image_width), int(reader.jpeg.image_height))
+
+	mcuwid := int(reader.jpeg.max_h_samp_factor) * 8
+	mcuhei := int(reader.jpeg.max_v_samp_factor) * 8
+
+	switch {
+	case !rect.In(bounds):
+		return errors.New("JPEG: crop rectangle out of image bounds")
+	case rect.Min.X%mcuwid != 0 || rect.Min.Y%mcuhei != 0:
+		return errors.New("JPEG: crop rectangle not MCU-aligned")
+	}
+
+	// Crop the image
+	ok := C.do_jpeg_crop(reader.jpeg, writer.jpeg,
+		C.JDIMENSION(rect.Min.X), C.JDIMENSION(rect.Min.Y),
+		C.JDIMENSION(rect.Dx()), C.JDIMENSION(rect.Dy()))
+
+	if ok == 0 && (reader.err == nil || reader.err == io.EOF) {
+		reader.err = io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// JPEGCropFeasible reports if the lossless crop of the JPEG image
+// with the specified [JPEGHeader] into the specified rectangle is
+// possible with the [JPEGCrop].
+func JPEGCropFeasible(hdr JPEGHeader, rect image.Rectangle) bool {
+	bounds := image.Rect(0, 0, hdr.Width, hdr.Height)
+
+	return !rect.Empty() && rect.In(bounds) &&
+		!hdr.Lossless && !hdr.Hierarchical &&
+		hdr.MCUWidth > 0 && rect.Min.X%hdr.MCUWidth == 0 &&
+		hdr.MCUHeight > 0 && rect.Min.Y%hdr.MCUHeight == 0
+}
+
+// destroy releases the jpegWriter resources without finishing
+// the compression.
+func (writer *jpegWriter) destroy() {
+	C.jpeg_destroy_compress(writer.jpeg)
+
+	C.free(unsafe.Pointer(writer.jpeg))
+	C.free(unsafe.Pointer(writer.jpegErrMgr))
+	C.free(unsafe.Pointer(writer.jpegDstMgr))
+
+	writer.jpeg = nil
+	writer.jpegErrMgr = nil
+	writer.jpegDstMgr = nil
+
+	writer.handle.Delete()
+}
@@ -0,0 +1,121 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Lossless JPEG crop tests
+
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestReadJPEGHeader tests ReadJPEGHeader
+func TestReadJPEGHeader(t *testing.T) {
+	for _, data := range [][]byte{
+		testutils.Images.JPEG100x75rgb8,
+		testutils.Images.JPEG100x75gray8,
+	} {
+		hdr, err := ReadJPEGHeader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("ReadJPEGHeader: %s", err)
+			continue
+		}
+
+		config, _ := jpeg.DecodeConfig(bytes.NewReader(data))
+		if hdr.Width != config.Width || hdr.Height != config.Height {
+			t.Errorf("ReadJPEGHeader: size %dx%d, expected %dx%d",
+				hdr.Width, hdr.Height, config.Width, config.Height)
+		}
+
+		if hdr.Precision != 8 || hdr.MCUWidth%8 != 0 ||
+			hdr.MCUHeight%8 != 0 || hdr.Lossless || hdr.Hierarchical {
+			t.Errorf("ReadJPEGHeader: unexpected %+v", hdr)
+		}
+	}
+
+	// Not a JPEG
+	_, err := ReadJPEGHeader(bytes.NewReader(testutils.Images.PNG100x75rgb8))
+	if err == nil {
+		t.Errorf("ReadJPEGHeader: PNG image accepted")
+	}
+}
+
+// TestJPEGCrop tests JPEGCrop
+func TestJPEGCrop(t *testing.T) {
+	for _, data := range [][]byte{
+		testutils.Images.JPEG100x75rgb8,
+		testutils.Images.JPEG100x75gray8,
+	} {
+		hdr, err := ReadJPEGHeader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadJPEGHeader: %s", err)
+		}
+
+		rect := image.Rect(hdr.MCUWidth, hdr.MCUHeight,
+			hdr.MCUWidth+50, hdr.MCUHeight+40)
+
+		if !JPEGCropFeasible(hdr, rect) {
+			t.Errorf("JPEGCropFeasible(%v): false", rect)
+			continue
+		}
+
+		buf := &bytes.Buffer{}
+		err = JPEGCrop(buf, bytes.NewReader(data), rect)
+		if err != nil {
+			t.Errorf("JPEGCrop: %s", err)
+			continue
+		}
+
+		// Compare with the reference image
+		reference, _ := jpeg.Decode(bytes.NewReader(data))
+		cropped, err := jpeg.Decode(buf)
+		if err != nil {
+			t.Errorf("JPEGCrop: output: %s", err)
+			continue
+		}
+
+		if sz := cropped.Bounds().Size(); sz != rect.Size() {
+			t.Errorf("JPEGCrop: size %v, expected %v", sz, rect.Size())
+			continue
+		}
+
+		expected := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		for y := 0; y < rect.Dy(); y++ {
+			for x := 0; x < rect.Dx(); x++ {
+				expected.Set(x, y, reference.At(rect.Min.X+x,
+					rect.Min.Y+y))
+			}
+		}
+
+		dist := imageEuclideanDistance(expected, cropped)
+		if dist > 1.0/100 {
+			t.Errorf("JPEGCrop: images too different: %g%%",
+				dist*100)
+		}
+	}
+
+	// Misaligned rectangle
+	rect := image.Rect(1, 1, 50, 40)
+	err := JPEGCrop(&bytes.Buffer{},
+		bytes.NewReader(testutils.Images.JPEG100x75rgb8), rect)
+	if err == nil {
+		t.Errorf("JPEGCrop(%v): misaligned rectangle accepted", rect)
+	}
+
+	// Truncated image
+	data := testutils.Images.JPEG100x75rgb8
+	rect = image.Rect(0, 0, 50, 40)
+	err = JPEGCrop(&bytes.Buffer{},
+		bytes.NewReader(data[:len(data)/2]), rect)
+	if err == nil {
+		t.Errorf("JPEGCrop: truncated image accepted")
+	}
+}
@@ -95,6 +95,105 @@ do_jpeg_write_scanline (j_compress_ptr jpeg, void *buf) {
     return jpeg_write_scanlines(jpeg, lines, 1);
 }
 
+// do_jpeg_crop performs the lossless crop of the JPEG image.
+//
+// The src must be initialized and jpeg_read_header must be already
+// called. The dst must be initialized. The crop rectangle is defined
+// by x, y, wid and hei; x and y must be aligned to the iMCU boundary.
+//
+// It reads DCT coefficients from the src, copies the blocks that
+// cover the crop rectangle into dst and writes the dst, without
+// decoding and re-encoding the image.
+//
+// It returns FALSE, if input data is exhausted before the
+// coefficients are read.
+static inline boolean
+do_jpeg_crop (j_decompress_ptr src, j_compress_ptr dst,
+              JDIMENSION x, JDIMENSION y,
+              JDIMENSION wid, JDIMENSION hei) {
+
+    jvirt_barray_ptr   *src_coefs;
+    jvirt_barray_ptr   dst_coefs[MAX_COMPONENTS];
+    JDIMENSION         dst_wid[MAX_COMPONENTS], dst_hei[MAX_COMPONENTS];
+    int                mcu_wid = src->max_h_samp_factor * DCTSIZE;
+    int                mcu_hei = src->max_v_samp_factor * DCTSIZE;
+    int                ci;
+
+    // Request destination coefficient arrays. It must be done
+    // before jpeg_read_coefficients, which realizes all arrays.
+    for (ci = 0; ci < src->num_components; ci ++) {
+        jpeg_component_info *comp = &src->comp_info[ci];
+        int                 h = comp->h_samp_factor;
+        int                 v = comp->v_samp_factor;
+        JDIMENSION          w, hh;
+
+        w = (wid * h + mcu_wid - 1) / mcu_wid;
+        hh = (hei * v + mcu_hei - 1) / mcu_hei;
+
+        dst_wid[ci] = (w + h - 1) / h * h;
+        dst_hei[ci] = (hh + v - 1) / v * v;
+
+        dst_coefs[ci] = src->mem->request_virt_barray((j_common_ptr) src,
+            JPOOL_IMAGE, FALSE, dst_wid[ci], dst_hei[ci], v);
+    }
+
+    // Read source coefficients
+    src_coefs = jpeg_read_coefficients(src);
+    if (src_coefs == NULL) {
+        return FALSE;
+    }
+
+    // Copy blocks
+    for (ci = 0; ci < src->num_components; ci ++) {
+        jpeg_component_info *comp = &src->comp_info[ci];
+        int                 v = comp->v_samp_factor;
+        JDIMENSION          xb = x / mcu_wid * comp->h_samp_factor;
+        JDIMENSION          yb = y / mcu_hei * v;
+        JDIMENSION          row;
+
+        for (row = 0; row < dst_hei[ci]; row += v) {
+            JBLOCKARRAY dbuf;
+            int         k;
+
+            dbuf = src->mem->access_virt_barray((j_common_ptr) src,
+                dst_coefs[ci], row, v, TRUE);
+
+            for (k = 0; k < v; k ++) {
+                JDIMENSION sy = yb + row + k;
+                JDIMENSION n = 0;
+
+                if (sy < comp->height_in_blocks &&
+                    xb < comp->width_in_blocks) {
+                    JBLOCKARRAY sbuf;
+
+                    sbuf = src->mem->access_virt_barray((j_common_ptr) src,
+                        src_coefs[ci], sy, 1, FALSE);
+
+                    n = comp->width_in_blocks - xb;
+                    if (n > dst_wid[ci]) {
+                        n = dst_wid[ci];
+                    }
+
+                    memcpy(dbuf[k], sbuf[0] + xb, n * sizeof(JBLOCK));
+                }
+
+                memset(dbuf[k] + n, 0, (dst_wid[ci] - n) * sizeof(JBLOCK));
+            }
+        }
+    }
+
+    // Write the destination
+    jpeg_copy_critical_parameters(src, dst);
+    dst->image_width = wid;
+    dst->image_height = hei;
+
+    jpeg_write_coefficients(dst, dst_coefs);
+    jpeg_finish_compress(dst);
+    jpeg_finish_decompress(src);
+
+    return TRUE;
+}
+
 #endif
 
 // vim:ts=8:sw=4:et
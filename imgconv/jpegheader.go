@@ -0,0 +1,154 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// JPEG header parser
+
+package imgconv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// JPEGHeader contains JPEG image parameters, obtained from the
+// image header without decoding the image.
+type JPEGHeader struct {
+	Width, Height int  // Image size, in pixels
+	Components    int  // Count of color components
+	Precision     int  // Bits per sample
+	MCUWidth      int  // MCU width, in pixels
+	MCUHeight     int  // MCU height, in pixels
+	Progressive   bool // Progressive JPEG
+	Arithmetic    bool // Arithmetic (not Huffman) coding
+	Lossless      bool // Lossless (not DCT-based) JPEG
+	Hierarchical  bool // Hierarchical JPEG
+}
+
+// ReadJPEGHeader reads and parses JPEG image header.
+//
+// It reads the input up to the frame header (SOFn marker) and maybe
+// some more bytes, so if image needs to be decoded later, caller is
+// responsible for saving these bytes (say, using [io.TeeReader]).
+func ReadJPEGHeader(input io.Reader) (JPEGHeader, error) {
+	var hdr JPEGHeader
+	in := bufio.NewReader(input)
+
+	// Check SOI marker
+	var soi [2]byte
+	_, err := io.ReadFull(in, soi[:])
+	if err != nil {
+		return hdr, err
+	}
+
+	if soi[0] != 0xff || soi[1] != 0xd8 {
+		return hdr, errors.New("JPEG: invalid header")
+	}
+
+	// Roll over markers until SOFn
+	for {
+		marker, err := jpegReadMarker(in)
+		if err != nil {
+			return hdr, err
+		}
+
+		switch {
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers: TEM, RSTn
+			continue
+
+		case marker == 0xd9 || marker == 0xda:
+			// EOI or SOS before SOFn
+			return hdr, errors.New("JPEG: missed frame header")
+		}
+
+		// Read marker segment
+		var lenbuf [2]byte
+		_, err = io.ReadFull(in, lenbuf[:])
+		if err != nil {
+			return hdr, err
+		}
+
+		seglen := int(lenbuf[0])<<8 | int(lenbuf[1])
+		if seglen < 2 {
+			return hdr, errors.New("JPEG: invalid marker length")
+		}
+
+		seg := make([]byte, seglen-2)
+		_, err = io.ReadFull(in, seg)
+		if err != nil {
+			return hdr, err
+		}
+
+		// SOFn, except DHT, JPG and DAC, which share the range
+		if marker >= 0xc0 && marker <= 0xcf &&
+			marker != 0xc4 && marker != 0xc8 && marker != 0xcc {
+			return hdr, hdr.decodeSOF(marker, seg)
+		}
+	}
+}
+
+// decodeSOF decodes the SOFn marker segment.
+func (hdr *JPEGHeader) decodeSOF(marker byte, seg []byte) error {
+	if len(seg) < 6 {
+		return errors.New("JPEG: invalid frame header")
+	}
+
+	hdr.Precision = int(seg[0])
+	hdr.Height = int(seg[1])<<8 | int(seg[2])
+	hdr.Width = int(seg[3])<<8 | int(seg[4])
+	hdr.Components = int(seg[5])
+
+	if hdr.Width == 0 || hdr.Height == 0 || hdr.Components == 0 ||
+		len(seg) < 6+3*hdr.Components {
+		return errors.New("JPEG: invalid frame header")
+	}
+
+	// SOF0-SOF7 use Huffman coding, SOF9-SOF15 use arithmetic
+	// coding. SOFn with n&3 == 2 are progressive, n&3 == 3 are
+	// lossless, SOF5-SOF7 and SOF13-SOF15 are hierarchical.
+	sof := marker & 0x0f
+	hdr.Arithmetic = sof >= 8
+	hdr.Progressive = sof&3 == 2
+	hdr.Lossless = sof&3 == 3
+	hdr.Hierarchical = sof&4 != 0
+
+	// MCU size is defined by the maximal sampling factors
+	maxh, maxv := 1, 1
+	for i := 0; i < hdr.Components; i++ {
+		samp := seg[6+3*i+1]
+		maxh = max(maxh, int(samp>>4))
+		maxv = max(maxv, int(samp&0x0f))
+	}
+
+	hdr.MCUWidth = maxh * 8
+	hdr.MCUHeight = maxv * 8
+
+	return nil
+}
+
+// jpegReadMarker reads the next JPEG marker.
+func jpegReadMarker(in *bufio.Reader) (byte, error) {
+	// Marker must start with 0xff
+	c, err := in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if c != 0xff {
+		return 0, errors.New("JPEG: marker expected")
+	}
+
+	// Skip fill bytes
+	for c == 0xff {
+		c, err = in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return c, nil
+}
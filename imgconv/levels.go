@@ -0,0 +1,270 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Tone (levels) adjustment filter
+
+package imgconv
+
+import (
+	"image/color"
+	"math"
+)
+
+// Levels defines the tone adjustments, performed by the
+// filter, created by the [NewLevels].
+//
+// All parameters are normalized and zero value of each parameter
+// means "no change", so zero value of Levels is the identity
+// transformation.
+type Levels struct {
+	// Brightness shifts all tones. The range is [-1.0...+1.0],
+	// -1.0 is the darkest, +1.0 is the brightest.
+	Brightness float64
+
+	// Contrast increases (positive values) or decreases (negative
+	// values) the difference between dark and light tones.
+	// The range is [-1.0...+1.0].
+	Contrast float64
+
+	// Gamma applies gamma correction: y = x^(1/Gamma).
+	// Values greater that 1.0 lighten the midtones, values
+	// below 1.0 darken them. 0 means 1.0 (no change).
+	Gamma float64
+
+	// Shadow adjusts the dark end of the tone curve.
+	// The range is [-1.0...+1.0]. Negative values clip darks to
+	// black, positive values lift them. The lower, the darker.
+	Shadow float64
+
+	// Highlight adjusts the light end of the tone curve.
+	// The range is [-1.0...+1.0]. Negative values dim highlights,
+	// positive values clip lights to white. The lower, the darker.
+	Highlight float64
+
+	// BlackPoint and WhitePoint are the input levels, mapped to
+	// black and white, so the [BlackPoint...WhitePoint] range is
+	// stretched to the full [0...1.0] range. They are applied before
+	// all other adjustments. Zero WhitePoint means 1.0 (no change).
+	// If WhitePoint is not above the BlackPoint, both are ignored.
+	BlackPoint, WhitePoint float64
+}
+
+// IsIdentity reports whether Levels doesn't change the image.
+func (lv Levels) IsIdentity() bool {
+	lv.Gamma = lv.gamma()
+	lv.BlackPoint, lv.WhitePoint = lv.points()
+	return lv == Levels{Gamma: 1, WhitePoint: 1}
+}
+
+// Apply applies the tone curve to the single value in range [0...1.0].
+func (lv Levels) Apply(x float64) float64 {
+	// Input black and white points
+	if black, white := lv.points(); black != 0 || white != 1 {
+		x = levelsClamp((x-black)/(white-black), 0, 1)
+	}
+
+	// Shadow and Highlight: input and output black/white points
+	blackIn, blackOut := 0.0, 0.0
+	whiteIn, whiteOut := 1.0, 1.0
+
+	shadow := levelsClamp(lv.Shadow, -1, 1)
+	if shadow < 0 {
+		blackIn = -shadow / 2
+	} else {
+		blackOut = shadow / 2
+	}
+
+	highlight := levelsClamp(lv.Highlight, -1, 1)
+	if highlight < 0 {
+		whiteOut = 1 + highlight/2
+	} else {
+		whiteIn = 1 - highlight/2
+	}
+
+	x = levelsClamp((x-blackIn)/(whiteIn-blackIn), 0, 1)
+	x = blackOut + x*(whiteOut-blackOut)
+
+	// Gamma
+	if g := lv.gamma(); g != 1 {
+		x = math.Pow(x, 1/g)
+	}
+
+	// Contrast. The slope of the curve around midtones is
+	// tan((c+1)*Pi/4): 0 at -1.0, 1 at 0, and steep near +1.0
+	if c := levelsClamp(lv.Contrast, -1, 0.98); c != 0 {
+		k := math.Tan((c + 1) * math.Pi / 4)
+		x = (x-0.5)*k + 0.5
+	}
+
+	// Brightness
+	x += levelsClamp(lv.Brightness, -1, 1) / 2
+
+	return levelsClamp(x, 0, 1)
+}
+
+// gamma returns the effective Gamma value.
+func (lv Levels) gamma() float64 {
+	if lv.Gamma <= 0 {
+		return 1
+	}
+	return lv.Gamma
+}
+
+// points returns the effective BlackPoint and WhitePoint values.
+func (lv Levels) points() (black, white float64) {
+	black = levelsClamp(lv.BlackPoint, 0, 1)
+	white = levelsClamp(lv.WhitePoint, 0, 1)
+	if lv.WhitePoint == 0 {
+		white = 1
+	}
+
+	if white <= black {
+		return 0, 1
+	}
+	return
+}
+
+// levelsClamp clamps v into the [lo...hi] range.
+func levelsClamp(v, lo, hi float64) float64 {
+	switch {
+	case v < lo:
+		return lo
+	case v > hi:
+		return hi
+	}
+	return v
+}
+
+// levels implements the tone adjustment filter
+type levels struct {
+	input Reader   // Image source
+	lv    Levels   // Levels parameters
+	lut8  []uint8  // Lookup table for 8-bit samples
+	lut16 []uint16 // Lookup table for 16-bit samples
+}
+
+// NewLevels creates a new image filter on a top of the existent
+// [Reader].
+//
+// This filter applies the tone adjustments, defined by the [Levels],
+// to the color channels of each pixel. The alpha channel and the
+// image [color.Model] are not affected.
+func NewLevels(in Reader, lv Levels) Reader {
+	// Bypass filter, if Levels doesn't change anything
+	if lv.IsIdentity() {
+		return in
+	}
+
+	return &levels{input: in, lv: lv}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (l *levels) ColorModel() color.Model {
+	return l.input.ColorModel()
+}
+
+// Size returns the image size.
+func (l *levels) Size() (wid, hei int) {
+	return l.input.Size()
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (l *levels) NewRow() Row {
+	return l.input.NewRow()
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (l *levels) Read(row Row) (n int, err error) {
+	// Read the next row from the underlying Reader
+	n, err = l.input.Read(row)
+	if err != nil || n == 0 {
+		return
+	}
+
+	switch row := row.(type) {
+	case RowGray8:
+		lut := l.getLUT8()
+		for i := range row {
+			row[i].Y = lut[row[i].Y]
+		}
+
+	case RowRGBA32:
+		lut := l.getLUT8()
+		for i := range row {
+			c := &row[i]
+			c.R, c.G, c.B = lut[c.R], lut[c.G], lut[c.B]
+		}
+
+	case RowGray16:
+		lut := l.getLUT16()
+		for i := range row {
+			row[i].Y = lut[row[i].Y]
+		}
+
+	case RowRGBA64:
+		lut := l.getLUT16()
+		for i := range row {
+			c := &row[i]
+			c.R, c.G, c.B = lut[c.R], lut[c.G], lut[c.B]
+		}
+
+	case RowGrayFP32:
+		for i := range row {
+			row[i] = float32(l.lv.Apply(float64(row[i])))
+		}
+
+	case RowRGBAFP32:
+		for i := range row {
+			if i%4 != 3 {
+				row[i] = float32(l.lv.Apply(float64(row[i])))
+			}
+		}
+
+	default:
+		lut := l.getLUT16()
+		wid := row.Width()
+		for x := 0; x < wid; x++ {
+			c := color.RGBA64Model.Convert(row.At(x)).(color.RGBA64)
+			c.R, c.G, c.B = lut[c.R], lut[c.G], lut[c.B]
+			row.Set(x, c)
+		}
+	}
+
+	return
+}
+
+// Close closes the reader.
+func (l *levels) Close() {
+	l.input.Close()
+}
+
+// getLUT8 returns the lookup table for 8-bit samples,
+// building it on demand.
+func (l *levels) getLUT8() []uint8 {
+	if l.lut8 == nil {
+		l.lut8 = make([]uint8, 0x100)
+		for i := range l.lut8 {
+			v := l.lv.Apply(float64(i) / 0xff)
+			l.lut8[i] = uint8(math.Round(v * 0xff))
+		}
+	}
+	return l.lut8
+}
+
+// getLUT16 returns the lookup table for 16-bit samples,
+// building it on demand.
+func (l *levels) getLUT16() []uint16 {
+	if l.lut16 == nil {
+		l.lut16 = make([]uint16, 0x10000)
+		for i := range l.lut16 {
+			v := l.lv.Apply(float64(i) / 0xffff)
+			l.lut16[i] = uint16(math.Round(v * 0xffff))
+		}
+	}
+	return l.lut16
+}
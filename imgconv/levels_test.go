@@ -0,0 +1,131 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Tone (levels) adjustment filter test
+
+package imgconv
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestLevelsApply tests Levels.Apply
+func TestLevelsApply(t *testing.T) {
+	type testData struct {
+		lv       Levels
+		in, out  float64
+		identity bool
+	}
+
+	tests := []testData{
+		{lv: Levels{}, in: 0.3, out: 0.3, identity: true},
+		{lv: Levels{Gamma: 1}, in: 0.3, out: 0.3, identity: true},
+
+		{lv: Levels{Brightness: 1}, in: 0.5, out: 1},
+		{lv: Levels{Brightness: -1}, in: 0.5, out: 0},
+		{lv: Levels{Brightness: 0.2}, in: 0.5, out: 0.6},
+
+		{lv: Levels{Contrast: 0.5}, in: 0.5, out: 0.5},
+		{lv: Levels{Contrast: -1}, in: 0.9, out: 0.5},
+		{lv: Levels{Contrast: 1}, in: 0.6, out: 1},
+
+		{lv: Levels{Gamma: 2}, in: 0.25, out: 0.5},
+		{lv: Levels{Gamma: 0.5}, in: 0.5, out: 0.25},
+
+		{lv: Levels{Shadow: -1}, in: 0.5, out: 0},
+		{lv: Levels{Shadow: 1}, in: 0, out: 0.5},
+		{lv: Levels{Highlight: -1}, in: 1, out: 0.5},
+		{lv: Levels{Highlight: 1}, in: 0.5, out: 1},
+
+		{lv: Levels{BlackPoint: 0.2, WhitePoint: 0.4}, in: 0.3, out: 0.5},
+		{lv: Levels{BlackPoint: 0.2, WhitePoint: 0.4}, in: 0.1, out: 0},
+		{lv: Levels{BlackPoint: 0.2, WhitePoint: 0.4}, in: 0.45, out: 1},
+		{lv: Levels{BlackPoint: 0.6}, in: 0.8, out: 0.5},
+		{lv: Levels{WhitePoint: 0.25}, in: 0.125, out: 0.5},
+		{lv: Levels{WhitePoint: 1}, in: 0.3, out: 0.3, identity: true},
+		{lv: Levels{BlackPoint: 0.5, WhitePoint: 0.5},
+			in: 0.3, out: 0.3, identity: true},
+
+		{lv: Levels{Brightness: 5}, in: 0, out: 0.5},
+	}
+
+	for _, test := range tests {
+		out := test.lv.Apply(test.in)
+		if math.Abs(out-test.out) > 1e-6 {
+			t.Errorf("%+v.Apply(%g):\n"+
+				"expected: %g\n"+
+				"present:  %g",
+				test.lv, test.in, test.out, out)
+		}
+
+		identity := test.lv.IsIdentity()
+		if identity != test.identity {
+			t.Errorf("%+v.IsIdentity:\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				test.lv, test.identity, identity)
+		}
+	}
+}
+
+// TestLevels tests the levels filter
+func TestLevels(t *testing.T) {
+	lv := Levels{Brightness: 0.1, Contrast: 0.3, Gamma: 1.2}
+
+	// Identity Levels must bypass the filter
+	in := newReaderWithError(color.RGBAModel, 10, 10, -1, nil)
+	if NewLevels(in, Levels{}) != in {
+		t.Errorf("NewLevels: identity Levels must bypass the filter")
+	}
+
+	// Test all row types
+	models := map[string]color.Model{
+		"Gray8":  color.GrayModel,
+		"Gray16": color.Gray16Model,
+		"RGBA32": color.RGBAModel,
+		"RGBA64": color.RGBA64Model,
+	}
+
+	for name, model := range models {
+		src, err := NewPNGReader(
+			bytes.NewReader(testutils.Images.PNG100x75rgb8))
+		if err != nil {
+			panic(err)
+		}
+
+		reference := mustDecodeImageRows(NewColorModelFilter(src, model))
+		src.Close()
+
+		src, _ = NewPNGReader(
+			bytes.NewReader(testutils.Images.PNG100x75rgb8))
+		filter := NewLevels(NewColorModelFilter(src, model), lv)
+		rows := mustDecodeImageRows(filter)
+		filter.Close()
+
+		for y := range rows {
+			for x := 0; x < rows[y].Width(); x++ {
+				r0, _, _, _ := reference[y].At(x).RGBA()
+				r1, _, _, _ := rows[y].At(x).RGBA()
+
+				expected := lv.Apply(float64(r0) / 0xffff)
+				present := float64(r1) / 0xffff
+
+				if math.Abs(expected-present) > 1.0/0xff {
+					t.Errorf("%s: (%d,%d):\n"+
+						"expected: %g\n"+
+						"present:  %g",
+						name, x, y, expected, present)
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image metadata
+
+package imgconv
+
+import "math"
+
+// ImageMeta contains the image metadata, which doesn't affect
+// the image pixels, but affects how image is rendered: resolution
+// and the color profile.
+//
+// [Decoder]s report the metadata, embedded into the image, and some
+// [Encoder]s accept it (see [NewPNGWriterMeta], [NewJPEGWriterMeta]).
+type ImageMeta struct {
+	XResolution int    // Horizontal resolution, DPI; 0 if unknown
+	YResolution int    // Vertical resolution, DPI; 0 if unknown
+	ICCProfile  []byte // ICC color profile, nil if none
+}
+
+// metaDPIFromPPM converts resolution in pixels per meter into
+// the resolution in DPI.
+func metaDPIFromPPM(ppm uint32) int {
+	return int(math.Round(float64(ppm) * 0.0254))
+}
+
+// metaPPMFromDPI converts resolution in DPI into the resolution
+// in pixels per meter.
+func metaPPMFromDPI(dpi int) uint32 {
+	return uint32(math.Round(float64(dpi) / 0.0254))
+}
@@ -0,0 +1,221 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image metadata test
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestICCProfile tests ICCProfileSRGB and ICCProfileGray
+func TestICCProfile(t *testing.T) {
+	type testData struct {
+		name    string // Profile name, for logging
+		profile []byte // The profile
+		space   string // Expected color space
+		tags    int    // Expected count of tags
+	}
+
+	tests := []testData{
+		{"sRGB", ICCProfileSRGB(), iccSpaceRGB, 9},
+		{"Gray", ICCProfileGray(2.2), iccSpaceGray, 4},
+	}
+
+	for _, test := range tests {
+		profile := test.profile
+
+		if space := iccColorSpace(profile); space != test.space {
+			t.Errorf("%s: color space %q, expected %q",
+				test.name, space, test.space)
+			continue
+		}
+
+		// Check the tag table
+		be := binary.BigEndian
+		tags := int(be.Uint32(profile[128:]))
+		if tags != test.tags {
+			t.Errorf("%s: %d tags, expected %d",
+				test.name, tags, test.tags)
+		}
+
+		for i := 0; i < tags; i++ {
+			ent := profile[128+4+12*i:]
+			off := be.Uint32(ent[4:])
+			size := be.Uint32(ent[8:])
+
+			if off%4 != 0 || int(off+size) > len(profile) {
+				t.Errorf("%s: tag %q: invalid offset/size %d/%d",
+					test.name, ent[:4], off, size)
+			}
+		}
+	}
+
+	// Invalid profiles
+	if space := iccColorSpace([]byte("not a profile")); space != "" {
+		t.Errorf("invalid profile: color space %q", space)
+	}
+
+	// ICCProfileMatches
+	cmyk := ICCProfileSRGB()
+	copy(cmyk[16:20], "CMYK")
+
+	matches := []struct {
+		name    string      // Test name
+		profile []byte      // The profile
+		model   color.Model // Color model
+		match   bool        // Expected result
+	}{
+		{"sRGB/RGBA", ICCProfileSRGB(), color.RGBAModel, true},
+		{"sRGB/RGBA64", ICCProfileSRGB(), color.RGBA64Model, true},
+		{"sRGB/Gray", ICCProfileSRGB(), color.GrayModel, false},
+		{"Gray/Gray16", ICCProfileGray(2.2), color.Gray16Model, true},
+		{"Gray/Bilevel", ICCProfileGray(2.2), BilevelModel, true},
+		{"Gray/RGBA", ICCProfileGray(2.2), color.RGBAModel, false},
+		{"CMYK/RGBA", cmyk, color.RGBAModel, false},
+		{"nil/RGBA", nil, color.RGBAModel, false},
+	}
+
+	for _, test := range matches {
+		match := ICCProfileMatches(test.profile, test.model)
+		if match != test.match {
+			t.Errorf("ICCProfileMatches: %s: expected %v, present %v",
+				test.name, test.match, match)
+		}
+	}
+}
+
+// TestImageMeta tests writing and reading the image metadata
+func TestImageMeta(t *testing.T) {
+	type testData struct {
+		name  string      // Test name
+		model color.Model // Image color model
+		meta  ImageMeta   // Image metadata
+	}
+
+	tests := []testData{
+		{
+			name:  "no metadata",
+			model: color.RGBAModel,
+		},
+		{
+			name:  "resolution",
+			model: color.GrayModel,
+			meta:  ImageMeta{XResolution: 300, YResolution: 600},
+		},
+		{
+			name:  "sRGB",
+			model: color.RGBAModel,
+			meta: ImageMeta{
+				XResolution: 150,
+				YResolution: 150,
+				ICCProfile:  ICCProfileSRGB(),
+			},
+		},
+		{
+			name:  "gray",
+			model: color.GrayModel,
+			meta: ImageMeta{
+				XResolution: 600,
+				YResolution: 600,
+				ICCProfile:  ICCProfileGray(2.2),
+			},
+		},
+	}
+
+	encoders := map[string]func(io.Writer, ImageMeta,
+		color.Model) (Encoder, error){
+
+		"PNG": func(out io.Writer, meta ImageMeta,
+			model color.Model) (Encoder, error) {
+			return NewPNGWriterMeta(out, 100, 75, model, meta)
+		},
+
+		"JPEG": func(out io.Writer, meta ImageMeta,
+			model color.Model) (Encoder, error) {
+			return NewJPEGWriterMeta(out, 100, 75, model, 90, meta)
+		},
+	}
+
+	for format, newEncoder := range encoders {
+		for _, test := range tests {
+			buf := &bytes.Buffer{}
+			encoder, err := newEncoder(buf, test.meta, test.model)
+			if err != nil {
+				t.Errorf("%s: %s: %s", format, test.name, err)
+				continue
+			}
+
+			row := NewRow(test.model, 100)
+			for y := 0; y < 75 && err == nil; y++ {
+				err = encoder.Write(row)
+			}
+
+			if err == nil {
+				err = encoder.Close()
+			}
+
+			if err != nil {
+				t.Errorf("%s: %s: encode: %s", format, test.name, err)
+				continue
+			}
+
+			decoder, err := NewDetectReader(buf)
+			if err != nil {
+				t.Errorf("%s: %s: decode: %s", format, test.name, err)
+				continue
+			}
+
+			meta := decoder.(Decoder).Meta()
+			decoder.Close()
+
+			if diff := testutils.Diff(meta, test.meta); diff != "" {
+				t.Errorf("%s: %s:\n%s", format, test.name, diff)
+			}
+		}
+
+		// ICC profile must match the color model
+		_, err := newEncoder(io.Discard,
+			ImageMeta{ICCProfile: ICCProfileSRGB()}, color.GrayModel)
+		if err == nil {
+			t.Errorf("%s: ICC profile mismatch not detected", format)
+		}
+	}
+
+	// Resolution of other formats
+	buf := &bytes.Buffer{}
+	writer, _ := NewTIFFWriter(buf, 100, 75, color.GrayModel, 200, 300)
+	writer.Close()
+
+	decoder, err := NewTIFFReader(buf)
+	if err != nil {
+		t.Fatalf("TIFF: %s", err)
+	}
+
+	expected := ImageMeta{XResolution: 200, YResolution: 300}
+	if diff := testutils.Diff(decoder.Meta(), expected); diff != "" {
+		t.Errorf("TIFF:\n%s", diff)
+	}
+
+	// Test images have no ICC profile
+	decoder, err = NewPNGReader(bytes.NewReader(testutils.Images.PNG100x75rgb8))
+	if err != nil {
+		t.Fatalf("PNG: %s", err)
+	}
+
+	if meta := decoder.Meta(); meta.ICCProfile != nil {
+		t.Errorf("PNG: unexpected ICC profile")
+	}
+
+	decoder.Close()
+}
@@ -16,7 +16,9 @@ const (
 	MIMETypeJPEG = "image/jpeg"
 	MIMETypePDF  = "application/pdf"
 	MIMETypePNG  = "image/png"
+	MIMETypePWG  = "image/pwg-raster"
 	MIMETypeTIFF = "image/tiff"
+	MIMETypeURF  = "image/urf"
 	MIMETypeData = "application/octet-stream"
 )
 
@@ -45,6 +47,8 @@ var formatTable = []struct {
 	{[]byte{'%', 'P', 'D', 'F', '-'}, MIMETypePDF},
 	{[]byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a},
 		MIMETypePNG},
+	{[]byte{'R', 'a', 'S', '2'}, MIMETypePWG},
 	{[]byte{'I', 'I', '*', 0}, MIMETypeTIFF},
 	{[]byte{'M', 'M', 0, '*'}, MIMETypeTIFF},
+	{[]byte{'U', 'N', 'I', 'R', 'A', 'S', 'T', 0}, MIMETypeURF},
 }
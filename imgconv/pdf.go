@@ -0,0 +1,516 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// PDF Writer
+
+package imgconv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// PDF object numbers, reserved for the document catalog
+// and the page tree.
+const (
+	pdfCatalogObj = 1
+	pdfPagesObj   = 2
+)
+
+// PDFDocumentWriter writes the image-only multi-page PDF documents.
+//
+// Each page contains exactly one image, which covers the whole page.
+// The page size is computed from the image size and resolution.
+//
+// Pages are written sequentially, one by one, and the output is
+// fully streaming: image data is written to the output as soon as
+// it comes, without buffering of the whole page.
+//
+// Gray, RGB and bilevel pages are compressed using the FlateDecode
+// filter. JPEG images are embedded as is, using the DCTDecode filter,
+// without re-compression.
+type PDFDocumentWriter struct {
+	out    pdfOutput // Output stream
+	xref   []int64   // Object offsets; xref[0] is for object 1
+	pages  []int     // Object numbers of the page objects
+	page   *pdfPage  // Current page, nil if none
+	closed bool      // Writer is closed
+}
+
+// pdfOutput wraps the io.Writer and tracks the current output
+// offset and sticky write error.
+type pdfOutput struct {
+	w   io.Writer // Underlying io.Writer
+	off int64     // Current offset
+	err error     // Sticky error
+}
+
+// pdfPage implements the [Writer] interface for the single
+// page of the PDFDocumentWriter.
+type pdfPage struct {
+	pdf        *PDFDocumentWriter // Back link to the PDFDocumentWriter
+	wid, hei   int                // Image size
+	model      color.Model        // Color model
+	xres, yres int                // Image resolution, DPI
+	image      int                // Image object number
+	start      int64              // Offset of the image stream data
+	zw         *zlib.Writer       // Compressor
+	rowBytes   []byte             // Row encoding buffer
+	y          int                // Current y-coordinate
+}
+
+// NewPDFDocumentWriter creates a new [PDFDocumentWriter].
+//
+// The PDFDocumentWriter needs to be explicitly closed after use,
+// to write the PDF trailer.
+func NewPDFDocumentWriter(output io.Writer) *PDFDocumentWriter {
+	pdf := &PDFDocumentWriter{out: pdfOutput{w: output}}
+
+	// Reserve objects for the catalog and the page tree.
+	// They will be written by Close, when all pages are known.
+	pdf.newObj()
+	pdf.newObj()
+
+	// Write the PDF header. The second line marks the file
+	// as binary, as recommended by the PDF specification.
+	pdf.printf("%%PDF-1.5\n%%\xe2\xe3\xcf\xd3\n")
+
+	return pdf
+}
+
+// NewPage starts a new page and returns the [Writer] for the page
+// image.
+//
+// The page is finished when the returned Writer is closed.
+// Only one page may be written at a time.
+//
+// xres and yres specify the image resolution, in DPI. They are
+// used to compute the page size. If resolution is not known,
+// zero may be passed, which is the same as 72 DPI.
+//
+// Supported color models are following:
+//   - BilevelModel (1-bit grayscale)
+//   - color.GrayModel
+//   - color.Gray16Model
+//   - color.RGBAModel
+//   - color.RGBA64Model
+func (pdf *PDFDocumentWriter) NewPage(wid, hei int, model color.Model,
+	xres, yres int) (Writer, error) {
+
+	// Check arguments
+	var colorSpace string
+	var depth, bytesPerRow int
+
+	switch model {
+	case BilevelModel:
+		colorSpace, depth, bytesPerRow = "DeviceGray", 1, (wid+7)/8
+	case color.GrayModel:
+		colorSpace, depth, bytesPerRow = "DeviceGray", 8, wid
+	case color.Gray16Model:
+		colorSpace, depth, bytesPerRow = "DeviceGray", 16, wid*2
+	case color.RGBAModel:
+		colorSpace, depth, bytesPerRow = "DeviceRGB", 8, wid*3
+	case color.RGBA64Model:
+		colorSpace, depth, bytesPerRow = "DeviceRGB", 16, wid*6
+	default:
+		return nil, errors.New("PDF: unsupported color model")
+	}
+
+	err := pdf.checkState()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the page
+	page := &pdfPage{
+		pdf:      pdf,
+		wid:      wid,
+		hei:      hei,
+		model:    model,
+		xres:     xres,
+		yres:     yres,
+		rowBytes: make([]byte, bytesPerRow),
+	}
+
+	dict := fmt.Sprintf("/ColorSpace /%s /BitsPerComponent %d "+
+		"/Filter /FlateDecode", colorSpace, depth)
+
+	page.image, page.start = pdf.beginImage(wid, hei, dict)
+	page.zw = zlib.NewWriter(&pdf.out)
+
+	if pdf.out.err != nil {
+		return nil, pdf.out.err
+	}
+
+	pdf.page = page
+	return page, nil
+}
+
+// WriteJPEG writes the JPEG image as a new page.
+//
+// The image is embedded into the PDF as is, without decoding and
+// re-compression. Only the image header is parsed, to obtain the
+// image size and color space.
+//
+// xres and yres have the same meaning, as for the
+// [PDFDocumentWriter.NewPage].
+func (pdf *PDFDocumentWriter) WriteJPEG(in io.Reader, xres, yres int) error {
+	err := pdf.checkState()
+	if err != nil {
+		return err
+	}
+
+	// Decode the JPEG header. Save all consumed bytes,
+	// so they can be written later.
+	var hdr bytes.Buffer
+	in = bufio.NewReader(in)
+	cfg, err := jpeg.DecodeConfig(io.TeeReader(in, &hdr))
+	if err != nil {
+		return fmt.Errorf("PDF: JPEG: %w", err)
+	}
+
+	var dict string
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		dict = "/ColorSpace /DeviceGray"
+	case color.CMYKModel:
+		// CMYK JPEGs are written by Adobe software with the
+		// inverted components.
+		dict = "/ColorSpace /DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+	default:
+		dict = "/ColorSpace /DeviceRGB"
+	}
+
+	dict += " /BitsPerComponent 8 /Filter /DCTDecode"
+
+	// Write the image
+	image, start := pdf.beginImage(cfg.Width, cfg.Height, dict)
+	pdf.out.Write(hdr.Bytes())
+
+	if pdf.out.err == nil {
+		_, err = io.Copy(&pdf.out, in)
+		if err != nil && pdf.out.err == nil {
+			// Input error. Output is still consistent, but
+			// the image is truncated.
+			pdf.out.err = err
+		}
+	}
+
+	pdf.endImage(image, start)
+	pdf.addPage(image, cfg.Width, cfg.Height, xres, yres)
+
+	return pdf.out.err
+}
+
+// Close finishes the current page, if any, writes the PDF trailer
+// and closes the PDFDocumentWriter.
+//
+// It doesn't close the underlying [io.Writer].
+func (pdf *PDFDocumentWriter) Close() error {
+	if pdf.closed {
+		return pdf.out.err
+	}
+
+	if pdf.page != nil {
+		pdf.page.Close()
+	}
+
+	pdf.closed = true
+
+	// Write catalog and page tree
+	pdf.beginObj(pdfCatalogObj)
+	pdf.printf("<< /Type /Catalog /Pages %d 0 R >>\n", pdfPagesObj)
+	pdf.endObj()
+
+	pdf.beginObj(pdfPagesObj)
+	pdf.printf("<< /Type /Pages /Kids [")
+	for i, obj := range pdf.pages {
+		if i != 0 {
+			pdf.printf(" ")
+		}
+		pdf.printf("%d 0 R", obj)
+	}
+	pdf.printf("] /Count %d >>\n", len(pdf.pages))
+	pdf.endObj()
+
+	// Write cross-reference table and trailer.
+	//
+	// Each xref entry must be exactly 20 bytes long.
+	startxref := pdf.out.off
+
+	pdf.printf("xref\n0 %d\n", len(pdf.xref)+1)
+	pdf.printf("0000000000 65535 f \n")
+	for _, off := range pdf.xref {
+		pdf.printf("%.10d 00000 n \n", off)
+	}
+
+	pdf.printf("trailer\n<< /Size %d /Root %d 0 R >>\n",
+		len(pdf.xref)+1, pdfCatalogObj)
+	pdf.printf("startxref\n%d\n%%%%EOF\n", startxref)
+
+	return pdf.out.err
+}
+
+// checkState checks that new page can be started.
+func (pdf *PDFDocumentWriter) checkState() error {
+	switch {
+	case pdf.closed:
+		return errors.New("PDF: writer is closed")
+	case pdf.page != nil:
+		return errors.New("PDF: previous page is not closed")
+	}
+
+	return pdf.out.err
+}
+
+// beginImage starts the image XObject with the specified size
+// and additional dictionary entries.
+//
+// It returns the image object number and the offset of the
+// image stream data, as required by the endImage.
+func (pdf *PDFDocumentWriter) beginImage(wid, hei int,
+	dict string) (image int, start int64) {
+
+	image = pdf.newObj()
+	length := pdf.newObj()
+
+	pdf.beginObj(image)
+	pdf.printf("<< /Type /XObject /Subtype /Image "+
+		"/Width %d /Height %d %s /Length %d 0 R >>\nstream\n",
+		wid, hei, dict, length)
+
+	return image, pdf.out.off
+}
+
+// endImage finishes the image XObject, started by the beginImage.
+func (pdf *PDFDocumentWriter) endImage(image int, start int64) {
+	length := pdf.out.off - start
+
+	pdf.printf("\nendstream\n")
+	pdf.endObj()
+
+	// Length object always follows the image object
+	pdf.beginObj(image + 1)
+	pdf.printf("%d\n", length)
+	pdf.endObj()
+}
+
+// addPage adds page with the single image that covers
+// the whole page.
+func (pdf *PDFDocumentWriter) addPage(image, wid, hei, xres, yres int) {
+	if xres <= 0 {
+		xres = 72
+	}
+	if yres <= 0 {
+		yres = 72
+	}
+
+	w := pdfReal(float64(wid) * 72 / float64(xres))
+	h := pdfReal(float64(hei) * 72 / float64(yres))
+
+	// Write content stream
+	content := fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q\n", w, h)
+
+	contentObj := pdf.newObj()
+	pdf.beginObj(contentObj)
+	pdf.printf("<< /Length %d >>\nstream\n%s\nendstream\n",
+		len(content), content)
+	pdf.endObj()
+
+	// Write page object
+	pageObj := pdf.newObj()
+	pdf.beginObj(pageObj)
+	pdf.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] "+
+		"/Resources << /XObject << /Im0 %d 0 R >> >> "+
+		"/Contents %d 0 R >>\n",
+		pdfPagesObj, w, h, image, contentObj)
+	pdf.endObj()
+
+	pdf.pages = append(pdf.pages, pageObj)
+}
+
+// newObj allocates the new object number.
+func (pdf *PDFDocumentWriter) newObj() int {
+	pdf.xref = append(pdf.xref, 0)
+	return len(pdf.xref)
+}
+
+// beginObj starts the object with the specified number.
+func (pdf *PDFDocumentWriter) beginObj(obj int) {
+	pdf.xref[obj-1] = pdf.out.off
+	pdf.printf("%d 0 obj\n", obj)
+}
+
+// endObj finishes the object.
+func (pdf *PDFDocumentWriter) endObj() {
+	pdf.printf("endobj\n")
+}
+
+// printf writes formatted output.
+func (pdf *PDFDocumentWriter) printf(format string, args ...any) {
+	fmt.Fprintf(&pdf.out, format, args...)
+}
+
+// pdfReal formats the real number, rounded to 2 decimal places.
+func pdfReal(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// Write writes to the underlying io.Writer.
+// It implements the [io.Writer] interface.
+func (out *pdfOutput) Write(data []byte) (int, error) {
+	if out.err != nil {
+		return 0, out.err
+	}
+
+	n, err := out.w.Write(data)
+	out.off += int64(n)
+	out.err = err
+
+	return n, err
+}
+
+// ColorModel returns the [color.Model] of image being written.
+func (page *pdfPage) ColorModel() color.Model {
+	return page.model
+}
+
+// Size returns the image size.
+func (page *pdfPage) Size() (wid, hei int) {
+	return page.wid, page.hei
+}
+
+// Write writes the next image [Row].
+func (page *pdfPage) Write(row Row) error {
+	pdf := page.pdf
+
+	// Check for pending error
+	switch {
+	case pdf.out.err != nil:
+		return pdf.out.err
+	case pdf.page != page:
+		return errors.New("PDF: page is closed")
+	}
+
+	// Silently ignore excessive rows
+	if page.y == page.hei {
+		return nil
+	}
+
+	// Encode the row
+	wid := generic.Min(row.Width(), page.wid)
+
+	var bytesPerPixel int
+
+	switch page.model {
+	case BilevelModel:
+		bytesBilevelFromRow(page.rowBytes, row)
+
+		// Fill the tail. Bit set means white.
+		for x := wid; x < page.wid; x++ {
+			page.rowBytes[x>>3] |= 0x80 >> (x & 7)
+		}
+	case color.GrayModel:
+		bytesPerPixel = 1
+		bytesGray8fromRow(page.rowBytes, row)
+	case color.Gray16Model:
+		bytesPerPixel = 2
+		bytesGray16BEfromRow(page.rowBytes, row)
+	case color.RGBAModel:
+		bytesPerPixel = 3
+		bytesRGB8fromRow(page.rowBytes, row)
+	case color.RGBA64Model:
+		bytesPerPixel = 6
+		bytesRGB16BEfromRow(page.rowBytes, row)
+	}
+
+	// Fill the tail
+	if wid < page.wid {
+		end := page.wid * bytesPerPixel
+		for x := wid * bytesPerPixel; x < end; x++ {
+			page.rowBytes[x] = 0xff
+		}
+	}
+
+	// Write the row
+	page.zw.Write(page.rowBytes)
+	if pdf.out.err == nil {
+		page.y++
+	}
+
+	return pdf.out.err
+}
+
+// Close finishes the page.
+func (page *pdfPage) Close() error {
+	pdf := page.pdf
+	if pdf.page != page {
+		return pdf.out.err
+	}
+
+	// Write missed lines
+	for pdf.out.err == nil && page.y < page.hei {
+		page.Write(RowEmpty{})
+	}
+
+	// Finish the page
+	page.zw.Close()
+	pdf.endImage(page.image, page.start)
+	pdf.addPage(page.image, page.wid, page.hei, page.xres, page.yres)
+	pdf.page = nil
+
+	return pdf.out.err
+}
+
+// pdfWriter implements the [Encoder] interface for writing
+// single-page PDF documents.
+type pdfWriter struct {
+	Writer                    // Page writer
+	pdf    *PDFDocumentWriter // Underlying PDFDocumentWriter
+}
+
+// NewPDFWriter creates a new [Writer] for single-page PDF documents,
+// containing one image.
+//
+// xres and yres specify the image resolution, in DPI, and used
+// to compute the page size. Zero means 72 DPI.
+//
+// Supported color models are the same as for the
+// [PDFDocumentWriter.NewPage].
+//
+// Use [PDFDocumentWriter] to write multi-page PDF documents.
+func NewPDFWriter(output io.Writer, wid, hei int, model color.Model,
+	xres, yres int) (Encoder, error) {
+
+	pdf := NewPDFDocumentWriter(output)
+	page, err := pdf.NewPage(wid, hei, model, xres, yres)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pdfWriter{page, pdf}, nil
+}
+
+// MIMEType returns the MIME type of the image being encoded.
+func (*pdfWriter) MIMEType() string {
+	return MIMETypePDF
+}
+
+// Close flushes the buffered data and then closes the Writer
+func (writer *pdfWriter) Close() error {
+	writer.Writer.Close()
+	return writer.pdf.Close()
+}
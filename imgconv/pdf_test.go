@@ -0,0 +1,327 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// PDF Writer test
+
+package imgconv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testPDF is the minimal parser of PDF files, written by
+// the PDFDocumentWriter.
+type testPDF struct {
+	data []byte         // PDF file content
+	objs map[int][]byte // Objects content, by number
+}
+
+// testPDFParse parses PDF file. It validates the file structure
+// and the cross-reference table.
+func testPDFParse(data []byte) (*testPDF, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-1.5\n")) {
+		return nil, fmt.Errorf("missed PDF header")
+	}
+
+	if !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		return nil, fmt.Errorf("missed %%%%EOF")
+	}
+
+	// Locate xref table
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		return nil, fmt.Errorf("missed startxref")
+	}
+
+	off, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[off:], []byte("xref\n0 ")) {
+		return nil, fmt.Errorf("invalid startxref")
+	}
+
+	// Parse xref table
+	lines := strings.Split(string(data[off:]), "\n")
+	cnt, _ := strconv.Atoi(strings.TrimPrefix(lines[1], "0 "))
+
+	pdf := &testPDF{data: data, objs: make(map[int][]byte)}
+	for obj := 1; obj < cnt; obj++ {
+		ent := lines[2+obj] + "\n"
+		if len(ent) != 20 {
+			return nil, fmt.Errorf("xref %d: invalid length", obj)
+		}
+
+		off, _ := strconv.Atoi(ent[:10])
+		hdr := fmt.Sprintf("%d 0 obj\n", obj)
+		if !bytes.HasPrefix(data[off:], []byte(hdr)) {
+			return nil, fmt.Errorf("xref %d: invalid offset", obj)
+		}
+
+		body := data[off+len(hdr):]
+		end := bytes.Index(body, []byte("endobj\n"))
+		if end < 0 {
+			return nil, fmt.Errorf("obj %d: missed endobj", obj)
+		}
+
+		pdf.objs[obj] = body[:end]
+	}
+
+	return pdf, nil
+}
+
+// ref returns object number, referenced by the dictionary key.
+func (pdf *testPDF) ref(obj int, key string) int {
+	re := regexp.MustCompile(key + ` (\d+) 0 R`)
+	m := re.FindSubmatch(pdf.objs[obj])
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(m[1]))
+	return n
+}
+
+// pages returns page object numbers.
+func (pdf *testPDF) pages() []int {
+	pages := pdf.ref(1, "/Pages")
+	re := regexp.MustCompile(`(\d+) 0 R`)
+	kids := bytes.SplitN(pdf.objs[pages], []byte("/Kids"), 2)[1]
+	kids = kids[:bytes.IndexByte(kids, ']')]
+
+	var objs []int
+	for _, m := range re.FindAllSubmatch(kids, -1) {
+		n, _ := strconv.Atoi(string(m[1]))
+		objs = append(objs, n)
+	}
+	return objs
+}
+
+// image returns the image object dictionary and stream data
+// for the page.
+func (pdf *testPDF) image(page int) (dict string, data []byte) {
+	obj := pdf.ref(page, "/Im0")
+	body := pdf.objs[obj]
+
+	i := bytes.Index(body, []byte("stream\n"))
+	dict = string(body[:i])
+	data = body[i+7:]
+
+	length := pdf.ref(obj, "/Length")
+	n, _ := strconv.Atoi(strings.TrimSpace(string(pdf.objs[length])))
+
+	return dict, data[:n]
+}
+
+// TestPDFDocumentWriter tests the PDFDocumentWriter
+func TestPDFDocumentWriter(t *testing.T) {
+	type testData struct {
+		model    color.Model // Color model
+		dict     string      // Expected dictionary entries
+		rowBytes []byte      // Expected bytes of each row
+	}
+
+	tests := []testData{
+		{
+			model:    BilevelModel,
+			dict:     "/ColorSpace /DeviceGray /BitsPerComponent 1 ",
+			rowBytes: []byte{0x60},
+		},
+		{
+			model:    color.GrayModel,
+			dict:     "/ColorSpace /DeviceGray /BitsPerComponent 8 ",
+			rowBytes: []byte{0, 0xff, 0xff},
+		},
+		{
+			model: color.Gray16Model,
+			dict:  "/ColorSpace /DeviceGray /BitsPerComponent 16 ",
+			rowBytes: []byte{0, 0, 0xff, 0xff,
+				0xff, 0xff},
+		},
+		{
+			model: color.RGBAModel,
+			dict:  "/ColorSpace /DeviceRGB /BitsPerComponent 8 ",
+			rowBytes: []byte{0, 0, 0, 0xff, 0xff, 0xff,
+				0xff, 0xff, 0xff},
+		},
+	}
+
+	// Each page is 3x2 pixels: black, white and the tail, filled
+	// by the writer. The second row is omitted and must be
+	// filled by Close.
+	row := RowGray8{{Y: 0}, {Y: 0xff}}
+
+	buf := &bytes.Buffer{}
+	pdf := NewPDFDocumentWriter(buf)
+
+	for _, test := range tests {
+		page, err := pdf.NewPage(3, 2, test.model, 144, 72)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+
+		_, err = pdf.NewPage(3, 2, test.model, 144, 72)
+		if err == nil {
+			t.Errorf("NewPage: second page must fail while " +
+				"first is active")
+		}
+
+		page.Write(row)
+		page.Close()
+
+		err = page.Write(row)
+		if err == nil {
+			t.Errorf("Write to the closed page must fail")
+		}
+	}
+
+	err := pdf.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	// Check the output
+	parsed, err := testPDFParse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	pages := parsed.pages()
+	if len(pages) != len(tests) {
+		t.Fatalf("pages count: expected %d, present %d",
+			len(tests), len(pages))
+	}
+
+	for i, test := range tests {
+		page := parsed.objs[pages[i]]
+		if !bytes.Contains(page, []byte("/MediaBox [0 0 1.5 2]")) {
+			t.Errorf("page %d: invalid MediaBox:\n%s", i, page)
+		}
+
+		dict, data := parsed.image(pages[i])
+		if !strings.Contains(dict, test.dict) {
+			t.Errorf("page %d: image dict:\nexpected: %s\npresent:  %s",
+				i, test.dict, dict)
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("page %d: zlib: %s", i, err)
+			continue
+		}
+
+		pixels, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("page %d: zlib: %s", i, err)
+			continue
+		}
+
+		// The second row is filled by white
+		white := bytes.Repeat([]byte{0xff}, len(test.rowBytes))
+		if test.model == BilevelModel {
+			white = []byte{0xe0}
+		}
+
+		expected := append(append([]byte{}, test.rowBytes...), white...)
+		if !bytes.Equal(pixels, expected) {
+			t.Errorf("page %d: pixels:\nexpected: %x\npresent:  %x",
+				i, expected, pixels)
+		}
+	}
+
+	// Pages cannot be added after Close
+	_, err = pdf.NewPage(3, 2, color.GrayModel, 0, 0)
+	if err == nil {
+		t.Errorf("NewPage after Close must fail")
+	}
+}
+
+// TestPDFJPEG tests JPEG passthrough
+func TestPDFJPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	jpg := &bytes.Buffer{}
+	jpeg.Encode(jpg, img, nil)
+
+	buf := &bytes.Buffer{}
+	pdf := NewPDFDocumentWriter(buf)
+
+	err := pdf.WriteJPEG(bytes.NewReader(jpg.Bytes()), 300, 300)
+	if err != nil {
+		t.Fatalf("WriteJPEG: %s", err)
+	}
+
+	err = pdf.WriteJPEG(strings.NewReader("garbage"), 300, 300)
+	if err == nil {
+		t.Errorf("WriteJPEG: error expected for invalid JPEG")
+	}
+
+	pdf.Close()
+
+	parsed, err := testPDFParse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	pages := parsed.pages()
+	if len(pages) != 1 {
+		t.Fatalf("pages count: expected %d, present %d", 1, len(pages))
+	}
+
+	dict, data := parsed.image(pages[0])
+	for _, s := range []string{"/Width 30", "/Height 20",
+		"/DeviceRGB", "/DCTDecode"} {
+		if !strings.Contains(dict, s) {
+			t.Errorf("image dict: missed %q:\n%s", s, dict)
+		}
+	}
+
+	if !bytes.Equal(data, jpg.Bytes()) {
+		t.Errorf("JPEG data is not passed as is")
+	}
+}
+
+// TestPDFWriter tests single-page PDF writer
+func TestPDFWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer, err := NewPDFWriter(buf, 10, 10, color.RGBAModel, 300, 300)
+	if err != nil {
+		t.Fatalf("NewPDFWriter: %s", err)
+	}
+
+	if writer.MIMEType() != MIMETypePDF {
+		t.Errorf("MIMEType: expected %q, present %q",
+			MIMETypePDF, writer.MIMEType())
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if MIMETypeDetect(buf.Bytes()) != MIMETypePDF {
+		t.Errorf("MIMETypeDetect: PDF not detected")
+	}
+
+	parsed, err := testPDFParse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if n := len(parsed.pages()); n != 1 {
+		t.Errorf("pages count: expected %d, present %d", 1, n)
+	}
+
+	_, err = NewPDFWriter(buf, 10, 10, color.CMYKModel, 0, 0)
+	if err == nil {
+		t.Errorf("NewPDFWriter: unsupported model must fail")
+	}
+}
@@ -0,0 +1,720 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// PDF Reader
+
+package imgconv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// pdfMaxDepth limits the nesting of the PDF objects and
+// of the page tree.
+const pdfMaxDepth = 32
+
+// pdfMaxSize is the maximal image width and height, in pixels,
+// accepted by the PDF reader. It protects from allocation of the
+// huge buffers due to the broken image dictionaries.
+const pdfMaxSize = 1 << 16
+
+// PDF object types, as returned by the pdfParser:
+//
+//	nil           - null
+//	bool          - boolean
+//	int           - integer number
+//	float64       - real number
+//	[]byte        - string
+//	pdfName       - name
+//	pdfRef        - indirect reference
+//	[]any         - array
+//	pdfDict       - dictionary
+type (
+	pdfName string
+	pdfDict map[pdfName]any
+	pdfRef  struct{ num, gen int }
+)
+
+// pdfObjHeader matches the header of the indirect object.
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// PDFDocumentReader reads the image-only PDF documents, where each
+// page contains a single image, like documents, produced by the
+// scanners and by the [PDFDocumentWriter].
+//
+// It is not a general-purpose PDF renderer. Only the page images are
+// decoded; everything else (text, vector graphics, image placement)
+// is ignored. If page contains multiple images, the largest one
+// is used.
+//
+// Supported are DCTDecode (JPEG) images, and uncompressed or
+// FlateDecode-compressed DeviceGray and DeviceRGB images with 1, 8
+// or 16 bits per component. Documents with the compressed object
+// streams (PDF 1.5+) are not supported.
+//
+// PDF is the random-access format, so the whole input is loaded
+// into memory. However, the image decoding is performed on demand.
+type PDFDocumentReader struct {
+	data   []byte      // The whole PDF file
+	objs   map[int]int // Offsets of indirect objects
+	images []int       // Image objects, one per page
+	next   int         // Index of the next page
+}
+
+// NewPDFDocumentReader creates a new [PDFDocumentReader].
+// It loads the whole input and locates images of all pages,
+// but doesn't decode them.
+func NewPDFDocumentReader(input io.Reader) (*PDFDocumentReader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if MIMETypeDetect(data) != MIMETypePDF {
+		return nil, errors.New("PDF: invalid header")
+	}
+
+	doc := &PDFDocumentReader{
+		data: data,
+		objs: make(map[int]int),
+	}
+
+	doc.index()
+
+	// Locate the document catalog
+	root, err := doc.root()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, _ := doc.resolve(root).(pdfDict)
+	if catalog == nil {
+		return nil, errors.New("PDF: missed document catalog")
+	}
+
+	// Walk the page tree
+	err = doc.walk(catalog["Pages"], nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc.images) == 0 {
+		return nil, errors.New("PDF: no pages")
+	}
+
+	return doc, nil
+}
+
+// NewPDFReader creates a new [Decoder] for the first page of
+// the image-only PDF document.
+//
+// See [PDFDocumentReader] for details.
+func NewPDFReader(input io.Reader) (Decoder, error) {
+	doc, err := NewPDFDocumentReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.NextPage()
+}
+
+// Pages returns count of pages in the document.
+func (doc *PDFDocumentReader) Pages() int {
+	return len(doc.images)
+}
+
+// NextPage returns the [Decoder] for the next page of the document.
+// At the end of document it returns [io.EOF].
+//
+// Pages are independent of each other, and previously returned
+// decoders remain valid.
+func (doc *PDFDocumentReader) NextPage() (Decoder, error) {
+	if doc.next >= len(doc.images) {
+		return nil, io.EOF
+	}
+
+	num := doc.images[doc.next]
+	doc.next++
+
+	return doc.openImage(num)
+}
+
+// index builds the index of indirect objects.
+//
+// The cross-reference table is not used. Instead, the whole file
+// is scanned for the object headers. This is simple and also works
+// for files with damaged cross-reference table. Streams are skipped,
+// so their content is not confused with the objects. If object is
+// defined multiple times (incremental updates), the last definition
+// wins.
+func (doc *PDFDocumentReader) index() {
+	off := 0
+	for {
+		loc := pdfObjHeader.FindSubmatchIndex(doc.data[off:])
+		if loc == nil {
+			return
+		}
+
+		num, _ := strconv.Atoi(string(doc.data[off+loc[2] : off+loc[3]]))
+		doc.objs[num] = off + loc[1]
+		off += loc[1]
+
+		// Skip the stream, if any
+		p := &pdfParser{data: doc.data, off: off}
+		if _, err := p.object(0); err == nil && p.keyword("stream") {
+			end := bytes.Index(doc.data[p.off:], []byte("endstream"))
+			if end < 0 {
+				return
+			}
+			off = p.off + end
+		}
+	}
+}
+
+// root returns reference to the document catalog.
+func (doc *PDFDocumentReader) root() (any, error) {
+	// Try the last trailer
+	if off := bytes.LastIndex(doc.data, []byte("trailer")); off >= 0 {
+		p := &pdfParser{data: doc.data, off: off + len("trailer")}
+		trailer, _ := p.object(0)
+		if dict, ok := trailer.(pdfDict); ok && dict["Root"] != nil {
+			return dict["Root"], nil
+		}
+	}
+
+	// Look for the catalog object. Files with cross-reference
+	// streams have no trailer.
+	for num := range doc.objs {
+		dict, _ := doc.resolve(pdfRef{num, 0}).(pdfDict)
+		if dict["Type"] == pdfName("Catalog") {
+			return dict, nil
+		}
+	}
+
+	return nil, errors.New("PDF: missed document catalog")
+}
+
+// walk walks the page tree, starting from node, and collects
+// page images.
+//
+// Resources are inherited from the parent nodes.
+func (doc *PDFDocumentReader) walk(node any, resources any, depth int) error {
+	if depth > pdfMaxDepth {
+		return errors.New("PDF: page tree is too deep")
+	}
+
+	dict, _ := doc.resolve(node).(pdfDict)
+	if dict == nil {
+		return errors.New("PDF: invalid page tree")
+	}
+
+	if r := dict["Resources"]; r != nil {
+		resources = r
+	}
+
+	switch dict["Type"] {
+	case pdfName("Pages"):
+		kids, _ := doc.resolve(dict["Kids"]).([]any)
+		for _, kid := range kids {
+			err := doc.walk(kid, resources, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+	case pdfName("Page"):
+		image, err := doc.pageImage(resources)
+		if err != nil {
+			return fmt.Errorf("%w (page %d)", err, len(doc.images)+1)
+		}
+		doc.images = append(doc.images, image)
+
+	default:
+		return errors.New("PDF: invalid page tree")
+	}
+
+	return nil
+}
+
+// pageImage returns the object number of the largest image
+// in the page resources.
+func (doc *PDFDocumentReader) pageImage(resources any) (int, error) {
+	res, _ := doc.resolve(resources).(pdfDict)
+	xobjects, _ := doc.resolve(res["XObject"]).(pdfDict)
+
+	image, size := -1, -1
+	for _, xobj := range xobjects {
+		ref, ok := xobj.(pdfRef)
+		if !ok {
+			continue
+		}
+
+		dict, _ := doc.resolve(ref).(pdfDict)
+		if dict["Subtype"] != pdfName("Image") {
+			continue
+		}
+
+		wid, _ := doc.resolve(dict["Width"]).(int)
+		hei, _ := doc.resolve(dict["Height"]).(int)
+
+		// Compare (size, num) to make choice deterministic
+		if wid*hei > size || (wid*hei == size && ref.num < image) {
+			image, size = ref.num, wid*hei
+		}
+	}
+
+	if image < 0 {
+		return 0, errors.New("PDF: page has no image")
+	}
+
+	return image, nil
+}
+
+// openImage returns the [Decoder] for the image object.
+func (doc *PDFDocumentReader) openImage(num int) (Decoder, error) {
+	// Parse the image dictionary
+	off, found := doc.objs[num]
+	if !found {
+		return nil, errors.New("PDF: missed image object")
+	}
+
+	p := &pdfParser{data: doc.data, off: off}
+	obj, err := p.object(0)
+	if err != nil {
+		return nil, err
+	}
+
+	dict, _ := obj.(pdfDict)
+	if dict == nil || !p.keyword("stream") {
+		return nil, errors.New("PDF: invalid image object")
+	}
+
+	// Locate the stream data. The stream keyword is followed
+	// by either CRLF or LF.
+	if bytes.HasPrefix(doc.data[p.off:], []byte("\r\n")) {
+		p.off += 2
+	} else if bytes.HasPrefix(doc.data[p.off:], []byte("\n")) {
+		p.off++
+	}
+
+	length, _ := doc.resolve(dict["Length"]).(int)
+	if length < 0 || length > len(doc.data)-p.off {
+		return nil, errors.New("PDF: invalid stream length")
+	}
+
+	stream := doc.data[p.off : p.off+length]
+
+	// Obtain image parameters
+	wid, _ := doc.resolve(dict["Width"]).(int)
+	hei, _ := doc.resolve(dict["Height"]).(int)
+	bpc, _ := doc.resolve(dict["BitsPerComponent"]).(int)
+	cs := doc.resolve(dict["ColorSpace"])
+	filter := doc.resolve(dict["Filter"])
+
+	if arr, ok := filter.([]any); ok && len(arr) == 1 {
+		filter = doc.resolve(arr[0])
+	}
+
+	if wid <= 0 || wid > pdfMaxSize || hei <= 0 || hei > pdfMaxSize {
+		return nil, errors.New("PDF: invalid image size")
+	}
+
+	if filter != pdfName("DCTDecode") &&
+		bpc != 1 && bpc != 8 && bpc != 16 {
+		return nil, fmt.Errorf("PDF: invalid BitsPerComponent %d", bpc)
+	}
+
+	if parms, _ := doc.resolve(dict["DecodeParms"]).(pdfDict); parms != nil {
+		if pred, _ := doc.resolve(parms["Predictor"]).(int); pred > 1 {
+			return nil, errors.New("PDF: predictors not supported")
+		}
+	}
+
+	// JPEG images are decoded by the JPEG decoder
+	if filter == pdfName("DCTDecode") {
+		return NewJPEGReader(bytes.NewReader(stream))
+	}
+
+	// Choose the color model
+	reader := &pdfImageReader{wid: wid, hei: hei}
+
+	switch {
+	case cs == pdfName("DeviceGray") && bpc == 1:
+		reader.model = BilevelModel
+		reader.rowBytes = make([]byte, (wid+7)/8)
+
+		decode, _ := doc.resolve(dict["Decode"]).([]any)
+		if len(decode) == 2 && decode[0] == 1 && decode[1] == 0 {
+			reader.invert = true
+		}
+
+	case cs == pdfName("DeviceGray") && bpc == 8:
+		reader.model = color.GrayModel
+		reader.rowBytes = make([]byte, wid)
+	case cs == pdfName("DeviceGray") && bpc == 16:
+		reader.model = color.Gray16Model
+		reader.rowBytes = make([]byte, wid*2)
+	case cs == pdfName("DeviceRGB") && bpc == 8:
+		reader.model = color.RGBAModel
+		reader.rowBytes = make([]byte, wid*3)
+	case cs == pdfName("DeviceRGB") && bpc == 16:
+		reader.model = color.RGBA64Model
+		reader.rowBytes = make([]byte, wid*6)
+	default:
+		return nil, errors.New("PDF: unsupported image format")
+	}
+
+	// Setup the decompressor
+	switch filter {
+	case nil:
+		reader.input = bytes.NewReader(stream)
+
+	case pdfName("FlateDecode"):
+		zr, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			return nil, fmt.Errorf("PDF: %w", err)
+		}
+		reader.input = zr
+
+	default:
+		return nil, fmt.Errorf("PDF: unsupported filter %v", filter)
+	}
+
+	return reader, nil
+}
+
+// resolve resolves the indirect reference. Other objects are
+// returned as is. Unresolvable references are resolved to nil.
+func (doc *PDFDocumentReader) resolve(obj any) any {
+	for depth := 0; depth < pdfMaxDepth; depth++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+
+		off, found := doc.objs[ref.num]
+		if !found {
+			return nil
+		}
+
+		p := &pdfParser{data: doc.data, off: off}
+		obj, _ = p.object(0)
+	}
+
+	return nil
+}
+
+// pdfImageReader implements the [Decoder] interface for the
+// uncompressed or FlateDecode-compressed PDF images.
+type pdfImageReader struct {
+	input    io.Reader   // Decompressed image data
+	wid, hei int         // Image size
+	model    color.Model // Color model
+	invert   bool        // Bilevel image with inverted decoding
+	rowBytes []byte      // Raw row
+	y        int         // Current y-coordinate
+	err      error       // Sticky error
+}
+
+// MIMEType returns the MIME type of the image.
+// It implements the [Decoder] interface.
+func (*pdfImageReader) MIMEType() string {
+	return MIMETypePDF
+}
+
+// Meta returns the image metadata.
+//
+// The image placement on the page is not interpreted, so the
+// resolution is not known, and zero value is returned.
+func (reader *pdfImageReader) Meta() ImageMeta {
+	return ImageMeta{}
+}
+
+// Close closes the reader.
+func (reader *pdfImageReader) Close() {
+	if closer, ok := reader.input.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// ColorModel returns the [color.Model] of the image.
+func (reader *pdfImageReader) ColorModel() color.Model {
+	return reader.model
+}
+
+// Size returns the image size.
+func (reader *pdfImageReader) Size() (wid, hei int) {
+	return reader.wid, reader.hei
+}
+
+// NewRow allocates a [Row] of the reasonable type and width
+// for the image.
+func (reader *pdfImageReader) NewRow() Row {
+	return NewRow(reader.model, reader.wid)
+}
+
+// Read returns the next image [Row].
+func (reader *pdfImageReader) Read(row Row) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+
+	// Read the next row
+	raw := reader.rowBytes
+	_, err := io.ReadFull(reader.input, raw)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		reader.err = err
+		return 0, err
+	}
+
+	// Decode the row
+	wid := generic.Min(row.Width(), reader.wid)
+
+	switch reader.model {
+	case BilevelModel:
+		if reader.invert {
+			for i := range raw {
+				raw[i] = ^raw[i]
+			}
+		}
+		row.Copy(RowBilevel{bits: raw, wid: reader.wid})
+	case color.GrayModel:
+		bytesGray8toRow(row, raw)
+	case color.Gray16Model:
+		bytesGray16BEtoRow(row, raw)
+	case color.RGBAModel:
+		bytesRGB8toRow(row, raw)
+	case color.RGBA64Model:
+		bytesRGB16BEtoRow(row, raw)
+	}
+
+	// Update current y
+	reader.y++
+	if reader.y == reader.hei {
+		reader.err = io.EOF
+	}
+
+	return wid, nil
+}
+
+// pdfParser parses the PDF objects.
+type pdfParser struct {
+	data []byte // Input data
+	off  int    // Current offset
+}
+
+// pdfDelimiters contains the PDF delimiter characters.
+const pdfDelimiters = "()<>[]{}/%"
+
+// pdfIsSpace reports whether c is the PDF white-space character.
+func pdfIsSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// pdfIsRegular reports whether c is the PDF regular character.
+func pdfIsRegular(c byte) bool {
+	return !pdfIsSpace(c) && bytes.IndexByte([]byte(pdfDelimiters), c) < 0
+}
+
+// skipSpace skips white space and comments.
+func (p *pdfParser) skipSpace() {
+	for p.off < len(p.data) {
+		switch c := p.data[p.off]; {
+		case pdfIsSpace(c):
+			p.off++
+		case c == '%':
+			for p.off < len(p.data) &&
+				p.data[p.off] != '\n' && p.data[p.off] != '\r' {
+				p.off++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next token of regular characters, without
+// consuming it.
+func (p *pdfParser) token() string {
+	p.skipSpace()
+	end := p.off
+	for end < len(p.data) && pdfIsRegular(p.data[end]) {
+		end++
+	}
+	return string(p.data[p.off:end])
+}
+
+// keyword consumes the keyword, if it is next in the input.
+func (p *pdfParser) keyword(kw string) bool {
+	if p.token() == kw {
+		p.off += len(kw)
+		return true
+	}
+	return false
+}
+
+// object parses the next object.
+func (p *pdfParser) object(depth int) (any, error) {
+	errInvalid := errors.New("PDF: invalid object")
+
+	if depth > pdfMaxDepth {
+		return nil, errInvalid
+	}
+
+	p.skipSpace()
+	if p.off >= len(p.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch c := p.data[p.off]; {
+	case c == '/':
+		p.off++
+		end := p.off
+		for end < len(p.data) && pdfIsRegular(p.data[end]) {
+			end++
+		}
+		name := pdfName(p.data[p.off:end])
+		p.off = end
+		return name, nil
+
+	case bytes.HasPrefix(p.data[p.off:], []byte("<<")):
+		p.off += 2
+		dict := make(pdfDict)
+		for {
+			p.skipSpace()
+			if bytes.HasPrefix(p.data[p.off:], []byte(">>")) {
+				p.off += 2
+				return dict, nil
+			}
+
+			key, err := p.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, errInvalid
+			}
+
+			val, err := p.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			dict[name] = val
+		}
+
+	case c == '[':
+		p.off++
+		arr := []any{}
+		for {
+			p.skipSpace()
+			if p.off < len(p.data) && p.data[p.off] == ']' {
+				p.off++
+				return arr, nil
+			}
+
+			val, err := p.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, val)
+		}
+
+	case c == '(':
+		return p.literalString()
+
+	case c == '<':
+		end := bytes.IndexByte(p.data[p.off:], '>')
+		if end < 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		s := p.data[p.off+1 : p.off+end]
+		p.off += end + 1
+		return s, nil
+	}
+
+	// Numbers, references and keywords
+	tok := p.token()
+	switch tok {
+	case "":
+		return nil, errInvalid
+	case "null":
+		p.off += len(tok)
+		return nil, nil
+	case "true", "false":
+		p.off += len(tok)
+		return tok == "true", nil
+	}
+
+	num, err := strconv.Atoi(tok)
+	if err != nil {
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, errInvalid
+		}
+		p.off += len(tok)
+		return f, nil
+	}
+
+	p.off += len(tok)
+
+	// Check for the "num gen R" reference
+	save := p.off
+	if gen, err := strconv.Atoi(p.token()); err == nil && gen >= 0 {
+		p.off += len(p.token())
+		if num >= 0 && p.keyword("R") {
+			return pdfRef{num, gen}, nil
+		}
+	}
+
+	p.off = save
+	return num, nil
+}
+
+// literalString parses the literal string. Escape sequences are
+// not interpreted; only the string boundaries are recognized.
+func (p *pdfParser) literalString() (any, error) {
+	start := p.off + 1
+	nest := 0
+
+	for p.off < len(p.data) {
+		c := p.data[p.off]
+		p.off++
+
+		switch c {
+		case '\\':
+			p.off++
+		case '(':
+			nest++
+		case ')':
+			nest--
+			if nest == 0 {
+				return p.data[start : p.off-1], nil
+			}
+		}
+	}
+
+	return nil, io.ErrUnexpectedEOF
+}
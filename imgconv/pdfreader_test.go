@@ -0,0 +1,305 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// PDF Reader test
+
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// TestPDFDecode tests decoding of PDF documents, written by
+// the PDFDocumentWriter
+func TestPDFDecode(t *testing.T) {
+	// Prepare source image
+	src, err := NewPNGReader(bytes.NewReader(testutils.Images.PNG100x75rgb8))
+	if err != nil {
+		panic(err)
+	}
+	rgb, err := decodeImage(src)
+	src.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	jpg, err := NewJPEGReader(bytes.NewReader(testutils.Images.JPEG100x75rgb8))
+	if err != nil {
+		panic(err)
+	}
+	jpgImage, err := decodeImage(jpg)
+	jpg.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	models := []color.Model{
+		color.RGBAModel,
+		color.RGBA64Model,
+		color.GrayModel,
+		color.Gray16Model,
+		BilevelModel,
+	}
+
+	// Write multi-page PDF, one page per model, plus JPEG page
+	buf := &bytes.Buffer{}
+	doc := NewPDFDocumentWriter(buf)
+	bounds := rgb.Bounds()
+	expected := []image.Image{}
+
+	for _, model := range models {
+		page, err := doc.NewPage(bounds.Dx(), bounds.Dy(), model, 300, 300)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+
+		rows := []Row{}
+		for y := 0; y < bounds.Dy(); y++ {
+			row := NewRow(model, bounds.Dx())
+			for x := 0; x < bounds.Dx(); x++ {
+				row.Set(x, rgb.At(x, y))
+			}
+			page.Write(row)
+			rows = append(rows, row)
+		}
+
+		page.Close()
+
+		img, err := decodeImage(newRowsReader(model, rows))
+		if err != nil {
+			panic(err)
+		}
+		expected = append(expected, img)
+	}
+
+	err = doc.WriteJPEG(bytes.NewReader(testutils.Images.JPEG100x75rgb8),
+		300, 300)
+	if err != nil {
+		t.Fatalf("WriteJPEG: %s", err)
+	}
+
+	err = doc.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	// Read it back
+	reader, err := NewPDFDocumentReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewPDFDocumentReader: %s", err)
+	}
+
+	if reader.Pages() != len(models)+1 {
+		t.Errorf("Pages: expected %d, present %d",
+			len(models)+1, reader.Pages())
+	}
+
+	for i, model := range models {
+		page, err := reader.NextPage()
+		if err != nil {
+			t.Fatalf("page %d: NextPage: %s", i, err)
+		}
+
+		if page.ColorModel() != model {
+			t.Errorf("page %d: ColorModel mismatch", i)
+		}
+
+		img, err := decodeImage(page)
+		page.Close()
+		if err != nil {
+			t.Fatalf("page %d: decodeImage: %s", i, err)
+		}
+
+		if diff := imageDiff(expected[i], img); diff != "" {
+			t.Errorf("page %d: %s", i, diff)
+		}
+	}
+
+	page, err := reader.NextPage()
+	if err != nil {
+		t.Fatalf("JPEG page: NextPage: %s", err)
+	}
+
+	if page.MIMEType() != MIMETypeJPEG {
+		t.Errorf("JPEG page: MIMEType: expected %q, present %q",
+			MIMETypeJPEG, page.MIMEType())
+	}
+
+	img, err := decodeImage(page)
+	page.Close()
+	if err != nil {
+		t.Fatalf("JPEG page: decodeImage: %s", err)
+	}
+
+	if diff := imageDiff(jpgImage, img); diff != "" {
+		t.Errorf("JPEG page: %s", diff)
+	}
+
+	_, err = reader.NextPage()
+	if err != io.EOF {
+		t.Errorf("NextPage: expected io.EOF, present %v", err)
+	}
+
+	// NewDetectReader returns the first page
+	decoder, err := NewDetectReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewDetectReader: %s", err)
+	}
+
+	img, err = decodeImage(decoder)
+	decoder.Close()
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	if diff := imageDiff(expected[0], img); diff != "" {
+		t.Errorf("NewDetectReader: %s", diff)
+	}
+}
+
+// TestPDFDecodeHandMade tests decoding of hand-made PDF document
+// with inherited resources, nested page tree, comments and
+// uncompressed inverted bilevel image.
+func TestPDFDecodeHandMade(t *testing.T) {
+	data := []byte("%PDF-1.4\n" +
+		"% comment with 1 0 obj inside\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1\n" +
+		"  /Resources << /XObject << /Im1 5 0 R /Im2 6 0 R >> >> >>\n" +
+		"endobj\n" +
+		"3 0 obj << /Type /Pages /Kids [4 0 R] /Count 1 >> endobj\n" +
+		"4 0 obj << /Type /Page /Title (page (one)) >> endobj\n" +
+		"5 0 obj << /Type /XObject /Subtype /Image /Width 8 /Height 2\n" +
+		"  /ColorSpace /DeviceGray /BitsPerComponent 1\n" +
+		"  /Decode [1 0] /Length 7 0 R >>\n" +
+		"stream\n\x0f\xf0\nendstream\nendobj\n" +
+		"6 0 obj << /Type /XObject /Subtype /Image /Width 1 /Height 1\n" +
+		"  /ColorSpace /DeviceGray /BitsPerComponent 8 /Length 1 >>\n" +
+		"stream\n\x00\nendstream\nendobj\n" +
+		"7 0 obj 2 endobj\n" +
+		"trailer << /Root 1 0 R >>\n" +
+		"%%EOF\n")
+
+	reader, err := NewPDFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewPDFReader: %s", err)
+	}
+
+	if reader.ColorModel() != BilevelModel {
+		t.Errorf("ColorModel: BilevelModel expected")
+	}
+
+	img, err := decodeImage(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	// Decode [1 0] means 1 is black
+	black := color.Gray{Y: 0}
+	white := color.Gray{Y: 255}
+	expected := []color.Color{
+		white, white, white, white, black, black, black, black,
+		black, black, black, black, white, white, white, white,
+	}
+
+	for i, c := range expected {
+		present := img.At(i%8, i/8)
+		if !colorEqual(c, present) {
+			t.Errorf("pixel (%d,%d):\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				i%8, i/8, c, present)
+		}
+	}
+}
+
+// testPDFImage returns the single-page PDF document with the
+// 1x1 image, described by the image dictionary entries.
+func testPDFImage(entries string) string {
+	return "%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] >> endobj\n" +
+		"3 0 obj << /Type /Page /Resources " +
+		"<< /XObject << /Im 4 0 R >> >> >> endobj\n" +
+		"4 0 obj << /Subtype /Image " + entries +
+		" /Length 4 >>\nstream\n\x00\x00\x00\x00\n" +
+		"endstream\nendobj\n"
+}
+
+// TestPDFDecodeErrors tests PDF decoding errors
+func TestPDFDecodeErrors(t *testing.T) {
+	type testData struct {
+		name string // Test name
+		data string // Document data
+	}
+
+	tests := []testData{
+		{"not a PDF", "PDF"},
+		{"no catalog", "%PDF-1.4\n1 0 obj << >> endobj\n"},
+		{"no pages", "%PDF-1.4\n" +
+			"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [] >> endobj\n"},
+		{"no image", "%PDF-1.4\n" +
+			"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [3 0 R] >> endobj\n" +
+			"3 0 obj << /Type /Page >> endobj\n"},
+		{"looped page tree", "%PDF-1.4\n" +
+			"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [2 0 R] >> endobj\n"},
+		{"unsupported color space", "%PDF-1.4\n" +
+			"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [3 0 R] >> endobj\n" +
+			"3 0 obj << /Type /Page /Resources " +
+			"<< /XObject << /Im 4 0 R >> >> >> endobj\n" +
+			"4 0 obj << /Subtype /Image /Width 1 /Height 1 " +
+			"/ColorSpace /DeviceCMYK /BitsPerComponent 8 " +
+			"/Length 4 >>\nstream\n\x00\x00\x00\x00\n" +
+			"endstream\nendobj\n"},
+		{"huge width", testPDFImage("/Width 4294967296 /Height 1 " +
+			"/ColorSpace /DeviceRGB /BitsPerComponent 16")},
+		{"huge height", testPDFImage("/Width 1 /Height 100000 " +
+			"/ColorSpace /DeviceGray /BitsPerComponent 8")},
+		{"invalid bits per component", testPDFImage("/Width 1 " +
+			"/Height 1 /ColorSpace /DeviceGray /BitsPerComponent 99")},
+	}
+
+	for _, test := range tests {
+		reader, err := NewPDFReader(bytes.NewReader([]byte(test.data)))
+		if err == nil {
+			reader.Close()
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+
+	// Truncated image data
+	data := "%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] >> endobj\n" +
+		"3 0 obj << /Type /Page /Resources " +
+		"<< /XObject << /Im 4 0 R >> >> >> endobj\n" +
+		"4 0 obj << /Subtype /Image /Width 2 /Height 2 " +
+		"/ColorSpace /DeviceGray /BitsPerComponent 8 " +
+		"/Length 3 >>\nstream\n\x00\x00\x00\n" +
+		"endstream\nendobj\n"
+
+	reader, err := NewPDFReader(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatalf("NewPDFReader: %s", err)
+	}
+
+	_, err = decodeImage(reader)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated data: expected %v, present %v",
+			io.ErrUnexpectedEOF, err)
+	}
+}
@@ -34,6 +34,7 @@ type pngReader struct {
 	input    io.Reader     // Underlying io.Reader
 	model    color.Model   // Image color mode
 	wid, hei int           // Image size
+	meta     ImageMeta     // Image metadata
 	rowBytes []byte        // Row decoding buffer
 	y        int           // Current y-coordinate
 }
@@ -71,6 +72,24 @@ func NewPNGReader(input io.Reader) (Decoder, error) {
 
 	reader.wid, reader.hei = int(width), int(height)
 
+	// Obtain image metadata
+	var xppm, yppm C.png_uint_32
+	var unit C.int
+	if C.png_get_pHYs(reader.png, reader.pngInfo,
+		&xppm, &yppm, &unit) != 0 && unit == C.PNG_RESOLUTION_METER {
+		reader.meta.XResolution = metaDPIFromPPM(uint32(xppm))
+		reader.meta.YResolution = metaDPIFromPPM(uint32(yppm))
+	}
+
+	var iccName *C.char
+	var iccProfile *C.png_byte
+	var iccLen C.png_uint_32
+	if C.png_get_iCCP(reader.png, reader.pngInfo, &iccName, nil,
+		&iccProfile, &iccLen) != 0 {
+		reader.meta.ICCProfile = C.GoBytes(unsafe.Pointer(iccProfile),
+			C.int(iccLen))
+	}
+
 	// Setup input transformations
 	var bytesPerPixel int
 
@@ -115,6 +134,11 @@ func (*pngReader) MIMEType() string {
 	return MIMETypePNG
 }
 
+// Meta returns the image metadata.
+func (reader *pngReader) Meta() ImageMeta {
+	return reader.meta
+}
+
 // Close closes the reader.
 func (reader *pngReader) Close() {
 	C.png_destroy_read_struct(&reader.png, &reader.pngInfo, nil)
@@ -201,18 +225,36 @@ type pngWriter struct {
 
 // NewPNGWriter creates a new [Writer] for PNG images.
 // Supported color models are following:
+//   - BilevelModel (1-bit grayscale)
 //   - color.GrayModel
 //   - color.Gray16Model
 //   - color.RGBAModel
 //   - color.RGBA64Model
 func NewPNGWriter(output io.Writer,
 	wid, hei int, model color.Model) (Encoder, error) {
+	return NewPNGWriterMeta(output, wid, hei, model, ImageMeta{})
+}
+
+// NewPNGWriterMeta creates a new [Writer] for PNG images, with
+// the image metadata.
+//
+// Resolution, if known, is written into the pHYs chunk. The ICC
+// profile, if present, is written into the iCCP chunk and must
+// match the color model (GRAY profile for grayscale images, RGB
+// for color). Otherwise, image is marked as sRGB.
+//
+// Supported color models are the same as for the [NewPNGWriter].
+func NewPNGWriterMeta(output io.Writer, wid, hei int,
+	model color.Model, meta ImageMeta) (Encoder, error) {
 
 	// Translate model into libpng terms
 	var colorType, depth C.int
 	var bytesPerPixel int
 
 	switch model {
+	case BilevelModel:
+		colorType = C.PNG_COLOR_TYPE_GRAY
+		depth = 1
 	case color.GrayModel:
 		colorType = C.PNG_COLOR_TYPE_GRAY
 		depth = 8
@@ -234,6 +276,11 @@ func NewPNGWriter(output io.Writer,
 		return nil, err
 	}
 
+	if meta.ICCProfile != nil && !ICCProfileMatches(meta.ICCProfile, model) {
+		err := errors.New("PNG: ICC profile doesn't match color model")
+		return nil, err
+	}
+
 	// Create writer structure. Initialize libpng stuff
 	writer := &pngWriter{
 		output:   output,
@@ -243,6 +290,10 @@ func NewPNGWriter(output io.Writer,
 		rowBytes: make([]byte, bytesPerPixel*int(wid)),
 	}
 
+	if model == BilevelModel {
+		writer.rowBytes = make([]byte, (wid+7)/8)
+	}
+
 	writer.handle = cgo.NewHandle(writer)
 
 	writer.png = C.do_png_create_write_struct(
@@ -258,10 +309,25 @@ func NewPNGWriter(output io.Writer,
 		C.PNG_COMPRESSION_TYPE_DEFAULT,
 		C.PNG_FILTER_TYPE_DEFAULT)
 
-	if writer.err == nil {
+	if writer.err == nil && meta.ICCProfile != nil {
+		icc := C.CBytes(meta.ICCProfile)
+		C.do_png_set_iCCP(writer.png, writer.pngInfo,
+			(*C.png_byte)(icc), C.png_uint_32(len(meta.ICCProfile)))
+		C.free(icc)
+	} else if writer.err == nil {
 		C.png_set_sRGB(writer.png, writer.pngInfo,
 			C.PNG_sRGB_INTENT_PERCEPTUAL)
+	}
 
+	if writer.err == nil &&
+		meta.XResolution > 0 && meta.YResolution > 0 {
+		C.png_set_pHYs(writer.png, writer.pngInfo,
+			C.png_uint_32(metaPPMFromDPI(meta.XResolution)),
+			C.png_uint_32(metaPPMFromDPI(meta.YResolution)),
+			C.PNG_RESOLUTION_METER)
+	}
+
+	if writer.err == nil {
 		C.do_png_write_info(writer.png, writer.pngInfo)
 	}
 
@@ -306,6 +372,13 @@ func (writer *pngWriter) Write(row Row) error {
 	var bytesPerPixel int
 
 	switch writer.model {
+	case BilevelModel:
+		bytesBilevelFromRow(writer.rowBytes, row)
+
+		// Fill the tail. Bit set means white.
+		for x := wid; x < writer.wid; x++ {
+			writer.rowBytes[x>>3] |= 0x80 >> (x & 7)
+		}
 	case color.GrayModel:
 		bytesPerPixel = 1
 		bytesGray8fromRow(writer.rowBytes, row)
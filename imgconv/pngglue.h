@@ -137,6 +137,21 @@ do_png_set_IHDR(png_struct *png, png_info *info_ptr,
                  filter_type);
 }
 
+// do_png_set_iCCP wraps png_set_iCCP.
+// The wrapper is required to catch setjmp return as
+// we can't do it from Go
+static inline void
+do_png_set_iCCP(png_struct *png, png_info *info_ptr,
+                png_const_bytep profile, png_uint_32 proflen) {
+
+    if (setjmp(png_jmpbuf(png))) {
+        return;
+    }
+
+    png_set_iCCP(png, info_ptr, "ICC Profile",
+                 PNG_COMPRESSION_TYPE_BASE, profile, proflen);
+}
+
 // do_png_read_row wraps png_read_row.
 // The wrapper is required to catch setjmp return as we can't do it from Go
 static inline void
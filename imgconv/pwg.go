@@ -0,0 +1,563 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// PWG Raster Reader and Writer
+
+package imgconv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io"
+	"math"
+)
+
+// pwgHeaderSize is the size of the PWG Raster page header
+const pwgHeaderSize = 1796
+
+// pwgSyncWord is the PWG Raster synchronization word
+const pwgSyncWord = "RaS2"
+
+// PWG Raster color spaces, as used in [PWGPageHeader.ColorSpace]:
+const (
+	PWGColorSpaceRGB      = 1  // Device RGB
+	PWGColorSpaceBlack    = 3  // Device black, 0 is white
+	PWGColorSpaceCMYK     = 6  // Device CMYK
+	PWGColorSpaceSgray    = 18 // sRGB grayscale, 0 is black
+	PWGColorSpaceSrgb     = 19 // sRGB color
+	PWGColorSpaceAdobeRGB = 20 // Adobe RGB color
+)
+
+// PWGPageHeader represents the PWG Raster page header, as
+// defined by the PWG 5102.4 specification.
+//
+// Strings are limited to 63 bytes; the reserved fields are
+// not represented.
+type PWGPageHeader struct {
+	MediaColor           string // Media color
+	MediaType            string // Media type
+	PrintContentOptimize string // Print optimization hint
+	CutMedia             int    // When to cut media
+	Duplex               bool   // Duplex printing
+	HWResolution         [2]int // Horizontal and vertical resolution, DPI
+	InsertSheet          int    // Insert separator sheet
+	Jog                  int    // When to jog pages
+	LeadingEdge          int    // Leading edge of the media
+	MediaPosition        int    // Media source (input tray)
+	MediaWeight          int    // Media weight, grams per square meter
+	NumCopies            int    // Number of copies to produce
+	Orientation          int    // Page orientation
+	PageSize             [2]int // Page width and height, in points
+	Tumble               bool   // Short edge duplex
+	Width                int    // Image width, in pixels
+	Height               int    // Image height, in pixels
+	BitsPerColor         int    // Bits per color (1, 2, 4, 8 or 16)
+	BitsPerPixel         int    // Bits per pixel
+	BytesPerLine         int    // Bytes per line
+	ColorOrder           int    // Color order (0 is chunky)
+	ColorSpace           int    // Color space (PWGColorSpaceXXX)
+	NumColors            int    // Number of colors
+	TotalPageCount       int    // Total count of pages, 0 if unknown
+	CrossFeedTransform   int    // Cross feed transform (1 or -1)
+	FeedTransform        int    // Feed transform (1 or -1)
+	ImageBox             [4]int // Image left, top, right, bottom
+	AlternatePrimary     uint32 // Alternate primary color, sRGB
+	PrintQuality         int    // Print quality (0, 3, 4 or 5)
+	VendorIdentifier     int    // USB vendor ID of the VendorData
+	VendorData           []byte // Vendor data, up to 1088 bytes
+	RenderingIntent      string // Rendering intent
+	PageSizeName         string // Page size name (PWG media name)
+}
+
+// NewPWGPageHeader creates the PWG Raster page header for the image
+// of the specified size, color model and resolution.
+//
+// xres and yres specify the image resolution, in DPI. If resolution
+// is not known, zero may be passed, which is the same as 72 DPI.
+//
+// Supported color models are following:
+//   - BilevelModel (1-bit black)
+//   - color.GrayModel (8-bit sgray)
+//   - color.Gray16Model (16-bit sgray)
+//   - color.RGBAModel (8-bit srgb)
+//   - color.RGBA64Model (16-bit srgb)
+func NewPWGPageHeader(wid, hei int, model color.Model,
+	xres, yres int) (PWGPageHeader, error) {
+
+	if xres <= 0 {
+		xres = 72
+	}
+	if yres <= 0 {
+		yres = 72
+	}
+
+	hdr := PWGPageHeader{
+		HWResolution:       [2]int{xres, yres},
+		NumCopies:          1,
+		Width:              wid,
+		Height:             hei,
+		CrossFeedTransform: 1,
+		FeedTransform:      1,
+		PageSize: [2]int{
+			int(math.Round(float64(wid) * 72 / float64(xres))),
+			int(math.Round(float64(hei) * 72 / float64(yres))),
+		},
+	}
+
+	switch model {
+	case BilevelModel:
+		hdr.ColorSpace, hdr.NumColors, hdr.BitsPerColor =
+			PWGColorSpaceBlack, 1, 1
+	case color.GrayModel:
+		hdr.ColorSpace, hdr.NumColors, hdr.BitsPerColor =
+			PWGColorSpaceSgray, 1, 8
+	case color.Gray16Model:
+		hdr.ColorSpace, hdr.NumColors, hdr.BitsPerColor =
+			PWGColorSpaceSgray, 1, 16
+	case color.RGBAModel:
+		hdr.ColorSpace, hdr.NumColors, hdr.BitsPerColor =
+			PWGColorSpaceSrgb, 3, 8
+	case color.RGBA64Model:
+		hdr.ColorSpace, hdr.NumColors, hdr.BitsPerColor =
+			PWGColorSpaceSrgb, 3, 16
+	default:
+		return hdr, errors.New("PWG: unsupported color model")
+	}
+
+	hdr.BitsPerPixel = hdr.BitsPerColor * hdr.NumColors
+	hdr.BytesPerLine = (wid*hdr.BitsPerPixel + 7) / 8
+
+	if wid <= 0 || hei <= 0 {
+		return hdr, errors.New("PWG: invalid image size")
+	}
+
+	return hdr, nil
+}
+
+// format returns the rasterFormat of the page.
+func (hdr *PWGPageHeader) format() (rasterFormat, error) {
+	var colors int
+	invert := false
+
+	switch hdr.ColorSpace {
+	case PWGColorSpaceBlack:
+		colors, invert = 1, true
+	case PWGColorSpaceSgray:
+		colors = 1
+	case PWGColorSpaceRGB, PWGColorSpaceSrgb, PWGColorSpaceAdobeRGB:
+		colors = 3
+	case PWGColorSpaceCMYK:
+		colors, invert = 4, true
+	default:
+		return rasterFormat{}, errors.New("PWG: unsupported color space")
+	}
+
+	f, err := newRasterFormat(hdr.Width, hdr.BitsPerColor, colors, invert)
+	switch {
+	case err != nil:
+		return f, errors.New("PWG: " + err.Error())
+	case hdr.Height <= 0 || hdr.Height > rasterMaxSize:
+		return f, errors.New("PWG: invalid image size")
+	case hdr.ColorOrder != 0:
+		return f, errors.New("PWG: unsupported color order")
+	case hdr.NumColors != colors ||
+		hdr.BitsPerPixel != hdr.BitsPerColor*colors ||
+		hdr.BytesPerLine != f.bytesPerLine:
+		return f, errors.New("PWG: inconsistent page header")
+	case len(hdr.VendorData) > 1088:
+		return f, errors.New("PWG: vendor data too long")
+	}
+
+	return f, nil
+}
+
+// decode decodes the PWG Raster page header.
+func (hdr *PWGPageHeader) decode(data []byte) error {
+	str := func(off int) string {
+		s := data[off : off+64]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		return string(s)
+	}
+
+	u32 := func(off int) int {
+		return int(binary.BigEndian.Uint32(data[off:]))
+	}
+
+	i32 := func(off int) int {
+		return int(int32(binary.BigEndian.Uint32(data[off:])))
+	}
+
+	if str(0) != "PwgRaster" {
+		return errors.New("PWG: invalid page header")
+	}
+
+	*hdr = PWGPageHeader{
+		MediaColor:           str(64),
+		MediaType:            str(128),
+		PrintContentOptimize: str(192),
+		CutMedia:             u32(268),
+		Duplex:               u32(272) != 0,
+		HWResolution:         [2]int{u32(276), u32(280)},
+		InsertSheet:          u32(300),
+		Jog:                  u32(304),
+		LeadingEdge:          u32(308),
+		MediaPosition:        u32(324),
+		MediaWeight:          u32(328),
+		NumCopies:            u32(340),
+		Orientation:          u32(344),
+		PageSize:             [2]int{u32(352), u32(356)},
+		Tumble:               u32(368) != 0,
+		Width:                u32(372),
+		Height:               u32(376),
+		BitsPerColor:         u32(384),
+		BitsPerPixel:         u32(388),
+		BytesPerLine:         u32(392),
+		ColorOrder:           u32(396),
+		ColorSpace:           u32(400),
+		NumColors:            u32(420),
+		TotalPageCount:       u32(452),
+		CrossFeedTransform:   i32(456),
+		FeedTransform:        i32(460),
+		ImageBox: [4]int{
+			u32(464), u32(468), u32(472), u32(476),
+		},
+		AlternatePrimary: uint32(u32(480)),
+		PrintQuality:     u32(484),
+		VendorIdentifier: u32(508),
+		RenderingIntent:  str(1668),
+		PageSizeName:     str(1732),
+	}
+
+	if n := u32(512); n > 0 {
+		if n > 1088 {
+			return errors.New("PWG: invalid page header")
+		}
+		hdr.VendorData = append([]byte{}, data[516:516+n]...)
+	}
+
+	return nil
+}
+
+// encode encodes the PWG Raster page header.
+func (hdr *PWGPageHeader) encode() []byte {
+	data := make([]byte, pwgHeaderSize)
+
+	str := func(off int, s string) {
+		copy(data[off:off+63], s)
+	}
+
+	u32 := func(off int, v int) {
+		binary.BigEndian.PutUint32(data[off:], uint32(v))
+	}
+
+	b32 := func(off int, v bool) {
+		if v {
+			u32(off, 1)
+		}
+	}
+
+	str(0, "PwgRaster")
+	str(64, hdr.MediaColor)
+	str(128, hdr.MediaType)
+	str(192, hdr.PrintContentOptimize)
+	u32(268, hdr.CutMedia)
+	b32(272, hdr.Duplex)
+	u32(276, hdr.HWResolution[0])
+	u32(280, hdr.HWResolution[1])
+	u32(300, hdr.InsertSheet)
+	u32(304, hdr.Jog)
+	u32(308, hdr.LeadingEdge)
+	u32(324, hdr.MediaPosition)
+	u32(328, hdr.MediaWeight)
+	u32(340, hdr.NumCopies)
+	u32(344, hdr.Orientation)
+	u32(352, hdr.PageSize[0])
+	u32(356, hdr.PageSize[1])
+	b32(368, hdr.Tumble)
+	u32(372, hdr.Width)
+	u32(376, hdr.Height)
+	u32(384, hdr.BitsPerColor)
+	u32(388, hdr.BitsPerPixel)
+	u32(392, hdr.BytesPerLine)
+	u32(396, hdr.ColorOrder)
+	u32(400, hdr.ColorSpace)
+	u32(420, hdr.NumColors)
+	u32(452, hdr.TotalPageCount)
+	u32(456, hdr.CrossFeedTransform)
+	u32(460, hdr.FeedTransform)
+	for i, v := range hdr.ImageBox {
+		u32(464+i*4, v)
+	}
+	u32(480, int(hdr.AlternatePrimary))
+	u32(484, hdr.PrintQuality)
+	u32(508, hdr.VendorIdentifier)
+	u32(512, len(hdr.VendorData))
+	copy(data[516:516+1088], hdr.VendorData)
+	str(1668, hdr.RenderingIntent)
+	str(1732, hdr.PageSizeName)
+
+	return data
+}
+
+// PWGDecoder is the [Decoder] for the single page of the PWG Raster
+// document. It provides access to the page header.
+type PWGDecoder interface {
+	Decoder
+
+	// Header returns the page header.
+	Header() PWGPageHeader
+}
+
+// pwgPageReader implements the [PWGDecoder] interface.
+type pwgPageReader struct {
+	*rasterPageReader
+	hdr PWGPageHeader // Page header
+}
+
+// Header returns the page header.
+func (page *pwgPageReader) Header() PWGPageHeader {
+	return page.hdr
+}
+
+// Meta returns the image metadata.
+// Only the resolution is reported.
+func (page *pwgPageReader) Meta() ImageMeta {
+	return ImageMeta{
+		XResolution: page.hdr.HWResolution[0],
+		YResolution: page.hdr.HWResolution[1],
+	}
+}
+
+// PWGDocumentReader reads the multi-page PWG Raster documents.
+//
+// Pages are decoded on the fly, row by row, so only one page
+// can be read at a time.
+type PWGDocumentReader struct {
+	input *bufio.Reader  // Buffered input
+	page  *pwgPageReader // Current page, nil if none
+	hdr   []byte         // Header buffer
+	err   error          // Sticky error
+}
+
+// NewPWGDocumentReader creates a new [PWGDocumentReader].
+// It reads and checks the synchronization word from the input.
+func NewPWGDocumentReader(input io.Reader) (*PWGDocumentReader, error) {
+	doc := &PWGDocumentReader{
+		input: bufio.NewReader(input),
+		hdr:   make([]byte, pwgHeaderSize),
+	}
+
+	var sync [4]byte
+	_, err := io.ReadFull(doc.input, sync[:])
+	switch {
+	case err == io.EOF:
+		return nil, io.ErrUnexpectedEOF
+	case err != nil:
+		return nil, err
+	case string(sync[:]) != pwgSyncWord:
+		return nil, errors.New("PWG: invalid synchronization word")
+	}
+
+	return doc, nil
+}
+
+// NextPage returns the [PWGDecoder] for the next page of
+// the document. At the end of document it returns [io.EOF].
+//
+// If the previous page is not completely read, its remaining
+// rows are skipped. The previous page's decoder becomes
+// invalid.
+func (doc *PWGDocumentReader) NextPage() (PWGDecoder, error) {
+	if doc.err != nil {
+		return nil, doc.err
+	}
+
+	// Skip the rest of the previous page
+	if doc.page != nil {
+		err := doc.page.skip()
+		doc.page.err = errors.New("PWG: page is closed")
+		doc.page = nil
+
+		if err != nil {
+			doc.err = err
+			return nil, err
+		}
+	}
+
+	// Read the page header. io.EOF here means the end of document.
+	_, err := io.ReadFull(doc.input, doc.hdr)
+	if err != nil {
+		doc.err = err
+		return nil, err
+	}
+
+	page := &pwgPageReader{}
+	err = page.hdr.decode(doc.hdr)
+	if err != nil {
+		doc.err = err
+		return nil, err
+	}
+
+	format, err := page.hdr.format()
+	if err != nil {
+		doc.err = err
+		return nil, err
+	}
+
+	page.rasterPageReader = newRasterPageReader(MIMETypePWG, "PWG",
+		doc.input, format, page.hdr.Height)
+
+	doc.page = page
+
+	return page, nil
+}
+
+// NewPWGReader creates a new [PWGDecoder] for the first page of
+// the PWG Raster document.
+//
+// Supported are the chunky images with 1, 8 and 16 bits per color
+// in the Black, Sgray, RGB, Srgb, AdobeRgb and CMYK color spaces.
+// 1-bit images are decoded as [BilevelModel], other grayscale
+// images as [color.GrayModel] or [color.Gray16Model], and
+// color images as [color.RGBAModel] or [color.RGBA64Model].
+// CMYK images are converted to RGB.
+func NewPWGReader(input io.Reader) (PWGDecoder, error) {
+	doc, err := NewPWGDocumentReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := doc.NextPage()
+	if err == io.EOF {
+		err = errors.New("PWG: document has no pages")
+	}
+
+	return page, err
+}
+
+// PWGDocumentWriter writes the multi-page PWG Raster documents.
+//
+// Pages are encoded on the fly, row by row, so only one page
+// can be written at a time.
+type PWGDocumentWriter struct {
+	out    rasterOutput      // Document output
+	page   *rasterPageWriter // Current page, nil if none
+	pages  int               // Count of pages
+	closed bool              // Writer is closed
+}
+
+// NewPWGDocumentWriter creates a new [PWGDocumentWriter].
+func NewPWGDocumentWriter(output io.Writer) *PWGDocumentWriter {
+	return &PWGDocumentWriter{out: rasterOutput{output: output}}
+}
+
+// NewPage starts a new page and returns the [Writer] for the page
+// image. Use [NewPWGPageHeader] to create the page header.
+//
+// The page is finished when the returned Writer is closed.
+// Only one page may be written at a time.
+//
+// CMYK pages are not supported for writing. The Black color
+// space requires [BilevelModel] or grayscale rows.
+func (doc *PWGDocumentWriter) NewPage(hdr PWGPageHeader) (Writer, error) {
+	format, err := hdr.format()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case format.colors == 4:
+		return nil, errors.New("PWG: CMYK is not supported for writing")
+	case doc.closed:
+		return nil, errors.New("PWG: writer is closed")
+	case doc.page != nil && !doc.page.closed:
+		return nil, errors.New("PWG: previous page is not closed")
+	case doc.out.err != nil:
+		return nil, doc.out.err
+	}
+
+	if doc.pages == 0 {
+		doc.out.write([]byte(pwgSyncWord))
+	}
+
+	doc.out.write(hdr.encode())
+	if doc.out.err != nil {
+		return nil, doc.out.err
+	}
+
+	doc.page = newRasterPageWriter(&doc.out, "PWG", format, hdr.Height)
+	doc.pages++
+
+	return doc.page, nil
+}
+
+// Close finishes the current page, if any, and closes the
+// PWGDocumentWriter.
+//
+// It doesn't close the underlying [io.Writer].
+func (doc *PWGDocumentWriter) Close() error {
+	if doc.closed {
+		return doc.out.err
+	}
+
+	if doc.page != nil {
+		doc.page.Close()
+	}
+
+	doc.closed = true
+
+	if doc.pages == 0 && doc.out.err == nil {
+		doc.out.err = errors.New("PWG: document has no pages")
+	}
+
+	return doc.out.err
+}
+
+// pwgWriter implements the [Encoder] interface for writing
+// single-page PWG Raster documents.
+type pwgWriter struct {
+	Writer                    // Page writer
+	doc    *PWGDocumentWriter // Underlying document
+}
+
+// NewPWGWriter creates a new [Encoder] for the single-page
+// PWG Raster document.
+//
+// xres and yres specify the image resolution, in DPI. If resolution
+// is not known, zero may be passed, which is the same as 72 DPI.
+//
+// See [NewPWGPageHeader] for the list of supported color models.
+func NewPWGWriter(output io.Writer,
+	wid, hei int, model color.Model, xres, yres int) (Encoder, error) {
+
+	hdr, err := NewPWGPageHeader(wid, hei, model, xres, yres)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := NewPWGDocumentWriter(output)
+	page, err := doc.NewPage(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pwgWriter{Writer: page, doc: doc}, nil
+}
+
+// MIMEType returns the MIME type of the image being written.
+func (writer *pwgWriter) MIMEType() string {
+	return MIMETypePWG
+}
+
+// Close flushes the buffered data and then closes the Writer
+func (writer *pwgWriter) Close() error {
+	return writer.doc.Close()
+}
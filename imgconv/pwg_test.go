@@ -0,0 +1,482 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// PWG Raster Reader and Writer test
+
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// testRasterSource returns the source image for raster tests.
+func testRasterSource() image.Image {
+	img, err := png.Decode(bytes.NewReader(testutils.Images.PNG100x75rgb16))
+	if err != nil {
+		panic(err)
+	}
+	return img
+}
+
+// testRasterWrite writes the src image into the Writer, except
+// for the last row, which must be filled by Close, and returns
+// the expected image.
+func testRasterWrite(writer Writer, src image.Image) (image.Image, error) {
+	bounds := src.Bounds()
+	expected := image.NewRGBA64(bounds)
+	row := NewRow(writer.ColorModel(), bounds.Dx())
+
+	for y := 0; y < bounds.Dy()-1; y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			row.Set(x, src.At(x, y))
+			expected.Set(x, y, row.At(x))
+		}
+
+		err := writer.Write(row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for x := 0; x < bounds.Dx(); x++ {
+		expected.Set(x, bounds.Dy()-1, color.White)
+	}
+
+	return expected, writer.Close()
+}
+
+// testPWGHeader returns the test PWG page header
+func testPWGHeader(wid, hei, cs, bpc, colors int) PWGPageHeader {
+	return PWGPageHeader{
+		HWResolution: [2]int{300, 300},
+		Width:        wid,
+		Height:       hei,
+		BitsPerColor: bpc,
+		BitsPerPixel: bpc * colors,
+		BytesPerLine: (wid*bpc*colors + 7) / 8,
+		ColorSpace:   cs,
+		NumColors:    colors,
+	}
+}
+
+// testPWGBuild builds the single-page PWG Raster document
+func testPWGBuild(hdr PWGPageHeader, data []byte) []byte {
+	buf := []byte(pwgSyncWord)
+	buf = append(buf, hdr.encode()...)
+	return append(buf, data...)
+}
+
+// TestPWGEncode tests PWG Raster encoding and decoding
+func TestPWGEncode(t *testing.T) {
+	src := testRasterSource()
+	bounds := src.Bounds()
+
+	models := []color.Model{
+		BilevelModel,
+		color.GrayModel,
+		color.Gray16Model,
+		color.RGBAModel,
+		color.RGBA64Model,
+	}
+
+	// Write the multi-page document, page per model
+	buf := &bytes.Buffer{}
+	doc := NewPWGDocumentWriter(buf)
+	headers := []PWGPageHeader{}
+	images := []image.Image{}
+
+	for i, model := range models {
+		hdr, err := NewPWGPageHeader(bounds.Dx(), bounds.Dy(),
+			model, 300, 600)
+		if err != nil {
+			t.Fatalf("NewPWGPageHeader: %s", err)
+		}
+
+		hdr.MediaType = "stationery"
+		hdr.PageSizeName = "na_letter_8.5x11in"
+		hdr.Duplex = true
+		hdr.TotalPageCount = len(models)
+		hdr.ImageBox = [4]int{1, 2, 3, 4}
+		hdr.VendorIdentifier = 0x1234
+		hdr.VendorData = []byte{byte(i), 1, 2, 3}
+
+		page, err := doc.NewPage(hdr)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+
+		expected, err := testRasterWrite(page, src)
+		if err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+
+		headers = append(headers, hdr)
+		images = append(images, expected)
+	}
+
+	err := doc.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if MIMETypeDetect(buf.Bytes()) != MIMETypePWG {
+		t.Errorf("MIMETypeDetect: PWG Raster not detected")
+	}
+
+	// Read it back
+	reader, err := NewPWGDocumentReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewPWGDocumentReader: %s", err)
+	}
+
+	for i, model := range models {
+		page, err := reader.NextPage()
+		if err != nil {
+			t.Fatalf("NextPage: %s", err)
+		}
+
+		if diff := testutils.Diff(headers[i], page.Header()); diff != "" {
+			t.Errorf("Header:\n%s", diff)
+		}
+
+		if page.MIMEType() != MIMETypePWG {
+			t.Errorf("MIMEType: expected %q, present %q",
+				MIMETypePWG, page.MIMEType())
+		}
+
+		if page.ColorModel() != model {
+			t.Errorf("page %d: ColorModel mismatch", i)
+		}
+
+		img, err := decodeImage(page)
+		if err != nil {
+			t.Fatalf("decodeImage: %s", err)
+		}
+
+		if diff := imageDiff(images[i], img); diff != "" {
+			t.Errorf("page %d: %s", i, diff)
+		}
+
+		page.Close()
+	}
+
+	_, err = reader.NextPage()
+	if err != io.EOF {
+		t.Errorf("NextPage: expected io.EOF, present %v", err)
+	}
+
+	// Unread pages must be skipped
+	reader, err = NewPWGDocumentReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewPWGDocumentReader: %s", err)
+	}
+
+	for i := range models {
+		page, err := reader.NextPage()
+		if err != nil {
+			t.Fatalf("NextPage: %s", err)
+		}
+
+		if page.Header().VendorData[0] != byte(i) {
+			t.Errorf("page %d: wrong page header", i)
+		}
+
+		page.Read(page.NewRow())
+	}
+
+	_, err = reader.NextPage()
+	if err != io.EOF {
+		t.Errorf("NextPage: expected io.EOF, present %v", err)
+	}
+
+	// The single-page writer
+	buf.Reset()
+	encoder, err := NewPWGWriter(buf, bounds.Dx(), bounds.Dy(),
+		color.RGBAModel, 0, 0)
+	if err != nil {
+		t.Fatalf("NewPWGWriter: %s", err)
+	}
+
+	if encoder.MIMEType() != MIMETypePWG {
+		t.Errorf("MIMEType: expected %q, present %q",
+			MIMETypePWG, encoder.MIMEType())
+	}
+
+	expected, err := testRasterWrite(encoder, src)
+	if err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	decoder, err := NewDetectReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewDetectReader: %s", err)
+	}
+
+	img, err := decodeImage(decoder)
+	decoder.Close()
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	if diff := imageDiff(expected, img); diff != "" {
+		t.Errorf("%s", diff)
+	}
+}
+
+// TestPWGCompression tests decoding of hand-made compressed data
+// and the compression efficiency.
+func TestPWGCompression(t *testing.T) {
+	// 4x3 image, 8-bit sgray.
+	// Line 0 is repeated twice, line 1 is filled with white by 0x80.
+	hdr := testPWGHeader(4, 3, PWGColorSpaceSgray, 8, 1)
+	data := testPWGBuild(hdr, []byte{
+		1, 1, 0x10, 0xff, 0x20, 0x30, // 0x10 0x10 0x20 0x30
+		0, 0xff, 0x40, 0x50, 0x80, // 0x40 0x50 white white
+	})
+
+	expected := [][]byte{
+		{0x10, 0x10, 0x20, 0x30},
+		{0x10, 0x10, 0x20, 0x30},
+		{0x40, 0x50, 0xff, 0xff},
+	}
+
+	reader, err := NewPWGReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewPWGReader: %s", err)
+	}
+	defer reader.Close()
+
+	for y := range expected {
+		row := reader.NewRow().(RowGray8)
+		_, err = reader.Read(row)
+		if err != nil {
+			t.Fatalf("Read: %s", err)
+		}
+
+		for x, v := range expected[y] {
+			if row[x].Y != v {
+				t.Errorf("(%d,%d): expected 0x%2.2x, present 0x%2.2x",
+					x, y, v, row[x].Y)
+			}
+		}
+	}
+
+	// Blank page must be compressed to runs of 128 pixels,
+	// and identical lines must be merged by 256
+	buf := &bytes.Buffer{}
+	encoder, err := NewPWGWriter(buf, 2550, 3300, color.RGBAModel, 300, 300)
+	if err != nil {
+		t.Fatalf("NewPWGWriter: %s", err)
+	}
+
+	encoder.Close()
+
+	size := buf.Len() - len(pwgSyncWord) - pwgHeaderSize
+	groups := (3300 + 255) / 256
+	runs := (2550 + 127) / 128
+	if expected := groups * (1 + runs*(1+3)); size != expected {
+		t.Errorf("blank page: expected %d bytes, present %d",
+			expected, size)
+	}
+}
+
+// TestPWGDecodeFormats tests decoding of various pixel formats
+func TestPWGDecodeFormats(t *testing.T) {
+	type testData struct {
+		name   string        // Test name
+		hdr    PWGPageHeader // Page header
+		data   []byte        // Compressed page data, 2x1 pixels
+		model  color.Model   // Expected color model
+		pixels []color.Color // Expected pixels
+	}
+
+	black := color.Gray{Y: 0}
+	white := color.Gray{Y: 255}
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	tests := []testData{
+		{
+			name:   "black_1",
+			hdr:    testPWGHeader(2, 1, PWGColorSpaceBlack, 1, 1),
+			data:   []byte{0, 0, 0x80},
+			model:  BilevelModel,
+			pixels: []color.Color{black, white},
+		},
+		{
+			name:   "sgray_1",
+			hdr:    testPWGHeader(2, 1, PWGColorSpaceSgray, 1, 1),
+			data:   []byte{0, 0, 0x80},
+			model:  BilevelModel,
+			pixels: []color.Color{white, black},
+		},
+		{
+			name:   "black_8",
+			hdr:    testPWGHeader(2, 1, PWGColorSpaceBlack, 8, 1),
+			data:   []byte{0, 0xff, 0xff, 0x00},
+			model:  color.GrayModel,
+			pixels: []color.Color{black, white},
+		},
+		{
+			name:   "adobe-rgb_8",
+			hdr:    testPWGHeader(2, 1, PWGColorSpaceAdobeRGB, 8, 3),
+			data:   []byte{0, 0xff, 255, 0, 0, 0, 0, 255},
+			model:  color.RGBAModel,
+			pixels: []color.Color{red, blue},
+		},
+		{
+			name: "cmyk_8",
+			hdr:  testPWGHeader(2, 1, PWGColorSpaceCMYK, 8, 4),
+			data: []byte{0, 0xff,
+				0, 255, 255, 0,
+				255, 255, 255, 255},
+			model:  color.RGBAModel,
+			pixels: []color.Color{red, black},
+		},
+		{
+			name: "cmyk_16",
+			hdr:  testPWGHeader(2, 1, PWGColorSpaceCMYK, 16, 4),
+			data: []byte{0, 0xff,
+				0, 0, 255, 255, 255, 255, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0},
+			model:  color.RGBA64Model,
+			pixels: []color.Color{red, white},
+		},
+	}
+
+	for _, test := range tests {
+		reader, err := NewPWGReader(bytes.NewReader(
+			testPWGBuild(test.hdr, test.data)))
+		if err != nil {
+			t.Errorf("%s: NewPWGReader: %s", test.name, err)
+			continue
+		}
+
+		if reader.ColorModel() != test.model {
+			t.Errorf("%s: ColorModel mismatch", test.name)
+		}
+
+		img, err := decodeImage(reader)
+		reader.Close()
+
+		if err != nil {
+			t.Errorf("%s: decodeImage: %s", test.name, err)
+			continue
+		}
+
+		for x, expected := range test.pixels {
+			present := img.At(x, 0)
+			if !colorEqual(expected, present) {
+				t.Errorf("%s: pixel %d:\n"+
+					"expected: %v\n"+
+					"present:  %v",
+					test.name, x, expected, present)
+			}
+		}
+	}
+}
+
+// TestPWGErrors tests PWG Raster errors
+func TestPWGErrors(t *testing.T) {
+	hdr := testPWGHeader(2, 2, PWGColorSpaceSgray, 8, 1)
+	page := []byte{1, 1, 0}
+
+	inconsistent := hdr
+	inconsistent.BytesPerLine++
+
+	badColorSpace := hdr
+	badColorSpace.ColorSpace = 100
+
+	badBits := testPWGHeader(2, 2, PWGColorSpaceSrgb, 1, 3)
+
+	badHeader := testPWGBuild(hdr, page)
+	badHeader[4] = 'X'
+
+	type testData struct {
+		name string // Test name
+		data []byte // Document data
+	}
+
+	tests := []testData{
+		{"empty document", []byte(pwgSyncWord)},
+		{"truncated sync word", []byte("RaS")},
+		{"invalid sync word", []byte("RaS3")},
+		{"invalid header", badHeader},
+		{"truncated header", testPWGBuild(hdr, nil)[:100]},
+		{"inconsistent header", testPWGBuild(inconsistent, page)},
+		{"unsupported color space", testPWGBuild(badColorSpace, page)},
+		{"unsupported bits", testPWGBuild(badBits, page)},
+	}
+
+	for _, test := range tests {
+		reader, err := NewPWGReader(bytes.NewReader(test.data))
+		if err == nil {
+			reader.Close()
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+
+	// Errors in the compressed data
+	tests = []testData{
+		{"truncated data", testPWGBuild(hdr, []byte{0, 1})},
+		{"run too long", testPWGBuild(hdr, []byte{0, 2, 0})},
+		{"literal too long", testPWGBuild(hdr, []byte{0, 0xfd, 1, 2, 3})},
+	}
+
+	for _, test := range tests {
+		reader, err := NewPWGReader(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: NewPWGReader: %s", test.name, err)
+			continue
+		}
+
+		_, err = decodeImage(reader)
+		if err == nil {
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+
+	// Writer errors
+	_, err := NewPWGWriter(io.Discard, 10, 10, color.CMYKModel, 0, 0)
+	if err == nil {
+		t.Errorf("NewPWGWriter: unsupported model must fail")
+	}
+
+	doc := NewPWGDocumentWriter(io.Discard)
+	_, err = doc.NewPage(testPWGHeader(2, 2, PWGColorSpaceCMYK, 8, 4))
+	if err == nil {
+		t.Errorf("NewPage: CMYK must fail")
+	}
+
+	_, err = doc.NewPage(hdr)
+	if err != nil {
+		t.Fatalf("NewPage: %s", err)
+	}
+
+	_, err = doc.NewPage(hdr)
+	if err == nil {
+		t.Errorf("NewPage: unclosed page must fail")
+	}
+
+	err = NewPWGDocumentWriter(io.Discard).Close()
+	if err == nil {
+		t.Errorf("Close: empty document must fail")
+	}
+
+	errTest := io.ErrShortWrite
+	_, err = NewPWGWriter(newIoWriterWithError(io.Discard, 0, errTest),
+		10, 10, color.GrayModel, 0, 0)
+	if err != errTest {
+		t.Errorf("NewPWGWriter: expected %v, present %v", errTest, err)
+	}
+}
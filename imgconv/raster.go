@@ -0,0 +1,550 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Common part of PWG Raster and Apple Raster (URF) codecs
+
+package imgconv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image/color"
+	"io"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+)
+
+// rasterMaxSize is the maximal image width and height, in pixels,
+// accepted by the PWG Raster, URF and TIFF decoders. It protects from
+// allocation of the huge buffers due to the broken page headers.
+const rasterMaxSize = 1 << 20
+
+// rasterFormat describes the pixel format of the raster page,
+// common for PWG Raster and URF.
+type rasterFormat struct {
+	model        color.Model // Image color model
+	wid          int         // Image width
+	bpc          int         // Bits per color (1, 8 or 16)
+	colors       int         // Count of colors (1, 3 or 4)
+	unit         int         // Compression unit, in bytes
+	bytesPerLine int         // Bytes per line
+	invert       bool        // Zero means white (Black and CMYK)
+}
+
+// newRasterFormat creates a new rasterFormat.
+//
+// If invert is true, the maximal sample value means black,
+// which is the case for the Black and CMYK color spaces.
+func newRasterFormat(wid, bpc, colors int, invert bool) (rasterFormat,
+	error) {
+
+	f := rasterFormat{
+		wid:    wid,
+		bpc:    bpc,
+		colors: colors,
+		invert: invert,
+	}
+
+	switch {
+	case bpc == 1 && colors == 1:
+		f.model = BilevelModel
+	case bpc == 8 && colors == 1:
+		f.model = color.GrayModel
+	case bpc == 16 && colors == 1:
+		f.model = color.Gray16Model
+	case bpc == 8 && (colors == 3 || colors == 4):
+		f.model = color.RGBAModel
+	case bpc == 16 && (colors == 3 || colors == 4):
+		f.model = color.RGBA64Model
+	default:
+		return f, errors.New("unsupported pixel format")
+	}
+
+	if wid <= 0 || wid > rasterMaxSize {
+		return f, errors.New("invalid image size")
+	}
+
+	f.unit = generic.Max(1, bpc*colors/8)
+	f.bytesPerLine = (wid*bpc*colors + 7) / 8
+
+	return f, nil
+}
+
+// white returns the byte value for filling the white area.
+func (f rasterFormat) white() byte {
+	if f.invert {
+		return 0
+	}
+	return 0xff
+}
+
+// decodeRow decodes the raw line into the Row. The tmp buffer
+// must be at least max(bytesPerLine, wid*6) bytes long.
+//
+// The line is not modified, as it may be repeated several times.
+func (f rasterFormat) decodeRow(row Row, line, tmp []byte) {
+	// Invert the Black color space
+	if f.invert && f.colors == 1 {
+		for i := range line {
+			tmp[i] = ^line[i]
+		}
+		line = tmp[:len(line)]
+	}
+
+	switch f.colors {
+	case 1:
+		switch f.bpc {
+		case 1:
+			row.Copy(RowBilevel{bits: line, wid: f.wid})
+		case 8:
+			bytesGray8toRow(row, line)
+		case 16:
+			bytesGray16BEtoRow(row, line)
+		}
+
+	case 3:
+		switch f.bpc {
+		case 8:
+			bytesRGB8toRow(row, line)
+		case 16:
+			bytesRGB16BEtoRow(row, line)
+		}
+
+	case 4:
+		// Naive CMYK to RGB conversion
+		switch f.bpc {
+		case 8:
+			for x := 0; x < f.wid; x++ {
+				s := line[x*4 : x*4+4]
+				d := tmp[x*3 : x*3+3]
+				d[0], d[1], d[2] = color.CMYKToRGB(s[0], s[1], s[2], s[3])
+			}
+			bytesRGB8toRow(row, tmp[:f.wid*3])
+
+		case 16:
+			for x := 0; x < f.wid; x++ {
+				s := line[x*8 : x*8+8]
+				k := 0xffff - uint32(s[6])<<8 - uint32(s[7])
+				for c := 0; c < 3; c++ {
+					v := uint32(s[c*2])<<8 | uint32(s[c*2+1])
+					v = (0xffff - v) * k / 0xffff
+					tmp[x*6+c*2] = uint8(v >> 8)
+					tmp[x*6+c*2+1] = uint8(v)
+				}
+			}
+			bytesRGB16BEtoRow(row, tmp[:f.wid*6])
+		}
+	}
+}
+
+// encodeRow encodes the Row into the raw line. The tail of the
+// line, not covered by the Row, is filled with white.
+//
+// CMYK is not supported for encoding.
+func (f rasterFormat) encodeRow(line []byte, row Row) {
+	wid := generic.Min(row.Width(), f.wid)
+
+	switch f.model {
+	case BilevelModel:
+		bytesBilevelFromRow(line, row)
+
+		// Fill the tail. Bit set means white.
+		for x := wid; x < f.wid; x++ {
+			line[x>>3] |= 0x80 >> (x & 7)
+		}
+
+	default:
+		switch f.model {
+		case color.GrayModel:
+			bytesGray8fromRow(line, row)
+		case color.Gray16Model:
+			bytesGray16BEfromRow(line, row)
+		case color.RGBAModel:
+			bytesRGB8fromRow(line, row)
+		case color.RGBA64Model:
+			bytesRGB16BEfromRow(line, row)
+		}
+
+		for i := wid * f.unit; i < f.bytesPerLine; i++ {
+			line[i] = 0xff
+		}
+	}
+
+	if f.invert {
+		for i := range line {
+			line[i] = ^line[i]
+		}
+	}
+}
+
+// rasterLineReader reads the compressed lines of the raster page.
+//
+// Both PWG Raster and URF use the same compression. Each line
+// starts with the line repeat count byte (the line is repeated
+// count+1 times), followed by packets, until the line is complete.
+//
+// Each packet starts with the control byte:
+//   - 0...127 means that the next pixel is repeated control+1 times
+//   - 128 means that the rest of line is filled with white
+//   - 129...255 means 257-control literal pixels follow
+//
+// For images with less that 8 bits per pixel, bytes are used
+// instead of pixels.
+type rasterLineReader struct {
+	input  *bufio.Reader // Underlying input
+	format rasterFormat  // Pixel format
+	line   []byte        // Current line
+	repeat int           // Remaining repeat count of the current line
+}
+
+// newRasterLineReader creates a new rasterLineReader.
+func newRasterLineReader(input *bufio.Reader,
+	format rasterFormat) *rasterLineReader {
+
+	return &rasterLineReader{
+		input:  input,
+		format: format,
+		line:   make([]byte, format.bytesPerLine),
+	}
+}
+
+// readLine reads the next line.
+// The returned slice remains valid until the next call.
+func (lr *rasterLineReader) readLine() ([]byte, error) {
+	if lr.repeat > 0 {
+		lr.repeat--
+		return lr.line, nil
+	}
+
+	c, err := lr.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	lr.repeat = int(c)
+	unit := lr.format.unit
+	line := lr.line
+
+	for off := 0; off < len(line); {
+		c, err = lr.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		var n int
+		switch {
+		case c < 128:
+			n = (int(c) + 1) * unit
+		case c == 128:
+			n = len(line) - off
+		default:
+			n = (257 - int(c)) * unit
+		}
+
+		if off+n > len(line) {
+			return nil, errors.New("invalid compressed data")
+		}
+
+		switch {
+		case c < 128:
+			err = lr.readFull(line[off : off+unit])
+			for i := off + unit; i < off+n; i += unit {
+				copy(line[i:i+unit], line[off:off+unit])
+			}
+		case c == 128:
+			white := lr.format.white()
+			for i := off; i < off+n; i++ {
+				line[i] = white
+			}
+		default:
+			err = lr.readFull(line[off : off+n])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		off += n
+	}
+
+	return line, nil
+}
+
+// readByte reads the next byte of the compressed data.
+func (lr *rasterLineReader) readByte() (byte, error) {
+	c, err := lr.input.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return c, err
+}
+
+// readFull reads the compressed data.
+func (lr *rasterLineReader) readFull(buf []byte) error {
+	_, err := io.ReadFull(lr.input, buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// rasterPageReader implements the [Decoder] interface for
+// reading the single page of the PWG Raster or URF document.
+type rasterPageReader struct {
+	mime     string            // MIME type of the document
+	prefix   string            // Error prefix ("PWG" or "URF")
+	hei      int               // Image height
+	lines    *rasterLineReader // Line reader
+	rowBytes []byte            // Row decoding buffer
+	y        int               // Current y-coordinate
+	err      error             // Sticky error
+}
+
+// newRasterPageReader creates a new rasterPageReader.
+func newRasterPageReader(mime, prefix string, input *bufio.Reader,
+	format rasterFormat, hei int) *rasterPageReader {
+
+	return &rasterPageReader{
+		mime:   mime,
+		prefix: prefix,
+		hei:    hei,
+		lines:  newRasterLineReader(input, format),
+		rowBytes: make([]byte,
+			generic.Max(format.bytesPerLine, format.wid*6)),
+	}
+}
+
+// MIMEType returns the MIME type of the image being decoded.
+func (page *rasterPageReader) MIMEType() string {
+	return page.mime
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (page *rasterPageReader) ColorModel() color.Model {
+	return page.lines.format.model
+}
+
+// Size returns the image size.
+func (page *rasterPageReader) Size() (wid, hei int) {
+	return page.lines.format.wid, page.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (page *rasterPageReader) NewRow() Row {
+	return NewRow(page.lines.format.model, page.lines.format.wid)
+}
+
+// Read returns the next image [Row].
+func (page *rasterPageReader) Read(row Row) (int, error) {
+	if page.err != nil {
+		return 0, page.err
+	}
+
+	line, err := page.lines.readLine()
+	if err != nil {
+		page.setError(err)
+		return 0, page.err
+	}
+
+	wid := generic.Min(row.Width(), page.lines.format.wid)
+	page.lines.format.decodeRow(row, line, page.rowBytes)
+
+	page.y++
+	if page.y == page.hei {
+		page.err = io.EOF
+	}
+
+	return wid, nil
+}
+
+// Close closes the reader.
+//
+// The rest of page is not consumed from the input until the
+// next page is requested.
+func (page *rasterPageReader) Close() {
+}
+
+// skip skips the rest of the page.
+func (page *rasterPageReader) skip() error {
+	for page.err == nil {
+		_, err := page.lines.readLine()
+		if err != nil {
+			page.setError(err)
+			return page.err
+		}
+
+		page.y++
+		if page.y == page.hei {
+			page.err = io.EOF
+		}
+	}
+
+	if page.err == io.EOF {
+		return nil
+	}
+
+	return page.err
+}
+
+// setError sets the sticky error, adding the error prefix
+// if appropriate.
+func (page *rasterPageReader) setError(err error) {
+	if err != io.ErrUnexpectedEOF {
+		err = errors.New(page.prefix + ": " + err.Error())
+	}
+	page.err = err
+}
+
+// rasterOutput is the output of the raster document writer.
+type rasterOutput struct {
+	output io.Writer // Underlying io.Writer
+	err    error     // Sticky error
+}
+
+// write writes data to the output.
+func (out *rasterOutput) write(data []byte) {
+	if out.err == nil {
+		_, out.err = out.output.Write(data)
+	}
+}
+
+// rasterPageWriter implements the [Writer] interface for the single
+// page of the PWG Raster or URF document.
+type rasterPageWriter struct {
+	out    *rasterOutput // Document output
+	prefix string        // Error prefix ("PWG" or "URF")
+	format rasterFormat  // Pixel format
+	hei    int           // Image height
+	line   []byte        // Current line
+	prev   []byte        // Previous line
+	repeat int           // Count of prev lines, not written yet
+	buf    []byte        // Compression buffer
+	y      int           // Current y-coordinate
+	closed bool          // Page is closed
+}
+
+// newRasterPageWriter creates a new rasterPageWriter.
+func newRasterPageWriter(out *rasterOutput, prefix string,
+	format rasterFormat, hei int) *rasterPageWriter {
+
+	return &rasterPageWriter{
+		out:    out,
+		prefix: prefix,
+		format: format,
+		hei:    hei,
+		line:   make([]byte, format.bytesPerLine),
+		prev:   make([]byte, format.bytesPerLine),
+	}
+}
+
+// ColorModel returns the [color.Model] of image being written.
+func (page *rasterPageWriter) ColorModel() color.Model {
+	return page.format.model
+}
+
+// Size returns the image size.
+func (page *rasterPageWriter) Size() (wid, hei int) {
+	return page.format.wid, page.hei
+}
+
+// Write writes the next image [Row].
+func (page *rasterPageWriter) Write(row Row) error {
+	// Check for pending error
+	switch {
+	case page.out.err != nil:
+		return page.out.err
+	case page.closed:
+		return errors.New(page.prefix + ": page is closed")
+	}
+
+	// Silently ignore excessive rows
+	if page.y == page.hei {
+		return nil
+	}
+
+	page.format.encodeRow(page.line, row)
+	page.y++
+
+	// Merge the repeated lines
+	if page.repeat > 0 && page.repeat < 256 &&
+		bytes.Equal(page.line, page.prev) {
+		page.repeat++
+		return nil
+	}
+
+	page.flush()
+	page.line, page.prev = page.prev, page.line
+	page.repeat = 1
+
+	return page.out.err
+}
+
+// Close writes the missing rows and finishes the page.
+func (page *rasterPageWriter) Close() error {
+	if !page.closed {
+		for page.y < page.hei && page.out.err == nil {
+			page.Write(RowEmpty{})
+		}
+
+		page.flush()
+		page.closed = true
+	}
+
+	return page.out.err
+}
+
+// flush compresses and writes the pending repeated lines.
+func (page *rasterPageWriter) flush() {
+	if page.repeat == 0 {
+		return
+	}
+
+	buf := append(page.buf[:0], byte(page.repeat-1))
+	line := page.prev
+	unit := page.format.unit
+	npix := len(line) / unit
+
+	pixel := func(i int) []byte {
+		return line[i*unit : i*unit+unit]
+	}
+
+	for i := 0; i < npix; {
+		// Count the run of identical pixels
+		run := 1
+		for i+run < npix && run < 128 &&
+			bytes.Equal(pixel(i), pixel(i+run)) {
+			run++
+		}
+
+		if run > 1 {
+			buf = append(buf, byte(run-1))
+			buf = append(buf, pixel(i)...)
+			i += run
+			continue
+		}
+
+		// Collect literal pixels, until the next run
+		start := i
+		i++
+		for i < npix && i-start < 128 &&
+			(i+1 == npix || !bytes.Equal(pixel(i), pixel(i+1))) {
+			i++
+		}
+
+		if i-start == 1 {
+			buf = append(buf, 0)
+		} else {
+			buf = append(buf, byte(257-(i-start)))
+		}
+		buf = append(buf, line[start*unit:i*unit]...)
+	}
+
+	page.out.write(buf)
+	page.buf = buf
+	page.repeat = 0
+}
@@ -0,0 +1,162 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Resampling kernels
+
+package imgconv
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScaleKernel selects the resampling kernel, used by the image
+// scaler (see [NewScalerKernel]).
+type ScaleKernel int
+
+// Resampling kernels:
+const (
+	// ScaleBilinear is the bi-linear interpolation. It is fast
+	// and good for upscaling and moderate downscaling, but aliases
+	// when image is downscaled by the large factor.
+	ScaleBilinear ScaleKernel = iota
+
+	// ScaleBox is the area averaging: each destination pixel is
+	// the average of source pixels it covers. It is the good
+	// choice for downscaling by the large factor.
+	ScaleBox
+
+	// ScaleLanczos3 is the Lanczos filter with a=3. It gives the
+	// sharpest results for both upscaling and downscaling, at
+	// the cost of the larger row history and computations.
+	ScaleLanczos3
+)
+
+// String returns the string representation of the [ScaleKernel],
+// for logging.
+func (kernel ScaleKernel) String() string {
+	switch kernel {
+	case ScaleBilinear:
+		return "Bilinear"
+	case ScaleBox:
+		return "Box"
+	case ScaleLanczos3:
+		return "Lanczos3"
+	}
+
+	return fmt.Sprintf("Unknown (%d)", int(kernel))
+}
+
+// makeScaleCoefficientsKernel prepares coefficients for image
+// scaling (vertical or horizontal) with changing image dimensions
+// range from [0...slen) to [0...dlen), using the specified kernel.
+//
+// Coefficients are sorted by the destination position and, for
+// the same destination position, by the source position.
+func makeScaleCoefficientsKernel(slen, dlen int,
+	kernel ScaleKernel) []scaleCoeff {
+
+	switch kernel {
+	case ScaleBox:
+		return makeScaleCoefficientsBox(slen, dlen)
+	case ScaleLanczos3:
+		return makeScaleCoefficientsLanczos(slen, dlen, 3)
+	}
+
+	return makeScaleCoefficients(slen, dlen)
+}
+
+// makeScaleCoefficientsBox prepares coefficients for the area
+// averaging.
+//
+// Each destination pixel covers the [d*scale...(d+1)*scale) range
+// of the source pixels. Each source pixel contributes in proportion
+// to its overlap with this range.
+func makeScaleCoefficientsBox(slen, dlen int) []scaleCoeff {
+	coeffs := make([]scaleCoeff, 0, slen+dlen)
+	scale := float64(slen) / float64(dlen)
+
+	for d := 0; d < dlen; d++ {
+		s0 := float64(d) * scale
+		s1 := float64(d+1) * scale
+
+		for s := int(s0); s < slen && float64(s) < s1; s++ {
+			overlap := math.Min(float64(s+1), s1) -
+				math.Max(float64(s), s0)
+
+			if overlap > 0 {
+				w := float32(overlap / scale)
+				coeffs = append(coeffs, scaleCoeff{S: s, D: d, W: w})
+			}
+		}
+	}
+
+	return coeffs
+}
+
+// makeScaleCoefficientsLanczos prepares coefficients for the
+// Lanczos filter with the specified a parameter.
+//
+// When downscaling, the kernel is stretched by the scale factor,
+// so it works as a low-pass filter. Pixels beyond the image edges
+// are replicated from the edge pixels. Weights are normalized, so
+// they sum up to 1 for each destination pixel.
+func makeScaleCoefficientsLanczos(slen, dlen, a int) []scaleCoeff {
+	scale := float64(slen) / float64(dlen)
+	stretch := math.Max(scale, 1)
+	support := float64(a) * stretch
+
+	coeffs := make([]scaleCoeff, 0, dlen*(2*int(support)+2))
+
+	for d := 0; d < dlen; d++ {
+		center := (float64(d)+0.5)*scale - 0.5
+		first := len(coeffs)
+		sum := float32(0)
+
+		smin := int(math.Ceil(center - support))
+		smax := int(math.Floor(center + support))
+
+		for s := smin; s <= smax; s++ {
+			w := float32(lanczos((float64(s)-center)/stretch, a))
+			if w == 0 {
+				continue
+			}
+
+			sum += w
+
+			// Replicate edge pixels
+			src := max(0, min(s, slen-1))
+			if l := len(coeffs); l > first && coeffs[l-1].S == src {
+				coeffs[l-1].W += w
+			} else {
+				coeffs = append(coeffs,
+					scaleCoeff{S: src, D: d, W: w})
+			}
+		}
+
+		// Normalize weights
+		if sum != 0 {
+			for i := first; i < len(coeffs); i++ {
+				coeffs[i].W /= sum
+			}
+		}
+	}
+
+	return coeffs
+}
+
+// lanczos computes the Lanczos kernel with the specified a parameter
+func lanczos(x float64, a int) float64 {
+	switch {
+	case x == 0:
+		return 1
+	case math.Abs(x) >= float64(a):
+		return 0
+	}
+
+	px := math.Pi * x
+	return float64(a) * math.Sin(px) * math.Sin(px/float64(a)) / (px * px)
+}
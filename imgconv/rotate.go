@@ -0,0 +1,256 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image rotation and mirroring
+
+package imgconv
+
+import (
+	"image/color"
+	"io"
+	"slices"
+)
+
+// mirror implements the horizontal mirroring filter.
+type mirror struct {
+	input Reader // Image source
+}
+
+// rotate implements the image rotation filter.
+type rotate struct {
+	input    Reader // Image source
+	angle    int    // Rotation angle: 90, 180 or 270
+	wid, hei int    // Source image size
+	rows     []Row  // Buffered source image, nil if not loaded
+	tmp      Row    // Output row
+	y        int    // Current output row
+	err      error  // Sticky error
+}
+
+// NewMirror creates a new image filter on a top of the existent
+// [Reader].
+//
+// This filter mirrors the image horizontally (left to right).
+// To mirror image vertically, combine it with the 180 degrees
+// rotation (see [NewRotate]).
+func NewMirror(in Reader) Reader {
+	return &mirror{input: in}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (mr *mirror) ColorModel() color.Model {
+	return mr.input.ColorModel()
+}
+
+// Size returns the image size.
+func (mr *mirror) Size() (wid, hei int) {
+	return mr.input.Size()
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (mr *mirror) NewRow() Row {
+	return mr.input.NewRow()
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (mr *mirror) Read(row Row) (int, error) {
+	wid, _ := mr.input.Size()
+	if row.Width() > wid {
+		row = row.Slice(0, wid)
+	}
+
+	n, err := mr.input.Read(row)
+	if err == nil {
+		mirrorRow(row.Slice(0, n))
+	}
+
+	return n, err
+}
+
+// Close closes the reader.
+func (mr *mirror) Close() {
+	mr.input.Close()
+}
+
+// NewRotate creates a new image filter on a top of the existent
+// [Reader].
+//
+// This filter rotates the image clockwise by the specified angle,
+// in degrees. The angle is rounded down to the multiple of 90
+// degrees. Zero angle bypasses the filter.
+//
+// Rotation requires the whole image to be buffered in memory.
+// The buffering happens on the first call to the Read.
+func NewRotate(in Reader, angle int) Reader {
+	angle = ((angle % 360) + 360) % 360 / 90 * 90
+	if angle == 0 {
+		return in
+	}
+
+	wid, hei := in.Size()
+	rot := &rotate{
+		input: in,
+		angle: angle,
+		wid:   wid,
+		hei:   hei,
+	}
+
+	outwid, _ := rot.Size()
+	rot.tmp = NewRow(in.ColorModel(), outwid)
+
+	return rot
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (rot *rotate) ColorModel() color.Model {
+	return rot.input.ColorModel()
+}
+
+// Size returns the image size.
+func (rot *rotate) Size() (wid, hei int) {
+	if rot.angle == 180 {
+		return rot.wid, rot.hei
+	}
+	return rot.hei, rot.wid
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (rot *rotate) NewRow() Row {
+	wid, _ := rot.Size()
+	return NewRow(rot.ColorModel(), wid)
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (rot *rotate) Read(row Row) (int, error) {
+	if rot.err == nil && rot.rows == nil {
+		rot.err = rot.load()
+	}
+
+	_, hei := rot.Size()
+	if rot.err == nil && rot.y == hei {
+		rot.err = io.EOF
+	}
+
+	if rot.err != nil {
+		return 0, rot.err
+	}
+
+	y := rot.y
+	rot.y++
+
+	switch rot.angle {
+	case 90:
+		// Output row is the source column, from bottom to top
+		rotateColumn(rot.tmp, rot.rows, y, true)
+	case 180:
+		// Output row is the mirrored source row, from bottom to top
+		rot.tmp.Copy(rot.rows[rot.hei-1-y])
+		mirrorRow(rot.tmp)
+	case 270:
+		// Output row is the source column, from right to left
+		rotateColumn(rot.tmp, rot.rows, rot.wid-1-y, false)
+	}
+
+	return row.Copy(rot.tmp), nil
+}
+
+// load loads the whole source image into memory.
+func (rot *rotate) load() error {
+	rows := make([]Row, rot.hei)
+	for y := range rows {
+		rows[y] = NewRow(rot.ColorModel(), rot.wid)
+		_, err := rot.input.Read(rows[y])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	rot.rows = rows
+	return nil
+}
+
+// Close closes the reader.
+func (rot *rotate) Close() {
+	rot.rows = nil
+	rot.input.Close()
+}
+
+// mirrorRow mirrors the Row horizontally, in place.
+func mirrorRow(row Row) {
+	switch row := row.(type) {
+	case RowGray8:
+		slices.Reverse(row)
+	case RowGray16:
+		slices.Reverse(row)
+	case RowRGBA32:
+		slices.Reverse(row)
+	case RowRGBA64:
+		slices.Reverse(row)
+	case RowBilevel:
+		for i, j := 0, row.Width()-1; i < j; i, j = i+1, j-1 {
+			bi, bj := row.BitAt(i), row.BitAt(j)
+			row.SetBit(i, bj)
+			row.SetBit(j, bi)
+		}
+	default:
+		for i, j := 0, row.Width()-1; i < j; i, j = i+1, j-1 {
+			ci, cj := row.At(i), row.At(j)
+			row.Set(i, cj)
+			row.Set(j, ci)
+		}
+	}
+}
+
+// rotateColumn copies the column x of the image, represented by
+// rows, into the dst Row. If up is true, column is copied from
+// bottom to top, otherwise from top to bottom.
+//
+// dst and rows must be of the same type.
+func rotateColumn(dst Row, rows []Row, x int, up bool) {
+	switch dst := dst.(type) {
+	case RowGray8:
+		rotateColumnOf(dst, rows, x, up)
+	case RowGray16:
+		rotateColumnOf(dst, rows, x, up)
+	case RowRGBA32:
+		rotateColumnOf(dst, rows, x, up)
+	case RowRGBA64:
+		rotateColumnOf(dst, rows, x, up)
+	case RowBilevel:
+		for i := range rows {
+			src := rows[rotateIndex(len(rows), i, up)]
+			dst.SetBit(i, src.(RowBilevel).BitAt(x))
+		}
+	default:
+		for i := range rows {
+			dst.Set(i, rows[rotateIndex(len(rows), i, up)].At(x))
+		}
+	}
+}
+
+// rotateColumnOf is the rotateColumn for the particular Row type.
+func rotateColumnOf[R ~[]P, P any](dst R, rows []Row, x int, up bool) {
+	for i := range rows {
+		dst[i] = rows[rotateIndex(len(rows), i, up)].(R)[x]
+	}
+}
+
+// rotateIndex returns the source row index for the i-th pixel
+// of the column, copied by the rotateColumn.
+func rotateIndex(n, i int, up bool) int {
+	if up {
+		return n - 1 - i
+	}
+	return i
+}
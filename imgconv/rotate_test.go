@@ -0,0 +1,113 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image rotation and mirroring test
+
+package imgconv
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// TestRotate tests image rotation and mirroring
+func TestRotate(t *testing.T) {
+	// Source image: 3x2, black and white pixels
+	src := [][]uint8{
+		{0, 255, 255},
+		{0, 0, 255},
+	}
+
+	type testData struct {
+		name   string              // Test name
+		filter func(Reader) Reader // Filter constructor
+		out    [][]uint8           // Expected output
+	}
+
+	tests := []testData{
+		{
+			name:   "mirror",
+			filter: NewMirror,
+			out: [][]uint8{
+				{255, 255, 0},
+				{255, 0, 0},
+			},
+		},
+		{
+			name:   "0",
+			filter: func(in Reader) Reader { return NewRotate(in, 0) },
+			out:    src,
+		},
+		{
+			name:   "90",
+			filter: func(in Reader) Reader { return NewRotate(in, 90) },
+			out: [][]uint8{
+				{0, 0},
+				{0, 255},
+				{255, 255},
+			},
+		},
+		{
+			name:   "180",
+			filter: func(in Reader) Reader { return NewRotate(in, 180) },
+			out: [][]uint8{
+				{255, 0, 0},
+				{255, 255, 0},
+			},
+		},
+		{
+			name:   "270",
+			filter: func(in Reader) Reader { return NewRotate(in, -90) },
+			out: [][]uint8{
+				{255, 255},
+				{255, 0},
+				{0, 0},
+			},
+		},
+	}
+
+	models := map[string]color.Model{
+		"Bilevel": BilevelModel,
+		"Gray8":   color.GrayModel,
+		"RGBA32":  color.RGBAModel,
+		"RGBA64":  color.RGBA64Model,
+	}
+
+	for _, test := range tests {
+		for name, model := range models {
+			in := NewColorModelFilter(
+				newRowsReader(color.GrayModel, testGrayRows(src)),
+				model)
+
+			filter := test.filter(in)
+
+			wid, hei := filter.Size()
+			if wid != len(test.out[0]) || hei != len(test.out) {
+				t.Errorf("%s (%s): Size: expected %dx%d, "+
+					"present %dx%d", test.name, name,
+					len(test.out[0]), len(test.out), wid, hei)
+				continue
+			}
+
+			rows := mustDecodeImageRows(filter)
+			out := make([][]uint8, len(rows))
+			for y := range rows {
+				out[y] = make([]uint8, wid)
+				for x := range out[y] {
+					out[y][x] = testGrayAt(rows, x, y)
+				}
+			}
+
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("%s (%s):\n"+
+					"expected: %v\n"+
+					"present:  %v",
+					test.name, name, test.out, out)
+			}
+		}
+	}
+}
@@ -41,6 +41,7 @@ type Row interface {
 
 // NewRow returns the new [Row] of the specified width and [color.Model].
 // The following color models are supported:
+//   - BilevelModel
 //   - color.GrayModel
 //   - color.Gray16Model
 //   - color.RGBAModel
@@ -49,6 +50,8 @@ type Row interface {
 // For unknown (unsupported) model nil is returned.
 func NewRow(model color.Model, width int) (row Row) {
 	switch model {
+	case BilevelModel:
+		row = NewRowBilevel(width)
 	case color.GrayModel:
 		row = make(RowGray8, width)
 	case color.Gray16Model:
@@ -93,6 +96,7 @@ type RowFP interface {
 // compatible with the [color.Model] (grayscale or RGBA).
 //
 // The following color models are supported:
+//   - BilevelModel
 //   - color.GrayModel
 //   - color.Gray16Model
 //   - color.RGBAModel
@@ -101,7 +105,7 @@ type RowFP interface {
 // For unknown (unsupported) model nil is returned.
 func NewRowFP(model color.Model, width int) (row RowFP) {
 	switch model {
-	case color.GrayModel, color.Gray16Model:
+	case BilevelModel, color.GrayModel, color.Gray16Model:
 		row = make(RowGrayFP32, width)
 	case color.RGBAModel, color.RGBA64Model:
 		row = make(RowRGBAFP32, width*4)
@@ -460,7 +464,7 @@ func (r RowGrayFP32) Copy(r2 Row) int {
 		}
 	default:
 		for x := 0; x < wid; x++ {
-			c2 := color.RGBA64Model.Convert(r2.At(x)).(color.Gray16)
+			c2 := color.Gray16Model.Convert(r2.At(x)).(color.Gray16)
 			r[x] = float32(c2.Y) / 0xffff
 		}
 	}
@@ -24,6 +24,7 @@ type scaler struct {
 	tmpout   RowFP        // Output buffer
 	history  []RowFP      // Scaled source rows: 0 - latest, 1 - previous etc
 	srcy     int          // Latest source row y-coordinate
+	clamp    bool         // Clamp output into the [0...1] range
 }
 
 // NewScaler creates a new image resize filter on a top of the
@@ -31,7 +32,21 @@ type scaler struct {
 //
 // This filter scales the input image into the new dimensions,
 // defined by the wid and hei parameters.
+//
+// It uses the bi-linear interpolation. See [NewScalerKernel]
+// for other resampling kernels.
 func NewScaler(in Reader, wid, hei int) Reader {
+	return NewScalerKernel(in, wid, hei, ScaleBilinear)
+}
+
+// NewScalerKernel is like [NewScaler], but allows to choose
+// the resampling kernel.
+//
+// Image is processed row by row. The scaler keeps in memory only
+// as much of the source rows, as needed by the kernel vertically,
+// so memory usage depends on the kernel and the scale factor,
+// but not on the image height.
+func NewScalerKernel(in Reader, wid, hei int, kernel ScaleKernel) Reader {
 	oldwid, oldhei := in.Size()
 
 	// Bypass the filter, if image dimensions doesn't change
@@ -45,11 +60,15 @@ func NewScaler(in Reader, wid, hei int) Reader {
 		input:   in,
 		wid:     wid,
 		hei:     hei,
-		xcoeffs: makeScaleCoefficients(oldwid, wid),
-		ycoeffs: makeScaleCoefficients(oldhei, hei),
+		xcoeffs: makeScaleCoefficientsKernel(oldwid, wid, kernel),
+		ycoeffs: makeScaleCoefficientsKernel(oldhei, hei, kernel),
 		tmpin:   NewRowFP(model, oldwid),
 		tmpout:  NewRowFP(model, wid),
 		srcy:    -1,
+
+		// Lanczos kernel has negative lobes, so output may
+		// overshoot the valid range
+		clamp: kernel == ScaleLanczos3,
 	}
 
 	// Populate scaler.rows
@@ -96,6 +115,10 @@ func (scl *scaler) Read(row Row) (int, error) {
 		scl.ycoeffs = scl.ycoeffs[1:]
 	}
 
+	if scl.clamp {
+		scaleClamp(scl.tmpout)
+	}
+
 	return row.Copy(scl.tmpout), nil
 }
 
@@ -129,3 +152,19 @@ func (scl *scaler) hstshift() {
 		scl.history[0] = tmp
 	}
 }
+
+// scaleClamp clamps all values of the RowFP into the [0...1] range.
+func scaleClamp(row RowFP) {
+	var samples []float32
+
+	switch row := row.(type) {
+	case RowGrayFP32:
+		samples = row
+	case RowRGBAFP32:
+		samples = row
+	}
+
+	for i, v := range samples {
+		samples[i] = min(max(v, 0), 1)
+	}
+}
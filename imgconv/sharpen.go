@@ -0,0 +1,85 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Sharpen/soften filter
+
+package imgconv
+
+import "github.com/OpenPrinting/go-mfp/util/generic"
+
+// sharpen implements the sharpen/soften image filter
+type sharpen struct {
+	*window3         // Sliding window of input rows
+	amount   float32 // Unsharp mask amount
+}
+
+// NewSharpen creates a new image filter on a top of the existent
+// [Reader].
+//
+// This filter sharpens (positive amount) or softens (negative amount)
+// the image, using the unsharp mask with the 3x3 blur kernel:
+//
+//	out = in + k * (in - blur(in))
+//
+// The amount range is [-1.0...+1.0]. At +1.0, k is 2.0. At -1.0,
+// the output is the blurred image. Zero amount bypasses the filter.
+func NewSharpen(in Reader, amount float64) Reader {
+	amount = levelsClamp(amount, -1, 1)
+	if amount == 0 {
+		return in
+	}
+
+	if amount > 0 {
+		amount *= 2
+	}
+
+	return &sharpen{window3: newWindow3(in), amount: float32(amount)}
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (shp *sharpen) Read(row Row) (int, error) {
+	err := shp.advance()
+	if err != nil {
+		return 0, err
+	}
+
+	prev := shp.samples(shp.rows[0])
+	cur := shp.samples(shp.rows[1])
+	next := shp.samples(shp.rows[2])
+	out := shp.samples(shp.out)
+	ch := shp.channels()
+
+	for i := range cur {
+		if ch == 4 && i%4 == 3 {
+			out[i] = cur[i] // Alpha channel
+			continue
+		}
+
+		// Horizontal neighbors, replicated at the edges
+		l, r := i-ch, i+ch
+		if l < 0 {
+			l = i
+		}
+		if r >= len(cur) {
+			r = i
+		}
+
+		// 3x3 blur kernel:
+		//
+		//	1 2 1
+		//	2 4 2  / 16
+		//	1 2 1
+		blur := (prev[l] + 2*prev[i] + prev[r] +
+			2*cur[l] + 4*cur[i] + 2*cur[r] +
+			next[l] + 2*next[i] + next[r]) / 16
+
+		v := cur[i] + shp.amount*(cur[i]-blur)
+		out[i] = generic.Max(0, generic.Min(v, 1))
+	}
+
+	return row.Copy(shp.out), nil
+}
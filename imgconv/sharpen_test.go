@@ -0,0 +1,172 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Sharpen and noise removal filters test
+
+package imgconv
+
+import (
+	"errors"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// testGrayRows creates a grayscale image, represented as
+// a slice of rows, from the matrix of 8-bit pixel values.
+func testGrayRows(pixels [][]uint8) []Row {
+	rows := make([]Row, len(pixels))
+	for y, line := range pixels {
+		row := make(RowGray8, len(line))
+		for x, v := range line {
+			row[x] = color.Gray{Y: v}
+		}
+		rows[y] = row
+	}
+	return rows
+}
+
+// testGrayAt returns 8-bit gray value of the pixel.
+func testGrayAt(rows []Row, x, y int) uint8 {
+	return color.GrayModel.Convert(rows[y].At(x)).(color.Gray).Y
+}
+
+// TestSharpen tests the sharpen filter
+func TestSharpen(t *testing.T) {
+	// Vertical edge between dark and light halves
+	pixels := [][]uint8{
+		{64, 64, 64, 192, 192, 192},
+		{64, 64, 64, 192, 192, 192},
+		{64, 64, 64, 192, 192, 192},
+		{64, 64, 64, 192, 192, 192},
+	}
+
+	// Zero amount must bypass the filter
+	in := newRowsReader(color.GrayModel, testGrayRows(pixels))
+	if NewSharpen(in, 0) != in {
+		t.Errorf("NewSharpen: zero amount must bypass the filter")
+	}
+
+	// Sharpen must increase the contrast at the edge
+	in = newRowsReader(color.GrayModel, testGrayRows(pixels))
+	rows := mustDecodeImageRows(NewSharpen(in, 1))
+
+	for y := range rows {
+		dark, light := testGrayAt(rows, 2, y), testGrayAt(rows, 3, y)
+		if dark >= 64 || light <= 192 {
+			t.Errorf("NewSharpen(1): row %d: edge not sharpened: %d %d",
+				y, dark, light)
+		}
+
+		if v := testGrayAt(rows, 0, y); v != 64 {
+			t.Errorf("NewSharpen(1): row %d: flat area changed: %d",
+				y, v)
+		}
+	}
+
+	// Soften must decrease the contrast at the edge
+	in = newRowsReader(color.GrayModel, testGrayRows(pixels))
+	rows = mustDecodeImageRows(NewSharpen(in, -1))
+
+	for y := range rows {
+		dark, light := testGrayAt(rows, 2, y), testGrayAt(rows, 3, y)
+		if dark <= 64 || light >= 192 {
+			t.Errorf("NewSharpen(-1): row %d: edge not softened: %d %d",
+				y, dark, light)
+		}
+	}
+
+	// Reading past the end must return io.EOF
+	in = newRowsReader(color.GrayModel, testGrayRows(pixels))
+	filter := NewSharpen(in, 1)
+	mustDecodeImageRows(filter)
+
+	_, err := filter.Read(filter.NewRow())
+	if err != io.EOF {
+		t.Errorf("NewSharpen: expected io.EOF, present: %v", err)
+	}
+}
+
+// TestDenoise tests the noise removal filter
+func TestDenoise(t *testing.T) {
+	// Single white speck on a gray background
+	pixels := [][]uint8{
+		{128, 128, 128, 128, 128},
+		{128, 128, 128, 128, 128},
+		{128, 128, 255, 128, 128},
+		{128, 128, 128, 128, 128},
+		{128, 128, 128, 128, 128},
+	}
+
+	// Zero amount must bypass the filter
+	in := newRowsReader(color.GrayModel, testGrayRows(pixels))
+	if NewDenoise(in, 0) != in {
+		t.Errorf("NewDenoise: zero amount must bypass the filter")
+	}
+
+	// Full amount must remove the speck completely
+	in = newRowsReader(color.GrayModel, testGrayRows(pixels))
+	rows := mustDecodeImageRows(NewDenoise(in, 1))
+
+	for y := range rows {
+		for x := 0; x < rows[y].Width(); x++ {
+			if v := testGrayAt(rows, x, y); v != 128 {
+				t.Errorf("NewDenoise(1): (%d,%d): %d", x, y, v)
+			}
+		}
+	}
+
+	// Half amount must attenuate the speck
+	in = newRowsReader(color.GrayModel, testGrayRows(pixels))
+	rows = mustDecodeImageRows(NewDenoise(in, 0.5))
+
+	if v := testGrayAt(rows, 2, 2); v <= 128 || v >= 255 {
+		t.Errorf("NewDenoise(0.5): speck not attenuated: %d", v)
+	}
+}
+
+// TestWindow3Errors tests error handling of filters, based on window3
+func TestWindow3Errors(t *testing.T) {
+	errTest := errors.New("test error")
+
+	filters := map[string]func(Reader) Reader{
+		"NewSharpen": func(in Reader) Reader { return NewSharpen(in, 1) },
+		"NewDenoise": func(in Reader) Reader { return NewDenoise(in, 1) },
+	}
+
+	for name, newFilter := range filters {
+		// Error at the first row
+		in := newReaderWithError(color.RGBAModel, 10, 10, 0, errTest)
+		filter := newFilter(in)
+		_, err := filter.Read(filter.NewRow())
+		if err != errTest {
+			t.Errorf("%s: error expected: %v, present: %v",
+				name, errTest, err)
+		}
+
+		// Error in the middle of image. Row 4 needs row 5
+		// for look-ahead, so it fails.
+		in = newReaderWithError(color.RGBAModel, 10, 10, 5, errTest)
+		filter = newFilter(in)
+		row := filter.NewRow()
+
+		for y := 0; y < 4; y++ {
+			_, err = filter.Read(row)
+			if err != nil {
+				t.Errorf("%s: row %d: unexpected error: %s",
+					name, y, err)
+			}
+		}
+
+		_, err = filter.Read(row)
+		if err != errTest {
+			t.Errorf("%s: error expected: %v, present: %v",
+				name, errTest, err)
+		}
+
+		filter.Close()
+	}
+}
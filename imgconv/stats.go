@@ -0,0 +1,257 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image statistics
+
+package imgconv
+
+import (
+	"image/color"
+	"math"
+)
+
+// statsChromaLevel is the minimal difference between the largest
+// and the smallest color channel of the pixel, for pixel to be
+// considered as colored.
+const statsChromaLevel = 0.15
+
+// statsAutoLevelsClip is the fraction of the darkest and the
+// lightest pixels, ignored by the ImageStats.AutoLevels.
+const statsAutoLevelsClip = 0.005
+
+// statsAutoLevelsMinRange is the minimal luminance range, stretched
+// by the ImageStats.AutoLevels. Images with the narrower range
+// (say, blank pages) are left unchanged, as stretching would only
+// amplify the noise.
+const statsAutoLevelsMinRange = 0.25
+
+// StatsReader is the image filter that passes the image unchanged
+// and gathers the image statistics: per-channel histograms, mean,
+// variance and colorfulness.
+//
+// It implements the [Reader] interface. Statistics becomes available
+// via the [StatsReader.Stats] after the whole image is read.
+type StatsReader struct {
+	input       Reader      // Image source
+	wid, hei    int         // Image size
+	left, right int         // Analyzed columns
+	top, bottom int         // Analyzed rows
+	y           int         // Current row
+	rgb         RowRGBA32   // Row, converted to RGB
+	stats       ImageStats  // Gathered statistics
+	rg, yb      statsMoment // Opponent color components
+}
+
+// ImageStats contains the image statistics, gathered by the
+// [StatsReader].
+//
+// All values are normalized to the [0...1.0] range of samples,
+// regardless of the image depth. Grayscale images are considered
+// as RGB images with equal channels.
+type ImageStats struct {
+	// Pixels is the count of analyzed pixels.
+	Pixels uint64
+
+	// Histogram contains per-channel (R, G, B) histograms,
+	// with samples reduced to 8 bits.
+	Histogram [3][256]uint64
+
+	// Luminance contains the luminance histogram, with the
+	// luminance computed the same way as by the color.GrayModel.
+	Luminance [256]uint64
+
+	// Mean and Variance of each channel (R, G, B).
+	Mean     [3]float64
+	Variance [3]float64
+
+	// Colorfulness is the colorfulness metric by Hasler and
+	// Süsstrunk, normalized to the [0...1.0] range of samples.
+	// It is 0 for grayscale images, about 0.06 for the slightly
+	// colorful and above 0.3 for highly colorful images.
+	Colorfulness float64
+
+	// ColorCoverage is the fraction of the colored pixels,
+	// in range [0...1.0].
+	ColorCoverage float64
+
+	colored uint64 // Count of colored pixels
+}
+
+// statsMoment accumulates the first and second moments
+// of the value.
+type statsMoment struct {
+	sum, sum2 float64
+}
+
+// NewStatsReader creates a new [StatsReader] on a top of the
+// existent [Reader].
+//
+// Like with the [BlankDetector], the image margins (5% of width
+// and height at each edge) are excluded from analysis.
+func NewStatsReader(in Reader) *StatsReader {
+	wid, hei := in.Size()
+	mx := int(float64(wid) * blankMargin)
+	my := int(float64(hei) * blankMargin)
+
+	return &StatsReader{
+		input:  in,
+		wid:    wid,
+		hei:    hei,
+		left:   mx,
+		right:  wid - mx,
+		top:    my,
+		bottom: hei - my,
+		rgb:    make(RowRGBA32, wid-2*mx),
+	}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (sr *StatsReader) ColorModel() color.Model {
+	return sr.input.ColorModel()
+}
+
+// Size returns the image size.
+func (sr *StatsReader) Size() (wid, hei int) {
+	return sr.wid, sr.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (sr *StatsReader) NewRow() Row {
+	return sr.input.NewRow()
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (sr *StatsReader) Read(row Row) (int, error) {
+	n, err := sr.input.Read(row)
+	if err != nil {
+		return n, err
+	}
+
+	if sr.top <= sr.y && sr.y < sr.bottom &&
+		row.Width() >= sr.right && sr.left < sr.right {
+
+		sr.rgb.Copy(row.Slice(sr.left, sr.right))
+		sr.collect()
+	}
+
+	sr.y++
+	return n, nil
+}
+
+// collect adds the converted row to the statistics.
+func (sr *StatsReader) collect() {
+	stats := &sr.stats
+	chroma := uint8(math.Round(statsChromaLevel * 255))
+
+	for _, c := range sr.rgb {
+		stats.Histogram[0][c.R]++
+		stats.Histogram[1][c.G]++
+		stats.Histogram[2][c.B]++
+
+		y := (19595*uint32(c.R) + 38470*uint32(c.G) +
+			7471*uint32(c.B) + 1<<15) >> 16
+		stats.Luminance[y]++
+
+		lo := min(c.R, c.G, c.B)
+		hi := max(c.R, c.G, c.B)
+		if hi-lo >= chroma {
+			stats.colored++
+		}
+
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		sr.rg.add(r - g)
+		sr.yb.add((r+g)/2 - b)
+	}
+
+	stats.Pixels += uint64(len(sr.rgb))
+}
+
+// Close closes the reader.
+func (sr *StatsReader) Close() {
+	sr.input.Close()
+}
+
+// Stats returns the gathered statistics.
+func (sr *StatsReader) Stats() ImageStats {
+	stats := sr.stats
+	if stats.Pixels == 0 {
+		return stats
+	}
+
+	total := float64(stats.Pixels)
+
+	// Mean and variance of each channel
+	for ch := range stats.Histogram {
+		var m statsMoment
+		for l, cnt := range stats.Histogram[ch] {
+			v := float64(l) / 255
+			m.sum += v * float64(cnt)
+			m.sum2 += v * v * float64(cnt)
+		}
+
+		stats.Mean[ch], stats.Variance[ch] = m.stat(total)
+	}
+
+	// Colorfulness
+	rgMean, rgVar := sr.rg.stat(total)
+	ybMean, ybVar := sr.yb.stat(total)
+
+	stats.Colorfulness = (math.Sqrt(rgVar+ybVar) +
+		0.3*math.Sqrt(rgMean*rgMean+ybMean*ybMean)) / 255
+
+	stats.ColorCoverage = float64(stats.colored) / total
+
+	return stats
+}
+
+// AutoLevels returns the [Levels], that stretch the image
+// luminance range to the full [0...1.0] range.
+//
+// The darkest and the lightest 0.5% of pixels are ignored, so
+// the few noise pixels don't affect the result. Images with the
+// narrow luminance range (like blank pages) are left unchanged.
+func (stats ImageStats) AutoLevels() Levels {
+	clip := uint64(float64(stats.Pixels) * statsAutoLevelsClip)
+
+	black := 0
+	for cnt := uint64(0); black < 255; black++ {
+		cnt += stats.Luminance[black]
+		if cnt > clip {
+			break
+		}
+	}
+
+	white := 255
+	for cnt := uint64(0); white > 0; white-- {
+		cnt += stats.Luminance[white]
+		if cnt > clip {
+			break
+		}
+	}
+
+	lo, hi := float64(black)/255, float64(white)/255
+	if stats.Pixels == 0 || hi-lo < statsAutoLevelsMinRange {
+		return Levels{}
+	}
+
+	return Levels{BlackPoint: lo, WhitePoint: hi}
+}
+
+// add adds the value.
+func (m *statsMoment) add(v float64) {
+	m.sum += v
+	m.sum2 += v * v
+}
+
+// stat returns mean and variance of the values, added to
+// the statsMoment.
+func (m statsMoment) stat(total float64) (mean, variance float64) {
+	mean = m.sum / total
+	variance = math.Max(0, m.sum2/total-mean*mean)
+	return
+}
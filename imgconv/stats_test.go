@@ -0,0 +1,216 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Image statistics test
+
+package imgconv
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestStatsReader tests the image statistics reader
+func TestStatsReader(t *testing.T) {
+	const size = 40
+
+	// Low-contrast horizontal gradient, 64...191
+	gradient := make([][]uint8, size)
+	for y := range gradient {
+		gradient[y] = make([]uint8, size)
+		for x := range gradient[y] {
+			gradient[y][x] = uint8(64 + x*127/(size-1))
+		}
+	}
+
+	// Colorful image: left half is red, right half is blue
+	colorful := make([]Row, size)
+	for y := range colorful {
+		row := make(RowRGBA32, size)
+		for x := range row {
+			row[x] = color.RGBA{R: 200, G: 30, B: 30, A: 255}
+			if x >= size/2 {
+				row[x] = color.RGBA{R: 30, G: 30, B: 200, A: 255}
+			}
+		}
+		colorful[y] = row
+	}
+
+	models := map[string]color.Model{
+		"Gray8":  color.GrayModel,
+		"RGBA32": color.RGBAModel,
+	}
+
+	// Gray image must have no color, regardless of the color model
+	for name, model := range models {
+		in := NewColorModelFilter(
+			newRowsReader(color.GrayModel, testGrayRows(gradient)),
+			model)
+
+		sr := NewStatsReader(in)
+		rows := mustDecodeImageRows(sr)
+
+		// Image must pass unchanged
+		if len(rows) != size || testGrayAt(rows, 20, 20) !=
+			gradient[20][20] {
+			t.Errorf("gradient (%s): image changed", name)
+		}
+
+		stats := sr.Stats()
+
+		// Margins are 2 pixels, so 36x36 pixels are analyzed
+		if stats.Pixels != 36*36 {
+			t.Errorf("gradient (%s): Pixels: "+
+				"expected %d, present %d",
+				name, 36*36, stats.Pixels)
+		}
+
+		if stats.Colorfulness != 0 || stats.ColorCoverage != 0 {
+			t.Errorf("gradient (%s): unexpected color: %g/%g",
+				name, stats.Colorfulness, stats.ColorCoverage)
+		}
+
+		if stats.Mean[0] != stats.Mean[2] ||
+			math.Abs(stats.Mean[1]-127.5/255) > 0.01 {
+			t.Errorf("gradient (%s): unexpected Mean: %v",
+				name, stats.Mean)
+		}
+	}
+
+	// Colorful image
+	sr := NewStatsReader(newRowsReader(color.RGBAModel, colorful))
+	mustDecodeImageRows(sr)
+	stats := sr.Stats()
+
+	if stats.Colorfulness < 0.3 || stats.ColorCoverage != 1 {
+		t.Errorf("colorful: unexpected color: %g/%g",
+			stats.Colorfulness, stats.ColorCoverage)
+	}
+
+	if stats.Histogram[0][200] != stats.Pixels/2 ||
+		stats.Histogram[2][200] != stats.Pixels/2 {
+		t.Errorf("colorful: unexpected Histogram")
+	}
+
+	// Empty image
+	sr = NewStatsReader(newRowsReader(color.GrayModel, nil))
+	if stats := sr.Stats(); stats.Pixels != 0 || stats.Colorfulness != 0 {
+		t.Errorf("empty image: unexpected %+v", stats)
+	}
+}
+
+// TestStatsAutoLevels tests ImageStats.AutoLevels
+func TestStatsAutoLevels(t *testing.T) {
+	const size = 40
+
+	// image returns the size x size image with pixels, computed
+	// by the function
+	image := func(f func(x, y int) uint8) [][]uint8 {
+		pixels := make([][]uint8, size)
+		for y := range pixels {
+			pixels[y] = make([]uint8, size)
+			for x := range pixels[y] {
+				pixels[y][x] = f(x, y)
+			}
+		}
+		return pixels
+	}
+
+	// Low-contrast image gets stretched to the full range
+	gradient := image(func(x, y int) uint8 {
+		return uint8(64 + x*127/(size-1))
+	})
+
+	sr := NewStatsReader(newRowsReader(color.GrayModel,
+		testGrayRows(gradient)))
+	mustDecodeImageRows(sr)
+
+	lv := sr.Stats().AutoLevels()
+	if lv.BlackPoint <= 0 || lv.WhitePoint >= 1 {
+		t.Errorf("gradient: unexpected %+v", lv)
+	}
+
+	rows := mustDecodeImageRows(NewLevels(
+		newRowsReader(color.GrayModel, testGrayRows(gradient)), lv))
+
+	dark, light := testGrayAt(rows, 2, 20), testGrayAt(rows, 37, 20)
+	if dark > 8 || light < 247 {
+		t.Errorf("gradient: range %d...%d after AutoLevels",
+			dark, light)
+	}
+
+	// Dark image, with the whole luminance range below 0.5,
+	// gets stretched to the full range as well
+	darkImage := image(func(x, y int) uint8 {
+		return uint8(16 + x*96/(size-1))
+	})
+
+	sr = NewStatsReader(newRowsReader(color.GrayModel,
+		testGrayRows(darkImage)))
+	mustDecodeImageRows(sr)
+
+	lv = sr.Stats().AutoLevels()
+	rows = mustDecodeImageRows(NewLevels(
+		newRowsReader(color.GrayModel, testGrayRows(darkImage)), lv))
+
+	black, white := testGrayAt(rows, 0, 20), testGrayAt(rows, 39, 20)
+	if black > 8 || white < 247 {
+		t.Errorf("dark: range %d...%d after AutoLevels",
+			black, white)
+	}
+
+	// Nearly blank image is left unchanged, a few noise
+	// pixels don't affect the result
+	blank := image(func(x, y int) uint8 {
+		if x == 20 && y == 20 {
+			return 0
+		}
+		return 240
+	})
+
+	sr = NewStatsReader(newRowsReader(color.GrayModel,
+		testGrayRows(blank)))
+	mustDecodeImageRows(sr)
+
+	if lv := sr.Stats().AutoLevels(); !lv.IsIdentity() {
+		t.Errorf("blank: unexpected %+v", lv)
+	}
+
+	// Empty image
+	if lv := (ImageStats{}).AutoLevels(); !lv.IsIdentity() {
+		t.Errorf("empty image: unexpected %+v", lv)
+	}
+}
+
+// TestImageBuffer tests the in-memory image buffer
+func TestImageBuffer(t *testing.T) {
+	pixels := [][]uint8{
+		{0, 1, 2, 3},
+		{4, 5, 6, 7},
+		{8, 9, 10, 11},
+	}
+
+	buf, err := NewImageBuffer(newRowsReader(color.GrayModel,
+		testGrayRows(pixels)))
+	if err != nil {
+		t.Fatalf("NewImageBuffer: %s", err)
+	}
+
+	rows := mustDecodeImageRows(buf)
+	if len(rows) != len(pixels) {
+		t.Fatalf("%d rows, expected %d", len(rows), len(pixels))
+	}
+
+	for y := range pixels {
+		for x := range pixels[y] {
+			if v := testGrayAt(rows, x, y); v != pixels[y][x] {
+				t.Errorf("(%d,%d): expected %d, present %d",
+					x, y, pixels[y][x], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Black and white threshold filter
+
+package imgconv
+
+import (
+	"image/color"
+)
+
+// threshold implements the black and white threshold filter
+type threshold struct {
+	input Reader     // Image source
+	wid   int        // Image width
+	level uint16     // Threshold level
+	tmp   Row        // Input buffer
+	out   RowBilevel // Output buffer
+}
+
+// NewThreshold creates a new image filter on a top of the existent
+// [Reader].
+//
+// This filter converts image into the black and white, using
+// the fixed threshold level in range [0...1.0]: pixels with the
+// luminance below the level become black, all others become white.
+//
+// The output image uses the [BilevelModel].
+func NewThreshold(in Reader, level float64) Reader {
+	level = levelsClamp(level, 0, 1)
+	wid, _ := in.Size()
+
+	return &threshold{
+		input: in,
+		wid:   wid,
+		level: uint16(level * 0xffff),
+		tmp:   in.NewRow(),
+		out:   NewRowBilevel(wid),
+	}
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (thr *threshold) ColorModel() color.Model {
+	return BilevelModel
+}
+
+// Size returns the image size.
+func (thr *threshold) Size() (wid, hei int) {
+	return thr.input.Size()
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (thr *threshold) NewRow() Row {
+	return NewRowBilevel(thr.wid)
+}
+
+// Read returns the next image [Row].
+// It returns the resulting row length, in pixels, or an error.
+func (thr *threshold) Read(row Row) (int, error) {
+	n, err := thr.input.Read(thr.tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	switch tmp := thr.tmp.(type) {
+	case RowGray8:
+		for x := range tmp {
+			y := uint16(tmp[x].Y) * 0x101
+			thr.out.SetBit(x, y >= thr.level)
+		}
+
+	case RowGray16:
+		for x := range tmp {
+			thr.out.SetBit(x, tmp[x].Y >= thr.level)
+		}
+
+	default:
+		for x := 0; x < thr.wid; x++ {
+			c := color.Gray16Model.Convert(tmp.At(x)).(color.Gray16)
+			thr.out.SetBit(x, c.Y >= thr.level)
+		}
+	}
+
+	row.Copy(thr.out)
+	return n, nil
+}
+
+// Close closes the reader.
+func (thr *threshold) Close() {
+	thr.input.Close()
+}
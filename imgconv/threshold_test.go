@@ -0,0 +1,75 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Black and white threshold filter test
+
+package imgconv
+
+import (
+	"image/color"
+	"testing"
+)
+
+// TestThreshold tests the threshold filter
+func TestThreshold(t *testing.T) {
+	type testData struct {
+		level float64 // Threshold level
+		in    []uint8 // Input pixels
+		out   []uint8 // Expected output pixels
+	}
+
+	tests := []testData{
+		{
+			level: 0.5,
+			in:    []uint8{0, 100, 127, 128, 200, 255},
+			out:   []uint8{0, 0, 0, 255, 255, 255},
+		},
+		{
+			level: 0,
+			in:    []uint8{0, 100, 255},
+			out:   []uint8{255, 255, 255},
+		},
+		{
+			level: 1,
+			in:    []uint8{0, 100, 254, 255},
+			out:   []uint8{0, 0, 0, 255},
+		},
+	}
+
+	for _, test := range tests {
+		// Test Gray8, Gray16 and RGBA inputs
+		models := map[string]color.Model{
+			"Gray8":  color.GrayModel,
+			"Gray16": color.Gray16Model,
+			"RGBA32": color.RGBAModel,
+		}
+
+		for name, model := range models {
+			in := NewColorModelFilter(
+				newRowsReader(color.GrayModel,
+					testGrayRows([][]uint8{test.in})),
+				model)
+
+			filter := NewThreshold(in, test.level)
+			if filter.ColorModel() != BilevelModel {
+				t.Errorf("%s: NewThreshold(%g): invalid color model",
+					name, test.level)
+			}
+
+			rows := mustDecodeImageRows(filter)
+			for x, expected := range test.out {
+				present := testGrayAt(rows, x, 0)
+				if present != expected {
+					t.Errorf("%s: NewThreshold(%g): pixel %d (%d):\n"+
+						"expected: %d\n"+
+						"present:  %d",
+						name, test.level, x, test.in[x],
+						expected, present)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,1232 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// TIFF Reader and Writer
+
+package imgconv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/OpenPrinting/go-mfp/util/generic"
+	"golang.org/x/image/ccitt"
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF tags
+const (
+	tiffTagNewSubfileType  = 254
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagFillOrder       = 266
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagXResolution     = 282
+	tiffTagYResolution     = 283
+	tiffTagPlanarConfig    = 284
+	tiffTagResolutionUnit  = 296
+	tiffTagPredictor       = 317
+	tiffTagColorMap        = 320
+	tiffTagTileWidth       = 322
+	tiffTagExtraSamples    = 338
+	tiffTagICCProfile      = 34675
+)
+
+// tiffMaxSamples is the maximal samples per pixel, accepted
+// by the TIFF decoder.
+const tiffMaxSamples = 8
+
+// TIFF field types
+const (
+	tiffTypeByte      = 1
+	tiffTypeShort     = 3
+	tiffTypeLong      = 4
+	tiffTypeRational  = 5
+	tiffTypeUndefined = 7
+)
+
+// TIFF compression methods
+const (
+	tiffCompressionNone       = 1
+	tiffCompressionG4         = 4
+	tiffCompressionLZW        = 5
+	tiffCompressionDeflate    = 8
+	tiffCompressionPackBits   = 32773
+	tiffCompressionDeflateOld = 32946
+)
+
+// TIFF photometric interpretations
+const (
+	tiffPhotometricWhiteIsZero = 0
+	tiffPhotometricBlackIsZero = 1
+	tiffPhotometricRGB         = 2
+	tiffPhotometricPalette     = 3
+)
+
+// tiffIFD contains the parsed TIFF Image File Directory.
+//
+// Values of all integer types are converted to uint32.
+// Each RATIONAL value is represented by two consecutive
+// uint32 values (numerator and denominator).
+type tiffIFD map[uint16][]uint32
+
+// tiffParseIFD parses the IFD at the specified offset.
+// It returns the parsed IFD and offset of the next IFD.
+func tiffParseIFD(data []byte, order binary.ByteOrder,
+	off uint32) (tiffIFD, uint32, error) {
+
+	errInvalid := errors.New("TIFF: invalid IFD")
+
+	if uint64(off)+2 > uint64(len(data)) {
+		return nil, 0, errInvalid
+	}
+
+	cnt := int(order.Uint16(data[off:]))
+	end := uint64(off) + 2 + uint64(cnt)*12
+	if end+4 > uint64(len(data)) {
+		return nil, 0, errInvalid
+	}
+
+	ifd := make(tiffIFD)
+	for i := 0; i < cnt; i++ {
+		ent := data[int(off)+2+i*12:]
+		tag := order.Uint16(ent)
+		typ := order.Uint16(ent[2:])
+		count := uint64(order.Uint32(ent[4:]))
+
+		var size uint64
+		switch typ {
+		case tiffTypeByte, tiffTypeUndefined:
+			size = 1
+		case tiffTypeShort:
+			size = 2
+		case tiffTypeLong:
+			size = 4
+		case tiffTypeRational:
+			size = 8
+		default:
+			// Other types are not used by the reader
+			continue
+		}
+
+		val := ent[8:12]
+		if count*size > 4 {
+			valoff := uint64(order.Uint32(ent[8:]))
+			if valoff+count*size > uint64(len(data)) {
+				return nil, 0, errInvalid
+			}
+			val = data[valoff : valoff+count*size]
+		}
+
+		var values []uint32
+		for j := uint64(0); j < count; j++ {
+			switch typ {
+			case tiffTypeByte, tiffTypeUndefined:
+				values = append(values, uint32(val[j]))
+			case tiffTypeShort:
+				values = append(values,
+					uint32(order.Uint16(val[j*2:])))
+			case tiffTypeLong:
+				values = append(values, order.Uint32(val[j*4:]))
+			case tiffTypeRational:
+				values = append(values,
+					order.Uint32(val[j*8:]),
+					order.Uint32(val[j*8+4:]))
+			}
+		}
+
+		ifd[tag] = values
+	}
+
+	return ifd, order.Uint32(data[end:]), nil
+}
+
+// get returns the first value of the tag or dflt, if tag is missed.
+func (ifd tiffIFD) get(tag uint16, dflt uint32) uint32 {
+	if values := ifd[tag]; len(values) > 0 {
+		return values[0]
+	}
+	return dflt
+}
+
+// meta returns the image metadata, contained in the IFD.
+func (ifd tiffIFD) meta() ImageMeta {
+	var meta ImageMeta
+
+	// Resolution is RATIONAL, 2 uint32 values per resolution.
+	// ResolutionUnit is 2 for inch (default), 3 for centimeter.
+	xres, yres := ifd[tiffTagXResolution], ifd[tiffTagYResolution]
+	if len(xres) == 2 && len(yres) == 2 && xres[1] != 0 && yres[1] != 0 {
+		scale := 0.0
+		switch ifd.get(tiffTagResolutionUnit, 2) {
+		case 2:
+			scale = 1
+		case 3:
+			scale = 2.54
+		}
+
+		x := float64(xres[0]) / float64(xres[1])
+		y := float64(yres[0]) / float64(yres[1])
+
+		meta.XResolution = int(math.Round(x * scale))
+		meta.YResolution = int(math.Round(y * scale))
+	}
+
+	if values := ifd[tiffTagICCProfile]; len(values) != 0 {
+		meta.ICCProfile = make([]byte, len(values))
+		for i, v := range values {
+			meta.ICCProfile[i] = byte(v)
+		}
+	}
+
+	return meta
+}
+
+// tiffReader implements the [Decoder] interface for reading TIFF images.
+type tiffReader struct {
+	data         []byte           // The whole TIFF file
+	order        binary.ByteOrder // File byte order
+	wid, hei     int              // Image size
+	model        color.Model      // Image color model
+	bps, spp     int              // Bits per sample, samples per pixel
+	photometric  uint32           // Photometric interpretation
+	compression  uint32           // Compression method
+	predictor    uint32           // Predictor
+	fillOrder    uint32           // Fill order (for CCITT)
+	palette      []byte           // Palette, as R-G-B triplets
+	stripOffsets []uint32         // Strip offsets
+	stripCounts  []uint32         // Strip byte counts
+	rowsPerStrip int              // Rows per strip
+	meta         ImageMeta        // Image metadata
+	strip        io.Reader        // Current strip decoder
+	stripCloser  io.Closer        // Strip decoder closer, if any
+	rawBytes     []byte           // Raw row, as stored in file
+	rowBytes     []byte           // Row, converted for decoding
+	y            int              // Current y-coordinate
+	err          error            // Sticky error
+}
+
+// NewTIFFReader creates a new [Decoder] for TIFF images.
+//
+// TIFF is the random-access format, so the whole input is
+// loaded into memory. However, the image decoding is performed
+// on demand, strip by strip.
+//
+// Only the first image (page) of the multi-page TIFF is decoded.
+// Use [TIFFDocumentReader] to decode all pages.
+//
+// Supported are baseline TIFF images (bilevel, grayscale, palette
+// and RGB), stored in strips with the contiguous planar configuration.
+// Supported compression methods are none, PackBits, LZW, Deflate
+// and, for bilevel images, CCITT Group 4.
+func NewTIFFReader(input io.Reader) (Decoder, error) {
+	doc, err := NewTIFFDocumentReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.NextPage()
+}
+
+// TIFFDocumentReader reads the multi-page TIFF document.
+//
+// TIFF is the random-access format, so the whole input is
+// loaded into memory. However, the image decoding is performed
+// on demand, strip by strip.
+type TIFFDocumentReader struct {
+	data  []byte           // The whole TIFF file
+	order binary.ByteOrder // File byte order
+	ifds  []uint32         // Offsets of IFDs, one per page
+	next  int              // Index of the next page
+}
+
+// NewTIFFDocumentReader creates a new [TIFFDocumentReader].
+// It loads the whole input and walks the chain of image
+// directories, but doesn't decode the images.
+//
+// See [NewTIFFReader] for the list of supported image formats.
+func NewTIFFDocumentReader(input io.Reader) (*TIFFDocumentReader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the header
+	if len(data) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var order binary.ByteOrder
+	switch string(data[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("TIFF: invalid header")
+	}
+
+	if order.Uint16(data[2:]) != 42 {
+		return nil, errors.New("TIFF: invalid header")
+	}
+
+	// Walk the IFD chain. The chain may be looped in the broken
+	// files, so the already seen offsets are tracked.
+	doc := &TIFFDocumentReader{data: data, order: order}
+	seen := make(map[uint32]struct{})
+
+	for off := order.Uint32(data[4:]); off != 0; {
+		if _, found := seen[off]; found {
+			return nil, errors.New("TIFF: looped IFD chain")
+		}
+		seen[off] = struct{}{}
+
+		_, next, err := tiffParseIFD(data, order, off)
+		if err != nil {
+			return nil, err
+		}
+
+		doc.ifds = append(doc.ifds, off)
+		off = next
+	}
+
+	if len(doc.ifds) == 0 {
+		return nil, errors.New("TIFF: no images")
+	}
+
+	return doc, nil
+}
+
+// Pages returns count of pages in the document.
+func (doc *TIFFDocumentReader) Pages() int {
+	return len(doc.ifds)
+}
+
+// NextPage returns the [Decoder] for the next page of the document.
+// At the end of document it returns [io.EOF].
+//
+// Pages are independent of each other, and previously returned
+// decoders remain valid.
+func (doc *TIFFDocumentReader) NextPage() (Decoder, error) {
+	if doc.next >= len(doc.ifds) {
+		return nil, io.EOF
+	}
+
+	off := doc.ifds[doc.next]
+	doc.next++
+
+	ifd, _, err := tiffParseIFD(doc.data, doc.order, off)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTIFFReader(doc.data, doc.order, ifd)
+}
+
+// newTIFFReader creates a new tiffReader for the image, described
+// by the IFD.
+func newTIFFReader(data []byte, order binary.ByteOrder,
+	ifd tiffIFD) (*tiffReader, error) {
+
+	// Create the reader
+	reader := &tiffReader{
+		data:         data,
+		order:        order,
+		wid:          int(ifd.get(tiffTagImageWidth, 0)),
+		hei:          int(ifd.get(tiffTagImageLength, 0)),
+		spp:          int(ifd.get(tiffTagSamplesPerPixel, 1)),
+		bps:          int(ifd.get(tiffTagBitsPerSample, 1)),
+		compression:  ifd.get(tiffTagCompression, tiffCompressionNone),
+		predictor:    ifd.get(tiffTagPredictor, 1),
+		fillOrder:    ifd.get(tiffTagFillOrder, 1),
+		stripOffsets: ifd[tiffTagStripOffsets],
+		stripCounts:  ifd[tiffTagStripByteCounts],
+	}
+
+	dfltPhotometric := uint32(tiffPhotometricBlackIsZero)
+	if reader.compression == tiffCompressionG4 {
+		dfltPhotometric = tiffPhotometricWhiteIsZero
+	}
+	reader.photometric = ifd.get(tiffTagPhotometric, dfltPhotometric)
+
+	rps := ifd.get(tiffTagRowsPerStrip, uint32(reader.hei))
+	if rps == 0 || rps > uint32(reader.hei) {
+		rps = uint32(reader.hei)
+	}
+	reader.rowsPerStrip = int(rps)
+
+	reader.meta = ifd.meta()
+
+	// Validate parameters
+	err := reader.validate(ifd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allocate buffers
+	bits := int64(reader.wid) * int64(reader.spp) * int64(reader.bps)
+	bytesPerRow := (bits + 7) / 8
+	if bytesPerRow > math.MaxInt32 {
+		return nil, errors.New("TIFF: image too large")
+	}
+
+	reader.rawBytes = make([]byte, bytesPerRow)
+
+	switch reader.model {
+	case color.GrayModel:
+		reader.rowBytes = make([]byte, reader.wid)
+	case color.Gray16Model:
+		reader.rowBytes = make([]byte, reader.wid*2)
+	case color.RGBAModel:
+		reader.rowBytes = make([]byte, reader.wid*3)
+	case color.RGBA64Model:
+		reader.rowBytes = make([]byte, reader.wid*6)
+	}
+
+	return reader, nil
+}
+
+// validate checks image parameters and chooses the color model.
+func (reader *tiffReader) validate(ifd tiffIFD) error {
+	if reader.wid <= 0 || reader.hei <= 0 || reader.spp <= 0 ||
+		reader.rowsPerStrip <= 0 {
+		return errors.New("TIFF: invalid image parameters")
+	}
+
+	if reader.wid > rasterMaxSize || reader.hei > rasterMaxSize ||
+		reader.spp > tiffMaxSamples {
+		return errors.New("TIFF: image too large")
+	}
+
+	if _, found := ifd[tiffTagTileWidth]; found {
+		return errors.New("TIFF: tiled images not supported")
+	}
+
+	if ifd.get(tiffTagPlanarConfig, 1) != 1 {
+		return errors.New("TIFF: planar images not supported")
+	}
+
+	for _, bps := range ifd[tiffTagBitsPerSample] {
+		if int(bps) != reader.bps {
+			return errors.New("TIFF: mixed sample sizes not supported")
+		}
+	}
+
+	// Choose color model. Grayscale image may only have a single
+	// extra sample (i.e., alpha), which is ignored
+	bps, spp := reader.bps, reader.spp
+	gray := spp == 1 ||
+		(spp == 2 && len(ifd[tiffTagExtraSamples]) == 1)
+
+	switch reader.photometric {
+	case tiffPhotometricWhiteIsZero, tiffPhotometricBlackIsZero:
+		switch {
+		case !gray:
+		case bps == 1 && spp == 1:
+			reader.model = BilevelModel
+		case bps == 2 || bps == 4 || bps == 8:
+			reader.model = color.GrayModel
+		case bps == 16:
+			reader.model = color.Gray16Model
+		}
+
+	case tiffPhotometricRGB:
+		switch {
+		case spp < 3:
+		case bps == 8:
+			reader.model = color.RGBAModel
+		case bps == 16:
+			reader.model = color.RGBA64Model
+		}
+
+	case tiffPhotometricPalette:
+		cmap := ifd[tiffTagColorMap]
+		if spp == 1 && bps <= 8 && len(cmap) == 3<<bps {
+			reader.model = color.RGBAModel
+
+			n := 1 << bps
+			reader.palette = make([]byte, n*3)
+			for i := 0; i < n; i++ {
+				reader.palette[i*3] = uint8(cmap[i] >> 8)
+				reader.palette[i*3+1] = uint8(cmap[n+i] >> 8)
+				reader.palette[i*3+2] = uint8(cmap[2*n+i] >> 8)
+			}
+		}
+	}
+
+	if reader.model == nil {
+		return fmt.Errorf("TIFF: unsupported image type "+
+			"(photometric=%d, bps=%d, spp=%d)",
+			reader.photometric, bps, spp)
+	}
+
+	// Check compression and predictor
+	switch reader.compression {
+	case tiffCompressionNone, tiffCompressionPackBits,
+		tiffCompressionLZW,
+		tiffCompressionDeflate, tiffCompressionDeflateOld:
+	case tiffCompressionG4:
+		if reader.model != BilevelModel {
+			return errors.New("TIFF: CCITT G4 requires bilevel image")
+		}
+	default:
+		return fmt.Errorf("TIFF: unsupported compression %d",
+			reader.compression)
+	}
+
+	switch {
+	case reader.predictor == 1:
+	case reader.predictor == 2 && (bps == 8 || bps == 16):
+	default:
+		return fmt.Errorf("TIFF: unsupported predictor %d",
+			reader.predictor)
+	}
+
+	// Check strips
+	strips := (reader.hei + reader.rowsPerStrip - 1) / reader.rowsPerStrip
+	if len(reader.stripOffsets) < strips ||
+		len(reader.stripCounts) < strips {
+		return errors.New("TIFF: missed strips")
+	}
+
+	return nil
+}
+
+// MIMEType returns the MIME type of the image being decoded.
+func (*tiffReader) MIMEType() string {
+	return MIMETypeTIFF
+}
+
+// Meta returns the image metadata.
+func (reader *tiffReader) Meta() ImageMeta {
+	return reader.meta
+}
+
+// Close closes the reader.
+func (reader *tiffReader) Close() {
+	reader.closeStrip()
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (reader *tiffReader) ColorModel() color.Model {
+	return reader.model
+}
+
+// Size returns the image size.
+func (reader *tiffReader) Size() (wid, hei int) {
+	return reader.wid, reader.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (reader *tiffReader) NewRow() Row {
+	return NewRow(reader.model, reader.wid)
+}
+
+// Read returns the next image [Row].
+func (reader *tiffReader) Read(row Row) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+
+	// Open the next strip, if needed
+	if reader.y%reader.rowsPerStrip == 0 {
+		err := reader.openStrip(reader.y / reader.rowsPerStrip)
+		if err != nil {
+			reader.setError(err)
+			return 0, err
+		}
+	}
+
+	// Read the next row
+	_, err := io.ReadFull(reader.strip, reader.rawBytes)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		} else if err != io.ErrUnexpectedEOF {
+			err = fmt.Errorf("TIFF: %w", err)
+		}
+		reader.setError(err)
+		return 0, err
+	}
+
+	// Decode the row
+	wid := generic.Min(row.Width(), reader.wid)
+	reader.decodeRow(row)
+
+	// Update current y
+	reader.y++
+	if reader.y == reader.hei {
+		reader.setError(io.EOF)
+	}
+
+	return wid, nil
+}
+
+// setError sets the reader.err, if it is not set yet
+func (reader *tiffReader) setError(err error) {
+	if reader.err == nil {
+		reader.err = err
+	}
+}
+
+// openStrip opens the decoder for the strip with the specified index.
+func (reader *tiffReader) openStrip(strip int) error {
+	reader.closeStrip()
+
+	off := uint64(reader.stripOffsets[strip])
+	end := off + uint64(reader.stripCounts[strip])
+	if end > uint64(len(reader.data)) {
+		return io.ErrUnexpectedEOF
+	}
+
+	rows := generic.Min(reader.rowsPerStrip, reader.hei-reader.y)
+	input := bytes.NewReader(reader.data[off:end])
+
+	switch reader.compression {
+	case tiffCompressionNone:
+		reader.strip = input
+
+	case tiffCompressionPackBits:
+		reader.strip = &tiffPackBitsReader{input: input}
+
+	case tiffCompressionLZW:
+		r := lzw.NewReader(input, lzw.MSB, 8)
+		reader.strip, reader.stripCloser = r, r
+
+	case tiffCompressionDeflate, tiffCompressionDeflateOld:
+		r, err := zlib.NewReader(input)
+		if err != nil {
+			return fmt.Errorf("TIFF: %w", err)
+		}
+		reader.strip, reader.stripCloser = r, r
+
+	case tiffCompressionG4:
+		order := ccitt.MSB
+		if reader.fillOrder == 2 {
+			order = ccitt.LSB
+		}
+
+		// Output bits follow the photometric interpretation,
+		// the same way as for the uncompressed images.
+		opts := &ccitt.Options{
+			Invert: reader.photometric == tiffPhotometricWhiteIsZero,
+		}
+
+		reader.strip = ccitt.NewReader(input, order, ccitt.Group4,
+			reader.wid, rows, opts)
+	}
+
+	return nil
+}
+
+// closeStrip closes the current strip decoder.
+func (reader *tiffReader) closeStrip() {
+	if reader.stripCloser != nil {
+		reader.stripCloser.Close()
+		reader.stripCloser = nil
+	}
+	reader.strip = nil
+}
+
+// decodeRow decodes the raw row into the Row.
+func (reader *tiffReader) decodeRow(row Row) {
+	raw := reader.rawBytes
+
+	// Convert 16-bit samples into big endian
+	if reader.bps == 16 && reader.order == binary.LittleEndian {
+		for i := 0; i+1 < len(raw); i += 2 {
+			raw[i], raw[i+1] = raw[i+1], raw[i]
+		}
+	}
+
+	// Undo horizontal differencing
+	if reader.predictor == 2 {
+		n := reader.wid * reader.spp
+		switch reader.bps {
+		case 8:
+			for i := reader.spp; i < n; i++ {
+				raw[i] += raw[i-reader.spp]
+			}
+		case 16:
+			for i := reader.spp; i < n; i++ {
+				v := binary.BigEndian.Uint16(raw[i*2:]) +
+					binary.BigEndian.Uint16(raw[(i-reader.spp)*2:])
+				binary.BigEndian.PutUint16(raw[i*2:], v)
+			}
+		}
+	}
+
+	// Convert WhiteIsZero into BlackIsZero
+	if reader.photometric == tiffPhotometricWhiteIsZero {
+		for i := range raw {
+			raw[i] = ^raw[i]
+		}
+	}
+
+	// Decode the row
+	switch {
+	case reader.model == BilevelModel:
+		row.Copy(RowBilevel{bits: raw, wid: reader.wid})
+
+	case reader.palette != nil:
+		for x := 0; x < reader.wid; x++ {
+			i := int(bytesPackedSample(raw, x, reader.bps)) * 3
+			copy(reader.rowBytes[x*3:x*3+3], reader.palette[i:i+3])
+		}
+		bytesRGB8toRow(row, reader.rowBytes)
+
+	case reader.model == color.GrayModel:
+		if reader.bps == 8 && reader.spp == 1 {
+			bytesGray8toRow(row, raw)
+			break
+		}
+
+		max := uint32(1)<<reader.bps - 1
+		for x := 0; x < reader.wid; x++ {
+			v := uint32(bytesPackedSample(raw, x*reader.spp, reader.bps))
+			reader.rowBytes[x] = uint8(v * 255 / max)
+		}
+		bytesGray8toRow(row, reader.rowBytes)
+
+	case reader.model == color.Gray16Model:
+		tiffPack(reader.rowBytes, raw, reader.wid, reader.spp, 1, 2)
+		bytesGray16BEtoRow(row, reader.rowBytes)
+
+	case reader.model == color.RGBAModel:
+		tiffPack(reader.rowBytes, raw, reader.wid, reader.spp, 3, 1)
+		bytesRGB8toRow(row, reader.rowBytes)
+
+	case reader.model == color.RGBA64Model:
+		tiffPack(reader.rowBytes, raw, reader.wid, reader.spp, 3, 2)
+		bytesRGB16BEtoRow(row, reader.rowBytes)
+	}
+}
+
+// tiffPack copies first n samples of each of wid pixels from src
+// into dst. Pixels in src contain spp samples of size bytes each.
+// Extra samples (alpha and so on) are dropped.
+func tiffPack(dst, src []byte, wid, spp, n, size int) {
+	if spp == n {
+		copy(dst, src)
+		return
+	}
+
+	for x := 0; x < wid; x++ {
+		copy(dst[x*n*size:(x+1)*n*size], src[x*spp*size:])
+	}
+}
+
+// tiffPackBitsReader decodes the PackBits compression.
+type tiffPackBitsReader struct {
+	input *bytes.Reader // Compressed input
+	cnt   int           // Bytes remaining in the current run
+	rep   bool          // Current run is the repeat run
+	val   byte          // Value to repeat
+}
+
+// Read decodes the PackBits data.
+// It implements the [io.Reader] interface.
+func (pb *tiffPackBitsReader) Read(buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		// Start the next run
+		if pb.cnt == 0 {
+			hdr, err := pb.input.ReadByte()
+			if err != nil {
+				if n > 0 {
+					return n, nil
+				}
+				return 0, err
+			}
+
+			switch {
+			case hdr < 128:
+				pb.cnt, pb.rep = int(hdr)+1, false
+			case hdr > 128:
+				pb.val, err = pb.input.ReadByte()
+				if err != nil {
+					return n, io.ErrUnexpectedEOF
+				}
+				pb.cnt, pb.rep = 257-int(hdr), true
+			}
+
+			continue
+		}
+
+		// Copy the run
+		if pb.rep {
+			buf[n] = pb.val
+		} else {
+			c, err := pb.input.ReadByte()
+			if err != nil {
+				return n, io.ErrUnexpectedEOF
+			}
+			buf[n] = c
+		}
+
+		n++
+		pb.cnt--
+	}
+
+	return n, nil
+}
+
+// TIFFDocumentWriter writes the multi-page TIFF documents.
+//
+// Images are compressed using the Deflate compression, split into
+// strips of approximately 64K of uncompressed data each. The 1-bit
+// bilevel images are written as such, which makes the output compact
+// for the black and white documents.
+//
+// TIFF requires the offset of each image directory to be written
+// before the directory itself, and the last page of the document
+// is only known when the document is closed. So TIFFDocumentWriter
+// keeps one page, in the compressed form, in memory, until the
+// next page is started or the document is closed.
+type TIFFDocumentWriter struct {
+	output  io.Writer // Underlying io.Writer
+	off     int64     // Current output offset
+	page    *tiffPage // Current page, nil if none
+	pending *tiffPage // Completed but not yet written page
+	pages   int       // Count of pages
+	closed  bool      // Writer is closed
+	err     error     // Sticky error
+}
+
+// tiffPage implements the [Writer] interface for the single
+// page of the TIFFDocumentWriter.
+type tiffPage struct {
+	tiff         *TIFFDocumentWriter // Back link to TIFFDocumentWriter
+	wid, hei     int                 // Image size
+	model        color.Model         // Color model
+	xres, yres   int                 // Image resolution, DPI
+	bps, spp     int                 // Bits per sample, samples per pixel
+	photometric  uint16              // Photometric interpretation
+	rowsPerStrip int                 // Rows per strip
+	strips       bytes.Buffer        // Compressed strips
+	stripStart   int                 // Start of the current strip
+	stripCounts  []uint32            // Strip byte counts
+	zw           *zlib.Writer        // Compressor
+	rowBytes     []byte              // Row encoding buffer
+	y            int                 // Current y-coordinate
+}
+
+// tiffEntry represents the IFD entry being written.
+type tiffEntry struct {
+	tag   uint16 // Tag
+	typ   uint16 // Field type
+	count int    // Count of values
+	data  []byte // Encoded values
+}
+
+// NewTIFFDocumentWriter creates a new [TIFFDocumentWriter].
+//
+// The TIFFDocumentWriter needs to be explicitly closed after use,
+// to write the last page.
+func NewTIFFDocumentWriter(output io.Writer) *TIFFDocumentWriter {
+	return &TIFFDocumentWriter{output: output}
+}
+
+// NewPage starts a new page and returns the [Writer] for the page
+// image.
+//
+// The page is finished when the returned Writer is closed.
+// Only one page may be written at a time.
+//
+// xres and yres specify the image resolution, in DPI. If resolution
+// is not known, zero may be passed, which is the same as 72 DPI.
+//
+// Supported color models are following:
+//   - BilevelModel (1-bit grayscale)
+//   - color.GrayModel
+//   - color.Gray16Model
+//   - color.RGBAModel
+//   - color.RGBA64Model
+func (tiff *TIFFDocumentWriter) NewPage(wid, hei int, model color.Model,
+	xres, yres int) (Writer, error) {
+
+	page := &tiffPage{
+		tiff:        tiff,
+		wid:         wid,
+		hei:         hei,
+		model:       model,
+		xres:        xres,
+		yres:        yres,
+		photometric: tiffPhotometricBlackIsZero,
+	}
+
+	switch model {
+	case BilevelModel:
+		page.bps, page.spp = 1, 1
+	case color.GrayModel:
+		page.bps, page.spp = 8, 1
+	case color.Gray16Model:
+		page.bps, page.spp = 16, 1
+	case color.RGBAModel:
+		page.bps, page.spp = 8, 3
+		page.photometric = tiffPhotometricRGB
+	case color.RGBA64Model:
+		page.bps, page.spp = 16, 3
+		page.photometric = tiffPhotometricRGB
+	default:
+		return nil, errors.New("TIFF: unsupported color model")
+	}
+
+	if wid <= 0 || hei <= 0 {
+		return nil, errors.New("TIFF: invalid image size")
+	}
+
+	switch {
+	case tiff.closed:
+		return nil, errors.New("TIFF: writer is closed")
+	case tiff.page != nil:
+		return nil, errors.New("TIFF: previous page is not closed")
+	case tiff.err != nil:
+		return nil, tiff.err
+	}
+
+	// Now we know that the pending page is not the last one.
+	if tiff.pending != nil {
+		tiff.flush(tiff.pending, true)
+		tiff.pending = nil
+
+		if tiff.err != nil {
+			return nil, tiff.err
+		}
+	}
+
+	bytesPerRow := (wid*page.spp*page.bps + 7) / 8
+	page.rowBytes = make([]byte, bytesPerRow)
+	page.rowsPerStrip = generic.Max(1, 65536/bytesPerRow)
+	page.zw = zlib.NewWriter(&page.strips)
+
+	tiff.page = page
+	return page, nil
+}
+
+// Close finishes the current page, if any, writes the last
+// page and closes the TIFFDocumentWriter.
+//
+// It doesn't close the underlying [io.Writer].
+func (tiff *TIFFDocumentWriter) Close() error {
+	if tiff.closed {
+		return tiff.err
+	}
+
+	if tiff.page != nil {
+		tiff.page.Close()
+	}
+
+	tiff.closed = true
+
+	switch {
+	case tiff.pending != nil:
+		tiff.flush(tiff.pending, false)
+		tiff.pending = nil
+	case tiff.pages == 0 && tiff.err == nil:
+		tiff.err = errors.New("TIFF: document has no pages")
+	}
+
+	return tiff.err
+}
+
+// flush writes the page. If more is true, the page is not
+// the last one.
+//
+// Each page is written as the IFD, followed by the IFD values
+// that don't fit the IFD entries, followed by the image data.
+func (tiff *TIFFDocumentWriter) flush(page *tiffPage, more bool) {
+	order := binary.BigEndian
+
+	// Write the header before the first page
+	if tiff.off == 0 {
+		tiff.write([]byte{'M', 'M', 0, 42, 0, 0, 0, 8})
+	}
+
+	// Prepare IFD entries
+	u16 := func(v ...int) []byte {
+		data := make([]byte, len(v)*2)
+		for i := range v {
+			order.PutUint16(data[i*2:], uint16(v[i]))
+		}
+		return data
+	}
+
+	u32 := func(v ...uint32) []byte {
+		data := make([]byte, len(v)*4)
+		for i := range v {
+			order.PutUint32(data[i*4:], v[i])
+		}
+		return data
+	}
+
+	xres, yres := page.xres, page.yres
+	if xres <= 0 {
+		xres = 72
+	}
+	if yres <= 0 {
+		yres = 72
+	}
+
+	bps := make([]int, page.spp)
+	for i := range bps {
+		bps[i] = page.bps
+	}
+
+	// Data goes after IFD. Strip offsets will be fixed later.
+	nstrips := len(page.stripCounts)
+	stripOffsets := make([]uint32, nstrips)
+
+	entries := []tiffEntry{
+		{tiffTagNewSubfileType, tiffTypeLong, 1, u32(0)},
+		{tiffTagImageWidth, tiffTypeLong, 1, u32(uint32(page.wid))},
+		{tiffTagImageLength, tiffTypeLong, 1, u32(uint32(page.hei))},
+		{tiffTagBitsPerSample, tiffTypeShort, page.spp, u16(bps...)},
+		{tiffTagCompression, tiffTypeShort, 1,
+			u16(tiffCompressionDeflate)},
+		{tiffTagPhotometric, tiffTypeShort, 1,
+			u16(int(page.photometric))},
+		{tiffTagStripOffsets, tiffTypeLong, nstrips, nil},
+		{tiffTagSamplesPerPixel, tiffTypeShort, 1, u16(page.spp)},
+		{tiffTagRowsPerStrip, tiffTypeLong, 1,
+			u32(uint32(page.rowsPerStrip))},
+		{tiffTagStripByteCounts, tiffTypeLong, nstrips,
+			u32(page.stripCounts...)},
+		{tiffTagXResolution, tiffTypeRational, 1, u32(uint32(xres), 1)},
+		{tiffTagYResolution, tiffTypeRational, 1, u32(uint32(yres), 1)},
+		{tiffTagResolutionUnit, tiffTypeShort, 1, u16(2)},
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].tag < entries[j].tag
+	})
+
+	// Compute layout
+	ifdOff := tiff.off
+	ifdSize := int64(2 + len(entries)*12 + 4)
+
+	extSize := int64(0)
+	for _, ent := range entries {
+		if size := ent.count * 4; ent.tag == tiffTagStripOffsets {
+			if size > 4 {
+				extSize += int64(size)
+			}
+		} else if len(ent.data) > 4 {
+			extSize += int64(len(ent.data))
+		}
+	}
+
+	dataOff := ifdOff + ifdSize + extSize
+	dataSize := int64(page.strips.Len())
+
+	off := uint32(dataOff)
+	for i, cnt := range page.stripCounts {
+		stripOffsets[i] = off
+		off += cnt
+	}
+
+	for i := range entries {
+		if entries[i].tag == tiffTagStripOffsets {
+			entries[i].data = u32(stripOffsets...)
+		}
+	}
+
+	// Keep IFD offsets at the word boundary
+	pad := dataSize & 1
+	next := uint32(0)
+	if more {
+		next = uint32(dataOff + dataSize + pad)
+	}
+
+	// Encode IFD and external values
+	var ifd, ext bytes.Buffer
+	extOff := uint32(ifdOff + ifdSize)
+
+	ifd.Write(u16(len(entries)))
+	for _, ent := range entries {
+		ifd.Write(u16(int(ent.tag), int(ent.typ)))
+		ifd.Write(u32(uint32(ent.count)))
+
+		if len(ent.data) <= 4 {
+			var val [4]byte
+			copy(val[:], ent.data)
+			ifd.Write(val[:])
+		} else {
+			ifd.Write(u32(extOff + uint32(ext.Len())))
+			ext.Write(ent.data)
+		}
+	}
+	ifd.Write(u32(next))
+
+	// Write everything
+	tiff.write(ifd.Bytes())
+	tiff.write(ext.Bytes())
+	tiff.write(page.strips.Bytes())
+	if pad != 0 {
+		tiff.write([]byte{0})
+	}
+}
+
+// write writes data to the output.
+func (tiff *TIFFDocumentWriter) write(data []byte) {
+	if tiff.err == nil {
+		var n int
+		n, tiff.err = tiff.output.Write(data)
+		tiff.off += int64(n)
+	}
+}
+
+// ColorModel returns the [color.Model] of image being written.
+func (page *tiffPage) ColorModel() color.Model {
+	return page.model
+}
+
+// Size returns the image size.
+func (page *tiffPage) Size() (wid, hei int) {
+	return page.wid, page.hei
+}
+
+// Write writes the next image [Row].
+func (page *tiffPage) Write(row Row) error {
+	tiff := page.tiff
+
+	// Check for pending error
+	switch {
+	case tiff.err != nil:
+		return tiff.err
+	case tiff.page != page:
+		return errors.New("TIFF: page is closed")
+	}
+
+	// Silently ignore excessive rows
+	if page.y == page.hei {
+		return nil
+	}
+
+	// Encode the row
+	wid := generic.Min(row.Width(), page.wid)
+
+	var bytesPerPixel int
+
+	switch page.model {
+	case BilevelModel:
+		bytesBilevelFromRow(page.rowBytes, row)
+
+		// Fill the tail. Bit set means white.
+		for x := wid; x < page.wid; x++ {
+			page.rowBytes[x>>3] |= 0x80 >> (x & 7)
+		}
+	case color.GrayModel:
+		bytesPerPixel = 1
+		bytesGray8fromRow(page.rowBytes, row)
+	case color.Gray16Model:
+		bytesPerPixel = 2
+		bytesGray16BEfromRow(page.rowBytes, row)
+	case color.RGBAModel:
+		bytesPerPixel = 3
+		bytesRGB8fromRow(page.rowBytes, row)
+	case color.RGBA64Model:
+		bytesPerPixel = 6
+		bytesRGB16BEfromRow(page.rowBytes, row)
+	}
+
+	// Fill the tail
+	if wid < page.wid {
+		end := page.wid * bytesPerPixel
+		for x := wid * bytesPerPixel; x < end; x++ {
+			page.rowBytes[x] = 0xff
+		}
+	}
+
+	// Compress the row. Finish the strip, if it is full.
+	page.zw.Write(page.rowBytes)
+	page.y++
+
+	if page.y%page.rowsPerStrip == 0 || page.y == page.hei {
+		page.zw.Close()
+
+		cnt := page.strips.Len() - page.stripStart
+		page.stripCounts = append(page.stripCounts, uint32(cnt))
+		page.stripStart = page.strips.Len()
+		page.zw.Reset(&page.strips)
+	}
+
+	return nil
+}
+
+// Close finishes the page.
+func (page *tiffPage) Close() error {
+	tiff := page.tiff
+	if tiff.page != page {
+		return tiff.err
+	}
+
+	// Write missed lines
+	for tiff.err == nil && page.y < page.hei {
+		page.Write(RowEmpty{})
+	}
+
+	// The page will be written, when the next one is
+	// started or the document is closed.
+	tiff.page = nil
+	tiff.pending = page
+	tiff.pages++
+
+	return tiff.err
+}
+
+// tiffWriter implements the [Encoder] interface for writing
+// single-page TIFF images.
+type tiffWriter struct {
+	Writer                     // Page writer
+	tiff   *TIFFDocumentWriter // Underlying TIFFDocumentWriter
+}
+
+// NewTIFFWriter creates a new [Writer] for single-page TIFF images.
+//
+// xres and yres specify the image resolution, in DPI.
+// Zero means 72 DPI.
+//
+// Supported color models are the same as for the
+// [TIFFDocumentWriter.NewPage].
+//
+// Use [TIFFDocumentWriter] to write multi-page TIFF documents.
+func NewTIFFWriter(output io.Writer, wid, hei int, model color.Model,
+	xres, yres int) (Encoder, error) {
+
+	tiff := NewTIFFDocumentWriter(output)
+	page, err := tiff.NewPage(wid, hei, model, xres, yres)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tiffWriter{page, tiff}, nil
+}
+
+// MIMEType returns the MIME type of the image being encoded.
+func (*tiffWriter) MIMEType() string {
+	return MIMETypeTIFF
+}
+
+// Close flushes the buffered data and then closes the Writer
+func (writer *tiffWriter) Close() error {
+	writer.Writer.Close()
+	return writer.tiff.Close()
+}
@@ -0,0 +1,790 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// TIFF Reader and Writer test
+
+package imgconv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/util/generic"
+	"golang.org/x/image/tiff"
+)
+
+// testTIFFBuild builds the single-strip TIFF image with the
+// specified tags. Tags values are written as LONGs, except for
+// the tags listed in the shorts, which are written as SHORTs.
+func testTIFFBuild(order binary.ByteOrder, tags map[uint16][]uint32,
+	strip []byte) []byte {
+
+	shorts := map[uint16]bool{
+		tiffTagBitsPerSample: true,
+		tiffTagColorMap:      true,
+	}
+
+	// Header and strip data
+	buf := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, order, uint16(42))
+	binary.Write(buf, order, uint32(8+len(strip)+len(strip)&1))
+	buf.Write(strip)
+	if len(strip)&1 != 0 {
+		buf.WriteByte(0)
+	}
+
+	// Prepare tags
+	tags[tiffTagStripOffsets] = []uint32{8}
+	tags[tiffTagStripByteCounts] = []uint32{uint32(len(strip))}
+	tags[tiffTagRowsPerStrip] = []uint32{tags[tiffTagImageLength][0]}
+
+	var keys []int
+	for tag := range tags {
+		keys = append(keys, int(tag))
+	}
+	sort.Ints(keys)
+
+	// Write IFD
+	ext := &bytes.Buffer{}
+	extOff := buf.Len() + 2 + len(keys)*12 + 4
+
+	binary.Write(buf, order, uint16(len(keys)))
+	for _, key := range keys {
+		tag := uint16(key)
+		values := tags[tag]
+
+		data := &bytes.Buffer{}
+		typ := uint16(tiffTypeLong)
+		for _, v := range values {
+			if shorts[tag] {
+				typ = tiffTypeShort
+				binary.Write(data, order, uint16(v))
+			} else {
+				binary.Write(data, order, v)
+			}
+		}
+
+		binary.Write(buf, order, tag)
+		binary.Write(buf, order, typ)
+		binary.Write(buf, order, uint32(len(values)))
+
+		if data.Len() <= 4 {
+			val := make([]byte, 4)
+			copy(val, data.Bytes())
+			buf.Write(val)
+		} else {
+			binary.Write(buf, order, uint32(extOff+ext.Len()))
+			ext.Write(data.Bytes())
+		}
+	}
+	binary.Write(buf, order, uint32(0))
+	buf.Write(ext.Bytes())
+
+	return buf.Bytes()
+}
+
+// testTIFFPackBits compresses data using PackBits. It encodes
+// runs of 3+ equal bytes as the repeat runs, the rest as literals.
+func testTIFFPackBits(data []byte) []byte {
+	var out []byte
+	for len(data) > 0 {
+		n := 1
+		for n < len(data) && n < 128 && data[n] == data[0] {
+			n++
+		}
+
+		if n >= 3 {
+			out = append(out, byte(257-n), data[0])
+		} else {
+			n = generic.Min(len(data), 128)
+			out = append(out, byte(n-1))
+			out = append(out, data[:n]...)
+		}
+
+		data = data[n:]
+	}
+	return out
+}
+
+// testTIFFLZW compresses data using TIFF LZW. It emits only the
+// literal codes, resetting the table often enough to keep codes
+// 9 bits wide.
+func testTIFFLZW(data []byte) []byte {
+	var out []byte
+	var acc uint32
+	var nbits uint
+
+	emit := func(code uint32) {
+		acc = acc<<9 | code
+		nbits += 9
+		for nbits >= 8 {
+			out = append(out, byte(acc>>(nbits-8)))
+			nbits -= 8
+		}
+	}
+
+	emit(256)
+	for i, c := range data {
+		if i > 0 && i%200 == 0 {
+			emit(256)
+		}
+		emit(uint32(c))
+	}
+	emit(257)
+
+	if nbits > 0 {
+		out = append(out, byte(acc<<(8-nbits)))
+	}
+
+	return out
+}
+
+// testTIFFDeflate compresses data using Deflate.
+func testTIFFDeflate(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	w := zlib.NewWriter(buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// testTIFFBits packs string of '0' and '1' into bytes, MSB first.
+func testTIFFBits(s string) []byte {
+	out := make([]byte, (len(s)+7)/8)
+	for i, c := range s {
+		if c == '1' {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// TestTIFFDecode tests TIFF decoding of the sample image
+func TestTIFFDecode(t *testing.T) {
+	reference, err := tiff.Decode(bytes.NewReader(testutils.Images.TIFF100x75))
+	if err != nil {
+		panic(err)
+	}
+
+	reader, err := NewTIFFReader(bytes.NewReader(testutils.Images.TIFF100x75))
+	if err != nil {
+		t.Fatalf("NewTIFFReader: %s", err)
+	}
+	defer reader.Close()
+
+	if reader.MIMEType() != MIMETypeTIFF {
+		t.Errorf("MIMEType: expected %q, present %q",
+			MIMETypeTIFF, reader.MIMEType())
+	}
+
+	// The sample image is 16-bit RGB with alpha channel
+	if reader.ColorModel() != color.RGBA64Model {
+		t.Errorf("ColorModel mismatch")
+	}
+
+	img, err := decodeImage(reader)
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	if diff := imageDiff(reference, img); diff != "" {
+		t.Errorf("%s", diff)
+	}
+
+	// Reading past the end must return io.EOF
+	_, err = reader.Read(reader.NewRow())
+	if err != io.EOF {
+		t.Errorf("expected io.EOF, present: %v", err)
+	}
+
+	// NewDetectReader must recognize TIFF
+	detected, err := NewDetectReader(
+		bytes.NewReader(testutils.Images.TIFF100x75))
+	if err != nil {
+		t.Fatalf("NewDetectReader: %s", err)
+	}
+	detected.Close()
+}
+
+// TestTIFFDecodeFormats tests decoding of various TIFF
+// formats and compression methods
+func TestTIFFDecodeFormats(t *testing.T) {
+	const wid, hei = 5, 3
+
+	// Gray 8-bit test image
+	gray8 := []byte{
+		0, 0, 0, 0, 100,
+		10, 20, 30, 40, 50,
+		255, 255, 255, 255, 255,
+	}
+
+	// The same image with horizontal differencing
+	gray8diff := []byte{
+		0, 0, 0, 0, 100,
+		10, 10, 10, 10, 10,
+		255, 0, 0, 0, 0,
+	}
+
+	// expect8 converts gray8 into color.Gray pixels
+	expect8 := func(pixels []byte) []color.Color {
+		out := make([]color.Color, len(pixels))
+		for i, v := range pixels {
+			out[i] = color.Gray{Y: v}
+		}
+		return out
+	}
+
+	gray8tags := func(compression uint32) map[uint16][]uint32 {
+		return map[uint16][]uint32{
+			tiffTagImageWidth:    {wid},
+			tiffTagImageLength:   {hei},
+			tiffTagBitsPerSample: {8},
+			tiffTagCompression:   {compression},
+			tiffTagPhotometric:   {tiffPhotometricBlackIsZero},
+		}
+	}
+
+	type testData struct {
+		name   string        // Test name
+		data   []byte        // TIFF image
+		model  color.Model   // Expected color model
+		pixels []color.Color // Expected pixels
+	}
+
+	tests := []testData{
+		{
+			name: "gray8 uncompressed",
+			data: testTIFFBuild(binary.LittleEndian,
+				gray8tags(tiffCompressionNone), gray8),
+			model:  color.GrayModel,
+			pixels: expect8(gray8),
+		},
+		{
+			name: "gray8 PackBits",
+			data: testTIFFBuild(binary.BigEndian,
+				gray8tags(tiffCompressionPackBits),
+				testTIFFPackBits(gray8)),
+			model:  color.GrayModel,
+			pixels: expect8(gray8),
+		},
+		{
+			name: "gray8 LZW",
+			data: testTIFFBuild(binary.LittleEndian,
+				gray8tags(tiffCompressionLZW),
+				testTIFFLZW(gray8)),
+			model:  color.GrayModel,
+			pixels: expect8(gray8),
+		},
+		{
+			name: "gray8 Deflate",
+			data: testTIFFBuild(binary.LittleEndian,
+				gray8tags(tiffCompressionDeflate),
+				testTIFFDeflate(gray8)),
+			model:  color.GrayModel,
+			pixels: expect8(gray8),
+		},
+		{
+			name: "gray8 Deflate with predictor",
+			data: func() []byte {
+				tags := gray8tags(tiffCompressionDeflate)
+				tags[tiffTagPredictor] = []uint32{2}
+				return testTIFFBuild(binary.LittleEndian, tags,
+					testTIFFDeflate(gray8diff))
+			}(),
+			model:  color.GrayModel,
+			pixels: expect8(gray8),
+		},
+		{
+			name: "gray16 little endian",
+			data: testTIFFBuild(binary.LittleEndian,
+				map[uint16][]uint32{
+					tiffTagImageWidth:    {2},
+					tiffTagImageLength:   {1},
+					tiffTagBitsPerSample: {16},
+					tiffTagPhotometric:   {tiffPhotometricBlackIsZero},
+				},
+				[]byte{0x34, 0x12, 0xff, 0x00}),
+			model: color.Gray16Model,
+			pixels: []color.Color{
+				color.Gray16{Y: 0x1234},
+				color.Gray16{Y: 0x00ff},
+			},
+		},
+		{
+			name: "palette 4-bit",
+			data: testTIFFBuild(binary.BigEndian,
+				map[uint16][]uint32{
+					tiffTagImageWidth:    {3},
+					tiffTagImageLength:   {1},
+					tiffTagBitsPerSample: {4},
+					tiffTagPhotometric:   {tiffPhotometricPalette},
+					tiffTagColorMap: func() []uint32 {
+						cmap := make([]uint32, 3*16)
+						cmap[1] = 0xffff    // 1: red
+						cmap[16+2] = 0xffff // 2: green
+						return cmap
+					}(),
+				},
+				[]byte{0x12, 0x00}),
+			model: color.RGBAModel,
+			pixels: []color.Color{
+				color.RGBA{R: 255, A: 255},
+				color.RGBA{G: 255, A: 255},
+				color.RGBA{A: 255},
+			},
+		},
+		{
+			name: "gray with alpha",
+			data: testTIFFBuild(binary.LittleEndian,
+				map[uint16][]uint32{
+					tiffTagImageWidth:      {2},
+					tiffTagImageLength:     {1},
+					tiffTagBitsPerSample:   {8, 8},
+					tiffTagSamplesPerPixel: {2},
+					tiffTagExtraSamples:    {2},
+					tiffTagPhotometric:     {tiffPhotometricBlackIsZero},
+				},
+				[]byte{10, 255, 200, 255}),
+			model:  color.GrayModel,
+			pixels: expect8([]byte{10, 200}),
+		},
+		{
+			name: "RGB with alpha",
+			data: testTIFFBuild(binary.LittleEndian,
+				map[uint16][]uint32{
+					tiffTagImageWidth:      {2},
+					tiffTagImageLength:     {1},
+					tiffTagBitsPerSample:   {8, 8, 8, 8},
+					tiffTagSamplesPerPixel: {4},
+					tiffTagPhotometric:     {tiffPhotometricRGB},
+				},
+				[]byte{1, 2, 3, 255, 4, 5, 6, 255}),
+			model: color.RGBAModel,
+			pixels: []color.Color{
+				color.RGBA{R: 1, G: 2, B: 3, A: 255},
+				color.RGBA{R: 4, G: 5, B: 6, A: 255},
+			},
+		},
+		{
+			name: "bilevel WhiteIsZero",
+			data: testTIFFBuild(binary.LittleEndian,
+				map[uint16][]uint32{
+					tiffTagImageWidth:  {10},
+					tiffTagImageLength: {1},
+					tiffTagPhotometric: {tiffPhotometricWhiteIsZero},
+				},
+				testTIFFBits("1100000001")),
+			model: BilevelModel,
+			pixels: expect8([]byte{
+				0, 0, 255, 255, 255, 255, 255, 255, 255, 0,
+			}),
+		},
+		{
+			// 8x2 image. The first row contains 3 black pixels
+			// at 2..4 and encoded using the horizontal mode.
+			// The second row repeats the first one and encoded
+			// using the vertical mode. Then EOFB follows.
+			name: "bilevel CCITT G4",
+			data: testTIFFBuild(binary.LittleEndian,
+				map[uint16][]uint32{
+					tiffTagImageWidth:  {8},
+					tiffTagImageLength: {2},
+					tiffTagCompression: {tiffCompressionG4},
+					tiffTagPhotometric: {tiffPhotometricWhiteIsZero},
+				},
+				testTIFFBits("001"+"0111"+"10"+"1"+
+					"111"+
+					"000000000001"+"000000000001")),
+			model: BilevelModel,
+			pixels: expect8([]byte{
+				255, 255, 0, 0, 0, 255, 255, 255,
+				255, 255, 0, 0, 0, 255, 255, 255,
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		reader, err := NewTIFFReader(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: NewTIFFReader: %s", test.name, err)
+			continue
+		}
+
+		if reader.ColorModel() != test.model {
+			t.Errorf("%s: ColorModel mismatch", test.name)
+		}
+
+		img, err := decodeImage(reader)
+		reader.Close()
+
+		if err != nil {
+			t.Errorf("%s: decodeImage: %s", test.name, err)
+			continue
+		}
+
+		w := img.Bounds().Dx()
+		for i, expected := range test.pixels {
+			present := img.At(i%w, i/w)
+			if !colorEqual(expected, present) {
+				t.Errorf("%s: pixel (%d,%d):\n"+
+					"expected: %v\n"+
+					"present:  %v",
+					test.name, i%w, i/w, expected, present)
+			}
+		}
+	}
+}
+
+// TestTIFFDecodeErrors tests TIFF decoding errors
+func TestTIFFDecodeErrors(t *testing.T) {
+	tags := func() map[uint16][]uint32 {
+		return map[uint16][]uint32{
+			tiffTagImageWidth:    {4},
+			tiffTagImageLength:   {2},
+			tiffTagBitsPerSample: {8},
+			tiffTagPhotometric:   {tiffPhotometricBlackIsZero},
+		}
+	}
+
+	type testData struct {
+		name string // Test name
+		data []byte // TIFF image
+	}
+
+	tests := []testData{
+		{"invalid header", []byte("IX*\x00\x08\x00\x00\x00")},
+		{"truncated header", []byte("II*\x00")},
+		{"invalid IFD offset", []byte("II*\x00\xff\x00\x00\x00")},
+		{"unsupported compression", func() []byte {
+			t := tags()
+			t[tiffTagCompression] = []uint32{7}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 8))
+		}()},
+		{"tiled image", func() []byte {
+			t := tags()
+			t[tiffTagTileWidth] = []uint32{16}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 8))
+		}()},
+		{"unsupported photometric", func() []byte {
+			t := tags()
+			t[tiffTagPhotometric] = []uint32{5}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 8))
+		}()},
+		{"gray with 3 samples", func() []byte {
+			t := tags()
+			t[tiffTagBitsPerSample] = []uint32{8, 8, 8}
+			t[tiffTagSamplesPerPixel] = []uint32{3}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 24))
+		}()},
+		{"gray with 2 samples, no ExtraSamples", func() []byte {
+			t := tags()
+			t[tiffTagBitsPerSample] = []uint32{8, 8}
+			t[tiffTagSamplesPerPixel] = []uint32{2}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 16))
+		}()},
+		{"huge width", func() []byte {
+			t := tags()
+			t[tiffTagImageWidth] = []uint32{0x7fffffff}
+			t[tiffTagBitsPerSample] = []uint32{16, 16, 16}
+			t[tiffTagSamplesPerPixel] = []uint32{3}
+			t[tiffTagPhotometric] = []uint32{tiffPhotometricRGB}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 8))
+		}()},
+		{"huge height", func() []byte {
+			t := tags()
+			t[tiffTagImageLength] = []uint32{0x7fffffff}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 8))
+		}()},
+		{"too many samples", func() []byte {
+			t := tags()
+			t[tiffTagBitsPerSample] = []uint32{8}
+			t[tiffTagSamplesPerPixel] = []uint32{1000}
+			t[tiffTagPhotometric] = []uint32{tiffPhotometricRGB}
+			return testTIFFBuild(binary.LittleEndian, t, make([]byte, 8))
+		}()},
+	}
+
+	for _, test := range tests {
+		reader, err := NewTIFFReader(bytes.NewReader(test.data))
+		if err == nil {
+			reader.Close()
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+
+	// Truncated strip must be detected while reading
+	data := testTIFFBuild(binary.LittleEndian, tags(), make([]byte, 6))
+	reader, err := NewTIFFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewTIFFReader: %s", err)
+	}
+	defer reader.Close()
+
+	row := reader.NewRow()
+	_, err = reader.Read(row)
+	if err != nil {
+		t.Errorf("row 0: unexpected error: %s", err)
+	}
+
+	_, err = reader.Read(row)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("row 1: expected %v, present %v",
+			io.ErrUnexpectedEOF, err)
+	}
+}
+
+// TestTIFFEncode tests multi-page TIFF encoding
+func TestTIFFEncode(t *testing.T) {
+	// Prepare source images
+	src, err := NewPNGReader(bytes.NewReader(testutils.Images.PNG100x75rgb8))
+	if err != nil {
+		panic(err)
+	}
+	rgb, err := decodeImage(src)
+	src.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	models := []color.Model{
+		color.RGBAModel,
+		color.RGBA64Model,
+		color.GrayModel,
+		color.Gray16Model,
+		BilevelModel,
+	}
+
+	// Write multi-page TIFF, one page per model
+	buf := &bytes.Buffer{}
+	doc := NewTIFFDocumentWriter(buf)
+	bounds := rgb.Bounds()
+
+	for _, model := range models {
+		page, err := doc.NewPage(bounds.Dx(), bounds.Dy(), model, 300, 150)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+
+		row := NewRow(model, bounds.Dx())
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				row.Set(x, rgb.At(x, y))
+			}
+			page.Write(row)
+		}
+
+		err = page.Close()
+		if err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+	}
+
+	err = doc.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	data := buf.Bytes()
+	if MIMETypeDetect(data) != MIMETypeTIFF {
+		t.Errorf("MIMETypeDetect: TIFF not detected")
+	}
+
+	// Walk IFD chain. Decode each page with the reference decoder
+	// by patching the first IFD offset in the header.
+	order := binary.BigEndian
+	off := order.Uint32(data[4:])
+
+	for i, model := range models {
+		if off == 0 {
+			t.Fatalf("page %d: missed", i)
+		}
+
+		if off&1 != 0 {
+			t.Errorf("page %d: IFD offset %d is not word-aligned",
+				i, off)
+		}
+
+		ifd, next, err := tiffParseIFD(data, order, off)
+		if err != nil {
+			t.Fatalf("page %d: %s", i, err)
+		}
+
+		xres := ifd[tiffTagXResolution]
+		yres := ifd[tiffTagYResolution]
+		if xres[0]/xres[1] != 300 || yres[0]/yres[1] != 150 {
+			t.Errorf("page %d: resolution mismatch: %v %v",
+				i, xres, yres)
+		}
+
+		page := append([]byte{}, data...)
+		order.PutUint32(page[4:], off)
+
+		reference, err := tiff.Decode(bytes.NewReader(page))
+		if err != nil {
+			t.Fatalf("page %d: tiff.Decode: %s", i, err)
+		}
+
+		reader, err := NewTIFFReader(bytes.NewReader(page))
+		if err != nil {
+			t.Fatalf("page %d: NewTIFFReader: %s", i, err)
+		}
+
+		if reader.ColorModel() != model {
+			t.Errorf("page %d: ColorModel mismatch", i)
+		}
+
+		img, err := decodeImage(reader)
+		reader.Close()
+
+		if err != nil {
+			t.Fatalf("page %d: decodeImage: %s", i, err)
+		}
+
+		if diff := imageDiff(reference, img); diff != "" {
+			t.Errorf("page %d: %s", i, diff)
+		}
+
+		// RGB pages must match the source exactly
+		if model == color.RGBAModel || model == color.RGBA64Model {
+			if diff := imageDiff(rgb, img); diff != "" {
+				t.Errorf("page %d: %s", i, diff)
+			}
+		}
+
+		off = next
+	}
+
+	if off != 0 {
+		t.Errorf("extra pages in the document")
+	}
+
+	// Read it back with TIFFDocumentReader
+	reader, err := NewTIFFDocumentReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewTIFFDocumentReader: %s", err)
+	}
+
+	if reader.Pages() != len(models) {
+		t.Errorf("Pages: expected %d, present %d",
+			len(models), reader.Pages())
+	}
+
+	for i, model := range models {
+		page, err := reader.NextPage()
+		if err != nil {
+			t.Fatalf("page %d: NextPage: %s", i, err)
+		}
+
+		if page.ColorModel() != model {
+			t.Errorf("page %d: ColorModel mismatch", i)
+		}
+
+		img, err := decodeImage(page)
+		page.Close()
+
+		if err != nil {
+			t.Fatalf("page %d: decodeImage: %s", i, err)
+		}
+
+		if model == color.RGBAModel {
+			if diff := imageDiff(rgb, img); diff != "" {
+				t.Errorf("page %d: %s", i, diff)
+			}
+		}
+	}
+
+	_, err = reader.NextPage()
+	if err != io.EOF {
+		t.Errorf("NextPage: expected io.EOF, present %v", err)
+	}
+
+	// Looped IFD chain
+	last := uint32(0)
+	for off := order.Uint32(data[4:]); off != 0; {
+		last = off
+		_, off, _ = tiffParseIFD(data, order, off)
+	}
+
+	cnt := int(order.Uint16(data[last:]))
+	order.PutUint32(data[int(last)+2+cnt*12:], order.Uint32(data[4:]))
+
+	_, err = NewTIFFDocumentReader(bytes.NewReader(data))
+	if err == nil {
+		t.Errorf("NewTIFFDocumentReader: looped IFD chain must fail")
+	}
+}
+
+// TestTIFFEncodeErrors tests TIFF encoding errors
+func TestTIFFEncodeErrors(t *testing.T) {
+	// Unsupported model
+	_, err := NewTIFFWriter(io.Discard, 10, 10, color.CMYKModel, 0, 0)
+	if err == nil {
+		t.Errorf("NewTIFFWriter: unsupported model must fail")
+	}
+
+	// Empty document
+	doc := NewTIFFDocumentWriter(io.Discard)
+	if doc.Close() == nil {
+		t.Errorf("Close: empty document must fail")
+	}
+
+	// Overlapping pages
+	doc = NewTIFFDocumentWriter(io.Discard)
+	page, _ := doc.NewPage(10, 10, color.GrayModel, 0, 0)
+	_, err = doc.NewPage(10, 10, color.GrayModel, 0, 0)
+	if err == nil {
+		t.Errorf("NewPage: second page must fail while first is active")
+	}
+
+	page.Close()
+	if page.Write(RowEmpty{}) == nil {
+		t.Errorf("Write to the closed page must fail")
+	}
+
+	// Write errors
+	errTest := io.ErrShortWrite
+	writer, err := NewTIFFWriter(newIoWriterWithError(io.Discard, 0, errTest),
+		10, 10, color.GrayModel, 0, 0)
+	if err != nil {
+		t.Fatalf("NewTIFFWriter: %s", err)
+	}
+
+	if writer.MIMEType() != MIMETypeTIFF {
+		t.Errorf("MIMEType: expected %q, present %q",
+			MIMETypeTIFF, writer.MIMEType())
+	}
+
+	err = writer.Close()
+	if err != errTest {
+		t.Errorf("Close: expected %v, present %v", errTest, err)
+	}
+
+	// Single-page TIFF must be readable by the reference decoder
+	buf := &bytes.Buffer{}
+	writer, _ = NewTIFFWriter(buf, 3, 2, BilevelModel, 0, 0)
+	writer.Close()
+
+	img, err := tiff.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("tiff.Decode: %s", err)
+	}
+
+	if img.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Errorf("Bounds mismatch: %v", img.Bounds())
+	}
+}
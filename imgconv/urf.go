@@ -0,0 +1,468 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Apple Raster (URF) Reader and Writer
+
+package imgconv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// URF file and page header sizes
+const (
+	urfFileHeaderSize = 12
+	urfPageHeaderSize = 32
+)
+
+// urfMagic is the URF file magic
+const urfMagic = "UNIRAST\x00"
+
+// URF color spaces, as used in [URFPageHeader.ColorSpace]:
+const (
+	URFColorSpaceSGray    = 0 // sRGB grayscale
+	URFColorSpaceSRGB     = 1 // sRGB color
+	URFColorSpaceCIELab   = 2 // CIE Lab
+	URFColorSpaceAdobeRGB = 3 // Adobe RGB color
+	URFColorSpaceGray     = 4 // Device grayscale
+	URFColorSpaceRGB      = 5 // Device RGB
+	URFColorSpaceCMYK     = 6 // Device CMYK
+)
+
+// URF duplex modes, as used in [URFPageHeader.Duplex]:
+const (
+	URFDuplexNone      = 1 // One-sided
+	URFDuplexLongEdge  = 2 // Two-sided, long edge
+	URFDuplexShortEdge = 3 // Two-sided, short edge
+)
+
+// URF print qualities, as used in [URFPageHeader.Quality]:
+const (
+	URFQualityDraft  = 3
+	URFQualityNormal = 4
+	URFQualityHigh   = 5
+)
+
+// URFPageHeader represents the URF page header.
+type URFPageHeader struct {
+	BitsPerPixel int // Bits per pixel (8, 16, 24, 32, 48 or 64)
+	ColorSpace   int // Color space (URFColorSpaceXXX)
+	Duplex       int // Duplex mode (URFDuplexXXX)
+	Quality      int // Print quality (URFQualityXXX)
+	Width        int // Image width, in pixels
+	Height       int // Image height, in pixels
+	Resolution   int // Image resolution, DPI
+}
+
+// NewURFPageHeader creates the URF page header for the image
+// of the specified size, color model and resolution.
+//
+// If resolution is not known, zero may be passed, which is the
+// same as 72 DPI.
+//
+// Supported color models are following:
+//   - color.GrayModel (8-bit sGray)
+//   - color.Gray16Model (16-bit sGray)
+//   - color.RGBAModel (8-bit sRGB)
+//   - color.RGBA64Model (16-bit sRGB)
+func NewURFPageHeader(wid, hei int, model color.Model,
+	res int) (URFPageHeader, error) {
+
+	if res <= 0 {
+		res = 72
+	}
+
+	hdr := URFPageHeader{
+		Duplex:     URFDuplexNone,
+		Quality:    URFQualityNormal,
+		Width:      wid,
+		Height:     hei,
+		Resolution: res,
+	}
+
+	switch model {
+	case color.GrayModel:
+		hdr.ColorSpace, hdr.BitsPerPixel = URFColorSpaceSGray, 8
+	case color.Gray16Model:
+		hdr.ColorSpace, hdr.BitsPerPixel = URFColorSpaceSGray, 16
+	case color.RGBAModel:
+		hdr.ColorSpace, hdr.BitsPerPixel = URFColorSpaceSRGB, 24
+	case color.RGBA64Model:
+		hdr.ColorSpace, hdr.BitsPerPixel = URFColorSpaceSRGB, 48
+	default:
+		return hdr, errors.New("URF: unsupported color model")
+	}
+
+	if wid <= 0 || hei <= 0 {
+		return hdr, errors.New("URF: invalid image size")
+	}
+
+	return hdr, nil
+}
+
+// format returns the rasterFormat of the page.
+func (hdr *URFPageHeader) format() (rasterFormat, error) {
+	var colors int
+	invert := false
+
+	switch hdr.ColorSpace {
+	case URFColorSpaceSGray, URFColorSpaceGray:
+		colors = 1
+	case URFColorSpaceSRGB, URFColorSpaceAdobeRGB, URFColorSpaceRGB:
+		colors = 3
+	case URFColorSpaceCMYK:
+		colors, invert = 4, true
+	default:
+		return rasterFormat{}, errors.New("URF: unsupported color space")
+	}
+
+	bpc := hdr.BitsPerPixel / colors
+	if bpc*colors != hdr.BitsPerPixel || bpc == 1 {
+		return rasterFormat{}, errors.New("URF: unsupported pixel format")
+	}
+
+	f, err := newRasterFormat(hdr.Width, bpc, colors, invert)
+	switch {
+	case err != nil:
+		return f, errors.New("URF: " + err.Error())
+	case hdr.Height <= 0 || hdr.Height > rasterMaxSize:
+		return f, errors.New("URF: invalid image size")
+	}
+
+	return f, nil
+}
+
+// decode decodes the URF page header.
+func (hdr *URFPageHeader) decode(data []byte) {
+	u32 := func(off int) int {
+		return int(binary.BigEndian.Uint32(data[off:]))
+	}
+
+	*hdr = URFPageHeader{
+		BitsPerPixel: int(data[0]),
+		ColorSpace:   int(data[1]),
+		Duplex:       int(data[2]),
+		Quality:      int(data[3]),
+		Width:        u32(12),
+		Height:       u32(16),
+		Resolution:   u32(20),
+	}
+}
+
+// encode encodes the URF page header.
+func (hdr *URFPageHeader) encode() []byte {
+	data := make([]byte, urfPageHeaderSize)
+
+	data[0] = byte(hdr.BitsPerPixel)
+	data[1] = byte(hdr.ColorSpace)
+	data[2] = byte(hdr.Duplex)
+	data[3] = byte(hdr.Quality)
+	binary.BigEndian.PutUint32(data[12:], uint32(hdr.Width))
+	binary.BigEndian.PutUint32(data[16:], uint32(hdr.Height))
+	binary.BigEndian.PutUint32(data[20:], uint32(hdr.Resolution))
+
+	return data
+}
+
+// URFDecoder is the [Decoder] for the single page of the URF
+// document. It provides access to the page header.
+type URFDecoder interface {
+	Decoder
+
+	// Header returns the page header.
+	Header() URFPageHeader
+}
+
+// urfPageReader implements the [URFDecoder] interface.
+type urfPageReader struct {
+	*rasterPageReader
+	hdr URFPageHeader // Page header
+}
+
+// Header returns the page header.
+func (page *urfPageReader) Header() URFPageHeader {
+	return page.hdr
+}
+
+// Meta returns the image metadata.
+// Only the resolution is reported.
+func (page *urfPageReader) Meta() ImageMeta {
+	return ImageMeta{
+		XResolution: page.hdr.Resolution,
+		YResolution: page.hdr.Resolution,
+	}
+}
+
+// URFDocumentReader reads the multi-page URF documents.
+//
+// Pages are decoded on the fly, row by row, so only one page
+// can be read at a time.
+type URFDocumentReader struct {
+	input *bufio.Reader  // Buffered input
+	page  *urfPageReader // Current page, nil if none
+	pages int            // Count of pages in the document
+	next  int            // Number of the next page
+	err   error          // Sticky error
+}
+
+// NewURFDocumentReader creates a new [URFDocumentReader].
+// It reads and checks the file header from the input.
+func NewURFDocumentReader(input io.Reader) (*URFDocumentReader, error) {
+	doc := &URFDocumentReader{input: bufio.NewReader(input)}
+
+	var hdr [urfFileHeaderSize]byte
+	_, err := io.ReadFull(doc.input, hdr[:])
+	switch {
+	case err == io.EOF:
+		return nil, io.ErrUnexpectedEOF
+	case err != nil:
+		return nil, err
+	case string(hdr[:8]) != urfMagic:
+		return nil, errors.New("URF: invalid file header")
+	}
+
+	doc.pages = int(binary.BigEndian.Uint32(hdr[8:]))
+
+	return doc, nil
+}
+
+// Pages returns the count of pages in the document, as specified
+// in the file header.
+func (doc *URFDocumentReader) Pages() int {
+	return doc.pages
+}
+
+// NextPage returns the [URFDecoder] for the next page of
+// the document. At the end of document it returns [io.EOF].
+//
+// If the previous page is not completely read, its remaining
+// rows are skipped. The previous page's decoder becomes
+// invalid.
+func (doc *URFDocumentReader) NextPage() (URFDecoder, error) {
+	if doc.err != nil {
+		return nil, doc.err
+	}
+
+	// Skip the rest of the previous page
+	if doc.page != nil {
+		err := doc.page.skip()
+		doc.page.err = errors.New("URF: page is closed")
+		doc.page = nil
+
+		if err != nil {
+			doc.err = err
+			return nil, err
+		}
+	}
+
+	if doc.next == doc.pages {
+		doc.err = io.EOF
+		return nil, doc.err
+	}
+
+	// Read the page header
+	var data [urfPageHeaderSize]byte
+	_, err := io.ReadFull(doc.input, data[:])
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		doc.err = err
+		return nil, err
+	}
+
+	page := &urfPageReader{}
+	page.hdr.decode(data[:])
+
+	format, err := page.hdr.format()
+	if err != nil {
+		doc.err = err
+		return nil, err
+	}
+
+	page.rasterPageReader = newRasterPageReader(MIMETypeURF, "URF",
+		doc.input, format, page.hdr.Height)
+
+	doc.page = page
+	doc.next++
+
+	return page, nil
+}
+
+// NewURFReader creates a new [URFDecoder] for the first page of
+// the URF document.
+//
+// Supported are the images with 8 and 16 bits per color in the
+// gray, RGB and CMYK color spaces. Grayscale images are decoded
+// as [color.GrayModel] or [color.Gray16Model], and color images
+// as [color.RGBAModel] or [color.RGBA64Model]. CMYK images are
+// converted to RGB.
+func NewURFReader(input io.Reader) (URFDecoder, error) {
+	doc, err := NewURFDocumentReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := doc.NextPage()
+	if err == io.EOF {
+		err = errors.New("URF: document has no pages")
+	}
+
+	return page, err
+}
+
+// URFDocumentWriter writes the multi-page URF documents.
+//
+// URF file header contains the count of pages, so it needs to be
+// known in advance.
+//
+// Pages are encoded on the fly, row by row, so only one page
+// can be written at a time.
+type URFDocumentWriter struct {
+	out    rasterOutput      // Document output
+	page   *rasterPageWriter // Current page, nil if none
+	pages  int               // Count of pages, declared
+	next   int               // Number of the next page
+	closed bool              // Writer is closed
+}
+
+// NewURFDocumentWriter creates a new [URFDocumentWriter] for
+// the document with the specified count of pages.
+func NewURFDocumentWriter(output io.Writer, pages int) *URFDocumentWriter {
+	return &URFDocumentWriter{
+		out:   rasterOutput{output: output},
+		pages: pages,
+	}
+}
+
+// NewPage starts a new page and returns the [Writer] for the page
+// image. Use [NewURFPageHeader] to create the page header.
+//
+// The page is finished when the returned Writer is closed.
+// Only one page may be written at a time.
+//
+// CMYK pages are not supported for writing.
+func (doc *URFDocumentWriter) NewPage(hdr URFPageHeader) (Writer, error) {
+	format, err := hdr.format()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case format.colors == 4:
+		return nil, errors.New("URF: CMYK is not supported for writing")
+	case doc.closed:
+		return nil, errors.New("URF: writer is closed")
+	case doc.page != nil && !doc.page.closed:
+		return nil, errors.New("URF: previous page is not closed")
+	case doc.next == doc.pages:
+		return nil, fmt.Errorf("URF: only %d pages declared", doc.pages)
+	case doc.out.err != nil:
+		return nil, doc.out.err
+	}
+
+	if doc.next == 0 {
+		doc.writeFileHeader()
+	}
+
+	doc.out.write(hdr.encode())
+	if doc.out.err != nil {
+		return nil, doc.out.err
+	}
+
+	doc.page = newRasterPageWriter(&doc.out, "URF", format, hdr.Height)
+	doc.next++
+
+	return doc.page, nil
+}
+
+// Close finishes the current page, if any, and closes the
+// URFDocumentWriter.
+//
+// It is an error, if count of written pages doesn't match
+// the count of pages, declared when URFDocumentWriter was
+// created.
+//
+// It doesn't close the underlying [io.Writer].
+func (doc *URFDocumentWriter) Close() error {
+	if doc.closed {
+		return doc.out.err
+	}
+
+	if doc.page != nil {
+		doc.page.Close()
+	}
+
+	doc.closed = true
+
+	if doc.next != doc.pages && doc.out.err == nil {
+		doc.out.err = fmt.Errorf("URF: %d pages declared, %d written",
+			doc.pages, doc.next)
+	}
+
+	return doc.out.err
+}
+
+// writeFileHeader writes the URF file header.
+func (doc *URFDocumentWriter) writeFileHeader() {
+	var hdr [urfFileHeaderSize]byte
+	copy(hdr[:], urfMagic)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(doc.pages))
+	doc.out.write(hdr[:])
+}
+
+// urfWriter implements the [Encoder] interface for writing
+// single-page URF documents.
+type urfWriter struct {
+	Writer                    // Page writer
+	doc    *URFDocumentWriter // Underlying document
+}
+
+// NewURFWriter creates a new [Encoder] for the single-page
+// URF document.
+//
+// xres and yres specify the image resolution, in DPI. URF
+// supports only the same resolution in both directions. If
+// resolution is not known, zero may be passed, which is the
+// same as 72 DPI.
+//
+// See [NewURFPageHeader] for the list of supported color models.
+func NewURFWriter(output io.Writer,
+	wid, hei int, model color.Model, xres, yres int) (Encoder, error) {
+
+	if xres != yres {
+		return nil, errors.New("URF: resolution must be the same " +
+			"in both directions")
+	}
+
+	hdr, err := NewURFPageHeader(wid, hei, model, xres)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := NewURFDocumentWriter(output, 1)
+	page, err := doc.NewPage(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &urfWriter{Writer: page, doc: doc}, nil
+}
+
+// MIMEType returns the MIME type of the image being written.
+func (writer *urfWriter) MIMEType() string {
+	return MIMETypeURF
+}
+
+// Close flushes the buffered data and then closes the Writer
+func (writer *urfWriter) Close() error {
+	return writer.doc.Close()
+}
@@ -0,0 +1,325 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Apple Raster (URF) Reader and Writer test
+
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+)
+
+// testURFBuild builds the URF document with the specified
+// page count and page data.
+func testURFBuild(pages int, data ...[]byte) []byte {
+	buf := []byte(urfMagic)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(pages))
+	for _, d := range data {
+		buf = append(buf, d...)
+	}
+	return buf
+}
+
+// testURFPage builds the URF page with the specified header
+// and compressed data.
+func testURFPage(hdr URFPageHeader, data []byte) []byte {
+	return append(hdr.encode(), data...)
+}
+
+// TestURFEncode tests URF encoding and decoding
+func TestURFEncode(t *testing.T) {
+	src := testRasterSource()
+	bounds := src.Bounds()
+
+	models := []color.Model{
+		color.GrayModel,
+		color.Gray16Model,
+		color.RGBAModel,
+		color.RGBA64Model,
+	}
+
+	// Write the multi-page document, page per model
+	buf := &bytes.Buffer{}
+	doc := NewURFDocumentWriter(buf, len(models))
+	headers := []URFPageHeader{}
+	images := []image.Image{}
+
+	for _, model := range models {
+		hdr, err := NewURFPageHeader(bounds.Dx(), bounds.Dy(),
+			model, 600)
+		if err != nil {
+			t.Fatalf("NewURFPageHeader: %s", err)
+		}
+
+		hdr.Duplex = URFDuplexLongEdge
+		hdr.Quality = URFQualityHigh
+
+		page, err := doc.NewPage(hdr)
+		if err != nil {
+			t.Fatalf("NewPage: %s", err)
+		}
+
+		expected, err := testRasterWrite(page, src)
+		if err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+
+		headers = append(headers, hdr)
+		images = append(images, expected)
+	}
+
+	err := doc.Close()
+	if err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if MIMETypeDetect(buf.Bytes()) != MIMETypeURF {
+		t.Errorf("MIMETypeDetect: URF not detected")
+	}
+
+	// Read it back
+	reader, err := NewURFDocumentReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewURFDocumentReader: %s", err)
+	}
+
+	if reader.Pages() != len(models) {
+		t.Errorf("Pages: expected %d, present %d",
+			len(models), reader.Pages())
+	}
+
+	for i, model := range models {
+		page, err := reader.NextPage()
+		if err != nil {
+			t.Fatalf("NextPage: %s", err)
+		}
+
+		if diff := testutils.Diff(headers[i], page.Header()); diff != "" {
+			t.Errorf("Header:\n%s", diff)
+		}
+
+		if page.MIMEType() != MIMETypeURF {
+			t.Errorf("MIMEType: expected %q, present %q",
+				MIMETypeURF, page.MIMEType())
+		}
+
+		if page.ColorModel() != model {
+			t.Errorf("page %d: ColorModel mismatch", i)
+		}
+
+		// Skip every second page
+		if i%2 != 0 {
+			continue
+		}
+
+		img, err := decodeImage(page)
+		if err != nil {
+			t.Fatalf("decodeImage: %s", err)
+		}
+
+		if diff := imageDiff(images[i], img); diff != "" {
+			t.Errorf("page %d: %s", i, diff)
+		}
+
+		page.Close()
+	}
+
+	_, err = reader.NextPage()
+	if err != io.EOF {
+		t.Errorf("NextPage: expected io.EOF, present %v", err)
+	}
+
+	// The single-page writer
+	buf.Reset()
+	encoder, err := NewURFWriter(buf, bounds.Dx(), bounds.Dy(),
+		color.RGBAModel, 300, 300)
+	if err != nil {
+		t.Fatalf("NewURFWriter: %s", err)
+	}
+
+	if encoder.MIMEType() != MIMETypeURF {
+		t.Errorf("MIMEType: expected %q, present %q",
+			MIMETypeURF, encoder.MIMEType())
+	}
+
+	expected, err := testRasterWrite(encoder, src)
+	if err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	decoder, err := NewDetectReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewDetectReader: %s", err)
+	}
+
+	img, err := decodeImage(decoder)
+	decoder.Close()
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	if diff := imageDiff(expected, img); diff != "" {
+		t.Errorf("%s", diff)
+	}
+}
+
+// TestURFDecode tests decoding of hand-made URF documents
+func TestURFDecode(t *testing.T) {
+	white := color.Gray{Y: 255}
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+
+	// 2x2 sRGB page: the first line is red and green,
+	// the second line is white, filled by 0x80
+	hdr := URFPageHeader{
+		BitsPerPixel: 24,
+		ColorSpace:   URFColorSpaceSRGB,
+		Width:        2,
+		Height:       2,
+		Resolution:   300,
+	}
+
+	data := testURFBuild(1, testURFPage(hdr, []byte{
+		0, 0xff, 255, 0, 0, 0, 255, 0,
+		0, 0x80,
+	}))
+
+	expected := []color.Color{red, green, white, white}
+
+	reader, err := NewURFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewURFReader: %s", err)
+	}
+
+	img, err := decodeImage(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	for i, c := range expected {
+		present := img.At(i%2, i/2)
+		if !colorEqual(c, present) {
+			t.Errorf("pixel (%d,%d):\n"+
+				"expected: %v\n"+
+				"present:  %v",
+				i%2, i/2, c, present)
+		}
+	}
+
+	// CMYK page, filled with white by 0x80
+	hdr.ColorSpace = URFColorSpaceCMYK
+	hdr.BitsPerPixel = 32
+	data = testURFBuild(1, testURFPage(hdr, []byte{1, 0x80}))
+
+	reader, err = NewURFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewURFReader: %s", err)
+	}
+
+	img, err = decodeImage(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("decodeImage: %s", err)
+	}
+
+	if !colorEqual(img.At(1, 1), white) {
+		t.Errorf("CMYK: white expected, present %v", img.At(1, 1))
+	}
+}
+
+// TestURFErrors tests URF errors
+func TestURFErrors(t *testing.T) {
+	hdr := URFPageHeader{
+		BitsPerPixel: 8,
+		ColorSpace:   URFColorSpaceSGray,
+		Width:        2,
+		Height:       2,
+		Resolution:   300,
+	}
+
+	page := testURFPage(hdr, []byte{1, 1, 0})
+
+	lab := hdr
+	lab.ColorSpace = URFColorSpaceCIELab
+
+	badBits := hdr
+	badBits.BitsPerPixel = 12
+
+	type testData struct {
+		name string // Test name
+		data []byte // Document data
+	}
+
+	tests := []testData{
+		{"no pages", testURFBuild(0)},
+		{"truncated file header", testURFBuild(1)[:10]},
+		{"invalid file header", append([]byte("UNIRAST!"), page...)},
+		{"missing page", testURFBuild(1)},
+		{"truncated page header", testURFBuild(1, page[:20])},
+		{"unsupported color space", testURFBuild(1,
+			testURFPage(lab, nil))},
+		{"unsupported bits", testURFBuild(1,
+			testURFPage(badBits, nil))},
+	}
+
+	for _, test := range tests {
+		reader, err := NewURFReader(bytes.NewReader(test.data))
+		if err == nil {
+			reader.Close()
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+
+	// Truncated page data
+	reader, err := NewURFReader(bytes.NewReader(
+		testURFBuild(1, page[:len(page)-1])))
+	if err != nil {
+		t.Fatalf("NewURFReader: %s", err)
+	}
+
+	_, err = decodeImage(reader)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated data: expected %v, present %v",
+			io.ErrUnexpectedEOF, err)
+	}
+
+	// Writer errors
+	_, err = NewURFWriter(io.Discard, 10, 10, BilevelModel, 0, 0)
+	if err == nil {
+		t.Errorf("NewURFWriter: unsupported model must fail")
+	}
+
+	_, err = NewURFWriter(io.Discard, 10, 10, color.GrayModel, 300, 600)
+	if err == nil {
+		t.Errorf("NewURFWriter: non-square resolution must fail")
+	}
+
+	doc := NewURFDocumentWriter(io.Discard, 2)
+	w, err := doc.NewPage(hdr)
+	if err != nil {
+		t.Fatalf("NewPage: %s", err)
+	}
+	w.Close()
+
+	err = doc.Close()
+	if err == nil {
+		t.Errorf("Close: page count mismatch must fail")
+	}
+
+	doc = NewURFDocumentWriter(io.Discard, 0)
+	_, err = doc.NewPage(hdr)
+	if err == nil {
+		t.Errorf("NewPage: extra page must fail")
+	}
+}
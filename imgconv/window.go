@@ -0,0 +1,141 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// Abstract definition for printer and scanner interfaces
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Sliding window of image rows
+
+package imgconv
+
+import (
+	"image/color"
+	"io"
+)
+
+// window3 maintains the sliding window of 3 consecutive image
+// rows, for filters that need the 3x3 pixel neighborhood.
+//
+// Rows are stored in the floating point representation ([RowFP]).
+// Rows beyond the image top and bottom edges are replicated from
+// the edge rows.
+type window3 struct {
+	input    Reader   // Image source
+	wid, hei int      // Image size
+	tmp      Row      // Input buffer, for reading from window3.input
+	rows     [3]RowFP // Previous, current and next rows
+	out      RowFP    // Output buffer
+	y        int      // y-coordinate of rows[1], -1 before start
+	err      error    // Sticky error
+}
+
+// newWindow3 creates a new window3 on a top of the existent [Reader].
+func newWindow3(in Reader) *window3 {
+	model := in.ColorModel()
+	wid, hei := in.Size()
+
+	win := &window3{
+		input: in,
+		wid:   wid,
+		hei:   hei,
+		tmp:   in.NewRow(),
+		out:   NewRowFP(model, wid),
+		y:     -1,
+	}
+
+	for i := range win.rows {
+		win.rows[i] = NewRowFP(model, wid)
+	}
+
+	return win
+}
+
+// channels returns number of channels per pixel in the RowFP.
+// Alpha channel, if present, is always the last one.
+func (win *window3) channels() int {
+	if _, ok := win.out.(RowRGBAFP32); ok {
+		return 4
+	}
+	return 1
+}
+
+// ColorModel returns the [color.Model] of image being decoded.
+func (win *window3) ColorModel() color.Model {
+	return win.input.ColorModel()
+}
+
+// Size returns the image size.
+func (win *window3) Size() (wid, hei int) {
+	return win.wid, win.hei
+}
+
+// NewRow allocates a [Row] of the appropriate type and width for
+// use with the [Reader.Read] function.
+func (win *window3) NewRow() Row {
+	return win.input.NewRow()
+}
+
+// Close closes the reader.
+func (win *window3) Close() {
+	win.input.Close()
+}
+
+// advance moves the window one row down.
+func (win *window3) advance() error {
+	if win.err != nil {
+		return win.err
+	}
+
+	if win.y+1 >= win.hei {
+		win.err = io.EOF
+		return win.err
+	}
+
+	if win.y < 0 {
+		// Fill the initial window
+		if win.err = win.read(win.rows[1]); win.err != nil {
+			return win.err
+		}
+
+		win.rows[0].Copy(win.rows[1])
+	} else {
+		// Rotate the window
+		tmp := win.rows[0]
+		win.rows[0], win.rows[1] = win.rows[1], win.rows[2]
+		win.rows[2] = tmp
+	}
+
+	win.y++
+
+	// Load the next row
+	if win.y+1 < win.hei {
+		win.err = win.read(win.rows[2])
+		if win.err == io.EOF {
+			win.err = io.ErrUnexpectedEOF
+		}
+	} else {
+		win.rows[2].Copy(win.rows[1])
+	}
+
+	return win.err
+}
+
+// read reads the next row from the input into the dst.
+func (win *window3) read(dst RowFP) error {
+	_, err := win.input.Read(win.tmp)
+	if err == nil {
+		dst.Copy(win.tmp)
+	}
+	return err
+}
+
+// samples returns the raw floating point samples of the RowFP.
+func (win *window3) samples(row RowFP) []float32 {
+	switch row := row.(type) {
+	case RowGrayFP32:
+		return row
+	case RowRGBAFP32:
+		return row
+	}
+	return nil
+}
@@ -33,6 +33,7 @@ type esclImageFilter struct {
 	XResolution  optional.Val[int]            // X resolution, DPI
 	YResolution  optional.Val[int]            // Y resolution, DPI
 	ColorMode    optional.Val[escl.ColorMode] // Desired color mode
+	Resampling   optional.Val[string]         // Resampling kernel
 }
 
 // FilterOptions exports esclImageFilter settings as abstract.FilterOptions.
@@ -65,6 +66,17 @@ func (flt *esclImageFilter) FilterOptions() (opt abstract.FilterOptions) {
 		}
 	}
 
+	if flt.Resampling != nil {
+		switch *flt.Resampling {
+		case "bilinear":
+			opt.Resampling = abstract.ResamplingBilinear
+		case "box":
+			opt.Resampling = abstract.ResamplingBox
+		case "lanczos3":
+			opt.Resampling = abstract.ResamplingLanczos3
+		}
+	}
+
 	return
 }
 
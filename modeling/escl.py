@@ -34,6 +34,7 @@ class ImageFilter(TypedDict):
     XResolution: int
     YResolution: int
     ColorMode: str
+    Resampling: str     # "bilinear", "box" or "lanczos3"
 
 # caps is the model-settable variable that defines the
 # eSCL scanner capabilities
@@ -0,0 +1,330 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// eSCL core protocol
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// abstract.Scanner on a top of eSCL client
+
+package escl
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/log"
+	"github.com/OpenPrinting/go-mfp/transport"
+)
+
+// NextDocument retry delays. Scanner responds with 503 Service
+// Unavailable, if the next page is not ready yet. The request is
+// retried with exponential backoff between these bounds.
+const (
+	abstractClientRetryMin = 100 * time.Millisecond
+	abstractClientRetryMax = 2 * time.Second
+)
+
+// AbstractClient implements [abstract.Scanner] on a top of the
+// eSCL [Client].
+//
+// It allows any eSCL scanner to be used via the protocol-independent
+// [abstract.Scanner] interface, so it can be re-exported by any
+// server that works on a top of abstract.Scanner.
+type AbstractClient struct {
+	clnt    *Client                       // Underlying eSCL client
+	version Version                       // Scanner's eSCL version
+	caps    *abstract.ScannerCapabilities // Scanner capabilities
+}
+
+// NewAbstractClient creates a new [AbstractClient].
+//
+// It queries the scanner for its [ScannerCapabilities], so the
+// scanner must be reachable at the time of the call.
+//
+// If tr is nil, [transport.NewTransport] will be used to create
+// a new transport.
+func NewAbstractClient(ctx context.Context,
+	u *url.URL, tr *transport.Transport) (*AbstractClient, error) {
+
+	clnt := NewClient(u, tr)
+
+	caps, _, err := clnt.GetScannerCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	absclnt := &AbstractClient{
+		clnt:    clnt,
+		version: caps.Version,
+		caps:    caps.ToAbstract(),
+	}
+
+	return absclnt, nil
+}
+
+// Capabilities returns the [abstract.ScannerCapabilities].
+// Caller should not modify the returned structure.
+func (absclnt *AbstractClient) Capabilities() *abstract.ScannerCapabilities {
+	return absclnt.caps
+}
+
+// Scan sends the scan request to the eSCL scanner.
+//
+// The request is validated against the scanner capabilities, missed
+// parameters are filled with defaults and then translated into
+// the eSCL [ScanSettings].
+//
+// On success, it returns the [abstract.Document] that fetches
+// scanned images using the eSCL NextDocument requests. Closing the
+// Document before all images are consumed or canceling the ctx
+// cancels the scan job at the scanner.
+func (absclnt *AbstractClient) Scan(ctx context.Context,
+	rawreq abstract.ScannerRequest) (abstract.Document, error) {
+
+	req, err := absclnt.caps.FillRequest(&rawreq)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := fromAbstractScanSettings(absclnt.version, req)
+	joburl, _, err := absclnt.clnt.Scan(ctx, *ss)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug(ctx, "eSCL: scan job started: %s", joburl)
+
+	doc := &abstractClientDocument{
+		clnt:   absclnt.clnt,
+		ctx:    ctx,
+		joburl: joburl,
+		res:    req.Resolution,
+		format: req.DocumentFormat,
+		mode:   req.ColorMode,
+		depth:  req.ColorDepth,
+		duplex: req.Input == abstract.InputADF &&
+			req.ADFMode == abstract.ADFModeDuplex,
+	}
+
+	doc.stop = context.AfterFunc(ctx, func() {
+		doc.lock.Lock()
+		doc.cancel()
+		doc.lock.Unlock()
+	})
+
+	return doc, nil
+}
+
+// Close closes the scanner connection.
+func (absclnt *AbstractClient) Close() error {
+	return nil
+}
+
+// abstractClientDocument implements the [abstract.Document] for
+// the AbstractClient.
+type abstractClientDocument struct {
+	clnt     *Client             // Underlying eSCL client
+	ctx      context.Context     // Scan request context
+	joburl   string              // Normalized JobUri
+	res      abstract.Resolution // Document resolution
+	format   string              // Requested document format
+	mode     abstract.ColorMode  // Requested color mode
+	depth    abstract.ColorDepth // Requested color depth
+	duplex   bool                // ADF duplex scan
+	pages    int                 // Count of files returned so far
+	file     *abstractClientFile // Current file, nil if none
+	stop     func() bool         // Stops context.AfterFunc
+	finished bool                // Job is finished at the scanner
+	closed   bool                // Document is closed
+	lock     sync.Mutex          // Access lock
+}
+
+// abstractClientFile implements the [abstract.DocumentFile] for
+// the AbstractClient.
+type abstractClientFile struct {
+	body   io.ReadCloser             // Response body
+	format string                    // Image format
+	info   abstract.DocumentFileInfo // File metadata
+}
+
+// Resolution returns the document's rendering resolution in DPI
+// (dots per inch).
+func (doc *abstractClientDocument) Resolution() abstract.Resolution {
+	return doc.res
+}
+
+// Next returns the next [abstract.DocumentFile].
+func (doc *abstractClientDocument) Next() (abstract.DocumentFile, error) {
+	doc.lock.Lock()
+	defer doc.lock.Unlock()
+
+	// Check document state
+	switch {
+	case doc.closed:
+		return nil, abstract.ErrDocumentClosed
+	case doc.finished:
+		return nil, io.EOF
+	}
+
+	// Close the previous file
+	doc.closeFile()
+
+	// Fetch the next file. Unlock while waiting for response.
+	doc.lock.Unlock()
+	body, details, err := doc.nextDocument()
+	doc.lock.Lock()
+
+	switch {
+	case doc.closed:
+		// Document was closed while we were waiting for
+		// the response.
+		if body != nil {
+			body.Close()
+		}
+		return nil, abstract.ErrDocumentClosed
+
+	case err == io.EOF:
+		doc.finished = true
+		return nil, io.EOF
+
+	case err != nil:
+		doc.cancel()
+		return nil, err
+	}
+
+	// Obtain image format
+	format := doc.format
+	if mediatype, _, err := mime.ParseMediaType(
+		details.ContentType); err == nil {
+		format = mediatype
+	}
+
+	// Fill the file metadata. Image size is not known in advance.
+	doc.pages++
+	info := abstract.DocumentFileInfo{
+		Resolution: doc.res,
+		ColorMode:  doc.mode,
+		ColorDepth: doc.depth,
+		Page:       doc.pages,
+	}
+
+	if doc.duplex {
+		info.Side = abstract.DuplexPageSide(doc.pages)
+	}
+
+	if details.Response.ContentLength > 0 {
+		info.Length = int(details.Response.ContentLength)
+	}
+
+	doc.file = &abstractClientFile{body: body, format: format, info: info}
+	return doc.file, nil
+}
+
+// nextDocument performs the NextDocument request.
+//
+// If scanner is not ready to return the next page yet, it responds
+// with 503 Service Unavailable. In this case request is retried with
+// exponential backoff, until it succeeds, fails with another error,
+// doc.ctx is canceled or Document is closed.
+//
+// Must be called without holding the doc.lock.
+func (doc *abstractClientDocument) nextDocument() (
+	io.ReadCloser, *HTTPDetails, error) {
+
+	delay := abstractClientRetryMin
+	for {
+		body, details, err := doc.clnt.NextDocument(doc.ctx, doc.joburl)
+		if err == nil || details == nil ||
+			details.StatusCode != http.StatusServiceUnavailable {
+			return body, details, err
+		}
+
+		log.Debug(doc.ctx, "eSCL: %s: page not ready, retry in %s",
+			doc.joburl, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-doc.ctx.Done():
+			timer.Stop()
+			return nil, nil, doc.ctx.Err()
+		}
+
+		doc.lock.Lock()
+		closed := doc.closed
+		doc.lock.Unlock()
+
+		if closed {
+			return nil, nil, abstract.ErrDocumentClosed
+		}
+
+		delay = min(delay*2, abstractClientRetryMax)
+	}
+}
+
+// Close closes the Document. It implicitly closes the current
+// image being read.
+//
+// If job is not finished yet, it will be canceled.
+func (doc *abstractClientDocument) Close() error {
+	doc.stop()
+
+	doc.lock.Lock()
+	doc.closeFile()
+	doc.cancel()
+	doc.closed = true
+	doc.lock.Unlock()
+
+	return nil
+}
+
+// closeFile closes the current file, if any.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) closeFile() {
+	if doc.file != nil {
+		doc.file.body.Close()
+		doc.file = nil
+	}
+}
+
+// cancel cancels the job at the scanner, if job is not finished yet.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) cancel() {
+	if doc.finished {
+		return
+	}
+
+	doc.finished = true
+
+	// doc.ctx may be already canceled at this point, so use
+	// a detached context, preserving its values for logging.
+	ctx := context.WithoutCancel(doc.ctx)
+	_, err := doc.clnt.Cancel(ctx, doc.joburl)
+	if err != nil && err != io.EOF {
+		log.Debug(ctx, "eSCL: cancel %s: %s", doc.joburl, err)
+	}
+}
+
+// Format returns the MIME type of the image format used by
+// the document file.
+func (file *abstractClientFile) Format() string {
+	return file.format
+}
+
+// Read reads the document file content as a sequence of bytes.
+// It implements the [io.Reader] interface.
+func (file *abstractClientFile) Read(buf []byte) (int, error) {
+	return file.body.Read(buf)
+}
+
+// Info returns the DocumentFile metadata.
+// It implements the [abstract.DocumentFileWithInfo] interface.
+func (file *abstractClientFile) Info() abstract.DocumentFileInfo {
+	return file.info
+}
@@ -0,0 +1,318 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// eSCL core protocol
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// AbstractClient test
+
+package escl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/assert"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/xmldoc"
+)
+
+// TestAbstractClient tests the AbstractClient
+func TestAbstractClient(t *testing.T) {
+	// Create ScannerCapabilities
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.ESCL.ScannerCapabilities))
+	assert.NoError(err)
+
+	caps, err := DecodeScannerCapabilities(xml)
+	assert.NoError(err)
+
+	// Create loopback transport
+	tr, loopback := transport.NewLoopback()
+
+	// Start virtual scanner
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps.ToAbstract(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	base := transport.MustParseURL("http://localhost/eSCL")
+	options := AbstractServerOptions{
+		Version:  caps.Version,
+		Scanner:  s,
+		BasePath: base.Path,
+	}
+
+	handler := NewAbstractServer(options)
+	server := transport.NewServer(context.Background(), nil, handler)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	// Create AbstractClient
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Errorf("NewAbstractClient: %s", err)
+		return
+	}
+
+	defer absclnt.Close()
+
+	capsExpected := FromAbstractScannerCapabilities(caps.Version, s.ScanCaps)
+	capsPresent := FromAbstractScannerCapabilities(caps.Version,
+		absclnt.Capabilities())
+
+	diff := testutils.Diff(capsPresent, capsExpected)
+	if diff != "" {
+		t.Errorf("AbstractClient.Capabilities:\n%s", diff)
+		return
+	}
+
+	// Scan all pages from ADF
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	doc, err := absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	if doc.Resolution() != s.Resolution {
+		t.Errorf("Document.Resolution mismatch:\n"+
+			"expected: %s\n"+
+			"present:  %s\n",
+			s.Resolution, doc.Resolution())
+	}
+
+	images := 0
+	for {
+		file, err := doc.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Errorf("Document.Next: %s", err)
+			return
+		}
+
+		if file.Format() != imgconv.MIMETypeJPEG {
+			t.Errorf("DocumentFile.Format mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				imgconv.MIMETypeJPEG, file.Format())
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Errorf("DocumentFile.Read: %s", err)
+			return
+		}
+
+		if imgconv.MIMETypeDetect(data) != imgconv.MIMETypeJPEG {
+			t.Errorf("DocumentFile.Read: JPEG image expected")
+		}
+
+		images++
+	}
+
+	doc.Close()
+
+	if images != len(s.ADFImages) {
+		t.Errorf("Document.Next:\n"+
+			"images expected: %d\n"+
+			"images present: %d\n",
+			len(s.ADFImages), images)
+	}
+
+	// Test that Document.Close cancels unfinished job
+	doc, err = absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	_, err = doc.Next()
+	if err != nil {
+		t.Errorf("Document.Next: %s", err)
+		return
+	}
+
+	doc.Close()
+
+	status, _, err := absclnt.clnt.GetScannerStatus(context.TODO())
+	if err != nil {
+		t.Errorf("Client.GetScannerStatus: %s", err)
+		return
+	}
+
+	if status.State != ScannerIdle {
+		t.Errorf("Document.Close: scanner state mismatch:\n"+
+			"expected: %s\n"+
+			"present:  %s\n",
+			ScannerIdle, status.State)
+	}
+
+	if len(status.Jobs) == 0 || status.Jobs[0].JobState != JobCanceled {
+		t.Errorf("Document.Close: job not canceled")
+	}
+
+	_, err = doc.Next()
+	if err != abstract.ErrDocumentClosed {
+		t.Errorf("Document.Next after Close:\n"+
+			"error expected: %s\n"+
+			"error present:  %v\n",
+			abstract.ErrDocumentClosed, err)
+	}
+
+	// Test that context cancellation cancels the job
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	doc, err = absclnt.Scan(ctx, req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	cancel()
+	_, err = doc.Next()
+	if err == nil {
+		t.Errorf("Document.Next after cancel: error expected")
+	}
+	doc.Close()
+
+	status, _, err = absclnt.clnt.GetScannerStatus(context.TODO())
+	if err != nil {
+		t.Errorf("Client.GetScannerStatus: %s", err)
+		return
+	}
+
+	if status.State != ScannerIdle {
+		t.Errorf("Context cancel: scanner state mismatch:\n"+
+			"expected: %s\n"+
+			"present:  %s\n",
+			ScannerIdle, status.State)
+	}
+}
+
+// TestAbstractClientRetry tests that AbstractClient retries the
+// NextDocument request, if scanner responds with 503 Service
+// Unavailable, and doesn't cancel the job
+func TestAbstractClientRetry(t *testing.T) {
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.ESCL.ScannerCapabilities))
+	assert.NoError(err)
+
+	caps, err := DecodeScannerCapabilities(xml)
+	assert.NoError(err)
+
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps.ToAbstract(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	base := transport.MustParseURL("http://localhost/eSCL")
+	handler := NewAbstractServer(AbstractServerOptions{
+		Version:  caps.Version,
+		Scanner:  s,
+		BasePath: base.Path,
+	})
+
+	// Every first NextDocument request for the page is
+	// responded with 503 Service Unavailable
+	var requests atomic.Int32
+	busy := http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		if strings.HasSuffix(rq.URL.Path, "/NextDocument") &&
+			requests.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		handler.ServeHTTP(w, rq)
+	})
+
+	server := transport.NewServer(context.Background(), nil, busy)
+	go server.Serve(loopback)
+	defer server.Close()
+
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	doc, err := absclnt.Scan(context.TODO(), abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	})
+	if err != nil {
+		t.Fatalf("AbstractClient.Scan: %s", err)
+	}
+
+	defer doc.Close()
+
+	images := 0
+	for {
+		file, err := doc.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Document.Next: %s", err)
+		}
+
+		if _, err = io.ReadAll(file); err != nil {
+			t.Fatalf("DocumentFile.Read: %s", err)
+		}
+
+		images++
+	}
+
+	if images != len(s.ADFImages) {
+		t.Errorf("Document.Next:\n"+
+			"images expected: %d\n"+
+			"images present: %d\n",
+			len(s.ADFImages), images)
+	}
+
+	// Each page and the final EOF are retried once
+	if n := requests.Load(); n != 2*int32(images+1) {
+		t.Errorf("NextDocument: %d requests, expected %d",
+			n, 2*(images+1))
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/OpenPrinting/go-mfp/abstract"
 	"github.com/OpenPrinting/go-mfp/log/trace"
@@ -29,13 +30,24 @@ import (
 // [AbstractServer] keeps on its history.
 const AbstractServerHistorySize = 10
 
+// abstractServerErrorHold is how long the scanner state, set by the
+// device error (warming up, cover open and so on), is reported by
+// the ScannerStatus. The AbstractServer doesn't know when the error
+// condition clears, so after this time it reports the scanner as
+// idle again, and the client's next scan request re-checks it.
+const abstractServerErrorHold = 5 * time.Second
+
 // AbstractServer implements eSCL server on a top of [abstract.Scanner].
 type AbstractServer struct {
 	options  AbstractServerOptions         // Server options
 	caps     *abstract.ScannerCapabilities // Scanner capabilities
 	status   ScannerStatus                 // Scanner status
 	document abstract.Document             // Document being server
+	starting bool                          // Scan is being started
+	input    abstract.Input                // Input of the current job
+	errTime  time.Time                     // Time of the device error
 	joburi   string                        // Current JobURI, "" if none
+	imginfo  *ScanImageInfo                // Last image info, nil if none
 	lock     sync.Mutex                    // Access lock
 }
 
@@ -208,6 +220,7 @@ func (srv *AbstractServer) getScannerStatus(query *transport.ServerQuery) {
 
 	// Generate scanner status
 	srv.lock.Lock()
+	srv.refreshStatus()
 	status := srv.status
 	srv.lock.Unlock()
 
@@ -279,8 +292,8 @@ func (srv *AbstractServer) postScanJobs(query *transport.ServerQuery) {
 		}
 	}
 
-	// Check if previous request already in progress
-	if srv.document != nil {
+	// Check if previous request already in progress or being started
+	if srv.document != nil || srv.starting {
 		err := errors.New("Device is busy with the previous request")
 		query.Reject(http.StatusServiceUnavailable, err)
 		return
@@ -289,17 +302,30 @@ func (srv *AbstractServer) postScanJobs(query *transport.ServerQuery) {
 	// Convert it into the abstract.ScannerRequest and validate
 	absreq := ss.ToAbstract()
 
-	// Send request to the underlying abstract.Scanner
+	// Send request to the underlying abstract.Scanner.
+	// Scan may wait for the scanner, shared with other frontends
+	// (see abstract.ScannerArbiter), so don't hold the lock meanwhile.
 	ctx := query.RequestContext()
+
+	srv.starting = true
+	srv.lock.Unlock()
+
 	document, err := srv.options.Scanner.Scan(ctx, absreq)
+
+	srv.lock.Lock()
+	srv.starting = false
+
 	if err != nil {
-		query.Reject(http.StatusConflict, err)
+		query.Reject(srv.deviceError(err, absreq.Input), err)
 		return
 	}
 
 	// Update server status
 	srv.document = document
+	srv.input = absreq.Input
+	srv.errTime = time.Time{}
 	srv.status.State = ScannerProcessing
+	srv.setADFState(ScannerAdfProcessing)
 
 	jobuuid := uuid.Random().URN()
 	joburi := path.Join(srv.options.BasePath, "ScanJobs", jobuuid)
@@ -311,6 +337,7 @@ func (srv *AbstractServer) postScanJobs(query *transport.ServerQuery) {
 	}
 
 	srv.joburi = joburi
+	srv.imginfo = nil
 	srv.status.PushJobInfo(info, AbstractServerHistorySize)
 
 	// Call OnScanJobsResponse hook
@@ -365,6 +392,9 @@ func (srv *AbstractServer) getJobURINextDocument(
 
 	if srv.document != nil && srv.joburi == joburi {
 		file, err = srv.document.Next()
+		if err == nil {
+			srv.imginfo = abstractScanImageInfo(joburi, file)
+		}
 	}
 
 	srv.lock.Unlock()
@@ -380,6 +410,15 @@ func (srv *AbstractServer) getJobURINextDocument(
 		query.Reject(http.StatusNotFound, nil)
 		return
 
+	case errors.Is(err, abstract.ErrADFJam),
+		errors.Is(err, abstract.ErrCoverOpen):
+		srv.finish(JobAborted, AbortedBySystem)
+		srv.lock.Lock()
+		status := srv.deviceError(err, srv.input)
+		srv.lock.Unlock()
+		query.Reject(status, err)
+		return
+
 	case err != nil:
 		srv.finish(JobCanceled, AbortedBySystem)
 		query.Reject(http.StatusServiceUnavailable, err)
@@ -422,7 +461,60 @@ func (srv *AbstractServer) getJobURIScanImageInfo(
 	message := traceMessage{name: "ScanImageInfo"}
 	trace.OnRequest(query, message, nil)
 
-	query.Reject(http.StatusNotImplemented, nil)
+	// Lookup the last image info
+	srv.lock.Lock()
+	info := srv.imginfo
+	srv.lock.Unlock()
+
+	switch {
+	case info == nil:
+		// The underlying abstract.Scanner doesn't provide
+		// the per-page metadata
+		query.Reject(http.StatusNotImplemented, nil)
+		return
+
+	case info.JobURI != joburi:
+		query.Reject(http.StatusNotFound, nil)
+		return
+	}
+
+	// Generate and send XML response
+	xml := info.ToXML()
+	srv.sendXML(query, HookScanImageInfo, xml)
+
+	// Notify tracer on response
+	message.xml = xml
+	trace.OnResponse(query, message, nil)
+}
+
+// abstractScanImageInfo returns the [ScanImageInfo] for the
+// [abstract.DocumentFile], returned by the job with the specified
+// JobURI. If file doesn't provide the per-page metadata (see
+// [abstract.DocumentFileWithInfo]), it returns nil.
+func abstractScanImageInfo(joburi string,
+	file abstract.DocumentFile) *ScanImageInfo {
+
+	withinfo, ok := file.(abstract.DocumentFileWithInfo)
+	if !ok {
+		return nil
+	}
+
+	absinfo := withinfo.Info()
+	info := &ScanImageInfo{
+		JobURI:             joburi,
+		JobUUID:            optional.New(path.Base(joburi)),
+		ActualWidth:        absinfo.Width,
+		ActualHeight:       absinfo.Height,
+		ActualBytesPerLine: absinfo.BytesPerLine(),
+	}
+
+	// BlankPageInfo doesn't tell if the detection was enabled,
+	// so only report pages, actually detected as blank.
+	if blank, ok := file.(abstract.BlankPageInfo); ok && blank.Blank() {
+		info.BlankPageDetected = optional.New(true)
+	}
+
+	return info
 }
 
 // deleteJobURI handles DELETE /{JobUri}
@@ -478,6 +570,75 @@ func (srv *AbstractServer) finish(state JobState, reason JobStateReason) {
 	}
 }
 
+// deviceError updates the scanner status according to the error,
+// returned by the underlying abstract.Scanner, and returns the HTTP
+// status to be sent to the client.
+//
+// The busy (say, warming up) scanner or scanner in use by another
+// job is reported with the 503 Service Unavailable status, so the
+// client will retry the request later.
+// Other errors are reported with the 409 Conflict status, and the
+// client may consult the ScannerStatus for the reason.
+//
+// The input is the input source of the failed job. Open cover is
+// reported as the ADF hatch open only for the ADF jobs.
+//
+// Must be called under the srv.lock.
+func (srv *AbstractServer) deviceError(err error, input abstract.Input) int {
+	if errors.Is(err, abstract.ErrDeviceInUse) {
+		return http.StatusServiceUnavailable
+	}
+
+	srv.errTime = time.Now()
+
+	switch {
+	case errors.Is(err, abstract.ErrDeviceBusy):
+		srv.status.State = ScannerTesting
+		return http.StatusServiceUnavailable
+
+	case errors.Is(err, abstract.ErrADFEmpty):
+		srv.status.State = ScannerIdle
+		srv.setADFState(ScannerAdfEmpty)
+
+	case errors.Is(err, abstract.ErrADFJam):
+		srv.status.State = ScannerStopped
+		srv.setADFState(ScannerAdfJam)
+
+	case errors.Is(err, abstract.ErrCoverOpen):
+		srv.status.State = ScannerStopped
+		if input == abstract.InputADF {
+			srv.setADFState(ScannerAdfHatchOpen)
+		}
+	}
+
+	return http.StatusConflict
+}
+
+// refreshStatus resets the scanner state, set by the deviceError,
+// if it is held longer than abstractServerErrorHold and no job
+// is active.
+//
+// Must be called under the srv.lock.
+func (srv *AbstractServer) refreshStatus() {
+	if srv.errTime.IsZero() || srv.document != nil || srv.starting ||
+		time.Since(srv.errTime) < abstractServerErrorHold {
+		return
+	}
+
+	srv.errTime = time.Time{}
+	srv.status.State = ScannerIdle
+	srv.setADFState(ScannerAdfProcessing)
+}
+
+// setADFState sets the ADF state, if scanner has ADF.
+//
+// Must be called under the srv.lock.
+func (srv *AbstractServer) setADFState(state ADFState) {
+	if srv.status.ADFState != nil {
+		srv.status.ADFState = optional.New(state)
+	}
+}
+
 // sendXML generates and sends the XML response to the query.
 func (srv *AbstractServer) sendXML(query *transport.ServerQuery,
 	action HookAction, xml xmldoc.Element) {
@@ -0,0 +1,394 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// eSCL core protocol
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// AbstractServer test
+
+package escl
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/assert"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/go-mfp/util/xmldoc"
+)
+
+// TestAbstractServerDeviceErrors tests how AbstractServer reports
+// the simulated device errors
+func TestAbstractServerDeviceErrors(t *testing.T) {
+	// Create ScannerCapabilities
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.ESCL.ScannerCapabilities))
+	assert.NoError(err)
+
+	caps, err := DecodeScannerCapabilities(xml)
+	assert.NoError(err)
+
+	// Start virtual scanner
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps.ToAbstract(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	base := transport.MustParseURL("http://localhost/eSCL")
+	options := AbstractServerOptions{
+		Version:  caps.Version,
+		Scanner:  s,
+		BasePath: base.Path,
+	}
+
+	handler := NewAbstractServer(options)
+	server := transport.NewServer(context.Background(), nil, handler)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	// checkStatus checks the scanner status
+	checkStatus := func(name string, state ScannerState, adf ADFState) {
+		t.Helper()
+
+		status, _, err := absclnt.clnt.GetScannerStatus(context.TODO())
+		if err != nil {
+			t.Fatalf("%s: GetScannerStatus: %s", name, err)
+		}
+
+		if status.State != state {
+			t.Errorf("%s: scanner state mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				name, state, status.State)
+		}
+
+		if optional.Get(status.ADFState) != adf {
+			t.Errorf("%s: ADF state mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				name, adf, optional.Get(status.ADFState))
+		}
+	}
+
+	// Paper jam in the middle of the batch
+	s.JamAfter = 1
+
+	doc, err := absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Paper jam: Scan: %s", err)
+	}
+
+	_, err = doc.Next()
+	if err != nil {
+		t.Errorf("Paper jam: first page: %s", err)
+	}
+
+	_, err = doc.Next()
+	if err == nil {
+		t.Errorf("Paper jam: second page: error expected")
+	}
+
+	doc.Close()
+
+	checkStatus("Paper jam", ScannerStopped, ScannerAdfJam)
+
+	status, _, _ := absclnt.clnt.GetScannerStatus(context.TODO())
+	if len(status.Jobs) == 0 || status.Jobs[0].JobState != JobAborted {
+		t.Errorf("Paper jam: job not aborted")
+	}
+
+	// ADF is empty
+	s.JamAfter = 0
+	s.ADFEmpty = true
+
+	_, err = absclnt.Scan(context.TODO(), req)
+	if err == nil {
+		t.Errorf("ADF empty: Scan: error expected")
+	}
+
+	checkStatus("ADF empty", ScannerIdle, ScannerAdfEmpty)
+
+	// Successful scan clears the ADF state
+	s.ADFEmpty = false
+
+	doc, err = absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Scan: %s", err)
+	}
+
+	doc.Close()
+
+	checkStatus("Scan", ScannerIdle, ScannerAdfProcessing)
+
+	// Cover open
+	s.CoverOpen = true
+
+	_, err = absclnt.Scan(context.TODO(), req)
+	if err == nil {
+		t.Errorf("Cover open: Scan: error expected")
+	}
+
+	checkStatus("Cover open", ScannerStopped, ScannerAdfHatchOpen)
+
+	// Warming up
+	s.CoverOpen = false
+
+	doc, err = absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Scan: %s", err)
+	}
+
+	doc.Close()
+
+	s.WarmUp = time.Hour
+
+	_, err = absclnt.Scan(context.TODO(), req)
+	if err == nil {
+		t.Errorf("Warm-up: Scan: error expected")
+	}
+
+	checkStatus("Warm-up", ScannerTesting, ScannerAdfProcessing)
+
+	// The device error state is reset after abstractServerErrorHold
+	handler.lock.Lock()
+	handler.errTime = time.Now().Add(-abstractServerErrorHold)
+	handler.lock.Unlock()
+
+	checkStatus("Warm-up expired", ScannerIdle, ScannerAdfProcessing)
+
+	// Cover open while scanning from platen doesn't affect ADF
+	s.WarmUp = 0
+	s.CoverOpen = true
+
+	platen := req
+	platen.Input = abstract.InputPlaten
+
+	_, err = absclnt.Scan(context.TODO(), platen)
+	if err == nil {
+		t.Errorf("Platen cover open: Scan: error expected")
+	}
+
+	checkStatus("Platen cover open", ScannerStopped, ScannerAdfProcessing)
+}
+
+// TestAbstractServerScanImageInfo tests the ScanImageInfo, generated
+// by the AbstractServer
+func TestAbstractServerScanImageInfo(t *testing.T) {
+	// Create ScannerCapabilities
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.ESCL.ScannerCapabilities))
+	assert.NoError(err)
+
+	caps, err := DecodeScannerCapabilities(xml)
+	assert.NoError(err)
+
+	// Start virtual scanner
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps.ToAbstract(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+	}
+
+	base := transport.MustParseURL("http://localhost/eSCL")
+	options := AbstractServerOptions{
+		Version:  caps.Version,
+		Scanner:  s,
+		BasePath: base.Path,
+	}
+
+	handler := NewAbstractServer(options)
+	server := transport.NewServer(context.Background(), nil, handler)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	clnt := NewClient(base, tr)
+
+	// Scan the single page. The image is extended to the
+	// whole A4 platen at 300 DPI.
+	ss := ScanSettings{
+		Version:     caps.Version,
+		InputSource: optional.New(InputPlaten),
+		ColorMode:   optional.New(RGB24),
+		XResolution: optional.New(300),
+		YResolution: optional.New(300),
+		DocumentFormat: optional.New(
+			imgconv.MIMETypeJPEG),
+	}
+
+	joburl, _, err := clnt.Scan(context.TODO(), ss)
+	if err != nil {
+		t.Fatalf("Scan: %s", err)
+	}
+
+	// No image is fetched yet
+	_, _, err = clnt.ScanImageInfo(context.TODO(), joburl)
+	if err == nil {
+		t.Errorf("ScanImageInfo before NextDocument: error expected")
+	}
+
+	body, _, err := clnt.NextDocument(context.TODO(), joburl)
+	if err != nil {
+		t.Fatalf("NextDocument: %s", err)
+	}
+
+	body.Close()
+
+	info, _, err := clnt.ScanImageInfo(context.TODO(), joburl)
+	if err != nil {
+		t.Fatalf("ScanImageInfo: %s", err)
+	}
+
+	expected := &ScanImageInfo{
+		JobURI:             joburl,
+		JobUUID:            optional.New(path.Base(joburl)),
+		ActualWidth:        2551,
+		ActualHeight:       3508,
+		ActualBytesPerLine: 2551 * 3,
+	}
+
+	if diff := testutils.Diff(info, expected); diff != "" {
+		t.Errorf("ScanImageInfo:\n%s", diff)
+	}
+
+	clnt.Cancel(context.TODO(), joburl)
+}
+
+// TestAbstractServerQueue tests that AbstractServer serves other
+// requests, while its scan request waits for the scanner, shared
+// by the abstract.ScannerArbiter
+func TestAbstractServerQueue(t *testing.T) {
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.ESCL.ScannerCapabilities))
+	assert.NoError(err)
+
+	caps, err := DecodeScannerCapabilities(xml)
+	assert.NoError(err)
+
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps.ToAbstract(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+	}
+
+	arb := &abstract.ScannerArbiter{QueueSize: 1}
+
+	base := transport.MustParseURL("http://localhost/eSCL")
+	handler := NewAbstractServer(AbstractServerOptions{
+		Version:  caps.Version,
+		Scanner:  arb.Scanner("eSCL", s),
+		BasePath: base.Path,
+	})
+
+	server := transport.NewServer(context.Background(), nil, handler)
+	go server.Serve(loopback)
+	defer server.Close()
+
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputPlaten,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	// Occupy the scanner by another frontend
+	other, err := arb.Scanner("WSD", s).Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("WSD: Scan: %s", err)
+	}
+
+	// Start the scan. It waits in the queue.
+	done := make(chan error)
+	go func() {
+		doc, err := absclnt.Scan(context.TODO(), req)
+		if err == nil {
+			doc.Close()
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for arb.Status().Position("eSCL") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("eSCL: scan request not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// ScannerStatus must be served meanwhile, and the next
+	// scan request must be rejected without waiting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, _, err = absclnt.clnt.GetScannerStatus(ctx)
+	if err != nil {
+		t.Errorf("GetScannerStatus: %s", err)
+	}
+
+	_, err = absclnt.Scan(ctx, req)
+	if err == nil {
+		t.Errorf("Scan while queued: error expected")
+	}
+
+	// Release the scanner; the queued scan must succeed
+	other.Close()
+
+	err = <-done
+	if err != nil {
+		t.Errorf("Queued Scan: %s", err)
+	}
+}
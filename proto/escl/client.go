@@ -134,6 +134,19 @@ func (c *Client) NextDocument(ctx context.Context, joburl string) (
 	return
 }
 
+// ScanImageInfo retrieves the [ScanImageInfo] of the image,
+// most recently returned by the [Client.NextDocument].
+func (c *Client) ScanImageInfo(ctx context.Context, joburl string) (
+	info *ScanImageInfo, details *HTTPDetails, err error) {
+
+	xml, details, err := c.getXML(ctx, joburl+"/ScanImageInfo")
+	if err == nil {
+		info, err = DecodeScanImageInfo(xml)
+	}
+
+	return
+}
+
 // Cancel cancels the scan operation currently in progress.
 // If job is already completed, it may return [io.EOF] or no error.
 func (c *Client) Cancel(ctx context.Context, joburl string) (
@@ -27,6 +27,7 @@ const (
 	HookScanJobs
 	HookNextDocument
 	HookDelete
+	HookScanImageInfo
 )
 
 // ServerHooks allows to specify set of hooks (callbacks) that
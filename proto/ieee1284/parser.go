@@ -259,14 +259,30 @@ func (p *Printer) emitDocument() {
 		}
 
 		body := bytes.NewReader(p.docBuf)
-		if err := p.backend.PrintDocument(params, body); err != nil {
-			log.Error(p.ctx, "ieee1284: PrintDocument: %s", err)
+		job, err := p.backend.Submit(p.ctx, params, body)
+		if err != nil {
+			log.Error(p.ctx, "ieee1284: Submit: %s", err)
+		} else {
+			go p.waitJob(job)
 		}
 	}
 	p.docBuf = nil
 	p.format = DocFormatUnknown
 }
 
+// waitJob waits for the job completion and logs its result.
+func (p *Printer) waitJob(job abstract.PrintJob) {
+	status, err := abstract.WaitPrintJob(p.ctx, job)
+	switch {
+	case err != nil:
+		log.Debug(p.ctx, "ieee1284: job %s: %s", status.State, err)
+	case status.Err != nil:
+		log.Error(p.ctx, "ieee1284: job %s: %s", status.State, status.Err)
+	default:
+		log.Debug(p.ctx, "ieee1284: job %s", status.State)
+	}
+}
+
 // Flush should be called when the stream ends to emit any
 // remaining document data that wasn't terminated by an explicit
 // end marker.
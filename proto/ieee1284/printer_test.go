@@ -32,28 +32,21 @@ type docResult struct {
 	data   []byte
 }
 
-// testBackend is a test implementation of abstract.Printer
-// that captures all PrintDocument calls.
-type testBackend struct {
-	results *[]docResult
-}
-
-func (b *testBackend) PrintDocument(
-	params abstract.PrinterRequest, body io.Reader) error {
-	data, err := io.ReadAll(body)
-	if err != nil {
-		return err
-	}
-	cp := make([]byte, len(data))
-	copy(cp, data)
-	*b.results = append(*b.results, docResult{params, cp})
-	return nil
-}
+// testHandler returns a test implementation of abstract.Printer
+// that appends all received documents to the provided slice.
+func testHandler(results *[]docResult) abstract.Printer {
+	return abstract.PrintDocumentFunc(func(ctx context.Context,
+		params abstract.PrinterRequest, body io.Reader) error {
 
-// testHandler returns a testBackend that appends results
-// to the provided slice.
-func testHandler(results *[]docResult) *testBackend {
-	return &testBackend{results: results}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		cp := make([]byte, len(data))
+		copy(cp, data)
+		*results = append(*results, docResult{params, cp})
+		return nil
+	})
 }
 
 // writeInChunks writes data to the printer in fixed-size chunks,
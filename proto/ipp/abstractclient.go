@@ -0,0 +1,388 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// IPP - Internet Printing Protocol implementation
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// abstract.Scanner on a top of IPP Scan client (PWG5100.17)
+
+package ipp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/log"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/goipp"
+)
+
+// Fetch-Document retry delays. When scanner is not ready to return
+// the next document, the request is retried with exponential backoff
+// between these limits.
+const (
+	abstractClientRetryMin = 100 * time.Millisecond
+	abstractClientRetryMax = 2 * time.Second
+)
+
+// AbstractClient implements [abstract.Scanner] on a top of the
+// IPP [Client], using the IPP Scan Service operations, defined
+// in PWG5100.17.
+//
+// It allows IPP Scan scanners to be used via the protocol-independent
+// [abstract.Scanner] interface, the same way as eSCL and WS-Scan
+// scanners.
+type AbstractClient struct {
+	clnt *Client                       // Underlying IPP client
+	caps *abstract.ScannerCapabilities // Scanner capabilities
+}
+
+// NewAbstractClient creates a new [AbstractClient].
+//
+// It queries the scanner for its [PrinterAttributes], so the
+// scanner must be reachable at the time of the call.
+//
+// If tr is nil, [transport.NewTransport] will be used to create
+// a new transport.
+func NewAbstractClient(ctx context.Context,
+	u *url.URL, tr *transport.Transport) (*AbstractClient, error) {
+
+	clnt := NewClient(u, tr)
+
+	attrs, err := clnt.GetPrinterAttributes(ctx, []string{"all"}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	caps := attrs.ScannerDescription.ToAbstract()
+	caps.DocumentFormats = attrs.DocumentFormatSupported
+	caps.MakeAndModel = optional.Get(attrs.PrinterMakeAndModel)
+
+	absclnt := &AbstractClient{
+		clnt: clnt,
+		caps: caps,
+	}
+
+	return absclnt, nil
+}
+
+// Capabilities returns the [abstract.ScannerCapabilities].
+// Caller should not modify the returned structure.
+func (absclnt *AbstractClient) Capabilities() *abstract.ScannerCapabilities {
+	return absclnt.caps
+}
+
+// Scan sends the scan request to the IPP scanner.
+//
+// The request is validated against the scanner capabilities, missed
+// parameters are filled with defaults and then translated into
+// the Create-Job request with the "input-attributes".
+//
+// On success, it returns the [abstract.Document] that fetches
+// scanned images using the Fetch-Document requests, until the
+// scanner reports that no more documents are available. Closing
+// the Document before all images are consumed or canceling the ctx
+// cancels the scan job at the scanner.
+//
+// IPP errors are returned as *[ErrIPP].
+func (absclnt *AbstractClient) Scan(ctx context.Context,
+	rawreq abstract.ScannerRequest) (abstract.Document, error) {
+
+	req, err := absclnt.caps.FillRequest(&rawreq)
+	if err != nil {
+		return nil, err
+	}
+
+	inp := fromAbstractInputAttributes(req)
+
+	// IPP scanners don't advertise brightness, contrast and
+	// sharpness ranges, so send them only if explicitly requested.
+	if rawreq.Brightness == nil {
+		inp.InputBrightness = nil
+	}
+	if rawreq.Contrast == nil {
+		inp.InputContrast = nil
+	}
+	if rawreq.Sharpen == nil {
+		inp.InputSharpness = nil
+	}
+
+	// Platen delivers exactly one image.
+	if req.Input == abstract.InputPlaten {
+		inp.InputImagesToTransfer = optional.New(1)
+	}
+
+	rq := &CreateJobRequest{
+		RequestHeader: DefaultRequestHeader,
+		JobCreateOperation: JobCreateOperation{
+			DocumentFormat:     optional.New(req.DocumentFormat),
+			InputAttributes:    optional.New(inp),
+			JobName:            optional.New("Scan"),
+			RequestingUserName: optional.New("go-mfp"),
+		},
+	}
+
+	job, err := absclnt.clnt.CreateJob(ctx, rq)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug(ctx, "IPP: scan job started: %d", job.JobID)
+
+	doc := &abstractClientDocument{
+		clnt:   absclnt.clnt,
+		ctx:    ctx,
+		jobID:  job.JobID,
+		res:    req.Resolution,
+		format: req.DocumentFormat,
+		mode:   req.ColorMode,
+		depth:  req.ColorDepth,
+		duplex: req.Input == abstract.InputADF &&
+			req.ADFMode == abstract.ADFModeDuplex,
+	}
+
+	doc.stop = context.AfterFunc(ctx, func() {
+		doc.lock.Lock()
+		doc.cancel()
+		doc.lock.Unlock()
+	})
+
+	return doc, nil
+}
+
+// Close closes the scanner connection.
+func (absclnt *AbstractClient) Close() error {
+	return nil
+}
+
+// abstractClientDocument implements the [abstract.Document] for
+// the AbstractClient.
+type abstractClientDocument struct {
+	clnt     *Client             // Underlying IPP client
+	ctx      context.Context     // Scan request context
+	jobID    int                 // Job ID
+	res      abstract.Resolution // Document resolution
+	format   string              // Requested document format
+	mode     abstract.ColorMode  // Requested color mode
+	depth    abstract.ColorDepth // Requested color depth
+	duplex   bool                // ADF duplex scan
+	file     *abstractClientFile // Current file, nil if none
+	docNum   int                 // Number of the last fetched document
+	stop     func() bool         // Stops context.AfterFunc
+	finished bool                // Job is finished at the scanner
+	closed   bool                // Document is closed
+	lock     sync.Mutex          // Access lock
+}
+
+// abstractClientFile implements the [abstract.DocumentFile] for
+// the AbstractClient.
+type abstractClientFile struct {
+	body   io.ReadCloser             // Response body
+	format string                    // Image format
+	info   abstract.DocumentFileInfo // File metadata
+}
+
+// Resolution returns the document's rendering resolution in DPI
+// (dots per inch).
+func (doc *abstractClientDocument) Resolution() abstract.Resolution {
+	return doc.res
+}
+
+// Next returns the next [abstract.DocumentFile].
+func (doc *abstractClientDocument) Next() (abstract.DocumentFile, error) {
+	doc.lock.Lock()
+	defer doc.lock.Unlock()
+
+	// Check document state
+	switch {
+	case doc.closed:
+		return nil, abstract.ErrDocumentClosed
+	case doc.finished:
+		return nil, io.EOF
+	}
+
+	// Close the previous file
+	doc.closeFile()
+
+	// Fetch the next file. Unlock while waiting for response.
+	docNum := doc.docNum + 1
+
+	doc.lock.Unlock()
+	rsp, err := doc.fetchDocument(docNum)
+	doc.lock.Lock()
+
+	var ippErr *ErrIPP
+
+	switch {
+	case doc.closed:
+		// Document was closed while we were waiting for
+		// the response.
+		if rsp != nil {
+			rsp.Body.Close()
+		}
+		return nil, abstract.ErrDocumentClosed
+
+	case errors.As(err, &ippErr) &&
+		ippErr.Status == goipp.StatusErrorNotFound:
+		// The job is done and all its documents are consumed
+		doc.finished = true
+		return nil, io.EOF
+
+	case err != nil:
+		doc.cancel()
+		return nil, err
+	}
+
+	doc.docNum = docNum
+
+	// Obtain image format
+	format := doc.format
+	if rsp.DocumentFormat != nil {
+		format = optional.Get(rsp.DocumentFormat)
+	}
+
+	// Fill the file metadata. Image size is not known in advance.
+	info := abstract.DocumentFileInfo{
+		Resolution: doc.res,
+		ColorMode:  doc.mode,
+		ColorDepth: doc.depth,
+		Page:       docNum,
+	}
+
+	if doc.duplex {
+		info.Side = abstract.DuplexPageSide(docNum)
+	}
+
+	doc.file = &abstractClientFile{body: rsp.Body, format: format, info: info}
+	return doc.file, nil
+}
+
+// fetchDocument performs the Fetch-Document request.
+//
+// If scanner is not ready to return the document yet, it responds
+// with server-error-busy or client-error-not-fetchable. In this case
+// request is retried with exponential backoff, until it succeeds,
+// fails with another error, the job reaches its final state,
+// doc.ctx is canceled or Document is closed.
+//
+// Must be called without holding the doc.lock.
+func (doc *abstractClientDocument) fetchDocument(docNum int) (
+	*FetchDocumentResponse, error) {
+
+	delay := abstractClientRetryMin
+	for {
+		rsp, err := doc.clnt.FetchDocument(doc.ctx, doc.jobID, docNum)
+
+		var ippErr *ErrIPP
+		if !errors.As(err, &ippErr) ||
+			(ippErr.Status != goipp.StatusErrorBusy &&
+				ippErr.Status != goipp.StatusErrorNotFetchable) {
+			return rsp, err
+		}
+
+		log.Debug(doc.ctx, "IPP: job %d: document %d not ready, "+
+			"retry in %s", doc.jobID, docNum, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-doc.ctx.Done():
+			timer.Stop()
+			return nil, doc.ctx.Err()
+		}
+
+		doc.lock.Lock()
+		closed := doc.closed
+		doc.lock.Unlock()
+
+		if closed {
+			return nil, abstract.ErrDocumentClosed
+		}
+
+		// Stop waiting, if job is not in progress anymore.
+		// Failed Get-Job-Attributes is not fatal here, as
+		// Fetch-Document will be retried anyway.
+		status, err2 := doc.clnt.GetJobAttributes(doc.ctx,
+			doc.jobID, []string{"job-state"})
+
+		if err2 == nil {
+			switch status.JobState {
+			case EnJobStateCanceled, EnJobStateAborted,
+				EnJobStateCompleted:
+				doc.lock.Lock()
+				doc.finished = true
+				doc.lock.Unlock()
+				return nil, err
+			}
+		}
+
+		delay = min(delay*2, abstractClientRetryMax)
+	}
+}
+
+// Close closes the Document. It implicitly closes the current
+// image being read.
+//
+// If job is not finished yet, it will be canceled.
+func (doc *abstractClientDocument) Close() error {
+	doc.stop()
+
+	doc.lock.Lock()
+	doc.closeFile()
+	doc.cancel()
+	doc.closed = true
+	doc.lock.Unlock()
+
+	return nil
+}
+
+// closeFile closes the current file, if any.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) closeFile() {
+	if doc.file != nil {
+		doc.file.body.Close()
+		doc.file = nil
+	}
+}
+
+// cancel cancels the job at the scanner, if job is not finished yet.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) cancel() {
+	if doc.finished {
+		return
+	}
+
+	doc.finished = true
+
+	// doc.ctx may be already canceled at this point, so use
+	// a detached context, preserving its values for logging.
+	ctx := context.WithoutCancel(doc.ctx)
+	err := doc.clnt.CancelJob(ctx, doc.jobID)
+	if err != nil {
+		log.Debug(ctx, "IPP: cancel job %d: %s", doc.jobID, err)
+	}
+}
+
+// Format returns the MIME type of the image format used by
+// the document file.
+func (file *abstractClientFile) Format() string {
+	return file.format
+}
+
+// Read reads the document file content as a sequence of bytes.
+// It implements the [io.Reader] interface.
+func (file *abstractClientFile) Read(buf []byte) (int, error) {
+	return file.body.Read(buf)
+}
+
+// Info returns the DocumentFile metadata.
+// It implements the [abstract.DocumentFileWithInfo] interface.
+func (file *abstractClientFile) Info() abstract.DocumentFileInfo {
+	return file.info
+}
@@ -0,0 +1,348 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// IPP - Internet Printing Protocol implementation
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// AbstractClient test
+
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/generic"
+	"github.com/OpenPrinting/goipp"
+)
+
+// testAbstractScannerCaps returns abstract.ScannerCapabilities
+// for the AbstractClient test.
+func testAbstractScannerCaps() *abstract.ScannerCapabilities {
+	inp := &abstract.InputCapabilities{
+		MinWidth:  abstract.Inch / 2,
+		MaxWidth:  abstract.A4Width,
+		MinHeight: abstract.Inch / 2,
+		MaxHeight: abstract.A4Height,
+		Profiles: []abstract.SettingsProfile{
+			{
+				ColorModes: generic.MakeBitset(
+					abstract.ColorModeMono,
+					abstract.ColorModeColor),
+				Depths: generic.MakeBitset(abstract.ColorDepth8),
+				Resolutions: []abstract.Resolution{
+					{XResolution: 150, YResolution: 150},
+					{XResolution: 300, YResolution: 300},
+				},
+			},
+		},
+	}
+
+	return &abstract.ScannerCapabilities{
+		MakeAndModel: "Test IPP Scanner",
+		DocumentFormats: []string{
+			imgconv.MIMETypeJPEG,
+			imgconv.MIMETypePNG,
+		},
+		Platen:     inp,
+		ADFSimplex: inp,
+	}
+}
+
+// TestAbstractClient tests the AbstractClient
+func TestAbstractClient(t *testing.T) {
+	// Create loopback transport
+	tr, loopback := transport.NewLoopback()
+
+	// Start virtual scanner
+	s := &abstract.VirtualScanner{
+		ScanCaps: testAbstractScannerCaps(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	attrs := &PrinterAttributes{}
+	scanner := NewScanner(attrs, ScannerOptions{Scanner: s})
+	server := transport.NewServer(context.Background(), nil, scanner)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	// Create AbstractClient
+	base := transport.MustParseURL("http://localhost/ipp/scan")
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Errorf("NewAbstractClient: %s", err)
+		return
+	}
+
+	defer absclnt.Close()
+
+	caps := absclnt.Capabilities()
+	if !reflect.DeepEqual(caps.DocumentFormats, s.ScanCaps.DocumentFormats) {
+		t.Errorf("AbstractClient.Capabilities: DocumentFormats mismatch:\n"+
+			"expected: %v\n"+
+			"present:  %v\n",
+			s.ScanCaps.DocumentFormats, caps.DocumentFormats)
+	}
+
+	if caps.Platen == nil || caps.ADFSimplex == nil || caps.ADFDuplex != nil {
+		t.Errorf("AbstractClient.Capabilities: inputs mismatch")
+		return
+	}
+
+	if caps.Platen.MaxWidth != abstract.A4Width ||
+		caps.Platen.MaxHeight != abstract.A4Height {
+		t.Errorf("AbstractClient.Capabilities: geometry mismatch:\n"+
+			"expected: %d x %d\n"+
+			"present:  %d x %d\n",
+			abstract.A4Width, abstract.A4Height,
+			caps.Platen.MaxWidth, caps.Platen.MaxHeight)
+	}
+
+	// Scan all pages from ADF
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	doc, err := absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	if doc.Resolution() != s.Resolution {
+		t.Errorf("Document.Resolution mismatch:\n"+
+			"expected: %s\n"+
+			"present:  %s\n",
+			s.Resolution, doc.Resolution())
+	}
+
+	images := 0
+	for {
+		file, err := doc.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Errorf("Document.Next: %s", err)
+			return
+		}
+
+		if file.Format() != imgconv.MIMETypeJPEG {
+			t.Errorf("DocumentFile.Format mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				imgconv.MIMETypeJPEG, file.Format())
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Errorf("DocumentFile.Read: %s", err)
+			return
+		}
+
+		if imgconv.MIMETypeDetect(data) != imgconv.MIMETypeJPEG {
+			t.Errorf("DocumentFile.Read: JPEG image expected")
+		}
+
+		images++
+	}
+
+	doc.Close()
+
+	if images != len(s.ADFImages) {
+		t.Errorf("Document.Next:\n"+
+			"images expected: %d\n"+
+			"images present: %d\n",
+			len(s.ADFImages), images)
+	}
+
+	jobID := doc.(*abstractClientDocument).jobID
+	testAbstractClientJobState(t, absclnt, jobID, EnJobStateCompleted)
+
+	// Test that Document.Close cancels unfinished job
+	doc, err = absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	_, err = doc.Next()
+	if err != nil {
+		t.Errorf("Document.Next: %s", err)
+		return
+	}
+
+	doc.Close()
+
+	jobID = doc.(*abstractClientDocument).jobID
+	testAbstractClientJobState(t, absclnt, jobID, EnJobStateCanceled)
+
+	_, err = doc.Next()
+	if err != abstract.ErrDocumentClosed {
+		t.Errorf("Document.Next after Close:\n"+
+			"error expected: %s\n"+
+			"error present:  %v\n",
+			abstract.ErrDocumentClosed, err)
+	}
+
+	// Test that context cancellation cancels the job
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	doc, err = absclnt.Scan(ctx, req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	cancel()
+	_, err = doc.Next()
+	if err == nil {
+		t.Errorf("Document.Next after cancel: error expected")
+	}
+	doc.Close()
+
+	jobID = doc.(*abstractClientDocument).jobID
+	testAbstractClientJobState(t, absclnt, jobID, EnJobStateCanceled)
+}
+
+// TestAbstractClientRetry tests that AbstractClient retries the
+// Fetch-Document request, if scanner responds with server-error-busy,
+// and doesn't cancel the job
+func TestAbstractClientRetry(t *testing.T) {
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: testAbstractScannerCaps(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	attrs := &PrinterAttributes{}
+	scanner := NewScanner(attrs, ScannerOptions{Scanner: s})
+
+	// Every first Fetch-Document request for the document is
+	// responded with server-error-busy
+	var requests atomic.Int32
+	busy := http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		data, _ := io.ReadAll(rq.Body)
+		rq.Body = io.NopCloser(bytes.NewReader(data))
+
+		var msg goipp.Message
+		err := msg.DecodeBytes(data)
+		if err == nil && goipp.Op(msg.Code) == goipp.OpFetchDocument &&
+			requests.Add(1)%2 == 1 {
+			rsp := goipp.NewResponse(msg.Version,
+				goipp.StatusErrorBusy, msg.RequestID)
+			rsp.Operation.Add(goipp.MakeAttribute(
+				"attributes-charset",
+				goipp.TagCharset, goipp.String("utf-8")))
+			rsp.Operation.Add(goipp.MakeAttribute(
+				"attributes-natural-language",
+				goipp.TagLanguage, goipp.String("en-us")))
+
+			w.Header().Set("Content-Type", goipp.ContentType)
+			rsp.Encode(w)
+			return
+		}
+
+		scanner.ServeHTTP(w, rq)
+	})
+
+	server := transport.NewServer(context.Background(), nil, busy)
+	go server.Serve(loopback)
+	defer server.Close()
+
+	base := transport.MustParseURL("http://localhost/ipp/scan")
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	doc, err := absclnt.Scan(context.TODO(), abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	})
+	if err != nil {
+		t.Fatalf("AbstractClient.Scan: %s", err)
+	}
+
+	defer doc.Close()
+
+	images := 0
+	for {
+		file, err := doc.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Document.Next: %s", err)
+		}
+
+		io.Copy(io.Discard, file)
+		images++
+	}
+
+	if images != len(s.ADFImages) {
+		t.Errorf("Document.Next:\n"+
+			"images expected: %d\n"+
+			"images present: %d\n",
+			len(s.ADFImages), images)
+	}
+
+	if n := int(requests.Load()); n != 2*(images+1) {
+		t.Errorf("Fetch-Document: %d requests, expected %d",
+			n, 2*(images+1))
+	}
+
+	jobID := doc.(*abstractClientDocument).jobID
+	testAbstractClientJobState(t, absclnt, jobID, EnJobStateCompleted)
+}
+
+// testAbstractClientJobState checks the job state at the scanner
+func testAbstractClientJobState(t *testing.T,
+	absclnt *AbstractClient, jobID int, expected EnJobState) {
+
+	status, err := absclnt.clnt.GetJobAttributes(context.TODO(),
+		jobID, nil)
+	if err != nil {
+		t.Errorf("Client.GetJobAttributes: %s", err)
+		return
+	}
+
+	if status.JobState != expected {
+		t.Errorf("job %d: state mismatch:\n"+
+			"expected: %d\n"+
+			"present:  %d\n",
+			jobID, expected, status.JobState)
+	}
+}
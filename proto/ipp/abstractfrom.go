@@ -21,11 +21,12 @@ func fromAbstractScannerDescription(
 	caps *abstract.ScannerCapabilities) ScannerDescription {
 
 	sd := ScannerDescription{
-		InputSourceSupported:     abstractInputSources(caps),
-		InputColorModeSupported:  abstractInputColorModes(caps),
-		InputResolutionSupported: abstractInputResolutions(caps),
-		InputSidesSupported:      abstractInputSides(caps),
-		InputAttributesSupported: abstractInputAttributesSupported(caps),
+		InputSourceSupported:      abstractInputSources(caps),
+		InputColorModeSupported:   abstractInputColorModes(caps),
+		InputResolutionSupported:  abstractInputResolutions(caps),
+		InputScanRegionsSupported: abstractInputScanRegions(caps),
+		InputSidesSupported:       abstractInputSides(caps),
+		InputAttributesSupported:  abstractInputAttributesSupported(caps),
 	}
 
 	if req := caps.DefaultRequest(); req != nil {
@@ -126,6 +127,50 @@ func abstractInputResolutions(
 	return out
 }
 
+// abstractInputScanRegions returns InputScanRegionsSupported, derived
+// from the abstract scanner capabilities.
+//
+// As IPP doesn't distinguish geometry of different inputs, the
+// returned ranges cover all inputs.
+func abstractInputScanRegions(
+	caps *abstract.ScannerCapabilities) optional.Val[InputScanRegionsSupported] {
+
+	inputs := abstractAllInputs(caps)
+	if inputs == nil {
+		return nil
+	}
+
+	var minWid, maxWid, minHei, maxHei, maxXOff, maxYOff abstract.Dimension
+	for i, inp := range inputs {
+		if i == 0 || inp.MinWidth < minWid {
+			minWid = inp.MinWidth
+		}
+		if i == 0 || inp.MinHeight < minHei {
+			minHei = inp.MinHeight
+		}
+
+		maxWid = generic.Max(maxWid, inp.MaxWidth)
+		maxHei = generic.Max(maxHei, inp.MaxHeight)
+		maxXOff = generic.Max(maxXOff, inp.MaxXOffset)
+		maxYOff = generic.Max(maxYOff, inp.MaxYOffset)
+	}
+
+	// MaxXOffset and MaxYOffset are optional
+	if maxXOff == 0 {
+		maxXOff = maxWid - minWid
+	}
+	if maxYOff == 0 {
+		maxYOff = maxHei - minHei
+	}
+
+	return optional.New(InputScanRegionsSupported{
+		XDimension: goipp.Range{Lower: int(minWid), Upper: int(maxWid)},
+		XOrigin:    goipp.Range{Lower: 0, Upper: int(maxXOff)},
+		YDimension: goipp.Range{Lower: int(minHei), Upper: int(maxHei)},
+		YOrigin:    goipp.Range{Lower: 0, Upper: int(maxYOff)},
+	})
+}
+
 // abstractInputSides returns InputSidesSupported values derived
 // from the abstract scanner capabilities.
 func abstractInputSides(caps *abstract.ScannerCapabilities) []KwSides {
@@ -275,3 +320,55 @@ func abstractAllInputs(
 
 	return inputs
 }
+
+// fromAbstractJobState translates [abstract.PrintJobState] into
+// the IPP job-state.
+func fromAbstractJobState(state abstract.PrintJobState) EnJobState {
+	switch state {
+	case abstract.PrintJobProcessing:
+		return EnJobStateProcessing
+	case abstract.PrintJobCompleted:
+		return EnJobStateCompleted
+	case abstract.PrintJobCanceled:
+		return EnJobStateCanceled
+	case abstract.PrintJobAborted:
+		return EnJobStateAborted
+	}
+
+	return EnJobStatePending
+}
+
+// fromAbstractJobStateReasons translates set of
+// [abstract.PrintJobStateReason] into the IPP job-state-reasons.
+func fromAbstractJobStateReasons(
+	reasons generic.Bitset[abstract.PrintJobStateReason]) []KwJobStateReasons {
+
+	kw := []KwJobStateReasons{}
+
+	for _, reason := range reasons.Elements() {
+		switch reason {
+		case abstract.PrintJobReasonIncoming:
+			kw = append(kw, KwJobStateReasonsJobIncoming)
+		case abstract.PrintJobReasonPrinting:
+			kw = append(kw, KwJobStateReasonsJobPrinting)
+		case abstract.PrintJobReasonProcessingToStopPoint:
+			kw = append(kw, KwJobStateReasonsProcessingToStopPoint)
+		case abstract.PrintJobReasonCanceledByUser:
+			kw = append(kw, KwJobStateReasonsJobCanceledByUser)
+		case abstract.PrintJobReasonAbortedBySystem:
+			kw = append(kw, KwJobStateReasonsAbortedBySystem)
+		case abstract.PrintJobReasonCompletedSuccessfully:
+			kw = append(kw, KwJobStateReasonsJobCompletedSuccessfully)
+		case abstract.PrintJobReasonDocumentFormatError:
+			kw = append(kw, KwJobStateReasonsDocumentFormatError)
+		case abstract.PrintJobReasonUnsupportedDocumentFormat:
+			kw = append(kw, KwJobStateReasonsUnsupportedDocumentFormat)
+		}
+	}
+
+	if len(kw) == 0 {
+		kw = append(kw, KwJobStateReasonsNone)
+	}
+
+	return kw
+}
@@ -8,7 +8,12 @@
 
 package ipp
 
-import "github.com/OpenPrinting/go-mfp/abstract"
+import (
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/util/generic"
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/goipp"
+)
 
 // sidesToAbstract maps a KwSides IPP keyword to abstract.Sides.
 func sidesToAbstract(kw KwSides) abstract.Sides {
@@ -73,3 +78,57 @@ func inputColorModeToAbstract(cm KwInputColorMode) (
 	// KwInputColorModeAuto and unknown values: let caps choose.
 	return abstract.ColorModeUnset, abstract.ColorDepthUnset
 }
+
+// resolutionToAbstract maps goipp.Resolution to abstract.Resolution.
+// Resolutions in dots per centimeter are converted into DPI.
+func resolutionToAbstract(r goipp.Resolution) abstract.Resolution {
+	res := abstract.Resolution{XResolution: r.Xres, YResolution: r.Yres}
+	if r.Units == goipp.UnitsDpcm {
+		res.XResolution = (r.Xres*254 + 50) / 100
+		res.YResolution = (r.Yres*254 + 50) / 100
+	}
+	return res
+}
+
+// inputGeometryToAbstract fills geometry of the abstract.InputCapabilities
+// from the ScannerDescription.
+//
+// It uses the "input-scan-regions-supported", if available, with
+// fallback to sizes of the "input-media-supported" and then to
+// the A4 size.
+func inputGeometryToAbstract(inp *abstract.InputCapabilities,
+	sd *ScannerDescription) {
+
+	if sd.InputScanRegionsSupported != nil {
+		regions := optional.Get(sd.InputScanRegionsSupported)
+		inp.MinWidth = abstract.Dimension(regions.XDimension.Lower)
+		inp.MaxWidth = abstract.Dimension(regions.XDimension.Upper)
+		inp.MinHeight = abstract.Dimension(regions.YDimension.Lower)
+		inp.MaxHeight = abstract.Dimension(regions.YDimension.Upper)
+		inp.MaxXOffset = abstract.Dimension(regions.XOrigin.Upper)
+		inp.MaxYOffset = abstract.Dimension(regions.YOrigin.Upper)
+		return
+	}
+
+	for _, media := range sd.InputMediaSupported {
+		size := mediaSizeToAbstract(KwMedia(media))
+		if size.IsZero() {
+			continue
+		}
+
+		if inp.MaxWidth == 0 || size.Width < inp.MinWidth {
+			inp.MinWidth = size.Width
+		}
+		if inp.MaxHeight == 0 || size.Height < inp.MinHeight {
+			inp.MinHeight = size.Height
+		}
+
+		inp.MaxWidth = generic.Max(inp.MaxWidth, size.Width)
+		inp.MaxHeight = generic.Max(inp.MaxHeight, size.Height)
+	}
+
+	if inp.MaxWidth == 0 || inp.MaxHeight == 0 {
+		inp.MaxWidth = abstract.A4Width
+		inp.MaxHeight = abstract.A4Height
+	}
+}
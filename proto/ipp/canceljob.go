@@ -0,0 +1,100 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// IPP - Internet Printing Protocol implementation
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Cancel-Job request
+
+package ipp
+
+import (
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/goipp"
+)
+
+// CancelJobRequest operation (0x0008) cancels the Job.
+type CancelJobRequest struct {
+	ObjectRawAttrs
+	RequestHeader
+	OperationGroup
+
+	// Operation attributes
+	PrinterURI         string               `ipp:"printer-uri"`
+	JobID              int                  `ipp:"job-id"`
+	RequestingUserName optional.Val[string] `ipp:"requesting-user-name"`
+	Message            optional.Val[string] `ipp:"message"`
+}
+
+// CancelJobResponse is the Cancel-Job response.
+type CancelJobResponse struct {
+	ObjectRawAttrs
+	ResponseHeader
+	OperationGroup
+}
+
+// GetOp returns CancelJobRequest IPP Operation code.
+func (rq *CancelJobRequest) GetOp() goipp.Op {
+	return goipp.OpCancelJob
+}
+
+// Encode encodes CancelJobRequest into the goipp.Message.
+func (rq *CancelJobRequest) Encode() *goipp.Message {
+	enc := ippEncoder{}
+
+	groups := goipp.Groups{
+		{
+			Tag:   goipp.TagOperationGroup,
+			Attrs: enc.Encode(rq),
+		},
+	}
+
+	msg := goipp.NewMessageWithGroups(rq.Version, goipp.Code(rq.GetOp()),
+		rq.RequestID, groups)
+
+	return msg
+}
+
+// Decode decodes CancelJobRequest from goipp.Message.
+func (rq *CancelJobRequest) Decode(
+	msg *goipp.Message, opt *DecoderOptions) error {
+
+	rq.Version = msg.Version
+	rq.RequestID = msg.RequestID
+
+	dec := NewDecoder(opt)
+	defer dec.Free()
+
+	return dec.Decode(rq, msg.Operation)
+}
+
+// Encode encodes CancelJobResponse into goipp.Message.
+func (rsp *CancelJobResponse) Encode() *goipp.Message {
+	enc := ippEncoder{}
+
+	groups := goipp.Groups{
+		{
+			Tag:   goipp.TagOperationGroup,
+			Attrs: enc.Encode(rsp),
+		},
+	}
+
+	msg := goipp.NewMessageWithGroups(rsp.Version, goipp.Code(rsp.Status),
+		rsp.RequestID, groups)
+
+	return msg
+}
+
+// Decode decodes CancelJobResponse from goipp.Message.
+func (rsp *CancelJobResponse) Decode(
+	msg *goipp.Message, opt *DecoderOptions) error {
+
+	rsp.Version = msg.Version
+	rsp.RequestID = msg.RequestID
+	rsp.Status = goipp.Status(msg.Code)
+
+	dec := NewDecoder(opt)
+	defer dec.Free()
+
+	return dec.Decode(rsp, msg.Operation)
+}
@@ -15,10 +15,12 @@ import (
 	"io"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"testing"
 
 	"github.com/OpenPrinting/go-mfp/abstract"
 	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/goipp"
 )
 
 // testBackend is a test implementation of abstract.Printer.
@@ -29,12 +31,15 @@ type testBackend struct {
 	err    error
 }
 
-func (b *testBackend) PrintDocument(
-	params abstract.PrinterRequest, body io.Reader) error {
+func (b *testBackend) Submit(ctx context.Context,
+	params abstract.PrinterRequest, body io.Reader) (abstract.PrintJob, error) {
 	b.called = true
 	b.params = params
 	b.data, b.err = io.ReadAll(body)
-	return b.err
+
+	job := abstract.NewPrintJobTracker(ctx)
+	job.Finish(b.err)
+	return job, b.err
 }
 
 // testNewCaptPrinter creates a minimal Printer for capture testing.
@@ -200,3 +205,229 @@ func TestDocumentReceiverLargeDoc(t *testing.T) {
 		t.Error("large document data mismatch")
 	}
 }
+
+// testAsyncBackend is a test implementation of abstract.Printer,
+// that processes jobs asynchronously. Each job prints one
+// impression and waits for the release signal or cancellation.
+type testAsyncBackend struct {
+	release chan struct{} // Closed to complete jobs
+	jobs    chan *abstract.PrintJobTracker
+}
+
+func (b *testAsyncBackend) Submit(ctx context.Context,
+	params abstract.PrinterRequest, body io.Reader) (abstract.PrintJob, error) {
+
+	if params.Format == "application/x-bad" {
+		return nil, abstract.ErrUnsupportedFormat
+	}
+
+	_, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	job := abstract.NewPrintJobTracker(ctx)
+	job.SetProcessing()
+
+	go func() {
+		job.AddImpressions(1, 1)
+		select {
+		case <-b.release:
+			job.Finish(nil)
+		case <-job.Context().Done():
+			job.Finish(job.Context().Err())
+		}
+	}()
+
+	b.jobs <- job
+	return job, nil
+}
+
+// testCaptSubmit creates a job and sends a single document into it.
+// It returns the job ID and the Send-Document response.
+func testCaptSubmit(t *testing.T, client *Client, ippURI, format string) (
+	int, *SendDocumentResponse) {
+
+	t.Helper()
+	ctx := context.Background()
+
+	createRq := &CreateJobRequest{
+		RequestHeader: DefaultRequestHeader,
+		JobCreateOperation: JobCreateOperation{
+			PrinterURI: ippURI,
+		},
+		Job: &JobAttributes{},
+	}
+	createRsp := &CreateJobResponse{}
+	if err := client.Do(ctx, createRq, createRsp); err != nil {
+		t.Fatalf("Create-Job: %v", err)
+	}
+
+	sendRq := &SendDocumentRequest{
+		RequestHeader:  DefaultRequestHeader,
+		PrinterURI:     optional.New(ippURI),
+		JobID:          optional.New(createRsp.Job.JobID),
+		DocumentFormat: optional.New(format),
+		LastDocument:   true,
+		Job:            &JobAttributes{},
+	}
+	sendRq.Body = bytes.NewReader([]byte("test data"))
+
+	sendRsp := &SendDocumentResponse{}
+	if err := client.Do(ctx, sendRq, sendRsp); err != nil {
+		t.Fatalf("Send-Document: %v", err)
+	}
+
+	return createRsp.Job.JobID, sendRsp
+}
+
+// testCaptJobStatus returns the job status via Get-Job-Attributes.
+func testCaptJobStatus(t *testing.T, client *Client, ippURI string,
+	id int) *JobStatus {
+
+	t.Helper()
+
+	rq := &GetJobAttributesRequest{
+		RequestHeader: DefaultRequestHeader,
+		PrinterURI:    ippURI,
+		JobID:         id,
+	}
+	rsp := &GetJobAttributesResponse{}
+	if err := client.Do(context.Background(), rq, rsp); err != nil {
+		t.Fatalf("Get-Job-Attributes: %v", err)
+	}
+
+	return rsp.Job
+}
+
+// TestJobStateCompleted verifies that the IPP job state follows
+// the state of the backend job.
+func TestJobStateCompleted(t *testing.T) {
+	printer := testNewCaptPrinter(t)
+	backend := &testAsyncBackend{
+		release: make(chan struct{}),
+		jobs:    make(chan *abstract.PrintJobTracker, 1),
+	}
+	printer.SetPrintBackend(backend)
+
+	srv := httptest.NewServer(printer)
+	defer srv.Close()
+
+	httpURL, ippURI := testCaptPrinterURL(srv)
+	client := NewClient(httpURL, nil)
+
+	id, sendRsp := testCaptSubmit(t, client, ippURI, "image/pwg-raster")
+	if sendRsp.Job.JobState != EnJobStateProcessing {
+		t.Errorf("Send-Document: job-state: got %d, want %d",
+			sendRsp.Job.JobState, EnJobStateProcessing)
+	}
+
+	job := <-backend.jobs
+	close(backend.release)
+	<-job.Done()
+
+	status := testCaptJobStatus(t, client, ippURI, id)
+	if status.JobState != EnJobStateCompleted {
+		t.Errorf("job-state: got %d, want %d",
+			status.JobState, EnJobStateCompleted)
+	}
+
+	if optional.Get(status.JobImpressionsCompleted) != 1 {
+		t.Errorf("job-impressions-completed: got %v, want 1",
+			status.JobImpressionsCompleted)
+	}
+
+	want := []KwJobStateReasons{KwJobStateReasonsJobCompletedSuccessfully}
+	if !reflect.DeepEqual(status.JobStateReasons, want) {
+		t.Errorf("job-state-reasons: got %v, want %v",
+			status.JobStateReasons, want)
+	}
+}
+
+// TestJobStateCanceled verifies that Cancel-Job cancels the
+// backend job.
+func TestJobStateCanceled(t *testing.T) {
+	printer := testNewCaptPrinter(t)
+	backend := &testAsyncBackend{
+		release: make(chan struct{}),
+		jobs:    make(chan *abstract.PrintJobTracker, 1),
+	}
+	printer.SetPrintBackend(backend)
+
+	srv := httptest.NewServer(printer)
+	defer srv.Close()
+
+	httpURL, ippURI := testCaptPrinterURL(srv)
+	client := NewClient(httpURL, nil)
+	ctx := context.Background()
+
+	id, _ := testCaptSubmit(t, client, ippURI, "image/pwg-raster")
+	job := <-backend.jobs
+
+	cancelRq := &CancelJobRequest{
+		RequestHeader: DefaultRequestHeader,
+		PrinterURI:    ippURI,
+		JobID:         id,
+	}
+	cancelRsp := &CancelJobResponse{}
+	if err := client.Do(ctx, cancelRq, cancelRsp); err != nil {
+		t.Fatalf("Cancel-Job: %v", err)
+	}
+
+	<-job.Done()
+
+	status := testCaptJobStatus(t, client, ippURI, id)
+	if status.JobState != EnJobStateCanceled {
+		t.Errorf("job-state: got %d, want %d",
+			status.JobState, EnJobStateCanceled)
+	}
+
+	want := []KwJobStateReasons{KwJobStateReasonsJobCanceledByUser}
+	if !reflect.DeepEqual(status.JobStateReasons, want) {
+		t.Errorf("job-state-reasons: got %v, want %v",
+			status.JobStateReasons, want)
+	}
+
+	// Finished job cannot be canceled
+	cancelRsp = &CancelJobResponse{}
+	err := client.Do(ctx, cancelRq, cancelRsp)
+	if err != nil {
+		t.Fatalf("Cancel-Job: %v", err)
+	}
+
+	if cancelRsp.Status != goipp.StatusErrorNotPossible {
+		t.Errorf("Cancel-Job: status: got %s, want %s",
+			cancelRsp.Status, goipp.StatusErrorNotPossible)
+	}
+}
+
+// TestJobStateAborted verifies that documents, rejected by the
+// backend, abort the job.
+func TestJobStateAborted(t *testing.T) {
+	printer := testNewCaptPrinter(t)
+	backend := &testAsyncBackend{}
+	printer.SetPrintBackend(backend)
+
+	srv := httptest.NewServer(printer)
+	defer srv.Close()
+
+	httpURL, ippURI := testCaptPrinterURL(srv)
+	client := NewClient(httpURL, nil)
+
+	id, _ := testCaptSubmit(t, client, ippURI, "application/x-bad")
+
+	status := testCaptJobStatus(t, client, ippURI, id)
+	if status.JobState != EnJobStateAborted {
+		t.Errorf("job-state: got %d, want %d",
+			status.JobState, EnJobStateAborted)
+	}
+
+	want := []KwJobStateReasons{
+		KwJobStateReasonsAbortedBySystem,
+		KwJobStateReasonsUnsupportedDocumentFormat,
+	}
+	if !reflect.DeepEqual(status.JobStateReasons, want) {
+		t.Errorf("job-state-reasons: got %v, want %v",
+			status.JobStateReasons, want)
+	}
+}
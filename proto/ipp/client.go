@@ -225,3 +225,128 @@ func (c *Client) GetPrinterAttributes(ctx context.Context,
 
 	return rsp.Printer, nil
 }
+
+// CreateJob sends the Create-Job request and returns the [JobStatus]
+// of the created job.
+//
+// For the IPP Scan Service (PWG5100.17), the scan parameters are
+// passed as the JobCreateOperation.InputAttributes.
+//
+// If rq.PrinterURI is empty, c.URL is used instead. If rq.Job is nil,
+// empty [JobAttributes] are sent.
+func (c *Client) CreateJob(ctx context.Context,
+	rq *CreateJobRequest) (*JobStatus, error) {
+
+	rq2 := *rq
+	if rq2.PrinterURI == "" {
+		rq2.PrinterURI = c.URL.String()
+	}
+	if rq2.Job == nil {
+		rq2.Job = &JobAttributes{}
+	}
+
+	rsp := &CreateJobResponse{}
+	err := c.Do(ctx, &rq2, rsp)
+	if err == nil {
+		err = statusError(rsp)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rsp.Job, nil
+}
+
+// FetchDocument fetches the document with the specified number
+// (starting from 1) from the job, identified by the jobID.
+//
+// On success, the document data is available as the response Body,
+// and caller MUST close it after use.
+//
+// If the Printer responds with the IPP error status, it is returned
+// as *[ErrIPP].
+func (c *Client) FetchDocument(ctx context.Context,
+	jobID, docNum int) (*FetchDocumentResponse, error) {
+
+	rq := &FetchDocumentRequest{
+		RequestHeader:  DefaultRequestHeader,
+		PrinterURI:     c.URL.String(),
+		JobID:          jobID,
+		DocumentNumber: docNum,
+	}
+
+	rsp := &FetchDocumentResponse{}
+	err := c.DoWithBody(ctx, rq, rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = statusError(rsp)
+	if err != nil {
+		rsp.Body.Close()
+		return nil, err
+	}
+
+	return rsp, nil
+}
+
+// GetJobAttributes returns attributes of the job, identified
+// by the jobID. The attrs attribute allows to specify list of
+// requested attributes.
+func (c *Client) GetJobAttributes(ctx context.Context,
+	jobID int, attrs []string) (*JobStatus, error) {
+
+	rq := &GetJobAttributesRequest{
+		RequestHeader:       DefaultRequestHeader,
+		PrinterURI:          c.URL.String(),
+		JobID:               jobID,
+		RequestedAttributes: attrs,
+	}
+
+	rsp := &GetJobAttributesResponse{}
+	err := c.Do(ctx, rq, rsp)
+	if err == nil {
+		err = statusError(rsp)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rsp.Job, nil
+}
+
+// CancelJob cancels the job, identified by the jobID.
+func (c *Client) CancelJob(ctx context.Context, jobID int) error {
+	rq := &CancelJobRequest{
+		RequestHeader: DefaultRequestHeader,
+		PrinterURI:    c.URL.String(),
+		JobID:         jobID,
+	}
+
+	rsp := &CancelJobResponse{}
+	err := c.Do(ctx, rq, rsp)
+	if err == nil {
+		err = statusError(rsp)
+	}
+
+	return err
+}
+
+// statusError returns *[ErrIPP] if the [Response] status is not
+// successful, or nil otherwise.
+func statusError(rsp Response) error {
+	hdr := rsp.Header()
+	if hdr.Status < 0x0100 {
+		// 0x0000-0x00ff are "successful" status codes
+		return nil
+	}
+
+	return &ErrIPP{
+		Version:       hdr.Version,
+		RequestID:     hdr.RequestID,
+		Status:        hdr.Status,
+		StatusMessage: hdr.StatusMessage,
+	}
+}
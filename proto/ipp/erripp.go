@@ -85,7 +85,7 @@ func (e *ErrIPP) Encode() *goipp.Message {
 		goipp.TagLanguage, goipp.String("en-US")))
 
 	if e.StatusMessage != "" {
-		msg.Operation.Add(goipp.MakeAttribute("status-message,",
+		msg.Operation.Add(goipp.MakeAttribute("status-message",
 			goipp.TagText, goipp.String(e.StatusMessage)))
 	}
 
@@ -0,0 +1,113 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// IPP - Internet Printing Protocol implementation
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Fetch-Document request
+
+package ipp
+
+import (
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/goipp"
+)
+
+// FetchDocumentRequest operation (0x0042) fetches the document data.
+//
+// In the IPP Scan Service (PWG5100.17), it is used by the client to
+// retrieve the scanned documents. Document data is returned as the
+// response body.
+type FetchDocumentRequest struct {
+	ObjectRawAttrs
+	RequestHeader
+	OperationGroup
+
+	// Operation attributes
+	PrinterURI             string               `ipp:"printer-uri"`
+	JobID                  int                  `ipp:"job-id"`
+	DocumentNumber         int                  `ipp:"document-number"`
+	RequestingUserName     optional.Val[string] `ipp:"requesting-user-name"`
+	CompressionAccepted    []KwCompression      `ipp:"compression-accepted"`
+	DocumentFormatAccepted []string             `ipp:"document-format-accepted"`
+}
+
+// FetchDocumentResponse is the Fetch-Document response.
+//
+// On success, the document data follows the IPP message and is
+// available as the ResponseHeader.Body.
+type FetchDocumentResponse struct {
+	ObjectRawAttrs
+	ResponseHeader
+	OperationGroup
+
+	// Operation attributes
+	Compression    optional.Val[KwCompression] `ipp:"compression"`
+	DocumentFormat optional.Val[string]        `ipp:"document-format"`
+}
+
+// GetOp returns FetchDocumentRequest IPP Operation code.
+func (rq *FetchDocumentRequest) GetOp() goipp.Op {
+	return goipp.OpFetchDocument
+}
+
+// Encode encodes FetchDocumentRequest into the goipp.Message.
+func (rq *FetchDocumentRequest) Encode() *goipp.Message {
+	enc := ippEncoder{}
+
+	groups := goipp.Groups{
+		{
+			Tag:   goipp.TagOperationGroup,
+			Attrs: enc.Encode(rq),
+		},
+	}
+
+	msg := goipp.NewMessageWithGroups(rq.Version, goipp.Code(rq.GetOp()),
+		rq.RequestID, groups)
+
+	return msg
+}
+
+// Decode decodes FetchDocumentRequest from goipp.Message.
+func (rq *FetchDocumentRequest) Decode(
+	msg *goipp.Message, opt *DecoderOptions) error {
+
+	rq.Version = msg.Version
+	rq.RequestID = msg.RequestID
+
+	dec := NewDecoder(opt)
+	defer dec.Free()
+
+	return dec.Decode(rq, msg.Operation)
+}
+
+// Encode encodes FetchDocumentResponse into goipp.Message.
+func (rsp *FetchDocumentResponse) Encode() *goipp.Message {
+	enc := ippEncoder{}
+
+	groups := goipp.Groups{
+		{
+			Tag:   goipp.TagOperationGroup,
+			Attrs: enc.Encode(rsp),
+		},
+	}
+
+	msg := goipp.NewMessageWithGroups(rsp.Version, goipp.Code(rsp.Status),
+		rsp.RequestID, groups)
+
+	return msg
+}
+
+// Decode decodes FetchDocumentResponse from goipp.Message.
+func (rsp *FetchDocumentResponse) Decode(
+	msg *goipp.Message, opt *DecoderOptions) error {
+
+	rsp.Version = msg.Version
+	rsp.RequestID = msg.RequestID
+	rsp.Status = goipp.Status(msg.Code)
+
+	dec := NewDecoder(opt)
+	defer dec.Free()
+
+	return dec.Decode(rsp, msg.Operation)
+}
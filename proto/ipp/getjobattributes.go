@@ -0,0 +1,118 @@
+// MFP - Miulti-Function Printers and scanners toolkit
+// IPP - Internet Printing Protocol implementation
+//
+// Copyright (C) 2024 and up by Alexander Pevzner (pzz@apevzner.com)
+// See LICENSE for license terms and conditions
+//
+// Get-Job-Attributes request
+
+package ipp
+
+import (
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/goipp"
+)
+
+// GetJobAttributesRequest operation (0x0009) returns the requested
+// attributes of the Job.
+type GetJobAttributesRequest struct {
+	ObjectRawAttrs
+	RequestHeader
+	OperationGroup
+
+	// Operation attributes
+	PrinterURI          string               `ipp:"printer-uri"`
+	JobID               int                  `ipp:"job-id"`
+	RequestingUserName  optional.Val[string] `ipp:"requesting-user-name"`
+	RequestedAttributes []string             `ipp:"requested-attributes"`
+}
+
+// GetJobAttributesResponse is the Get-Job-Attributes response.
+type GetJobAttributesResponse struct {
+	ObjectRawAttrs
+	ResponseHeader
+	OperationGroup
+
+	// Unsupported attributes, if any
+	UnsupportedAttributes goipp.Attributes
+
+	// Job status
+	Job *JobStatus
+}
+
+// GetOp returns GetJobAttributesRequest IPP Operation code.
+func (rq *GetJobAttributesRequest) GetOp() goipp.Op {
+	return goipp.OpGetJobAttributes
+}
+
+// Encode encodes GetJobAttributesRequest into the goipp.Message.
+func (rq *GetJobAttributesRequest) Encode() *goipp.Message {
+	enc := ippEncoder{}
+
+	groups := goipp.Groups{
+		{
+			Tag:   goipp.TagOperationGroup,
+			Attrs: enc.Encode(rq),
+		},
+	}
+
+	msg := goipp.NewMessageWithGroups(rq.Version, goipp.Code(rq.GetOp()),
+		rq.RequestID, groups)
+
+	return msg
+}
+
+// Decode decodes GetJobAttributesRequest from goipp.Message.
+func (rq *GetJobAttributesRequest) Decode(
+	msg *goipp.Message, opt *DecoderOptions) error {
+
+	rq.Version = msg.Version
+	rq.RequestID = msg.RequestID
+
+	dec := NewDecoder(opt)
+	defer dec.Free()
+
+	return dec.Decode(rq, msg.Operation)
+}
+
+// Encode encodes GetJobAttributesResponse into goipp.Message.
+func (rsp *GetJobAttributesResponse) Encode() *goipp.Message {
+	enc := ippEncoder{}
+
+	groups := goipp.Groups{
+		{
+			Tag:   goipp.TagOperationGroup,
+			Attrs: enc.Encode(rsp),
+		},
+	}
+
+	if rsp.Job != nil {
+		groups = append(groups, goipp.Group{
+			Tag:   goipp.TagJobGroup,
+			Attrs: enc.Encode(rsp.Job),
+		})
+	}
+
+	msg := goipp.NewMessageWithGroups(rsp.Version, goipp.Code(rsp.Status),
+		rsp.RequestID, groups)
+
+	return msg
+}
+
+// Decode decodes GetJobAttributesResponse from goipp.Message.
+func (rsp *GetJobAttributesResponse) Decode(
+	msg *goipp.Message, opt *DecoderOptions) error {
+
+	rsp.Version = msg.Version
+	rsp.RequestID = msg.RequestID
+	rsp.Status = goipp.Status(msg.Code)
+	rsp.UnsupportedAttributes = msg.Unsupported
+
+	var err error
+	rsp.Job, err = DecodeJobStatusAttributes(msg.Job, opt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -19,7 +19,7 @@ import (
 type Handler struct {
 	Op       goipp.Op
 	callback func(context.Context, *goipp.Message, io.Reader) (
-		*goipp.Message, error)
+		*goipp.Message, io.ReadCloser, error)
 }
 
 // NewHandler creates a new IPP handler from the function that
@@ -36,17 +36,40 @@ func NewHandler[RQT any,
 		Request
 	}](f func(ctx context.Context, rq RQ) (*goipp.Message, error)) *Handler {
 
+	return NewHandlerWithBody(func(ctx context.Context, rq RQ) (
+		*goipp.Message, io.ReadCloser, error) {
+
+		rsp, err := f(ctx, rq)
+		return rsp, nil, err
+	})
+}
+
+// NewHandlerWithBody is like [NewHandler], but the handler function
+// returns the response body in addition to the [goipp.Message].
+//
+// If returned body is not nil, it is sent to the client immediately
+// after the IPP response message and then closed.
+//
+// It is useful for operations that return document data, like
+// Fetch-Document.
+func NewHandlerWithBody[RQT any,
+	RQ interface {
+		*RQT
+		Request
+	}](f func(ctx context.Context, rq RQ) (
+	*goipp.Message, io.ReadCloser, error)) *Handler {
+
 	callback := func(ctx context.Context,
 		rqMsg *goipp.Message, body io.Reader) (
 
-		*goipp.Message, error) {
+		*goipp.Message, io.ReadCloser, error) {
 
 		rq := RQ(new(RQT))
 		rq.Header().setBody(body)
 
 		err := rq.Decode(rqMsg, nil)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		return f(ctx, rq)
@@ -60,6 +83,6 @@ func NewHandler[RQT any,
 
 // handle handles the received request.
 func (h *Handler) handle(ctx context.Context, rq *goipp.Message, body io.Reader) (
-	*goipp.Message, error) {
+	*goipp.Message, io.ReadCloser, error) {
 	return h.callback(ctx, rq, body)
 }
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/util/generic"
 	"github.com/OpenPrinting/go-mfp/util/optional"
 	"github.com/OpenPrinting/go-mfp/util/uuid"
 )
@@ -22,7 +24,12 @@ type job struct {
 	JobCreateOperation            // Job create-time operation attributes
 	JobAttributes                 // Job creation attributes
 	SendDocumentActive bool       // Send-Document in progress
+	LastDocument       bool       // Last document received
+	Canceled           bool       // Cancel-Job received
 	lock               sync.Mutex // Access lock
+
+	// Documents, submitted to the print backend
+	docs []abstract.PrintJob
 }
 
 // newJob creates a new job.
@@ -56,3 +63,95 @@ func (j *job) Lock() {
 func (j *job) Unlock() {
 	j.lock.Unlock()
 }
+
+// Accepting reports whether job accepts more documents.
+func (j *job) Accepting() bool {
+	return !j.LastDocument && !j.Canceled
+}
+
+// AddDocument adds the document, submitted to the print backend.
+func (j *job) AddDocument(doc abstract.PrintJob) {
+	j.docs = append(j.docs, doc)
+}
+
+// Cancel cancels the job and all its documents.
+func (j *job) Cancel() {
+	j.Canceled = true
+	for _, doc := range j.docs {
+		doc.Cancel()
+	}
+}
+
+// UpdateStatus updates the job status attributes, based on
+// status of the job's documents.
+//
+// While at least one document is being processed, the job is
+// processing. When all documents are finished and no more
+// documents are expected, the job is completed, canceled or
+// aborted, depending on the documents' final state.
+func (j *job) UpdateStatus() {
+	var reasons generic.Bitset[abstract.PrintJobStateReason]
+	impressions, sheets := 0, 0
+	processing := false
+	aborted, canceled := false, j.Canceled
+	message := ""
+
+	for _, doc := range j.docs {
+		status := doc.Status()
+
+		impressions += status.ImpressionsCompleted
+		sheets += status.MediaSheetsCompleted
+		reasons = reasons.Union(status.Reasons)
+
+		switch status.State {
+		case abstract.PrintJobPending, abstract.PrintJobProcessing:
+			processing = true
+		case abstract.PrintJobCanceled:
+			canceled = true
+		case abstract.PrintJobAborted:
+			aborted = true
+			if message == "" && status.Err != nil {
+				message = status.Err.Error()
+			}
+		}
+	}
+
+	state := abstract.PrintJobCompleted
+
+	switch {
+	case processing:
+		state = abstract.PrintJobProcessing
+	case j.Accepting():
+		j.JobState = EnJobStatePendingHeld
+		j.JobStateReasons = []KwJobStateReasons{
+			KwJobStateReasonsJobIncoming,
+		}
+		return
+	case canceled:
+		state = abstract.PrintJobCanceled
+	case aborted:
+		state = abstract.PrintJobAborted
+	}
+
+	// Some documents may be completed while job as a whole is not
+	if state != abstract.PrintJobCompleted {
+		reasons.Del(abstract.PrintJobReasonCompletedSuccessfully)
+	}
+
+	if state == abstract.PrintJobCanceled {
+		reasons.Add(abstract.PrintJobReasonCanceledByUser)
+	}
+
+	if j.Accepting() {
+		reasons.Add(abstract.PrintJobReasonIncoming)
+	}
+
+	j.JobState = fromAbstractJobState(state)
+	j.JobStateReasons = fromAbstractJobStateReasons(reasons)
+	j.JobImpressionsCompleted = optional.New(impressions)
+	j.JobMediaSheetsCompleted = optional.New(sheets)
+
+	if message != "" {
+		j.JobStateMessage = optional.New(message)
+	}
+}
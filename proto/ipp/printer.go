@@ -20,11 +20,11 @@ import (
 
 // Printer implements the IPP printer.
 type Printer struct {
-	options PrinterOptions       // Printer options
-	server  *Server              // Underlying IPP server
-	attrs   *PrinterAttributes   // Printer attributes
-	q       *queue               // Job queue
-	backend abstract.Printer // Print backend
+	options PrinterOptions     // Printer options
+	server  *Server            // Underlying IPP server
+	attrs   *PrinterAttributes // Printer attributes
+	q       *queue             // Job queue
+	backend abstract.Printer   // Print backend
 }
 
 // PrinterOptions extends [ServerOptions] with printer-specific
@@ -60,12 +60,18 @@ func NewPrinter(attrs *PrinterAttributes, options PrinterOptions) *Printer {
 	server.RegisterHandler(NewHandler(printer.handleValidateJob))
 	server.RegisterHandler(NewHandler(printer.handleCreateJob))
 	server.RegisterHandler(NewHandler(printer.handleSendDocument))
+	server.RegisterHandler(NewHandler(printer.handleCancelJob))
+	server.RegisterHandler(NewHandler(printer.handleGetJobAttributes))
 
 	return printer
 }
 
 // SetPrintBackend installs backend as the handler for incoming
 // print documents. Pass nil to clear a previously set backend.
+//
+// Each received document is submitted to the backend as a separate
+// [abstract.PrintJob]. The IPP job state is derived from state of
+// these jobs.
 func (printer *Printer) SetPrintBackend(backend abstract.Printer) {
 	printer.backend = backend
 }
@@ -160,10 +166,10 @@ func (printer *Printer) handleSendDocument(
 	defer j.Unlock()
 
 	// Check job state
-	if j.JobState != EnJobStatePendingHeld {
+	if !j.Accepting() {
 		err := NewErrIPPFromRequest(rq,
 			goipp.StatusErrorNotPossible,
-			"job is not in pending-held state")
+			"job doesn't accept more documents")
 		return nil, err
 	}
 
@@ -178,6 +184,8 @@ func (printer *Printer) handleSendDocument(
 	j.SendDocumentActive = true
 	j.Unlock()
 
+	var doc abstract.PrintJob
+
 	if printer.backend != nil {
 		// Build protocol-independent job parameters
 		params := abstract.PrinterRequest{}
@@ -205,8 +213,19 @@ func (printer *Printer) handleSendDocument(
 			}
 		}
 
-		if err := printer.backend.PrintDocument(params, rq.Body); err != nil {
+		// Job processing continues after the request completion,
+		// so it must not be canceled with the request context.
+		jobctx := context.WithoutCancel(ctx)
+
+		var err error
+		doc, err = printer.backend.Submit(jobctx, params, rq.Body)
+		if err != nil {
 			log.Error(ctx, "Send-Document: backend error: %s", err)
+
+			// Record rejected document as aborted
+			tracker := abstract.NewPrintJobTracker(jobctx)
+			tracker.Finish(err)
+			doc = tracker
 		}
 	} else {
 		// No backend — drain the body so the connection stays clean
@@ -221,6 +240,21 @@ func (printer *Printer) handleSendDocument(
 	j.Lock()
 	j.SendDocumentActive = false
 
+	if doc != nil {
+		j.AddDocument(doc)
+
+		// Job could be canceled while document was being received
+		if j.Canceled {
+			doc.Cancel()
+		}
+	}
+
+	if rq.LastDocument {
+		j.LastDocument = true
+	}
+
+	j.UpdateStatus()
+
 	// Generate response
 	rsp := &SendDocumentResponse{
 		Job: &JobStatus{
@@ -233,3 +267,70 @@ func (printer *Printer) handleSendDocument(
 
 	return rsp.Encode(), nil
 }
+
+// handleCancelJob handles Cancel-Job request.
+func (printer *Printer) handleCancelJob(
+	ctx context.Context,
+	rq *CancelJobRequest) (*goipp.Message, error) {
+
+	// Lookup the job
+	j := printer.q.JobByID(rq.JobID)
+	if j == nil {
+		err := NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job not found (job-id=%d)", rq.JobID)
+		return nil, err
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	// Check job state
+	j.UpdateStatus()
+
+	switch j.JobState {
+	case EnJobStateCanceled, EnJobStateAborted, EnJobStateCompleted:
+		err := NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotPossible,
+			"job already finished (job-state=%d)", j.JobState)
+		return nil, err
+	}
+
+	// Cancel the job
+	j.Cancel()
+	j.UpdateStatus()
+
+	rsp := CancelJobResponse{
+		ResponseHeader: rq.ResponseHeader(goipp.StatusOk),
+	}
+
+	return rsp.Encode(), nil
+}
+
+// handleGetJobAttributes handles Get-Job-Attributes request.
+func (printer *Printer) handleGetJobAttributes(
+	ctx context.Context,
+	rq *GetJobAttributesRequest) (*goipp.Message, error) {
+
+	// Lookup the job
+	j := printer.q.JobByID(rq.JobID)
+	if j == nil {
+		err := NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job not found (job-id=%d)", rq.JobID)
+		return nil, err
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	j.UpdateStatus()
+	status := j.JobStatus
+
+	rsp := GetJobAttributesResponse{
+		ResponseHeader: rq.ResponseHeader(goipp.StatusOk),
+		Job:            &status,
+	}
+
+	return rsp.Encode(), nil
+}
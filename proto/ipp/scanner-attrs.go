@@ -9,6 +9,8 @@
 package ipp
 
 import (
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/util/generic"
 	"github.com/OpenPrinting/go-mfp/util/optional"
 	"github.com/OpenPrinting/goipp"
 )
@@ -25,6 +27,19 @@ type InputScanRegion struct {
 	YOrigin    optional.Val[int] `ipp:"y-origin"`
 }
 
+// InputScanRegionsSupported represents the "input-scan-regions-supported"
+// printer description attribute.
+//
+// It defines the supported ranges of the "input-scan-regions" members.
+// All dimensions are in hundredths of a millimeter (1/100 mm).
+// See PWG5100.15.
+type InputScanRegionsSupported struct {
+	XDimension goipp.Range `ipp:"x-dimension"`
+	XOrigin    goipp.Range `ipp:"x-origin"`
+	YDimension goipp.Range `ipp:"y-dimension"`
+	YOrigin    goipp.Range `ipp:"y-origin"`
+}
+
 // OutputAttributes represents the "output-attributes" collection.
 //
 // It is used in scan job operation requests to specify per-job
@@ -94,6 +109,9 @@ type ScannerDescription struct {
 	// PWG5100.15: resolution
 	InputResolutionSupported []goipp.Resolution `ipp:"input-resolution-supported"`
 
+	// PWG5100.15: scan regions
+	InputScanRegionsSupported optional.Val[InputScanRegionsSupported] `ipp:"input-scan-regions-supported"`
+
 	// PWG5100.15: sides (reuses KwSides values from RFC8011, 5.2.8)
 	InputSidesSupported []KwSides `ipp:"input-sides-supported"`
 
@@ -109,3 +127,69 @@ type ScannerDescription struct {
 	// PWG5100.17: which output-attributes member attributes are supported.
 	OutputAttributesSupported []string `ipp:"output-attributes-supported"`
 }
+
+// ToAbstract converts [ScannerDescription] into the
+// *[abstract.ScannerCapabilities].
+//
+// ScannerDescription contains only scanner-specific attributes, so
+// the general information, like DocumentFormats or MakeAndModel,
+// is left unset and must be filled by the caller from the
+// [PrinterDescription].
+//
+// IPP doesn't distinguish capabilities of the different inputs,
+// so all inputs share the same geometry and settings profiles.
+func (sd *ScannerDescription) ToAbstract() *abstract.ScannerCapabilities {
+	caps := &abstract.ScannerCapabilities{}
+
+	inp := &abstract.InputCapabilities{}
+	inputGeometryToAbstract(inp, sd)
+
+	prof := abstract.SettingsProfile{}
+	for _, cm := range sd.InputColorModeSupported {
+		mode, depth := inputColorModeToAbstract(cm)
+		switch mode {
+		case abstract.ColorModeUnset:
+			continue
+		case abstract.ColorModeBinary:
+			prof.BinaryRenderings.Add(abstract.BinaryRenderingThreshold)
+		default:
+			if depth == abstract.ColorDepthUnset {
+				depth = abstract.ColorDepth8
+			}
+			prof.Depths.Add(depth)
+		}
+		prof.ColorModes.Add(mode)
+	}
+
+	seen := generic.NewSet[abstract.Resolution]()
+	for _, r := range sd.InputResolutionSupported {
+		res := resolutionToAbstract(r)
+		if res.Valid() && seen.TestAndAdd(res) {
+			prof.Resolutions = append(prof.Resolutions, res)
+		}
+	}
+
+	inp.Profiles = []abstract.SettingsProfile{prof}
+
+	duplex := false
+	for _, sides := range sd.InputSidesSupported {
+		if sides == KwSidesTwoSidedLongEdge ||
+			sides == KwSidesTwoSidedShortEdge {
+			duplex = true
+		}
+	}
+
+	for _, src := range sd.InputSourceSupported {
+		switch src {
+		case KwInputSourcePlaten:
+			caps.Platen = inp.Clone()
+		case KwInputSourceADF:
+			caps.ADFSimplex = inp.Clone()
+			if duplex {
+				caps.ADFDuplex = inp.Clone()
+			}
+		}
+	}
+
+	return caps
+}
@@ -10,10 +10,13 @@ package ipp
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	"sync"
 
 	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/util/optional"
 	"github.com/OpenPrinting/goipp"
 )
 
@@ -26,6 +29,8 @@ type Scanner struct {
 
 	activeDoc abstract.Document
 	activeJob int
+	activeNum int
+	starting  bool
 	lock      sync.Mutex
 }
 
@@ -50,6 +55,11 @@ func NewScanner(attrs *PrinterAttributes, options ScannerOptions) *Scanner {
 	attrs.ScannerDescription =
 		fromAbstractScannerDescription(options.Scanner.Capabilities())
 
+	if len(attrs.DocumentFormatSupported) == 0 {
+		attrs.DocumentFormatSupported =
+			options.Scanner.Capabilities().DocumentFormats
+	}
+
 	server := NewServer(options.ServerOptions)
 	scanner := &Scanner{
 		options: options,
@@ -61,6 +71,9 @@ func NewScanner(attrs *PrinterAttributes, options ScannerOptions) *Scanner {
 	// Install scan-service handlers.
 	server.RegisterHandler(NewHandler(scanner.handleGetPrinterAttributes))
 	server.RegisterHandler(NewHandler(scanner.handleCreateScanJob))
+	server.RegisterHandler(NewHandlerWithBody(scanner.handleFetchDocument))
+	server.RegisterHandler(NewHandler(scanner.handleGetJobAttributes))
+	server.RegisterHandler(NewHandler(scanner.handleCancelJob))
 
 	return scanner
 }
@@ -101,17 +114,35 @@ func (scanner *Scanner) handleCreateScanJob(
 			"invalid scan parameters: %s", err)
 	}
 
-	// Single-document model: reject if another scan is already active.
+	// Single-document model: reject if another scan is already active
+	// or being started.
 	scanner.lock.Lock()
-	if scanner.activeDoc != nil {
+	if scanner.activeDoc != nil || scanner.starting {
 		scanner.lock.Unlock()
 		return nil, NewErrIPPFromRequest(rq,
 			goipp.StatusErrorBusy,
 			"scanner is busy with another job")
 	}
 
+	// Scan may wait for the scanner, shared with other frontends
+	// (see abstract.ScannerArbiter), so don't hold the lock meanwhile.
+	scanner.starting = true
+	scanner.lock.Unlock()
+
 	doc, err := scanner.options.Scanner.Scan(ctx, *filled)
-	if err != nil {
+
+	scanner.lock.Lock()
+	scanner.starting = false
+
+	switch {
+	case errors.Is(err, abstract.ErrDeviceInUse),
+		errors.Is(err, abstract.ErrDeviceBusy):
+		scanner.lock.Unlock()
+		return nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorBusy,
+			"scanner is busy: %s", err)
+
+	case err != nil:
 		scanner.lock.Unlock()
 		return nil, NewErrIPPFromRequest(rq,
 			goipp.StatusErrorDevice,
@@ -123,6 +154,7 @@ func (scanner *Scanner) handleCreateScanJob(
 
 	scanner.activeDoc = doc
 	scanner.activeJob = j.JobID
+	scanner.activeNum = 0
 	scanner.lock.Unlock()
 
 	j.Lock()
@@ -142,3 +174,151 @@ func (scanner *Scanner) handleCreateScanJob(
 
 	return rsp.Encode(), nil
 }
+
+// handleFetchDocument handles Fetch-Document request.
+//
+// Each request returns the next scanned image of the active job.
+// When all images are consumed, the job is completed and
+// client-error-not-found is returned.
+//
+// Images are streamed from the scanner, so documents must be
+// fetched in order, each one only once. Request for the already
+// fetched document fails with client-error-not-found, request
+// that skips documents fails with client-error-not-fetchable.
+func (scanner *Scanner) handleFetchDocument(
+	ctx context.Context,
+	rq *FetchDocumentRequest) (*goipp.Message, io.ReadCloser, error) {
+
+	j := scanner.q.JobByID(rq.JobID)
+	if j == nil {
+		return nil, nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job %d not found", rq.JobID)
+	}
+
+	scanner.lock.Lock()
+	defer scanner.lock.Unlock()
+
+	if scanner.activeDoc == nil || scanner.activeJob != rq.JobID {
+		return nil, nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job %d: no more documents", rq.JobID)
+	}
+
+	switch next := scanner.activeNum + 1; {
+	case rq.DocumentNumber < next:
+		return nil, nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job %d: document %d already fetched",
+			rq.JobID, rq.DocumentNumber)
+
+	case rq.DocumentNumber > next:
+		return nil, nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFetchable,
+			"job %d: document %d not available, next is %d",
+			rq.JobID, rq.DocumentNumber, next)
+	}
+
+	file, err := scanner.activeDoc.Next()
+	switch {
+	case err == io.EOF:
+		scanner.finishJob(j, EnJobStateCompleted,
+			KwJobStateReasonsJobCompletedSuccessfully)
+		return nil, nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job %d: no more documents", rq.JobID)
+
+	case err != nil:
+		scanner.finishJob(j, EnJobStateAborted,
+			KwJobStateReasonsAbortedBySystem)
+		return nil, nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorDevice,
+			"scan failed: %s", err)
+	}
+
+	scanner.activeNum = rq.DocumentNumber
+
+	j.Lock()
+	j.JobImpressionsCompleted = optional.New(
+		optional.Get(j.JobImpressionsCompleted) + 1)
+	j.Unlock()
+
+	rsp := FetchDocumentResponse{
+		ResponseHeader: rq.ResponseHeader(goipp.StatusOk),
+		DocumentFormat: optional.New(file.Format()),
+	}
+
+	return rsp.Encode(), io.NopCloser(file), nil
+}
+
+// handleGetJobAttributes handles Get-Job-Attributes request.
+func (scanner *Scanner) handleGetJobAttributes(
+	ctx context.Context,
+	rq *GetJobAttributesRequest) (*goipp.Message, error) {
+
+	j := scanner.q.JobByID(rq.JobID)
+	if j == nil {
+		return nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job %d not found", rq.JobID)
+	}
+
+	j.Lock()
+	status := j.JobStatus
+	j.Unlock()
+
+	rsp := GetJobAttributesResponse{
+		ResponseHeader: rq.ResponseHeader(goipp.StatusOk),
+		Job:            &status,
+	}
+
+	return rsp.Encode(), nil
+}
+
+// handleCancelJob handles Cancel-Job request.
+func (scanner *Scanner) handleCancelJob(
+	ctx context.Context,
+	rq *CancelJobRequest) (*goipp.Message, error) {
+
+	j := scanner.q.JobByID(rq.JobID)
+	if j == nil {
+		return nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotFound,
+			"job %d not found", rq.JobID)
+	}
+
+	scanner.lock.Lock()
+	defer scanner.lock.Unlock()
+
+	if scanner.activeDoc == nil || scanner.activeJob != rq.JobID {
+		return nil, NewErrIPPFromRequest(rq,
+			goipp.StatusErrorNotPossible,
+			"job %d already finished", rq.JobID)
+	}
+
+	scanner.finishJob(j, EnJobStateCanceled,
+		KwJobStateReasonsJobCanceledByUser)
+
+	rsp := CancelJobResponse{
+		ResponseHeader: rq.ResponseHeader(goipp.StatusOk),
+	}
+
+	return rsp.Encode(), nil
+}
+
+// finishJob closes the active document and moves the job into
+// the final state.
+// Must be called under the scanner.lock.
+func (scanner *Scanner) finishJob(j *job,
+	state EnJobState, reason KwJobStateReasons) {
+
+	scanner.activeDoc.Close()
+	scanner.activeDoc = nil
+	scanner.activeJob = 0
+	scanner.activeNum = 0
+
+	j.Lock()
+	j.JobState = state
+	j.JobStateReasons = []KwJobStateReasons{reason}
+	j.Unlock()
+}
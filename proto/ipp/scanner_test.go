@@ -0,0 +1,212 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// IPP - Internet Printing Protocol implementation
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// IPP Scan Service test
+
+package ipp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/goipp"
+)
+
+// TestScannerFetchDocumentNumber tests that Scanner serves
+// documents strictly in order of the document-number
+func TestScannerFetchDocumentNumber(t *testing.T) {
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: testAbstractScannerCaps(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	attrs := &PrinterAttributes{}
+	scanner := NewScanner(attrs, ScannerOptions{Scanner: s})
+	server := transport.NewServer(context.Background(), nil, scanner)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	base := transport.MustParseURL("http://localhost/ipp/scan")
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	// Create the job. Its documents are fetched below directly
+	// by the Client.
+	doc, err := absclnt.Scan(context.TODO(), abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	})
+	if err != nil {
+		t.Fatalf("AbstractClient.Scan: %s", err)
+	}
+
+	defer doc.Close()
+
+	jobID := doc.(*abstractClientDocument).jobID
+
+	type testData struct {
+		docNum int          // Requested document number
+		status goipp.Status // Expected status
+	}
+
+	tests := []testData{
+		{2, goipp.StatusErrorNotFetchable},
+		{1, goipp.StatusOk},
+		{1, goipp.StatusErrorNotFound},
+		{3, goipp.StatusErrorNotFetchable},
+		{2, goipp.StatusOk},
+		{2, goipp.StatusErrorNotFound},
+		{3, goipp.StatusErrorNotFound},
+	}
+
+	for _, test := range tests {
+		rsp, err := absclnt.clnt.FetchDocument(context.TODO(),
+			jobID, test.docNum)
+
+		status := goipp.StatusOk
+		var ippErr *ErrIPP
+		switch {
+		case errors.As(err, &ippErr):
+			status = ippErr.Status
+		case err != nil:
+			t.Fatalf("Fetch-Document %d: %s", test.docNum, err)
+		default:
+			io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+
+		if status != test.status {
+			t.Errorf("Fetch-Document %d: status mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				test.docNum, test.status, status)
+		}
+	}
+
+	testAbstractClientJobState(t, absclnt, jobID, EnJobStateCompleted)
+}
+
+// TestScannerQueue tests that Scanner serves other requests, while
+// its scan request waits for the scanner, shared by the
+// abstract.ScannerArbiter
+func TestScannerQueue(t *testing.T) {
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: testAbstractScannerCaps(),
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+	}
+
+	arb := &abstract.ScannerArbiter{QueueSize: 1}
+
+	attrs := &PrinterAttributes{}
+	scanner := NewScanner(attrs,
+		ScannerOptions{Scanner: arb.Scanner("IPP", s)})
+	server := transport.NewServer(context.Background(), nil, scanner)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	base := transport.MustParseURL("http://localhost/ipp/scan")
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputPlaten,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	// Make a finished job
+	doc, err := absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("AbstractClient.Scan: %s", err)
+	}
+
+	doc.Close()
+	jobID := doc.(*abstractClientDocument).jobID
+
+	// Occupy the scanner by another frontend
+	other, err := arb.Scanner("eSCL", s).Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("eSCL: Scan: %s", err)
+	}
+
+	// Start the scan. It waits in the queue.
+	done := make(chan error)
+	go func() {
+		doc, err := absclnt.Scan(context.TODO(), req)
+		if err == nil {
+			doc.Close()
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for arb.Status().Position("IPP") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("IPP: scan request not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Cancel-Job must be served meanwhile, and the next
+	// scan request must be rejected without waiting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err = absclnt.clnt.CancelJob(ctx, jobID)
+	var ippErr *ErrIPP
+	if !errors.As(err, &ippErr) ||
+		ippErr.Status != goipp.StatusErrorNotPossible {
+		t.Errorf("Cancel-Job of finished job: unexpected error: %v",
+			err)
+	}
+
+	_, err = absclnt.Scan(ctx, req)
+	if !errors.As(err, &ippErr) || ippErr.Status != goipp.StatusErrorBusy {
+		t.Errorf("Scan while queued: unexpected error: %v", err)
+	}
+
+	// Release the scanner; the queued scan must succeed
+	other.Close()
+
+	err = <-done
+	if err != nil {
+		t.Errorf("Queued Scan: %s", err)
+	}
+}
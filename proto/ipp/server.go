@@ -11,6 +11,7 @@ package ipp
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"net/http/httputil"
@@ -146,12 +147,16 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
 	}
 
 	// Handle the message
-	rsp, err := handler.handle(ctx, msg, body)
+	rsp, rspBody, err := handler.handle(ctx, msg, body)
 	if err != nil {
 		s.httpError(query, err)
 		return
 	}
 
+	if rspBody != nil {
+		defer func() { rspBody.Close() }()
+	}
+
 	// Close the body. It will notify tracer that request is
 	// fully consumed, so tracer can finish writing it.
 	body.Close()
@@ -180,9 +185,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
 
 	// Notify tracer, if present (must be after WriteHeader so
 	// DumpResponse can read the correct response status).
-	trace.OnResponse(query, goippResponse{rsp}, nil)
+	rspBody = trace.OnResponse(query, goippResponse{rsp}, rspBody)
 
 	err = rsp.Encode(query)
+	if err == nil && rspBody != nil {
+		_, err = io.Copy(query, rspBody)
+	}
+
 	if err != nil {
 		log.Error(ctx, "IPP error sending response: %s", err)
 	}
@@ -205,9 +214,6 @@ func (s *Server) httpError(query *transport.ServerQuery, err error) {
 		// Create the IPP response
 		rsp := err.Encode()
 
-		// Notify tracer if present
-		trace.OnResponse(query, goippResponse{rsp}, nil)
-
 		// Call OnIPPResponse hook
 		if s.options.Hooks.OnIPPResponse != nil {
 			rsp2 := s.options.Hooks.OnIPPResponse(query, rsp)
@@ -231,6 +237,10 @@ func (s *Server) httpError(query *transport.ServerQuery, err error) {
 		query.ResponseHeader().Set("Content-Type", "application/ipp")
 		query.WriteHeader(http.StatusOK) // At HTTP level everything OK.
 
+		// Notify tracer if present (must be after WriteHeader so
+		// DumpResponse can read the correct response status).
+		trace.OnResponse(query, goippResponse{rsp}, nil)
+
 		rsp.Encode(query)
 
 	default:
@@ -0,0 +1,346 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// WS-Scan core protocol
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// abstract.Scanner on a top of WS-Scan client
+
+package wsscan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/url"
+	"sync"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/log"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/optional"
+)
+
+// AbstractClient implements [abstract.Scanner] on a top of the
+// WS-Scan [Client].
+//
+// It allows WSD-only scanners to be used via the protocol-independent
+// [abstract.Scanner] interface, the same way as eSCL scanners.
+type AbstractClient struct {
+	clnt *Client                       // Underlying WS-Scan client
+	caps *abstract.ScannerCapabilities // Scanner capabilities
+}
+
+// NewAbstractClient creates a new [AbstractClient].
+//
+// It queries the scanner for its [ScannerDescription] and
+// [ScannerConfiguration], so the scanner must be reachable at
+// the time of the call.
+//
+// If tr is nil, [transport.NewTransport] will be used to create
+// a new transport.
+func NewAbstractClient(ctx context.Context,
+	u *url.URL, tr *transport.Transport) (*AbstractClient, error) {
+
+	clnt := NewClient(u, tr)
+
+	rsp, err := clnt.GetScannerElements(ctx,
+		ScannerElemDescription, ScannerElemConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	absclnt := &AbstractClient{
+		clnt: clnt,
+		caps: rsp.ToAbstract(),
+	}
+
+	return absclnt, nil
+}
+
+// Capabilities returns the [abstract.ScannerCapabilities].
+// Caller should not modify the returned structure.
+func (absclnt *AbstractClient) Capabilities() *abstract.ScannerCapabilities {
+	return absclnt.caps
+}
+
+// Scan sends the scan request to the WS-Scan scanner.
+//
+// The request is validated against the scanner capabilities, missed
+// parameters are filled with defaults and then translated into
+// the WS-Scan [ScanTicket].
+//
+// On success, it returns the [abstract.Document] that fetches
+// scanned images using the WS-Scan RetrieveImage requests, until
+// the scanner reports that no more images are available. Closing
+// the Document before all images are consumed or canceling the ctx
+// cancels the scan job at the scanner.
+//
+// WS-Scan faults are returned as [*Fault] errors.
+func (absclnt *AbstractClient) Scan(ctx context.Context,
+	rawreq abstract.ScannerRequest) (abstract.Document, error) {
+
+	req, err := absclnt.caps.FillRequest(&rawreq)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := fromAbstractScannerRequest(req)
+	ticket.JobDescription = JobDescription{
+		JobName:                "Scan",
+		JobOriginatingUserName: "go-mfp",
+	}
+
+	// Platen delivers exactly one image. For ADF, 0 means
+	// "all images the feeder has".
+	if dp := ticket.DocumentParameters; dp != nil {
+		images := 0
+		if req.Input == abstract.InputPlaten {
+			images = 1
+		}
+		dp.ImagesToTransfer = optional.New(
+			ValWithOptions[int]{Val: images})
+	}
+
+	rsp, err := absclnt.clnt.CreateScanJob(ctx,
+		&CreateScanJobRequest{ScanTicket: ticket})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug(ctx, "WS-Scan: scan job started: %d", rsp.JobID)
+
+	// Obtain actual resolution
+	res := req.Resolution
+	if sides := rsp.DocumentFinalParameters.MediaSides; sides != nil {
+		front := optional.Get(sides).MediaFront
+		if front.Resolution != nil {
+			r := optional.Get(front.Resolution)
+			res = abstract.Resolution{
+				XResolution: r.Width.Val,
+				YResolution: r.Height.Val,
+			}
+		}
+	}
+
+	doc := &abstractClientDocument{
+		clnt:     absclnt.clnt,
+		ctx:      ctx,
+		jobID:    rsp.JobID,
+		jobToken: rsp.JobToken,
+		res:      res,
+		format:   req.DocumentFormat,
+		mode:     req.ColorMode,
+		depth:    req.ColorDepth,
+		duplex: req.Input == abstract.InputADF &&
+			req.ADFMode == abstract.ADFModeDuplex,
+		imginfo: rsp.ImageInformation,
+	}
+
+	doc.stop = context.AfterFunc(ctx, func() {
+		doc.lock.Lock()
+		doc.cancel()
+		doc.lock.Unlock()
+	})
+
+	return doc, nil
+}
+
+// Close closes the scanner connection.
+func (absclnt *AbstractClient) Close() error {
+	return nil
+}
+
+// abstractClientDocument implements the [abstract.Document] for
+// the AbstractClient.
+type abstractClientDocument struct {
+	clnt     *Client             // Underlying WS-Scan client
+	ctx      context.Context     // Scan request context
+	jobID    int                 // Job ID
+	jobToken string              // Job token
+	res      abstract.Resolution // Document resolution
+	format   string              // Requested document format
+	mode     abstract.ColorMode  // Requested color mode
+	depth    abstract.ColorDepth // Requested color depth
+	duplex   bool                // ADF duplex scan
+	imginfo  ImageInformation    // Estimated image information
+	file     *abstractClientFile // Current file, nil if none
+	images   int                 // Count of images received so far
+	stop     func() bool         // Stops context.AfterFunc
+	finished bool                // Job is finished at the scanner
+	closed   bool                // Document is closed
+	lock     sync.Mutex          // Access lock
+}
+
+// abstractClientFile implements the [abstract.DocumentFile] for
+// the AbstractClient.
+type abstractClientFile struct {
+	body   io.ReadCloser             // Image data
+	format string                    // Image format
+	info   abstract.DocumentFileInfo // File metadata
+}
+
+// Resolution returns the document's rendering resolution in DPI
+// (dots per inch).
+func (doc *abstractClientDocument) Resolution() abstract.Resolution {
+	return doc.res
+}
+
+// Next returns the next [abstract.DocumentFile].
+func (doc *abstractClientDocument) Next() (abstract.DocumentFile, error) {
+	doc.lock.Lock()
+	defer doc.lock.Unlock()
+
+	// Check document state
+	switch {
+	case doc.closed:
+		return nil, abstract.ErrDocumentClosed
+	case doc.finished:
+		return nil, io.EOF
+	}
+
+	// Close the previous file
+	doc.closeFile()
+
+	// Fetch the next file. Unlock while waiting for response.
+	req := &RetrieveImageRequest{
+		DocumentDescription: DocumentDescription{DocumentName: "Scan"},
+		JobID:               doc.jobID,
+		JobToken:            doc.jobToken,
+	}
+
+	doc.lock.Unlock()
+	rsp, err := doc.clnt.RetrieveImage(doc.ctx, req)
+	doc.lock.Lock()
+
+	switch {
+	case errors.Is(err, &Fault{Subcode: FaultNoImagesAvailable}):
+		doc.finished = true
+		return nil, io.EOF
+
+	case errors.Is(err, &Fault{Subcode: FaultJobIDNotFound}) &&
+		doc.images > 0:
+		// Some scanners forget the job immediately after
+		// the last image is delivered.
+		doc.finished = true
+		return nil, io.EOF
+
+	case err != nil:
+		doc.cancel()
+		return nil, err
+
+	case doc.closed:
+		// Document was closed while we were waiting for
+		// the response.
+		rsp.Image.Close()
+		return nil, abstract.ErrDocumentClosed
+	}
+
+	doc.images++
+
+	// Obtain image format
+	format := doc.format
+	if mediatype, _, err := mime.ParseMediaType(
+		rsp.ContentType); err == nil {
+		format = mediatype
+	}
+
+	doc.file = &abstractClientFile{
+		body:   rsp.Image,
+		format: format,
+		info:   doc.info(),
+	}
+
+	return doc.file, nil
+}
+
+// info returns the [abstract.DocumentFileInfo] for the most
+// recently received image. Image size is taken from the
+// ImageInformation, reported by the scanner in the
+// CreateScanJobResponse.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) info() abstract.DocumentFileInfo {
+	info := abstract.DocumentFileInfo{
+		Resolution: doc.res,
+		ColorMode:  doc.mode,
+		ColorDepth: doc.depth,
+		Page:       doc.images,
+	}
+
+	side := doc.imginfo.MediaFrontImageInfo
+	if doc.duplex {
+		info.Side = abstract.DuplexPageSide(doc.images)
+		if info.Side == abstract.PageSideBack {
+			side = doc.imginfo.MediaBackImageInfo
+		}
+	}
+
+	if side != nil {
+		info.Width = optional.Get(side).PixelsPerLine
+		info.Height = optional.Get(side).NumberOfLines
+	}
+
+	return info
+}
+
+// Close closes the Document. It implicitly closes the current
+// image being read.
+//
+// If job is not finished yet, it will be canceled.
+func (doc *abstractClientDocument) Close() error {
+	doc.stop()
+
+	doc.lock.Lock()
+	doc.closeFile()
+	doc.cancel()
+	doc.closed = true
+	doc.lock.Unlock()
+
+	return nil
+}
+
+// closeFile closes the current file, if any.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) closeFile() {
+	if doc.file != nil {
+		doc.file.body.Close()
+		doc.file = nil
+	}
+}
+
+// cancel cancels the job at the scanner, if job is not finished yet.
+// Must be called under the doc.lock.
+func (doc *abstractClientDocument) cancel() {
+	if doc.finished {
+		return
+	}
+
+	doc.finished = true
+
+	// doc.ctx may be already canceled at this point, so use
+	// a detached context, preserving its values for logging.
+	ctx := context.WithoutCancel(doc.ctx)
+	_, err := doc.clnt.CancelJob(ctx, doc.jobID)
+	if err != nil {
+		log.Debug(ctx, "WS-Scan: cancel job %d: %s", doc.jobID, err)
+	}
+}
+
+// Format returns the MIME type of the image format used by
+// the document file.
+func (file *abstractClientFile) Format() string {
+	return file.format
+}
+
+// Read reads the document file content as a sequence of bytes.
+// It implements the [io.Reader] interface.
+func (file *abstractClientFile) Read(buf []byte) (int, error) {
+	return file.body.Read(buf)
+}
+
+// Info returns the DocumentFile metadata.
+// It implements the [abstract.DocumentFileWithInfo] interface.
+func (file *abstractClientFile) Info() abstract.DocumentFileInfo {
+	return file.info
+}
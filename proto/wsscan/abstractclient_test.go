@@ -0,0 +1,242 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// WS-Scan core protocol
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// AbstractClient test
+
+package wsscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/assert"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/xmldoc"
+)
+
+// TestAbstractClient tests the AbstractClient
+func TestAbstractClient(t *testing.T) {
+	// Create ScannerCapabilities
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.WSD.GetScannerElementsResponse))
+	assert.NoError(err)
+
+	msg, err := DecodeMessage(xml)
+	assert.NoError(err)
+
+	caps := msg.Body.(*GetScannerElementsResponse).ToAbstract()
+
+	// Create loopback transport
+	tr, loopback := transport.NewLoopback()
+
+	// Start virtual scanner
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps,
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	base := transport.MustParseURL("http://localhost/WSDScanner")
+	options := AbstractServerOptions{
+		Scanner:  s,
+		BasePath: base.Path,
+	}
+
+	handler := NewAbstractServer(options)
+	server := transport.NewServer(context.Background(), nil, handler)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	// Create AbstractClient
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Errorf("NewAbstractClient: %s", err)
+		return
+	}
+
+	defer absclnt.Close()
+
+	capsExpected := fromAbstractScannerConfiguration(s.ScanCaps)
+	capsPresent := fromAbstractScannerConfiguration(absclnt.Capabilities())
+
+	diff := testutils.Diff(capsPresent, capsExpected)
+	if diff != "" {
+		t.Errorf("AbstractClient.Capabilities:\n%s", diff)
+		return
+	}
+
+	// Scan all pages from ADF
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	doc, err := absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	if doc.Resolution() != s.Resolution {
+		t.Errorf("Document.Resolution mismatch:\n"+
+			"expected: %s\n"+
+			"present:  %s\n",
+			s.Resolution, doc.Resolution())
+	}
+
+	images := 0
+	for {
+		file, err := doc.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Errorf("Document.Next: %s", err)
+			return
+		}
+
+		if file.Format() != imgconv.MIMETypeJPEG {
+			t.Errorf("DocumentFile.Format mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				imgconv.MIMETypeJPEG, file.Format())
+		}
+
+		// Image size comes from the CreateScanJobResponse
+		// ImageInformation
+		info := file.(abstract.DocumentFileWithInfo).Info()
+		if info.Page != images+1 || info.Width <= 1 || info.Height <= 1 {
+			t.Errorf("DocumentFile.Info: unexpected %+v", info)
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Errorf("DocumentFile.Read: %s", err)
+			return
+		}
+
+		if imgconv.MIMETypeDetect(data) != imgconv.MIMETypeJPEG {
+			t.Errorf("DocumentFile.Read: JPEG image expected")
+		}
+
+		images++
+	}
+
+	doc.Close()
+
+	if images != len(s.ADFImages) {
+		t.Errorf("Document.Next:\n"+
+			"images expected: %d\n"+
+			"images present: %d\n",
+			len(s.ADFImages), images)
+	}
+
+	// Test that Document.Close cancels unfinished job
+	doc, err = absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	_, err = doc.Next()
+	if err != nil {
+		t.Errorf("Document.Next: %s", err)
+		return
+	}
+
+	// The scanner is busy now
+	_, err = absclnt.Scan(context.TODO(), req)
+	if !errors.Is(err, &Fault{Subcode: FaultNotAcceptingJobs}) {
+		t.Errorf("AbstractClient.Scan while busy:\n"+
+			"error expected: %s\n"+
+			"error present:  %v\n",
+			NewFault(FaultNotAcceptingJobs, ""), err)
+	}
+
+	doc.Close()
+
+	history, err := absclnt.clnt.GetJobHistory(context.TODO())
+	if err != nil {
+		t.Errorf("Client.GetJobHistory: %s", err)
+		return
+	}
+
+	last := len(history.JobHistory) - 1
+	if last < 0 || history.JobHistory[last].JobState != JobStateCanceled {
+		t.Errorf("Document.Close: job not canceled")
+	}
+
+	_, err = doc.Next()
+	if err != abstract.ErrDocumentClosed {
+		t.Errorf("Document.Next after Close:\n"+
+			"error expected: %s\n"+
+			"error present:  %v\n",
+			abstract.ErrDocumentClosed, err)
+	}
+
+	// Test that context cancellation cancels the job
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	doc, err = absclnt.Scan(ctx, req)
+	if err != nil {
+		t.Errorf("AbstractClient.Scan: %s", err)
+		return
+	}
+
+	cancel()
+	_, err = doc.Next()
+	if err == nil {
+		t.Errorf("Document.Next after cancel: error expected")
+	}
+	doc.Close()
+
+	active, err := absclnt.clnt.GetActiveJobs(context.TODO())
+	if err != nil {
+		t.Errorf("Client.GetActiveJobs: %s", err)
+		return
+	}
+
+	if n := len(active.ActiveJobs.JobSummary); n != 0 {
+		t.Errorf("Context cancel: %d active jobs remain", n)
+	}
+
+	// Test the WS-Scan fault for the unknown job
+	_, err = absclnt.clnt.RetrieveImage(context.TODO(),
+		&RetrieveImageRequest{
+			DocumentDescription: DocumentDescription{
+				DocumentName: "Scan",
+			},
+			JobID:    12345,
+			JobToken: "invalid",
+		})
+
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Subcode != FaultJobIDNotFound ||
+		fault.Code != FaultCodeSender {
+		t.Errorf("Client.RetrieveImage with invalid job:\n"+
+			"error expected: %s\n"+
+			"error present:  %v\n",
+			NewFault(FaultJobIDNotFound, ""), err)
+	}
+}
@@ -404,3 +404,32 @@ func fromAbstractColorEntries(
 
 	return out
 }
+
+// fromAbstractImageInformation builds the [ImageInformation] from
+// the estimated [abstract.DocumentFileInfo] of the scanned pages.
+// The back side information is only included for duplex scans.
+func fromAbstractImageInformation(info abstract.DocumentFileInfo,
+	duplex bool) ImageInformation {
+
+	side := fromAbstractMediaSideImageInfo(info)
+
+	ii := ImageInformation{MediaFrontImageInfo: optional.New(side)}
+	if duplex {
+		ii.MediaBackImageInfo = optional.New(side)
+	}
+
+	return ii
+}
+
+// fromAbstractMediaSideImageInfo converts [abstract.DocumentFileInfo]
+// into the [MediaSideImageInfo]. Unknown image dimensions are reported
+// as 1, the minimum value WS-Scan allows.
+func fromAbstractMediaSideImageInfo(
+	info abstract.DocumentFileInfo) MediaSideImageInfo {
+
+	return MediaSideImageInfo{
+		BytesPerLine:  info.BytesPerLine(),
+		NumberOfLines: generic.Max(1, info.Height),
+		PixelsPerLine: generic.Max(1, info.Width),
+	}
+}
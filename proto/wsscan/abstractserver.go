@@ -26,11 +26,6 @@ import (
 	"github.com/OpenPrinting/go-mfp/util/xmldoc"
 )
 
-var (
-	errBusy       = errors.New("scanner busy")
-	errInvalidJob = errors.New("invalid job")
-)
-
 // AbstractServer implements a WS-Scan server on top of
 // [abstract.Scanner].
 type AbstractServer struct {
@@ -38,6 +33,7 @@ type AbstractServer struct {
 	caps      *abstract.ScannerCapabilities
 	status    ScannerStatus
 	document  abstract.Document
+	starting  bool
 	jobs      jobList
 	nextJobID int
 	lock      sync.Mutex
@@ -137,8 +133,12 @@ func (srv *AbstractServer) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
 		return
 	}
 
-	if err == nil {
+	var fault *Fault
+	switch {
+	case err == nil:
 		srv.sendSOAPResponse(query, msg, rsp)
+	case errors.As(err, &fault):
+		srv.sendSOAPResponse(query, msg, fault)
 	}
 }
 
@@ -214,8 +214,7 @@ func (srv *AbstractServer) handleGetJobElementsRequest(
 	job := srv.jobs.get(req.JobID)
 	if job == nil {
 		srv.lock.Unlock()
-		query.Reject(http.StatusNotFound, nil)
-		return nil, errInvalidJob
+		return nil, NewFault(FaultJobIDNotFound, "")
 	}
 	j := *job
 	srv.lock.Unlock()
@@ -264,9 +263,10 @@ func (srv *AbstractServer) handleGetJobElementsRequest(
 // jobStatusFrom builds a [JobStatus] from a [jobInfo].
 func jobStatusFrom(j jobInfo) JobStatus {
 	js := JobStatus{
-		JobID:          j.jobID,
-		JobState:       j.state,
-		ScansCompleted: j.scansCompleted,
+		JobID:           j.jobID,
+		JobState:        j.state,
+		JobStateReasons: j.reasons,
+		ScansCompleted:  j.scansCompleted,
 	}
 	if !j.createdTime.IsZero() {
 		js.JobCreatedTime = optional.New(j.createdTime)
@@ -286,10 +286,9 @@ func (srv *AbstractServer) handleCreateScanJobRequest(
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
 
-	// Check if previous scan is still in progress
-	if srv.document != nil {
-		query.Reject(http.StatusServiceUnavailable, nil)
-		return nil, errBusy
+	// Check if previous scan is still in progress or being started
+	if srv.document != nil || srv.starting {
+		return nil, NewFault(FaultNotAcceptingJobs, "scanner busy")
 	}
 
 	// Convert ScanTicket to abstract.ScannerRequest
@@ -299,21 +298,41 @@ func (srv *AbstractServer) handleCreateScanJobRequest(
 	// capabilities. FillRequest returns an error for unsupported params.
 	filled, err := srv.caps.FillRequest(&absreq)
 	if err != nil {
-		query.Reject(http.StatusConflict, err)
-		return nil, err
+		subcode := UnknownFaultSubcode
+		var perr abstract.ErrParam
+		if errors.As(err, &perr) && perr.Name == "DocumentFormat" {
+			subcode = FaultFormatNotSupported
+		}
+
+		return nil, &Fault{
+			Code:    FaultCodeSender,
+			Subcode: subcode,
+			Reason:  err.Error(),
+		}
 	}
 
-	// Send filled request to the underlying abstract.Scanner
+	// Send filled request to the underlying abstract.Scanner.
+	// Scan may wait for the scanner, shared with other frontends
+	// (see abstract.ScannerArbiter), so don't hold the lock meanwhile.
 	ctx := query.RequestContext()
+
+	srv.starting = true
+	srv.lock.Unlock()
+
 	document, err := srv.options.Scanner.Scan(ctx, *filled)
+
+	srv.lock.Lock()
+	srv.starting = false
+
 	if err != nil {
-		query.Reject(http.StatusConflict, err)
-		return nil, err
+		return nil, srv.deviceError(err)
 	}
 
 	// Store document and update status
 	srv.document = document
 	srv.status.ScannerState = Processing
+	srv.status.ScannerStateReasons = nil
+	srv.status.ActiveConditions = nil
 
 	// Convert the filled request back to DocumentParameters so the
 	// response reflects the actual parameters used for the scan.
@@ -335,8 +354,22 @@ func (srv *AbstractServer) handleCreateScanJobRequest(
 
 	srv.status.ScannerState = Processing
 
+	// Estimate the resulting image parameters
+	res := filled.Resolution
+	info := abstract.DocumentFileInfo{
+		Width:      filled.Region.Width.Dots(res.XResolution),
+		Height:     filled.Region.Height.Dots(res.YResolution),
+		Resolution: res,
+		ColorMode:  filled.ColorMode,
+		ColorDepth: filled.ColorDepth,
+	}
+
+	duplex := filled.Input == abstract.InputADF &&
+		filled.ADFMode == abstract.ADFModeDuplex
+
 	return &CreateScanJobResponse{
 		DocumentFinalParameters: optional.Get(finalTicket.DocumentParameters),
+		ImageInformation:        fromAbstractImageInformation(info, duplex),
 		JobID:                   jobID,
 		JobToken:                jobToken,
 	}, nil
@@ -351,10 +384,14 @@ func (srv *AbstractServer) handleRetrieveImageRequest(
 	srv.lock.Lock()
 
 	job := srv.jobs.get(req.JobID)
-	if srv.document == nil || job == nil || req.JobToken != job.jobToken {
+	switch {
+	case job == nil || req.JobToken != job.jobToken:
 		srv.lock.Unlock()
-		query.Reject(http.StatusNotFound, nil)
-		return nil, errInvalidJob
+		return nil, NewFault(FaultJobIDNotFound, "")
+
+	case srv.document == nil || job.state != JobStateProcessing:
+		srv.lock.Unlock()
+		return nil, NewFault(FaultNoImagesAvailable, "")
 	}
 
 	// Get next document file
@@ -364,12 +401,17 @@ func (srv *AbstractServer) handleRetrieveImageRequest(
 	switch {
 	case err == io.EOF:
 		srv.finish(req.JobID, JobStateCompleted)
-		query.Reject(http.StatusNotFound, nil)
-		return nil, err
+		return nil, NewFault(FaultNoImagesAvailable, "")
+	case errors.Is(err, abstract.ErrADFJam),
+		errors.Is(err, abstract.ErrCoverOpen):
+		srv.finish(req.JobID, JobStateAborted, ScannerStopped)
+		srv.lock.Lock()
+		fault := srv.deviceError(err)
+		srv.lock.Unlock()
+		return nil, fault
 	case err != nil:
 		srv.finish(req.JobID, JobStateAborted)
-		query.Reject(http.StatusServiceUnavailable, err)
-		return nil, err
+		return nil, NewFault(FaultTemporaryError, err.Error())
 	}
 
 	// Increment scansCompleted for this job
@@ -394,12 +436,11 @@ func (srv *AbstractServer) handleCancelJobRequest(
 
 	srv.lock.Lock()
 	job := srv.jobs.get(req.JobID)
-	active := job.state == JobStateProcessing
+	active := job != nil && job.state == JobStateProcessing
 	srv.lock.Unlock()
 
 	if !active {
-		query.Reject(http.StatusNotFound, nil)
-		return nil, errInvalidJob
+		return nil, NewFault(FaultJobIDNotFound, "")
 	}
 
 	srv.finish(req.JobID, JobStateCanceled)
@@ -453,13 +494,15 @@ func jobSummaryFrom(j jobInfo) JobSummary {
 		JobName:                j.scanTicket.JobDescription.JobName,
 		JobOriginatingUserName: j.scanTicket.JobDescription.JobOriginatingUserName,
 		JobState:               j.state,
+		JobStateReasons:        j.reasons,
 		ScansCompleted:         j.scansCompleted,
 	}
 }
 
-// finish closes the current document, updates the job state, and
-// resets the server to idle.
-func (srv *AbstractServer) finish(jobID int, state JobState) {
+// finish closes the current document, updates the job state and
+// reasons, and resets the server to idle.
+func (srv *AbstractServer) finish(jobID int, state JobState,
+	reasons ...JobStateReason) {
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
 
@@ -472,13 +515,87 @@ func (srv *AbstractServer) finish(jobID int, state JobState) {
 
 	if j := srv.jobs.get(jobID); j != nil {
 		j.state = state
+		j.reasons = reasons
 		j.completedTime = time.Now()
 	}
 }
 
+// deviceError updates the scanner status according to the error,
+// returned by the underlying abstract.Scanner, and returns the
+// [Fault] to be sent to the client.
+//
+// The device condition remains active until the next successfully
+// created scan job.
+//
+// Must be called under the srv.lock.
+func (srv *AbstractServer) deviceError(err error) *Fault {
+	var state ScannerState
+	var reason ScannerStateReason
+	var cond DeviceCondition
+
+	switch {
+	case errors.Is(err, abstract.ErrDeviceInUse):
+		return NewFault(FaultNotAcceptingJobs, err.Error())
+
+	case errors.Is(err, abstract.ErrDeviceBusy):
+		state = Idle
+		reason = StateLampWarming
+		cond = DeviceCondition{
+			Component: PlatenComponent,
+			Name:      LampWarming,
+			Severity:  Informational,
+		}
+
+	case errors.Is(err, abstract.ErrADFEmpty):
+		state = Idle
+		reason = StateAttentionRequired
+		cond = DeviceCondition{
+			Component: ADFComponent,
+			Name:      InputTrayEmpty,
+			Severity:  Warning,
+		}
+
+	case errors.Is(err, abstract.ErrADFJam):
+		state = Stopped
+		reason = StateMediaJam
+		cond = DeviceCondition{
+			Component: ADFComponent,
+			Name:      MediaJam,
+			Severity:  Critical,
+		}
+
+	case errors.Is(err, abstract.ErrCoverOpen):
+		state = Stopped
+		reason = StateCoverOpen
+		cond = DeviceCondition{
+			Component: PlatenComponent,
+			Name:      CoverOpen,
+			Severity:  Critical,
+		}
+
+	default:
+		return NewFault(FaultTemporaryError, err.Error())
+	}
+
+	cond.Time = time.Now()
+
+	srv.status.ScannerState = state
+	srv.status.ScannerStateReasons = []ScannerStateReason{reason}
+	srv.status.ActiveConditions = []DeviceCondition{cond}
+
+	subcode := FaultTemporaryError
+	if reason == StateLampWarming {
+		subcode = FaultNotAcceptingJobs
+	}
+
+	return NewFault(subcode, err.Error())
+}
+
 // sendSOAPResponse wraps a response body in a SOAP envelope and sends it.
 // If the body is a [RetrieveImageResponse], it sends an MTOM/XOP
 // multipart message with the image as a binary attachment.
+// If the body is a [Fault], the HTTP status is chosen according
+// to the Fault Code.
 func (srv *AbstractServer) sendSOAPResponse(
 	query *transport.ServerQuery,
 	req Message,
@@ -500,8 +617,13 @@ func (srv *AbstractServer) sendSOAPResponse(
 		return
 	}
 
+	status := http.StatusOK
+	if fault, ok := body.(*Fault); ok {
+		status = fault.httpStatus()
+	}
+
 	query.ResponseHeader().Set("Content-Type", "application/soap+xml")
-	query.SendXML(http.StatusOK, NsMap, rsp.toXML())
+	query.SendXML(status, NsMap, rsp.toXML())
 
 	// Notify tracer
 	trace.OnResponse(query, traceMessage{rsp}, nil)
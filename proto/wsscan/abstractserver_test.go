@@ -0,0 +1,291 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// WS-Scan core protocol
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// AbstractServer test
+
+package wsscan
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenPrinting/go-mfp/abstract"
+	"github.com/OpenPrinting/go-mfp/imgconv"
+	"github.com/OpenPrinting/go-mfp/internal/assert"
+	"github.com/OpenPrinting/go-mfp/internal/testutils"
+	"github.com/OpenPrinting/go-mfp/transport"
+	"github.com/OpenPrinting/go-mfp/util/xmldoc"
+)
+
+// TestAbstractServerDeviceErrors tests how AbstractServer reports
+// the simulated device errors
+func TestAbstractServerDeviceErrors(t *testing.T) {
+	// Create ScannerCapabilities
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.WSD.GetScannerElementsResponse))
+	assert.NoError(err)
+
+	msg, err := DecodeMessage(xml)
+	assert.NoError(err)
+
+	caps := msg.Body.(*GetScannerElementsResponse).ToAbstract()
+
+	// Start virtual scanner
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps,
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+		ADFImages: [][]byte{
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+			testutils.Images.PNG100x75rgb8,
+		},
+	}
+
+	base := transport.MustParseURL("http://localhost/WSDScanner")
+	options := AbstractServerOptions{
+		Scanner:  s,
+		BasePath: base.Path,
+	}
+
+	handler := NewAbstractServer(options)
+	server := transport.NewServer(context.Background(), nil, handler)
+
+	go server.Serve(loopback)
+	defer server.Close()
+
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputADF,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	// checkStatus checks the scanner status
+	checkStatus := func(name string, state ScannerState,
+		reason ScannerStateReason, cond ConditionName) {
+
+		t.Helper()
+
+		handler.lock.Lock()
+		status := handler.status
+		handler.lock.Unlock()
+
+		if status.ScannerState != state {
+			t.Errorf("%s: scanner state mismatch:\n"+
+				"expected: %s\n"+
+				"present:  %s\n",
+				name, state, status.ScannerState)
+		}
+
+		reasons := []ScannerStateReason{}
+		if reason != UnknownScannerStateReason {
+			reasons = append(reasons, reason)
+		}
+
+		if !reflect.DeepEqual(append([]ScannerStateReason{},
+			status.ScannerStateReasons...), reasons) {
+			t.Errorf("%s: scanner state reasons mismatch:\n"+
+				"expected: %v\n"+
+				"present:  %v\n",
+				name, reasons, status.ScannerStateReasons)
+		}
+
+		conds := []ConditionName{}
+		for _, c := range status.ActiveConditions {
+			conds = append(conds, c.Name)
+		}
+
+		if cond != UnknownConditionName &&
+			(len(conds) != 1 || conds[0] != cond) {
+			t.Errorf("%s: active conditions mismatch:\n"+
+				"expected: %v\n"+
+				"present:  %v\n",
+				name, cond, conds)
+		}
+	}
+
+	// Paper jam in the middle of the batch
+	s.JamAfter = 1
+
+	doc, err := absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Paper jam: Scan: %s", err)
+	}
+
+	_, err = doc.Next()
+	if err != nil {
+		t.Errorf("Paper jam: first page: %s", err)
+	}
+
+	_, err = doc.Next()
+	if err == nil {
+		t.Errorf("Paper jam: second page: error expected")
+	}
+
+	doc.Close()
+
+	checkStatus("Paper jam", Stopped, StateMediaJam, MediaJam)
+
+	handler.lock.Lock()
+	job := handler.jobs[len(handler.jobs)-1]
+	handler.lock.Unlock()
+
+	if job.state != JobStateAborted ||
+		!reflect.DeepEqual(job.reasons, []JobStateReason{ScannerStopped}) {
+		t.Errorf("Paper jam: job state mismatch: %s %v",
+			job.state, job.reasons)
+	}
+
+	// ADF is empty
+	s.JamAfter = 0
+	s.ADFEmpty = true
+
+	_, err = absclnt.Scan(context.TODO(), req)
+	if err == nil {
+		t.Errorf("ADF empty: Scan: error expected")
+	}
+
+	checkStatus("ADF empty", Idle, StateAttentionRequired, InputTrayEmpty)
+
+	// Successful scan clears the device conditions
+	s.ADFEmpty = false
+
+	doc, err = absclnt.Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Scan: %s", err)
+	}
+
+	doc.Close()
+
+	checkStatus("Scan", Idle, UnknownScannerStateReason,
+		UnknownConditionName)
+
+	// Cover open
+	s.CoverOpen = true
+
+	_, err = absclnt.Scan(context.TODO(), req)
+	if err == nil {
+		t.Errorf("Cover open: Scan: error expected")
+	}
+
+	checkStatus("Cover open", Stopped, StateCoverOpen, CoverOpen)
+}
+
+// TestAbstractServerQueue tests that AbstractServer serves other
+// requests, while its scan request waits for the scanner, shared
+// by the abstract.ScannerArbiter
+func TestAbstractServerQueue(t *testing.T) {
+	xml, err := xmldoc.Decode(
+		NsMap,
+		bytes.NewReader(testutils.
+			Kyocera.ECOSYS.M2040dn.WSD.GetScannerElementsResponse))
+	assert.NoError(err)
+
+	msg, err := DecodeMessage(xml)
+	assert.NoError(err)
+
+	caps := msg.Body.(*GetScannerElementsResponse).ToAbstract()
+
+	tr, loopback := transport.NewLoopback()
+
+	s := &abstract.VirtualScanner{
+		ScanCaps: caps,
+		Resolution: abstract.Resolution{
+			XResolution: 300,
+			YResolution: 300,
+		},
+		PlatenImage: testutils.Images.PNG100x75rgb8,
+	}
+
+	arb := &abstract.ScannerArbiter{QueueSize: 1}
+
+	base := transport.MustParseURL("http://localhost/WSDScanner")
+	handler := NewAbstractServer(AbstractServerOptions{
+		Scanner:  arb.Scanner("WSD", s),
+		BasePath: base.Path,
+	})
+
+	server := transport.NewServer(context.Background(), nil, handler)
+	go server.Serve(loopback)
+	defer server.Close()
+
+	absclnt, err := NewAbstractClient(context.TODO(), base, tr)
+	if err != nil {
+		t.Fatalf("NewAbstractClient: %s", err)
+	}
+
+	defer absclnt.Close()
+
+	req := abstract.ScannerRequest{
+		Input:          abstract.InputPlaten,
+		DocumentFormat: imgconv.MIMETypeJPEG,
+		Resolution:     s.Resolution,
+	}
+
+	// Occupy the scanner by another frontend
+	other, err := arb.Scanner("eSCL", s).Scan(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("eSCL: Scan: %s", err)
+	}
+
+	// Start the scan. It waits in the queue.
+	done := make(chan error)
+	go func() {
+		doc, err := absclnt.Scan(context.TODO(), req)
+		if err == nil {
+			doc.Close()
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for arb.Status().Position("WSD") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("WSD: scan request not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// GetActiveJobs must be served meanwhile, and the next
+	// scan request must be rejected without waiting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = absclnt.clnt.GetActiveJobs(ctx)
+	if err != nil {
+		t.Errorf("GetActiveJobs: %s", err)
+	}
+
+	_, err = absclnt.Scan(ctx, req)
+	if err == nil {
+		t.Errorf("Scan while queued: error expected")
+	}
+
+	// Release the scanner; the queued scan must succeed
+	other.Close()
+
+	err = <-done
+	if err != nil {
+		t.Errorf("Queued Scan: %s", err)
+	}
+}
@@ -33,11 +33,15 @@ const (
 	ActGetScannerElementsResponse        // GetScannerElements response
 	ActRetrieveImage                     // RetrieveImage request
 	ActRetrieveImageResponse             // RetrieveImage response
+	ActFault                             // SOAP Fault
 )
 
 // actionBaseURL is the common prefix for all WS-Scan action URLs.
 const actionBaseURL = "http://schemas.microsoft.com/windows/2006/08/wdp/scan/"
 
+// actionFaultURL is the WS-Addressing action URL, used for SOAP faults.
+const actionFaultURL = "http://schemas.xmlsoap.org/ws/2004/08/addressing/fault"
+
 // String returns a short string representation for debugging.
 func (act Action) String() string {
 	switch act {
@@ -69,6 +73,8 @@ func (act Action) String() string {
 		return "RetrieveImage"
 	case ActRetrieveImageResponse:
 		return "RetrieveImageResponse"
+	case ActFault:
+		return "Fault"
 	}
 	return "Unknown"
 }
@@ -76,8 +82,11 @@ func (act Action) String() string {
 // Encode returns the wire representation (URL string) of the action.
 func (act Action) Encode() string {
 	s := act.String()
-	if s == "Unknown" {
+	switch s {
+	case "Unknown":
 		return ""
+	case "Fault":
+		return actionFaultURL
 	}
 	return actionBaseURL + s
 }
@@ -114,6 +123,8 @@ func (act Action) bodyElementName() string {
 		return NsWSCN + ":RetrieveImageRequest"
 	case ActRetrieveImageResponse:
 		return NsWSCN + ":RetrieveImageResponse"
+	case ActFault:
+		return NsSOAP + ":Fault"
 	}
 	return ""
 }
@@ -159,6 +170,8 @@ func actDecode(s string) Action {
 		return ActRetrieveImage
 	case actionBaseURL + "RetrieveImageResponse":
 		return ActRetrieveImageResponse
+	case actionFaultURL:
+		return ActFault
 	}
 	return ActUnknown
 }
@@ -280,7 +280,14 @@ func (c *Client) doRequest(
 	}
 
 	if httpRsp.StatusCode/100 != http.StatusOK/100 {
-		httpRsp.Body.Close()
+		defer httpRsp.Body.Close()
+
+		// SOAP 1.2 servers report errors by sending Fault
+		// with the HTTP 4xx/5xx status. Return it, if present.
+		if fault := c.decodeFault(httpRsp); fault != nil {
+			return nil, fault
+		}
+
 		return nil, fmt.Errorf("HTTP %d: %s",
 			httpRsp.StatusCode, httpRsp.Status)
 	}
@@ -288,6 +295,24 @@ func (c *Client) doRequest(
 	return httpRsp, nil
 }
 
+// decodeFault attempts to decode the [Fault] from the HTTP
+// response body. It returns nil if response doesn't contain
+// a valid Fault message.
+func (c *Client) decodeFault(httpRsp *http.Response) *Fault {
+	root, err := xmldoc.Decode(NsMap, httpRsp.Body)
+	if err != nil {
+		return nil
+	}
+
+	msg, err := DecodeMessage(root)
+	if err != nil {
+		return nil
+	}
+
+	fault, _ := msg.Body.(*Fault)
+	return fault
+}
+
 // sendSOAP wraps body in a SOAP envelope, POSTs it to the server,
 // and returns the decoded response [Message].
 func (c *Client) sendSOAP(ctx context.Context, body Body) (Message, error) {
@@ -307,5 +332,15 @@ func (c *Client) sendSOAP(ctx context.Context, body Body) (Message, error) {
 		return Message{}, err
 	}
 
-	return DecodeMessage(root)
+	msg, err := DecodeMessage(root)
+	if err != nil {
+		return Message{}, err
+	}
+
+	// Some devices send Fault with the HTTP 200 status
+	if fault, ok := msg.Body.(*Fault); ok {
+		return Message{}, fault
+	}
+
+	return msg, nil
 }
@@ -0,0 +1,282 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// WS-Scan core protocol
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// Fault: SOAP 1.2 fault, sent in response to the failed request
+
+package wsscan
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/OpenPrinting/go-mfp/util/optional"
+	"github.com/OpenPrinting/go-mfp/util/xmldoc"
+)
+
+// Fault represents a SOAP 1.2 Fault, returned by the WSD Scan Service
+// instead of the normal response, if request cannot be fulfilled.
+//
+// Fault implements the error interface, so the [Client] returns it
+// as error. Use [errors.As] to obtain the Fault details or [errors.Is]
+// with the Fault value to test for the particular Subcode:
+//
+//	if errors.Is(err, &Fault{Subcode: FaultNoImagesAvailable}) {
+//		...
+//	}
+type Fault struct {
+	Code    FaultCode    // soap:Sender or soap:Receiver
+	Subcode FaultSubcode // WS-Scan specific error, if any
+	Reason  string       // Human-readable explanation
+}
+
+// NewFault creates a new [Fault] with the given Subcode and Reason.
+// The Fault Code is chosen according to the Subcode.
+func NewFault(subcode FaultSubcode, reason string) *Fault {
+	return &Fault{
+		Code:    subcode.code(),
+		Subcode: subcode,
+		Reason:  reason,
+	}
+}
+
+// Action returns the [Action] associated with this body.
+func (*Fault) Action() Action { return ActFault }
+
+// ToXML encodes the body into an XML tree.
+func (f *Fault) ToXML() xmldoc.Element {
+	return f.toXML(NsSOAP + ":Fault")
+}
+
+// Error returns the error string.
+// It implements the error interface.
+func (f *Fault) Error() string {
+	s := "wsscan: " + f.Code.String()
+	if f.Subcode != UnknownFaultSubcode {
+		s += ": " + f.Subcode.String()
+	}
+	if f.Reason != "" {
+		s += ": " + f.Reason
+	}
+	return s
+}
+
+// Is reports whether the Fault matches the target.
+//
+// The target matches, if it is the *Fault with the same Subcode.
+// It allows the Fault to be tested with [errors.Is].
+func (f *Fault) Is(target error) bool {
+	t, ok := target.(*Fault)
+	return ok && t.Subcode == f.Subcode
+}
+
+// httpStatus returns the HTTP status code, used to send the Fault.
+func (f *Fault) httpStatus() int {
+	if f.Code == FaultCodeSender {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// toXML generates XML tree for the [Fault].
+func (f Fault) toXML(name string) xmldoc.Element {
+	code := xmldoc.Element{
+		Name: NsSOAP + ":Code",
+		Children: []xmldoc.Element{
+			{
+				Name: NsSOAP + ":Value",
+				Text: NsSOAP + ":" + f.Code.String(),
+			},
+		},
+	}
+
+	if f.Subcode != UnknownFaultSubcode {
+		code.Children = append(code.Children, xmldoc.Element{
+			Name: NsSOAP + ":Subcode",
+			Children: []xmldoc.Element{
+				{
+					Name: NsSOAP + ":Value",
+					Text: NsWSCN + ":" + f.Subcode.String(),
+				},
+			},
+		})
+	}
+
+	reason := TextWithLangElement{Text: f.Reason, Lang: optional.New("en")}
+
+	return xmldoc.Element{
+		Name: name,
+		Children: []xmldoc.Element{
+			code,
+			{
+				Name: NsSOAP + ":Reason",
+				Children: []xmldoc.Element{
+					reason.toXML(NsSOAP + ":Text"),
+				},
+			},
+		},
+	}
+}
+
+// decodeFault decodes [Fault] from the XML tree.
+func decodeFault(root xmldoc.Element) (f Fault, err error) {
+	defer func() { err = xmldoc.XMLErrWrap(root, err) }()
+
+	code := xmldoc.Lookup{Name: NsSOAP + ":Code", Required: true}
+	reason := xmldoc.Lookup{Name: NsSOAP + ":Reason"}
+
+	if missed := root.Lookup(&code, &reason); missed != nil {
+		err = xmldoc.XMLErrMissed(missed.Name)
+		return
+	}
+
+	// Decode Code and Subcode
+	value := xmldoc.Lookup{Name: NsSOAP + ":Value", Required: true}
+	subcode := xmldoc.Lookup{Name: NsSOAP + ":Subcode"}
+
+	if missed := code.Elem.Lookup(&value, &subcode); missed != nil {
+		err = xmldoc.XMLErrWrap(code.Elem,
+			xmldoc.XMLErrMissed(missed.Name))
+		return
+	}
+
+	f.Code = DecodeFaultCode(faultQNameLocal(value.Elem.Text))
+	if f.Code == UnknownFaultCode {
+		err = xmldoc.XMLErrWrap(code.Elem, xmldoc.XMLErrWrap(value.Elem,
+			fmt.Errorf("invalid FaultCode: %q", value.Elem.Text)))
+		return
+	}
+
+	if subcode.Found {
+		// Unknown subcodes are not an error: the Fault still
+		// carries the meaningful Code and Reason.
+		if v, ok := subcode.Elem.ChildByName(NsSOAP + ":Value"); ok {
+			f.Subcode = DecodeFaultSubcode(faultQNameLocal(v.Text))
+		}
+	}
+
+	// Decode Reason
+	if reason.Found {
+		var texts TextWithLangList
+		for _, chld := range reason.Elem.Children {
+			if chld.Name == NsSOAP+":Text" {
+				var t TextWithLangElement
+				t.decodeTextWithLangElement(chld)
+				texts = append(texts, t)
+			}
+		}
+		f.Reason = texts.NeutralLang().Text
+	}
+
+	return
+}
+
+// faultQNameLocal returns the local part of the QName, used as
+// the Fault Code and Subcode values.
+//
+// These values are transmitted as the element text, so namespace
+// prefixes are not normalized by the XML decoder and we cannot rely
+// on them.
+func faultQNameLocal(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// FaultCode is the SOAP 1.2 Fault Code.
+type FaultCode int
+
+// Known fault codes:
+const (
+	UnknownFaultCode  FaultCode = iota
+	FaultCodeSender             // Problem with the request (client side)
+	FaultCodeReceiver           // Problem with the server
+)
+
+// String returns a string representation of the [FaultCode]
+func (code FaultCode) String() string {
+	switch code {
+	case FaultCodeSender:
+		return "Sender"
+	case FaultCodeReceiver:
+		return "Receiver"
+	}
+
+	return "Unknown"
+}
+
+// DecodeFaultCode decodes [FaultCode] out of its XML string
+// representation (without namespace prefix).
+func DecodeFaultCode(s string) FaultCode {
+	switch s {
+	case "Sender":
+		return FaultCodeSender
+	case "Receiver":
+		return FaultCodeReceiver
+	}
+
+	return UnknownFaultCode
+}
+
+// FaultSubcode is the WS-Scan specific fault subcode.
+type FaultSubcode int
+
+// Known fault subcodes:
+const (
+	UnknownFaultSubcode     FaultSubcode = iota
+	FaultFormatNotSupported              // Requested format not supported
+	FaultJobIDNotFound                   // Job is not found or token mismatch
+	FaultNoImagesAvailable               // No more images in the job
+	FaultNotAcceptingJobs                // Scanner is busy
+	FaultTemporaryError                  // Temporary server error
+)
+
+// code returns the [FaultCode] that corresponds to the subcode.
+func (sub FaultSubcode) code() FaultCode {
+	if strings.HasPrefix(sub.String(), "Client") {
+		return FaultCodeSender
+	}
+	return FaultCodeReceiver
+}
+
+// String returns a string representation of the [FaultSubcode]
+func (sub FaultSubcode) String() string {
+	switch sub {
+	case FaultFormatNotSupported:
+		return "ClientErrorFormatNotSupported"
+	case FaultJobIDNotFound:
+		return "ClientErrorJobIdNotFound"
+	case FaultNoImagesAvailable:
+		return "ClientErrorNoImagesAvailable"
+	case FaultNotAcceptingJobs:
+		return "ServerErrorNotAcceptingJobs"
+	case FaultTemporaryError:
+		return "ServerErrorTemporaryError"
+	}
+
+	return "Unknown"
+}
+
+// DecodeFaultSubcode decodes [FaultSubcode] out of its XML string
+// representation (without namespace prefix).
+func DecodeFaultSubcode(s string) FaultSubcode {
+	switch s {
+	case "ClientErrorFormatNotSupported":
+		return FaultFormatNotSupported
+	case "ClientErrorJobIdNotFound":
+		return FaultJobIDNotFound
+	case "ClientErrorNoImagesAvailable":
+		return FaultNoImagesAvailable
+	case "ServerErrorNotAcceptingJobs":
+		return FaultNotAcceptingJobs
+	case "ServerErrorTemporaryError":
+		return FaultTemporaryError
+	}
+
+	return UnknownFaultSubcode
+}
@@ -0,0 +1,204 @@
+// MFP - Multi-Function Printers and scanners toolkit
+// WS-Scan core protocol
+//
+// Copyright (C) 2024 and up by Yogesh Singla (yogeshsingla481@gmail.com)
+// See LICENSE for license terms and conditions
+//
+// Fault tests
+
+package wsscan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/OpenPrinting/go-mfp/util/xmldoc"
+)
+
+// TestFault_Action verifies that Action returns ActFault.
+func TestFault_Action(t *testing.T) {
+	f := NewFault(FaultNoImagesAvailable, "")
+	if f.Action() != ActFault {
+		t.Errorf("expected ActFault, got %v", f.Action())
+	}
+}
+
+// TestFault_Code verifies that NewFault chooses the Code by Subcode.
+func TestFault_Code(t *testing.T) {
+	tests := []struct {
+		subcode FaultSubcode
+		code    FaultCode
+	}{
+		{FaultFormatNotSupported, FaultCodeSender},
+		{FaultJobIDNotFound, FaultCodeSender},
+		{FaultNoImagesAvailable, FaultCodeSender},
+		{FaultNotAcceptingJobs, FaultCodeReceiver},
+		{FaultTemporaryError, FaultCodeReceiver},
+		{UnknownFaultSubcode, FaultCodeReceiver},
+	}
+
+	for _, test := range tests {
+		f := NewFault(test.subcode, "")
+		if f.Code != test.code {
+			t.Errorf("%s: expected %s, got %s",
+				test.subcode, test.code, f.Code)
+		}
+	}
+}
+
+// TestFault_RoundTrip verifies that a Fault encodes to XML and decodes
+// back to an identical value.
+func TestFault_RoundTrip(t *testing.T) {
+	tests := []Fault{
+		*NewFault(FaultNoImagesAvailable, "no more images"),
+		*NewFault(FaultNotAcceptingJobs, "scanner busy"),
+		{Code: FaultCodeSender, Reason: "invalid ticket"},
+	}
+
+	for _, orig := range tests {
+		elm := orig.ToXML()
+		if elm.Name != NsSOAP+":Fault" {
+			t.Errorf("expected element name %q, got %q",
+				NsSOAP+":Fault", elm.Name)
+		}
+
+		parsed, err := decodeFault(elm)
+		if err != nil {
+			t.Fatalf("decodeFault returned error: %v", err)
+		}
+		if !reflect.DeepEqual(orig, parsed) {
+			t.Errorf("expected %+v, got %+v", orig, parsed)
+		}
+	}
+}
+
+// TestFault_Message verifies that the Fault survives the full
+// SOAP message encoding/decoding, including the wire Action.
+func TestFault_Message(t *testing.T) {
+	orig := Message{
+		Header: Header{
+			Action:    ActFault,
+			MessageID: "urn:uuid:00000000-0000-0000-0000-000000000001",
+		},
+		Body: NewFault(FaultJobIDNotFound, "job not found"),
+	}
+
+	root, err := xmldoc.Decode(NsMap, bytes.NewReader(orig.Encode()))
+	if err != nil {
+		t.Fatalf("xmldoc.Decode returned error: %v", err)
+	}
+
+	msg, err := DecodeMessage(root)
+	if err != nil {
+		t.Fatalf("DecodeMessage returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(orig, msg) {
+		t.Errorf("expected %+v, got %+v", orig, msg)
+	}
+}
+
+// TestFault_Decode verifies decoding of Fault with the foreign
+// namespace prefixes and multiple Reason texts.
+func TestFault_Decode(t *testing.T) {
+	elm := xmldoc.Element{
+		Name: NsSOAP + ":Fault",
+		Children: []xmldoc.Element{
+			{
+				Name: NsSOAP + ":Code",
+				Children: []xmldoc.Element{
+					{Name: NsSOAP + ":Value", Text: "s:Receiver"},
+					{
+						Name: NsSOAP + ":Subcode",
+						Children: []xmldoc.Element{{
+							Name: NsSOAP + ":Value",
+							Text: "sc:ServerErrorNotAcceptingJobs",
+						}},
+					},
+				},
+			},
+			{
+				Name: NsSOAP + ":Reason",
+				Children: []xmldoc.Element{
+					{
+						Name:  NsSOAP + ":Text",
+						Text:  "Scanner ist beschäftigt",
+						Attrs: []xmldoc.Attr{{Name: "xml:lang", Value: "de"}},
+					},
+					{
+						Name:  NsSOAP + ":Text",
+						Text:  "Scanner is busy",
+						Attrs: []xmldoc.Attr{{Name: "xml:lang", Value: "en"}},
+					},
+				},
+			},
+		},
+	}
+
+	expected := Fault{
+		Code:    FaultCodeReceiver,
+		Subcode: FaultNotAcceptingJobs,
+		Reason:  "Scanner is busy",
+	}
+
+	parsed, err := decodeFault(elm)
+	if err != nil {
+		t.Fatalf("decodeFault returned error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, parsed) {
+		t.Errorf("expected %+v, got %+v", expected, parsed)
+	}
+}
+
+// TestFault_DecodeErrors verifies that decoding an invalid Fault
+// returns an error.
+func TestFault_DecodeErrors(t *testing.T) {
+	tests := []xmldoc.Element{
+		{Name: NsSOAP + ":Fault"},
+		{
+			Name: NsSOAP + ":Fault",
+			Children: []xmldoc.Element{
+				{Name: NsSOAP + ":Code"},
+			},
+		},
+		{
+			Name: NsSOAP + ":Fault",
+			Children: []xmldoc.Element{{
+				Name: NsSOAP + ":Code",
+				Children: []xmldoc.Element{
+					{Name: NsSOAP + ":Value", Text: "soap:Nobody"},
+				},
+			}},
+		},
+	}
+
+	for _, elm := range tests {
+		_, err := decodeFault(elm)
+		if err == nil {
+			t.Errorf("expected error for %s, got nil",
+				elm.EncodeString(NsMap))
+		}
+	}
+}
+
+// TestFault_Is verifies that errors.Is matches Fault by Subcode.
+func TestFault_Is(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w",
+		NewFault(FaultNoImagesAvailable, "no more images"))
+
+	if !errors.Is(err, &Fault{Subcode: FaultNoImagesAvailable}) {
+		t.Errorf("errors.Is: expected match")
+	}
+
+	if errors.Is(err, &Fault{Subcode: FaultJobIDNotFound}) {
+		t.Errorf("errors.Is: unexpected match")
+	}
+
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Reason != "no more images" {
+		t.Errorf("errors.As: Fault expected")
+	}
+}
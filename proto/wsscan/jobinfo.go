@@ -19,6 +19,7 @@ type jobInfo struct {
 	jobID          int
 	jobToken       string
 	state          JobState
+	reasons        []JobStateReason
 	scanTicket     ScanTicket
 	scansCompleted int
 	createdTime    time.Time
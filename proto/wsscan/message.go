@@ -116,6 +116,9 @@ func decodeMessageXML(root xmldoc.Element) (msg Message, err error) {
 	case ActGetJobHistoryResponse:
 		v, e := decodeGetJobHistoryResponse(child)
 		msg.Body, err = &v, e
+	case ActFault:
+		v, e := decodeFault(child)
+		msg.Body, err = &v, e
 	default:
 		err = fmt.Errorf("unhandled action: %s", msg.Header.Action)
 	}